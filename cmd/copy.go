@@ -69,6 +69,15 @@ type rawCopyCmdArgs struct {
 	excludeContainer      string
 	includeBefore         string
 	includeAfter          string
+	includeSizeMin        string
+	includeSizeMax        string
+	filter                string
+	ignoreFile            string
+	rename                []string
+	renameFile            string
+	maxDepth              int
+	flatten               bool
+	flattenCollision      string
 	legacyInclude         string // used only for warnings
 	legacyExclude         string // used only for warnings
 	listOfVersionIDs      string
@@ -78,6 +87,7 @@ type rawCopyCmdArgs struct {
 
 	// filters from flags
 	listOfFilesToCopy string
+	listOfURLs        string
 	recursive         bool
 	followSymlinks    bool
 	autoDecompress    bool
@@ -147,8 +157,10 @@ type rawCopyCmdArgs struct {
 	internalOverrideStripTopDir bool
 
 	// HTTP-specific authentication
-	bearerToken string // OAuth 2.0 Bearer token for HTTP downloads
-	httpHeaders string // Custom HTTP headers in format "header1=value1;header2=value2"
+	bearerToken  string // OAuth 2.0 Bearer token for HTTP downloads
+	httpHeaders  string // Custom HTTP headers in format "header1=value1;header2=value2"
+	checksumFile string // checksum file to validate HTTP downloads against, e.g. ".sha256" or "SHA256SUMS"
+	mirrors      string // other URLs serving the same HTTP source, separated by ';'
 
 	// whether to include blobs that have metadata 'hdi_isfolder = true'
 	includeDirectoryStubs bool
@@ -211,6 +223,10 @@ func (raw *rawCopyCmdArgs) toOptions() (cooked CookedCopyCmdArgs, err error) {
 		BlockSizeMB:              raw.blockSizeMB,
 		PutBlobSizeMB:            raw.putBlobSizeMB,
 		ListOfFiles:              raw.listOfFilesToCopy,
+		ListOfURLs:               raw.listOfURLs,
+		bearerToken:              raw.bearerToken,
+		checksumFile:             raw.checksumFile,
+		mirrors:                  parsePatterns(raw.mirrors),
 		ListOfVersionIDs:         raw.listOfVersionIDs,
 		metadata:                 raw.metadata,
 		contentType:              raw.contentType,
@@ -266,17 +282,29 @@ func (raw *rawCopyCmdArgs) toOptions() (cooked CookedCopyCmdArgs, err error) {
 
 	// Source
 	tempSrc := raw.src
-	// Check if source has a trailing wildcard on a URL
-	if cooked.FromTo.From().IsRemote() {
+	if raw.listOfURLs != "" {
+		if raw.src != "" {
+			return cooked, errors.New("a source cannot be specified alongside --list-of-urls; every source comes from the list")
+		}
+		if cooked.FromTo.From() != common.ELocation.Http() {
+			return cooked, errors.New("--list-of-urls is only supported with HTTP sources")
+		}
+
+		// there's no common source root, so every transfer's source is the absolute URL from the list,
+		// and its destination is the target path from the list without any top directory
+		cooked.StripTopDir = true
+	} else if cooked.FromTo.From().IsRemote() { // Check if source has a trailing wildcard on a URL
 		tempSrc, cooked.StripTopDir, err = stripTrailingWildcardOnRemoteSource(raw.src, cooked.FromTo.From())
 
 		if err != nil {
 			return cooked, err
 		}
 	}
-	cooked.Source, err = SplitResourceString(tempSrc, cooked.FromTo.From())
-	if err != nil {
-		return cooked, err
+	if raw.listOfURLs == "" {
+		cooked.Source, err = SplitResourceString(tempSrc, cooked.FromTo.From())
+		if err != nil {
+			return cooked, err
+		}
 	}
 
 	if raw.internalOverrideStripTopDir {
@@ -346,6 +374,42 @@ func (raw *rawCopyCmdArgs) toOptions() (cooked CookedCopyCmdArgs, err error) {
 		cooked.IncludeAfter = &parsedIncludeAfter
 	}
 
+	cooked.IncludeSizeMin, cooked.IncludeSizeMax, err = parseSizeFilterRange(raw.includeSizeMin, raw.includeSizeMax)
+	if err != nil {
+		return cooked, err
+	}
+
+	cooked.filterExpression, err = parseFilterExpression(raw.filter)
+	if err != nil {
+		return cooked, err
+	}
+
+	if raw.ignoreFile != "" && cooked.FromTo.From() != common.ELocation.Local() {
+		return cooked, errors.New("--ignore-file only applies to uploads from the local file system")
+	}
+	cooked.ignoreFile = raw.ignoreFile
+
+	cooked.rename, err = newRenameRules(raw.rename, raw.renameFile)
+	if err != nil {
+		return cooked, err
+	}
+
+	if raw.maxDepth < 0 {
+		return cooked, errors.New("--max-depth must be a number of levels, or 0 for no limit")
+	}
+	if raw.maxDepth > 0 && !raw.recursive {
+		return cooked, errors.New("--max-depth only applies with --recursive")
+	}
+	cooked.maxDepth = raw.maxDepth
+
+	if raw.flatten {
+		var collision common.FlattenCollision
+		if err = collision.Parse(raw.flattenCollision); err != nil {
+			return cooked, fmt.Errorf("invalid --flatten-collision '%s': %w", raw.flattenCollision, err)
+		}
+		cooked.flatten = newFlattener(collision)
+	}
+
 	err = cooked.trailingDot.Parse(raw.trailingDot)
 	if err != nil {
 		return cooked, err
@@ -625,15 +689,33 @@ type CookedCopyCmdArgs struct {
 	ExcludeFileAttributes []string
 	IncludeBefore         *time.Time
 	IncludeAfter          *time.Time
+	IncludeSizeMin        *int64
+	IncludeSizeMax        *int64
 
 	// include/exclude filters with regular expression (also for sync)
 	includeRegex []string
 	excludeRegex []string
 
+	// filterExpression is the compiled --filter, or nil
+	filterExpression *expressionFilter
+
+	// ignoreFile holds rules in .gitignore syntax that apply to the whole upload, under those of any .azcopyignore files
+	ignoreFile string
+
+	// rename gives objects different paths at the destination than at the source, or is nil
+	rename *renameRules
+
+	// maxDepth is how many levels below the source a recursive copy goes, or 0 for no limit
+	maxDepth int
+
+	// flatten puts every file directly under the destination, or is nil
+	flatten *flattener
+
 	// list of version ids
 	ListOfVersionIDsChannel chan string
 	// filters from flags
 	ListOfFilesChannel chan string // Channels are nullable.
+	ListOfURLsChannel  chan string // Channels are nullable.
 	Recursive          bool
 	StripTopDir        bool
 	SymlinkHandling    common.SymlinkHandlingType
@@ -759,7 +841,11 @@ type CookedCopyCmdArgs struct {
 	PutBlobSizeMB                 float64
 	IncludePathPatterns           []string
 	ListOfFiles                   string
+	ListOfURLs                    string
 	ListOfVersionIDs              string
+	bearerToken                   string
+	checksumFile                  string
+	mirrors                       []string
 	blobTagsMap                   common.BlobTags
 	cpkByName                     string
 	cpkByValue                    bool
@@ -974,6 +1060,14 @@ func (cca *CookedCopyCmdArgs) getSrcCredential(ctx context.Context, jpo *common.
 		return common.CredentialInfo{CredentialType: common.ECredentialType.S3AccessKey()}, nil
 	case common.ELocation.GCP():
 		return common.CredentialInfo{CredentialType: common.ECredentialType.GoogleAppCredentials()}, nil
+	case common.ELocation.Http(), common.ELocation.WebDAV():
+		// HTTP and WebDAV sources are read by the service as-is on S2S, so there's nothing to forward.
+		if cca.FromTo.IsS2S() {
+			if err := checkNoHTTPSourceCredentialForS2S(cca.Source.Value); err != nil {
+				return common.CredentialInfo{}, err
+			}
+		}
+		return common.CredentialInfo{CredentialType: common.ECredentialType.Anonymous()}, nil
 	case common.ELocation.Pipe():
 		panic("Invalid Source")
 	}
@@ -1011,6 +1105,32 @@ func (cca *CookedCopyCmdArgs) getSrcCredential(ctx context.Context, jpo *common.
 	return srcCredInfo, nil
 }
 
+// checkNoHTTPSourceCredentialForS2S fails if HTTP requests to source are configured to carry a bearer token,
+// a user name and password, or TLS settings such as a client certificate.
+// On S2S the service fetches the source itself, and none of them reach it, so the copy would fail on the service side.
+func checkNoHTTPSourceCredentialForS2S(source string) error {
+	tokenSource, err := common.GetHTTPTokenSource()
+	if err != nil {
+		return err
+	}
+	// a user name is only given to the server of a single source URL, but a list of URLs would still need it
+	passwordSource, err := common.GetHTTPPasswordSource(source)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := common.GetHTTPTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	if tokenSource != nil || passwordSource != nil || tlsConfig != nil ||
+		common.GetEnvironmentVariable(common.EEnvironmentVariable.HTTPUsername()) != "" {
+		return errors.New("service to service copies can't authenticate to HTTP and WebDAV sources, since the service reads the source itself; " +
+			"remove the bearer token, user name, .netrc file and TLS settings, or download the source to the local disk and upload it from there")
+	}
+	return nil
+}
+
 // handles the copy command
 // dispatches the job order (in parts) to the storage engine
 func (cca *CookedCopyCmdArgs) processCopyJobPartOrders() (err error) {
@@ -1085,6 +1205,7 @@ func (cca *CookedCopyCmdArgs) processCopyJobPartOrders() (err error) {
 			PreserveLastModifiedTime: cca.preserveLastModifiedTime,
 			PutMd5:                   cca.putMd5,
 			MD5ValidationOption:      cca.md5ValidationOption,
+			HTTPChecksumFile:         cca.checksumFile,
 			DeleteSnapshotsOption:    cca.deleteSnapshotsOption,
 			// Setting tags when tags explicitly provided by the user through blob-tags flag
 			BlobTagsString:                   cca.blobTagsMap.ToString(),
@@ -1570,7 +1691,23 @@ func init() {
 		Long:       copyCmdLongDescription,
 		Example:    copyCmdExample,
 		Args: func(cmd *cobra.Command, args []string) error {
-			if len(args) == 1 { // redirection
+			if len(args) == 1 && raw.listOfURLs != "" { // every source comes from the list of URLs
+				raw.dst = args[0]
+
+				// the sources can only be HTTP, so only the destination needs inferring
+				if raw.fromTo == "" {
+					dstLocation := InferArgumentLocation(raw.dst)
+					if dstLocation == common.ELocation.Unknown() {
+						return errors.New("the destination type could not be inferred; please specify --from-to")
+					}
+					raw.fromTo = common.FromToValue(common.ELocation.Http(), dstLocation).String()
+				}
+
+				glcm.EnableInputWatcher()
+				if cancelFromStdin {
+					glcm.EnableCancelFromStdIn()
+				}
+			} else if len(args) == 1 { // redirection
 				// Enforce the usage of from-to flag when pipes are involved
 				if raw.fromTo == "" {
 					return fmt.Errorf("fatal: from-to argument required, PipeBlob (upload) or BlobPipe (download) is acceptable")
@@ -1659,6 +1796,53 @@ func init() {
 			"timezone.\n As of AzCopy 10.5, this flag applies only to files, not folders, so folder properties "+
 			"won't be copied when using this flag with --preserve-info or --preserve-permissions.")
 
+	cpCmd.PersistentFlags().StringVar(&raw.includeSizeMin, "include-size-min", "",
+		"Include only those files whose size is at least the given value. \n "+
+			"The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). "+
+			"\n E.g. 500, 64K or 2GiB. This flag applies only to files, not folders.")
+
+	cpCmd.PersistentFlags().StringVar(&raw.includeSizeMax, "include-size-max", "",
+		"Include only those files whose size is at most the given value. \n "+
+			"The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). "+
+			"\n E.g. 500, 64K or 2GiB. This flag applies only to files, not folders.")
+
+	cpCmd.PersistentFlags().StringVar(&raw.filter, "filter", "",
+		"Include only those files for which the given expression is true. \n "+
+			"The expression compares fields with values, and combines comparisons with and, or, not and parentheses. "+
+			"\n The fields are "+knownFilterExpressionFields()+". "+
+			"\n E.g. \"tags.env == prod and age > 90d and not tier in (Archive, Cold)\". This flag applies only to files, not folders.")
+
+	cpCmd.PersistentFlags().StringVar(&raw.ignoreFile, "ignore-file", "",
+		"Exclude the paths matched by the rules in the given file, which uses the syntax of .gitignore, when uploading. \n "+
+			"The rules of any "+azcopyIgnoreFileName+" files in the source directories are applied too, and take precedence, "+
+			"\n just as the rules of .gitignore files take precedence over git's core.excludesFile.")
+
+	cpCmd.PersistentFlags().StringArrayVar(&raw.rename, "rename", nil,
+		"Change the path of each object at the destination with a rule written like a sed substitution. \n "+
+			"E.g. 's#^logs/(\\d{4})-(\\d{2})/#logs/year=$1/month=$2/#' moves logs/2024-05/app.log to logs/year=2024/month=05/app.log. "+
+			"\n The replacement can use {lmt:yyyy/MM/dd} for the last modified time, and {lower:...} or {upper:...} to change case. "+
+			"\n Give the flag more than once for several rules, which apply in order. The job fails if two files would have the same destination.")
+
+	cpCmd.PersistentFlags().StringVar(&raw.renameFile, "rename-file", "",
+		"Read rename rules from the given file, one to a line, and apply them after those given with --rename. "+
+			"\n Blank lines and lines starting with # are skipped.")
+
+	cpCmd.PersistentFlags().IntVar(&raw.maxDepth, "max-depth", 0,
+		"Go no further than this many levels below the source when copying recursively. "+
+			"\n 1 copies only what is directly in the source directory, 2 adds what is in its subdirectories, and so on. "+
+			"\n Defaults to 0, for no limit. Where the source allows, the deeper levels aren't listed at all.")
+
+	cpCmd.PersistentFlags().BoolVar(&raw.flatten, "flatten", false,
+		"False by default. Copy every file directly into the destination directory, by its name alone, dropping the directories it was in. "+
+			"\n Folders themselves aren't copied. See --flatten-collision for files that end up with the same name.")
+
+	cpCmd.PersistentFlags().StringVar(&raw.flattenCollision, "flatten-collision", common.EFlattenCollision.Fail().String(),
+		"What --flatten does with a file whose name another file has already been given. "+
+			"\n Fail (default) stops the job, Skip leaves the file out, "+
+			"and Suffix gives it the first free name with -1, -2 and so on before its extension. "+
+			"\n Which of the files keeps the name is whichever is listed first, which can change from one run to the next, "+
+			"\n since the source is listed in parallel; the suffixes aren't a stable way to tell the files apart.")
+
 	cpCmd.PersistentFlags().StringVar(&raw.include, "include-pattern", "",
 		"Include only these files when copying. "+
 			"\n This option supports wildcard characters (*). Separate files by using a ';' "+
@@ -1689,6 +1873,13 @@ func init() {
 			"\n The text file should contain paths from root for each file name or directory"+
 			"written on a separate line.")
 
+	cpCmd.PersistentFlags().StringVar(&raw.listOfURLs, "list-of-urls", "",
+		"Defines the location of a text file which has the list of HTTP(S) URLs to be downloaded in a single job. "+
+			"\n Each line holds an absolute URL, optionally followed by the URLs of mirrors serving the same file (downloads to the local disk only), "+
+			"and then by the path relative to the destination to save it under (by default, the file name from the URL), all separated by whitespace. "+
+			"Blank lines and lines starting with # are ignored. "+
+			"\n When this flag is used, only the destination argument is given (For example: azcopy copy --list-of-urls urls.txt /path/to/dir).")
+
 	cpCmd.PersistentFlags().StringVar(&raw.exclude, "exclude-pattern", "",
 		"Exclude these files when copying. This option supports wildcard characters (*). "+
 			"\n Separate files by using a ';' (For example: *.jpg;*.pdf;exactName).")
@@ -1893,8 +2084,26 @@ func init() {
 	cpCmd.PersistentFlags().StringVar(&raw.bearerToken, "bearer-token", "",
 		"OAuth 2.0 Bearer token for HTTP source authentication. "+
 			"\n Use this flag when downloading from HTTP/HTTPS endpoints that require OAuth authentication. "+
+			"\n The token is not refreshed, and is not available when the job is resumed. For tokens that expire, "+
+			"\n configure a token source with the AZCOPY_HTTP_TOKEN_URL, AZCOPY_HTTP_TOKEN_FILE or AZCOPY_HTTP_TOKEN_COMMAND environment variables instead. "+
+			"\n Servers asking for Basic or Digest authentication are answered with AZCOPY_HTTP_USERNAME and AZCOPY_HTTP_PASSWORD, or a netrc file named by AZCOPY_HTTP_NETRC, "+
+			"\n and AZCOPY_HTTP_CLIENT_CERTIFICATE, AZCOPY_HTTP_CLIENT_KEY and AZCOPY_HTTP_CA_BUNDLE configure mutual TLS. "+
 			"\n Example: --bearer-token='eyJ0eXAiOiJKV1QiLCJh...'")
 
+	cpCmd.PersistentFlags().StringVar(&raw.checksumFile, "checksum-file", "",
+		"Checksum file to validate HTTP downloads against, in addition to any Repr-Digest, Content-Digest, Digest or Content-MD5 response header. "+
+			"\n A value starting with a dot is appended to the URL of each file (e.g. '.sha256' for tool.tar.gz.sha256). "+
+			"\n Anything else is resolved relative to the URL of each file, so 'SHA256SUMS' names a list in the same directory. "+
+			"\n Files holding a lone hash and lists in the sha256sum/sha512sum/md5sum formats are understood. "+
+			"\n The --check-md5 flag controls what happens when a file's hash is missing or different.")
+
+	cpCmd.PersistentFlags().StringVar(&raw.mirrors, "mirrors", "",
+		"Other URLs serving the same content as the HTTP source, to download from at the same time. Separate URLs by using a ';'. "+
+			"\n The chunks of each file are spread across the source and its mirrors, and a mirror that keeps failing, or is much slower than the others, is dropped. "+
+			"\n When the source is a directory listing, each mirror is the root of an identical tree. "+
+			"\n Mirrors must support range requests and report the same size as the source. They must also advertise the same digest, if any, "+
+			"\n or, when neither the headers nor a checksum file give a digest to validate the download against, the same ETag. Mirrors that don't are left out.")
+
 	cpCmd.PersistentFlags().StringVar(&raw.httpHeaders, "http-headers", "",
 		"Custom HTTP headers for HTTP source requests. "+
 			"\n Specify headers in the format 'Header1=Value1;Header2=Value2'. "+
@@ -65,7 +65,7 @@ func (cca *CookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 	getRemoteProperties := cca.ForceWrite == common.EOverwriteOption.IfSourceNewer() ||
 		(cca.FromTo.From().IsFile() && !cca.FromTo.To().IsRemote()) || // If it's a download, we still need LMT and MD5 from files.
 		(cca.FromTo.From().IsFile() &&
-			cca.FromTo.To().IsRemote() && (cca.s2sSourceChangeValidation || cca.IncludeAfter != nil || cca.IncludeBefore != nil)) || // If S2S from File to *, and sourceChangeValidation is enabled, we get properties so that we have LMTs. Likewise, if we are using includeAfter or includeBefore, which require LMTs.
+			cca.FromTo.To().IsRemote() && (cca.s2sSourceChangeValidation || cca.IncludeAfter != nil || cca.IncludeBefore != nil || cca.filterExpression != nil || cca.rename.usesLastModifiedTime())) || // If S2S from File to *, and sourceChangeValidation is enabled, we get properties so that we have LMTs. Likewise, if we are using includeAfter, includeBefore, a filter expression or rename rules, which may require LMTs.
 		(cca.FromTo.From().IsRemote() && cca.FromTo.To().IsRemote() && cca.s2sPreserveProperties.Value() && !cca.s2sGetPropertiesInBackend) // If S2S and preserve properties AND get properties in backend is on, turn this off, as properties will be obtained in the backend.
 	jobPartOrder.S2SGetPropertiesInBackend = cca.s2sPreserveProperties.Value() && !getRemoteProperties && cca.s2sGetPropertiesInBackend // Infer GetProperties if GetPropertiesInBackend is enabled.
 	jobPartOrder.S2SSourceChangeValidation = cca.s2sSourceChangeValidation
@@ -73,6 +73,14 @@ func (cca *CookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 	jobPartOrder.S2SInvalidMetadataHandleOption = cca.s2sInvalidMetadataHandleOption
 	jobPartOrder.S2SPreserveBlobTags = cca.S2sPreserveBlobTags
 
+	// uploads leave out what .azcopyignore files exclude, as git leaves out what .gitignore files do
+	var ignore *azcopyIgnore
+	if cca.FromTo.From() == common.ELocation.Local() {
+		if ignore, err = newUploadIgnore(cca.Source.ValueLocal(), cca.ignoreFile); err != nil {
+			return nil, err
+		}
+	}
+
 	dest := cca.FromTo.To()
 	traverser, err = InitResourceTraverser(cca.Source, cca.FromTo.From(), ctx, InitResourceTraverserOptions{
 		DestResourceType: &dest,
@@ -80,6 +88,8 @@ func (cca *CookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 		Credential: &srcCredInfo,
 
 		ListOfFiles:      cca.ListOfFilesChannel,
+		ListOfURLs:       cca.ListOfURLsChannel,
+		HTTPMirrors:      cca.mirrors,
 		ListOfVersionIDs: cca.ListOfVersionIDsChannel,
 
 		CpkOptions: cca.CpkOptions,
@@ -93,10 +103,12 @@ func (cca *CookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 		Recursive:               cca.Recursive,
 		GetPropertiesInFrontend: getRemoteProperties,
 		IncludeDirectoryStubs:   cca.IncludeDirectoryStubs,
-		PreserveBlobTags:        cca.S2sPreserveBlobTags,
+		PreserveBlobTags:        cca.S2sPreserveBlobTags || cca.filterExpression.needsBlobTags(), // tags that aren't preserved are replaced when scheduling
 		StripTopDir:             cca.StripTopDir,
 
 		ExcludeContainers: cca.excludeContainer,
+		Ignore:            ignore,
+		MaxDepth:          cca.maxDepth,
 		IncrementEnumeration: func(entityType common.EntityType) {
 			if common.IsNFSCopy() {
 				if entityType == common.EEntityType.Other() {
@@ -276,11 +288,25 @@ func (cca *CookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 	// decide our folder transfer strategy
 	var message string
 	jobPartOrder.Fpo, message = NewFolderPropertyOption(cca.FromTo, cca.Recursive, cca.StripTopDir, filters, cca.preserveInfo, cca.preservePermissions.IsTruthy(), cca.preservePOSIXProperties, strings.EqualFold(cca.Destination.Value, common.Dev_Null), cca.IncludeDirectoryStubs)
+	if cca.flatten != nil && jobPartOrder.Fpo != common.EFolderPropertiesOption.NoFolders() {
+		jobPartOrder.Fpo = common.EFolderPropertiesOption.NoFolders()
+		message = "Folders will not be processed, because --flatten copies files without the folders they are in"
+	}
 	if !cca.dryrunMode {
 		glcm.Info(message)
 	}
 	common.LogToJobLogWithPrefix(message, common.LogInfo)
 
+	// the destinations given to renamed files, which are checked for collisions, move to disk past the same number of files as the sync index
+	if cca.rename != nil {
+		spillThreshold, err := syncIndexSpillThreshold()
+		if err != nil {
+			return nil, err
+		}
+		cca.rename.spillAt(spillThreshold, filepath.Join(common.AzcopyJobPlanFolder, cca.jobID.String()+"-renames"))
+		glcm.RegisterCloseFunc(func() { _ = cca.rename.reset() })
+	}
+
 	processor := func(object StoredObject) error {
 		// Start by resolving the name and creating the container
 		if object.ContainerName != "" {
@@ -312,8 +338,20 @@ func (cca *CookedCopyCmdArgs) initEnumerator(jobPartOrder common.CopyJobPartOrde
 			}
 		}
 
+		// the rename rules and flattening only change where the object goes
+		dstObject := object
+		if dstObject.relativePath, err = cca.rename.destinationPath(object); err != nil {
+			return err
+		}
+		var skip bool
+		if dstObject.relativePath, skip, err = cca.flatten.destinationPath(object, dstObject.relativePath); err != nil {
+			return err
+		} else if skip {
+			return nil
+		}
+
 		srcRelPath := cca.MakeEscapedRelativePath(true, isDestDir, cca.asSubdir, object)
-		dstRelPath := cca.MakeEscapedRelativePath(false, isDestDir, cca.asSubdir, object)
+		dstRelPath := cca.MakeEscapedRelativePath(false, isDestDir, cca.asSubdir, dstObject)
 
 		transfer, shouldSendToSte := object.ToNewCopyTransfer(cca.autoDecompress && cca.FromTo.IsDownload(), srcRelPath, dstRelPath, cca.s2sPreserveAccessTier.Value(), jobPartOrder.Fpo, cca.SymlinkHandling, cca.hardlinks)
 		if !cca.S2sPreserveBlobTags {
@@ -419,6 +457,10 @@ func (cca *CookedCopyCmdArgs) InitModularFilters() []ObjectFilter {
 		filters = append(filters, &IncludeAfterDateFilter{Threshold: *cca.IncludeAfter})
 	}
 
+	filters = append(filters, buildSizeFilters(cca.IncludeSizeMin, cca.IncludeSizeMax)...)
+	filters = append(filters, buildExpressionFilters(cca.filterExpression)...)
+	filters = append(filters, buildMaxDepthFilters(cca.maxDepth)...)
+
 	if len(cca.IncludePatterns) != 0 {
 		filters = append(filters, &IncludeFilter{patterns: cca.IncludePatterns}) // TODO should this call buildIncludeFilters?
 	}
@@ -654,6 +696,11 @@ func (cca *CookedCopyCmdArgs) MakeEscapedRelativePath(source bool, dstIsDir bool
 		return "\x00"
 	}
 
+	// objects from a list of URLs have no common source root, the URL is the whole source
+	if source && object.sourceURL != "" {
+		return object.sourceURL
+	}
+
 	// source is a EXACT path to the file
 	if object.isSingleSourceFile() {
 		// If we're finding an object from the source, it returns "" if it's already got it.
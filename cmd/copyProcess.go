@@ -23,6 +23,12 @@ func (cooked *CookedCopyCmdArgs) processArgs() (err error) {
 		common.LogPathFolder = ""
 	}
 
+	// The flag takes precedence over any token source configured in the environment.
+	// Both the traversers and the transfer engine pick it up from there.
+	if cooked.bearerToken != "" {
+		common.SetHTTPTokenSource(common.NewStaticHTTPTokenSource(cooked.bearerToken))
+	}
+
 	cooked.putBlobSize, err = blockSizeInBytes(cooked.PutBlobSizeMB)
 	if err != nil {
 		return err
@@ -105,6 +111,36 @@ func (cooked *CookedCopyCmdArgs) processArgs() (err error) {
 	if cooked.ListOfFiles != "" || len(cooked.IncludePathPatterns) > 0 {
 		cooked.ListOfFilesChannel = listChan
 	}
+
+	// The list of URLs is read the same way, but each line is parsed by the traverser, as it carries the whole source URL.
+	if cooked.ListOfURLs != "" {
+		urlFile, err := os.Open(cooked.ListOfURLs)
+		if err != nil {
+			return fmt.Errorf("cannot open %s file passed with the list-of-urls flag", cooked.ListOfURLs)
+		}
+
+		urlChan := make(chan string)
+		go func() {
+			defer close(urlChan)
+			defer urlFile.Close()
+
+			scanner := bufio.NewScanner(urlFile)
+			checkBOM := false
+			for scanner.Scan() {
+				v := scanner.Text()
+
+				if !checkBOM {
+					v = strings.TrimPrefix(v, utf8BOM)
+					checkBOM = true
+				}
+
+				urlChan <- v
+			}
+		}()
+
+		cooked.ListOfURLsChannel = urlChan
+	}
+
 	versionsChan := make(chan string)
 	var filePtr *os.File
 	// Get file path from user which would contain list of all versionIDs
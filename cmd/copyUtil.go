@@ -69,9 +69,11 @@ func parsePatterns(pattern string) (cookedPatterns []string) {
 func stripTrailingWildcardOnRemoteSource(source string, location common.Location) (result string, stripTopDir bool, err error) {
 	result = source
 
-	// HTTP sources don't support wildcards - single file downloads only
-	// Skip wildcard processing for HTTP sources
-	if location == common.ELocation.Http() {
+	// HTTP and WebDAV sources have no containers, so the only wildcard we honour is a trailing /* on a directory
+	if location == common.ELocation.Http() || location == common.ELocation.WebDAV() {
+		if strings.HasSuffix(result, "/*") {
+			return strings.TrimSuffix(result, "*"), true, nil
+		}
 		return result, false, nil
 	}
 
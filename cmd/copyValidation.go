@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/Azure/azure-storage-azcopy/v10/ste"
 )
 
 // Note: blockSize, blobTagsMap is set here
@@ -49,6 +50,36 @@ func (cooked *CookedCopyCmdArgs) validate() (err error) {
 		return errors.New("cannot combine list of files and include path")
 	}
 
+	if cooked.ListOfURLs != "" && (cooked.ListOfFiles != "" || len(cooked.IncludePathPatterns) > 0) {
+		return errors.New("cannot combine list of URLs with list of files or include path")
+	}
+
+	isHTTPLocation := func(l common.Location) bool { return l == common.ELocation.Http() || l == common.ELocation.WebDAV() }
+	if cooked.bearerToken != "" && !isHTTPLocation(cooked.FromTo.From()) && !isHTTPLocation(cooked.FromTo.To()) {
+		return errors.New("bearer-token is only supported when transferring from or to HTTP and WebDAV locations")
+	}
+
+	if cooked.checksumFile != "" && cooked.FromTo.From() != common.ELocation.Http() {
+		return errors.New("checksum-file is only supported when downloading from HTTP locations")
+	}
+	if len(cooked.checksumFile) > len(ste.JobPartPlanDstLocal{}.HTTPChecksumFile) {
+		return fmt.Errorf("checksum-file must be at most %d characters long", len(ste.JobPartPlanDstLocal{}.HTTPChecksumFile))
+	}
+
+	if len(cooked.mirrors) > 0 {
+		if cooked.FromTo != common.EFromTo.HttpLocal() {
+			return errors.New("mirrors are only supported when downloading from HTTP locations to the local disk")
+		}
+		if cooked.ListOfURLs != "" {
+			return errors.New("mirrors cannot be combined with a list of URLs; list the mirrors of each file on its line instead")
+		}
+		for _, mirror := range cooked.mirrors {
+			if _, err := parseAbsoluteHTTPURL(mirror); err != nil {
+				return fmt.Errorf("invalid mirror %s: %w", common.URLStringExtension(mirror).RedactSecretQueryParamForLogging(), err)
+			}
+		}
+	}
+
 	if cooked.FromTo.To() == common.ELocation.None() && strings.EqualFold(cooked.metadata, common.MetadataAndBlobTagsClearFlag) { // in case of Blob, BlobFS and Files
 		glcm.Warn("*** WARNING *** Metadata will be cleared because of input --metadata=clear ")
 	}
@@ -182,10 +213,34 @@ func (cooked *CookedCopyCmdArgs) validate() (err error) {
 		if cooked.blobType != common.EBlobType.Detect() {
 			return fmt.Errorf("blob-type is not supported on Azure File")
 		}
+	case common.EFromTo.LocalWebDAV():
+		if cooked.preserveLastModifiedTime {
+			return fmt.Errorf("preserve-last-modified-time is not supported while uploading")
+		}
+		if cooked.blockBlobTier != common.EBlockBlobTier.None() ||
+			cooked.pageBlobTier != common.EPageBlobTier.None() {
+			return fmt.Errorf("blob-tier is not supported while uploading to WebDAV")
+		}
+		if cooked.s2sPreserveProperties.ValueToValidate() {
+			return fmt.Errorf("s2s-preserve-properties is not supported while uploading")
+		}
+		if cooked.s2sPreserveAccessTier.ValueToValidate() {
+			return fmt.Errorf("s2s-preserve-access-tier is not supported while uploading")
+		}
+		if cooked.s2sInvalidMetadataHandleOption != common.DefaultInvalidMetadataHandleOption {
+			return fmt.Errorf("s2s-handle-invalid-metadata is not supported while uploading")
+		}
+		if cooked.s2sSourceChangeValidation {
+			return fmt.Errorf("s2s-detect-source-changed is not supported while uploading")
+		}
+		if cooked.blobType != common.EBlobType.Detect() {
+			return fmt.Errorf("blob-type is not supported on WebDAV")
+		}
 	case common.EFromTo.BlobLocal(),
 		common.EFromTo.FileLocal(),
 		common.EFromTo.FileNFSLocal(),
-		common.EFromTo.BlobFSLocal():
+		common.EFromTo.BlobFSLocal(),
+		common.EFromTo.WebDAVLocal():
 		if cooked.SymlinkHandling.Follow() {
 			return fmt.Errorf("follow-symlinks flag is not supported while downloading")
 		}
@@ -217,6 +272,9 @@ func (cooked *CookedCopyCmdArgs) validate() (err error) {
 		common.EFromTo.FileBlob(),
 		common.EFromTo.FileFile(),
 		common.EFromTo.GCPBlob(),
+		common.EFromTo.HttpBlob(),
+		common.EFromTo.WebDAVBlob(),
+		common.EFromTo.WebDAVFile(),
 		common.EFromTo.FileNFSFileNFS():
 
 		if cooked.preserveLastModifiedTime {
@@ -427,6 +427,9 @@ func doGetCredentialTypeForLocation(ctx context.Context, location common.Locatio
 	switch location {
 	case common.ELocation.Local(), common.ELocation.Benchmark(), common.ELocation.None(), common.ELocation.Pipe():
 		return common.ECredentialType.Anonymous(), false, nil
+	case common.ELocation.WebDAV():
+		// Azure credentials must never be sent to a WebDAV server
+		return common.ECredentialType.Anonymous(), false, nil
 	}
 
 	defer func() {
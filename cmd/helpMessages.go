@@ -267,6 +267,34 @@ Copy a subset of files modified on or before the given date/time (in ISO8601 for
 
   - azcopy cp "https://[srcaccount].blob.core.windows.net/[containername]?[SAS]" 
 	"https://[dstaccount].blob.core.windows.net/[containername]?[SAS]" --include-before='2020-08-19T15:04:00Z'"
+
+Copy the files that match a filter expression. An expression compares fields such as name, path, size, lmt, age,
+tier, metadata.<key> or tags.<key> with values, using ==, !=, <, <=, >, >=, like (a glob pattern), matches (a regular
+expression) or in (a list of values), and combines comparisons with and, or, not and parentheses. exists(metadata.<key>)
+checks that a key is set. Values containing spaces or any of ()=!<>,&| must be quoted.
+
+  - azcopy cp "https://[srcaccount].blob.core.windows.net/[containername]?[SAS]" 
+	"https://[dstaccount].blob.core.windows.net/[containername]?[SAS]" --recursive 
+	--filter="tags.env == prod and age > 90d and not (tier == Archive or name like '*.tmp')"
+
+Upload a directory leaving out what the .azcopyignore files in it exclude. They use the syntax of .gitignore, and apply 
+to the directory they're in and below. Rules that apply to every upload can be kept in a file given with --ignore-file.
+
+  - azcopy cp "/path/to/repo" "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" --recursive 
+	--ignore-file="$HOME/.config/azcopy/ignore"
+
+Upload logs into a folder per service and day, e.g. Billing/app.log to billing/dt=2024-05-07/app.log. Each --rename rule is a sed-style substitution on the path relative to the source, 
+and the replacement can use {lmt:yyyy/MM/dd} for the last modified time and {lower:...} for lower case. 
+The job fails if two files would be renamed to the same destination.
+
+  - azcopy cp "/var/log/app" "https://[account].blob.core.windows.net/[container]?[SAS]" --recursive 
+	--rename='s#^([^/]+)/#{lower:$1}/dt={lmt:yyyy-MM-dd}/#'
+
+Copy the files in the top two levels of a directory into a single folder, adding -1, -2 and so on to the names 
+of files that would otherwise overwrite each other.
+
+  - azcopy cp "https://[account].blob.core.windows.net/[container]/[path/to/directory]?[SAS]" "/path/to/dir" --recursive 
+	--max-depth=2 --flatten --flatten-collision=Suffix
 `
 
 // ===================================== ENV COMMAND ===================================== //
@@ -483,6 +511,9 @@ The supported directions and forms of authorization are:
   - Azure Data Lake Storage <-> Azure Data Lake Storage (Microsoft Entra ID or SAS)
   - Azure File <-> Azure File (Source must include a SAS or is publicly accessible; SAS authorization should be used for destination)
   - Azure Blob <-> Azure File
+  - HTTP/HTTPS -> Local / Azure Blob (Files are compared by size, then by the ETag recorded at the destination by the previous sync, or else by Last-Modified time)
+  - Amazon S3 -> Azure Blob (Access key and secret key set in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY; objects are compared as for HTTP/HTTPS)
+  - Google Cloud Storage -> Azure Blob (Service account key set in GOOGLE_APPLICATION_CREDENTIALS; objects are compared as for HTTP/HTTPS)
 
 The sync command differs from the copy command in several ways:
 
@@ -537,6 +568,10 @@ Sync an entire directory but exclude certain files from the scope (For example:
    - azcopy sync "/path/to/dir" 
      "https://[account].blob.core.windows.net/[container]/[path/to/virtual/dir]" --exclude-pattern="foo*;*bar"
 
+Sync a directory, then keep running and upload the files created or modified in it, and delete those removed from it, as they change:
+
+   - azcopy sync "/path/to/dir" "https://[account].blob.core.windows.net/[container]/[path/to/virtual/dir]" --watch
+
 Sync a single blob:
 
    - azcopy sync "https://[account].blob.core.windows.net/[container]/[path/to/blob]?[SAS]" 
@@ -26,11 +26,15 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/Azure/azure-storage-azcopy/v10/jobsAdmin"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -239,7 +243,7 @@ func TestHTTPServer_NoRangeSupport(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
-// TestHTTPFromTo_Validation verifies HTTP to Local is valid
+// TestHTTPFromTo_Validation verifies HTTP to Local and HTTP to Blob are valid
 func TestHTTPFromTo_Validation(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -259,6 +263,12 @@ func TestHTTPFromTo_Validation(t *testing.T) {
 			dst:      "./downloads/",
 			expected: common.EFromTo.HttpLocal(),
 		},
+		{
+			name:     "HTTPToBlob",
+			src:      "https://api.example.com/file.bin",
+			dst:      "https://account.blob.core.windows.net/container/file.bin",
+			expected: common.EFromTo.HttpBlob(),
+		},
 	}
 
 	for _, tc := range testCases {
@@ -283,4 +293,63 @@ func TestHTTPAuthentication_BearerTokenFormat(t *testing.T) {
 	resp, err := http.DefaultClient.Do(req)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, resp.StatusCode, "Should accept Bearer token")
-}
\ No newline at end of file
+}
+
+// TestSyncFromHTTP verifies that a file served over HTTP is only synced when it differs from the local copy,
+// and that its ETag is passed on to be recorded at the destination
+func TestSyncFromHTTP(t *testing.T) {
+	a := assert.New(t)
+
+	content := "release notes"
+	lastModified := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	dstDirName := scenarioHelper{}.generateLocalDirectory(a)
+	defer os.RemoveAll(dstDirName)
+	dstFileName := filepath.Join(dstDirName, "notes.txt")
+
+	// set up interceptor
+	mockedRPC := interceptor{}
+	jobsAdmin.ExecuteNewCopyJobPartOrder = func(order common.CopyJobPartOrderRequest) common.CopyJobPartOrderResponse {
+		return mockedRPC.intercept(order)
+	}
+	mockedRPC.init()
+
+	// the credential lookup for the source consults the login cache
+	if common.AzcopyJobPlanFolder == "" {
+		common.AzcopyJobPlanFolder = os.TempDir()
+	}
+
+	raw := getDefaultSyncRawInput(server.URL+"/notes.txt", dstFileName)
+	raw.fromTo = common.EFromTo.HttpLocal().String()
+	raw.localHashStorageMode = common.EHashStorageMode.HiddenFiles().String()
+
+	// the local copy is the same size and newer, so it's up to date
+	a.NoError(os.WriteFile(dstFileName, []byte(content), 0644))
+	runSyncAndVerify(a, raw, func(err error) {
+		a.NoError(err)
+		a.Zero(len(mockedRPC.transfers))
+	})
+
+	// a local copy of a different size is out of date, however recent
+	a.NoError(os.WriteFile(dstFileName, []byte("stale"), 0644))
+	mockedRPC.reset()
+	runSyncAndVerify(a, raw, func(err error) {
+		a.NoError(err)
+		a.Len(mockedRPC.transfers, 1)
+		if len(mockedRPC.transfers) == 1 {
+			eTag, ok := common.TryReadMetadata(mockedRPC.transfers[0].Metadata, common.SyncSourceETagMetadataKey)
+			a.True(ok)
+			a.Equal(`"v1"`, *eTag)
+		}
+	})
+}
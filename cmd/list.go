@@ -50,6 +50,9 @@ type rawListCmdArgs struct {
 	RunningTally    bool
 	MegaUnits       bool
 	trailingDot     string
+	includeSizeMin  string
+	includeSizeMax  string
+	filter          string
 }
 
 type validProperty string
@@ -147,6 +150,16 @@ func (raw rawListCmdArgs) cook() (cookedListCmdArgs, error) {
 	}
 	cooked.properties = raw.parseProperties()
 
+	cooked.includeSizeMin, cooked.includeSizeMax, err = parseSizeFilterRange(raw.includeSizeMin, raw.includeSizeMax)
+	if err != nil {
+		return cooked, err
+	}
+
+	cooked.filter, err = parseFilterExpression(raw.filter)
+	if err != nil {
+		return cooked, err
+	}
+
 	return cooked, nil
 }
 
@@ -159,6 +172,9 @@ type cookedListCmdArgs struct {
 	RunningTally    bool
 	MegaUnits       bool
 	trailingDot     common.TrailingDotOption
+	includeSizeMin  *int64
+	includeSizeMax  *int64
+	filter          *expressionFilter
 }
 
 var raw rawListCmdArgs
@@ -207,6 +223,13 @@ func init() {
 	listContainerCmd.PersistentFlags().StringVar(&raw.Properties, "properties", "", "Properties to be displayed in list output. "+
 		"\n Possible properties include: "+strings.Join(validPropertiesString(), ", ")+". "+
 		"\n Delimiter (;) should be used to separate multiple values of properties (i.e. 'LastModifiedTime;VersionId;BlobType').")
+	listContainerCmd.PersistentFlags().StringVar(&raw.includeSizeMin, "include-size-min", "", "List only those files whose size is at least the given value. "+
+		"\n The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). E.g. 500, 64K or 2GiB.")
+	listContainerCmd.PersistentFlags().StringVar(&raw.includeSizeMax, "include-size-max", "", "List only those files whose size is at most the given value. "+
+		"\n The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). E.g. 500, 64K or 2GiB.")
+	listContainerCmd.PersistentFlags().StringVar(&raw.filter, "filter", "", "List only those files for which the given expression is true. "+
+		"\n The fields are "+knownFilterExpressionFields()+". "+
+		"\n E.g. \"tags.env == prod and age > 90d and not tier in (Archive, Cold)\". See 'azcopy copy --help' for the syntax.")
 	listContainerCmd.PersistentFlags().StringVar(&raw.trailingDot, "trailing-dot", "", "'Enable' by default to treat file share related operations in a safe manner. "+
 		"\n Available options: "+strings.Join(common.ValidTrailingDotOptions(), ", ")+". "+
 		"\n Choose 'Disable' to go back to legacy (potentially unsafe) treatment of trailing dot files where the file service will trim any trailing dots in paths. "+
@@ -262,6 +285,7 @@ func (cooked cookedListCmdArgs) handleListContainerCommand() (err error) {
 		GetPropertiesInFrontend: true,
 
 		ListVersions:     getVersionId,
+		PreserveBlobTags: cooked.filter.needsBlobTags(),
 		HardlinkHandling: common.EHardlinkHandlingType.Follow(),
 	})
 	if err != nil {
@@ -327,7 +351,8 @@ func (cooked cookedListCmdArgs) handleListContainerCommand() (err error) {
 		return nil
 	}
 
-	err = traverser.Traverse(nil, processor, nil)
+	filters := append(buildSizeFilters(cooked.includeSizeMin, cooked.includeSizeMax), buildExpressionFilters(cooked.filter)...)
+	err = traverser.Traverse(nil, processor, filters)
 
 	if err != nil {
 		return fmt.Errorf("failed to traverse container: %s", err.Error())
@@ -58,7 +58,11 @@ func DetermineLocationLevel(location string, locationType common.Location, sourc
 		return ELocationLevel.Object(), nil // we always benchmark to a subfolder, not the container root
 
 	case common.ELocation.Http():
-		// HTTP sources are always single file downloads - treat as Object level
+		// HTTP sources have no container concept; a directory listing behaves like a blob virtual directory
+		return ELocationLevel.Object(), nil
+
+	case common.ELocation.WebDAV():
+		// likewise for WebDAV, where any collection can be the root of a transfer
 		return ELocationLevel.Object(), nil
 
 	case common.ELocation.Blob(),
@@ -191,8 +195,10 @@ func GetResourceRoot(resource string, location common.Location) (resourceBase st
 		gcpURL := gcpURLParts.URL()
 		return gcpURL.String(), nil
 	case common.ELocation.Http():
-		// HTTP sources are always single files - just return the URL as-is
-		// No container/bucket concept, no wildcards, no account-level traversal
+		// HTTP sources are a single file or a directory listing - just return the URL as-is
+		// No container/bucket concept, no account-level traversal
+		return resource, nil
+	case common.ELocation.WebDAV():
 		return resource, nil
 	default:
 		panic(fmt.Sprintf("Location %s is missing from GetResourceRoot", location))
@@ -238,7 +244,13 @@ func splitAuthTokenFromResource(resource string, location common.Location) (reso
 		return resource, "", nil
 	case common.ELocation.Http():
 		// HTTP sources don't have embedded auth tokens (SAS, etc.)
-		// Authentication is handled via Bearer token flag or custom headers
+		// Authentication is handled via Bearer token flag or custom headers, or the AZCOPY_HTTP_* environment variables.
+		// Passwords in the URL are refused, since the URL is saved in the job's plan files.
+		if err := checkNoHTTPPassword(resource); err != nil {
+			return "", "", err
+		}
+		return resource, "", nil
+	case common.ELocation.WebDAV():
 		return resource, "", nil
 	case common.ELocation.Benchmark(), // cover for benchmark as we generate data for that
 		common.ELocation.Unknown(), // cover for unknown as we treat that as garbage
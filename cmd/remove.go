@@ -140,6 +140,13 @@ func init() {
 		"\n If no timezone is specified, the value is assumed to be in the local timezone of the machine running AzCopy. "+
 		"\n E.g. '2020-08-19T15:04:00Z' for a UTC time, or '2020-08-19' for midnight (00:00) in the local timezone. "+
 		"\n As of AzCopy 10.5, this flag applies only to files, not folders, so folder properties won't be copied when using this flag with --preserve-info or --preserve-permissions.")
+	deleteCmd.PersistentFlags().StringVar(&raw.includeSizeMin, "include-size-min", "", "Include only those files whose size is at least the given value. "+
+		"\n The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). E.g. 500, 64K or 2GiB.")
+	deleteCmd.PersistentFlags().StringVar(&raw.includeSizeMax, "include-size-max", "", "Include only those files whose size is at most the given value. "+
+		"\n The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). E.g. 500, 64K or 2GiB.")
+	deleteCmd.PersistentFlags().StringVar(&raw.filter, "filter", "", "Include only those files for which the given expression is true. "+
+		"\n The fields are "+knownFilterExpressionFields()+". "+
+		"\n E.g. \"tags.env == prod and age > 90d and not tier in (Archive, Cold)\". See 'azcopy copy --help' for the syntax.")
 	deleteCmd.PersistentFlags().StringVar(&raw.trailingDot, "trailing-dot", "", "'Enable' by default to treat file share related operations in a safe manner. "+
 		"\n Available options: "+strings.Join(common.ValidTrailingDotOptions(), ", ")+". "+
 		"\n Choose 'Disable' to go back to legacy (potentially unsafe) treatment of trailing dot files where the file service will trim any trailing dots in paths. "+
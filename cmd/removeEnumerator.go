@@ -63,6 +63,7 @@ func newRemoveEnumerator(cca *CookedCopyCmdArgs) (enumerator *CopyEnumerator, er
 		Recursive:               cca.Recursive,
 		IncludeDirectoryStubs:   cca.IncludeDirectoryStubs,
 		GetPropertiesInFrontend: true,
+		PreserveBlobTags:        cca.filterExpression.needsBlobTags(),
 		StripTopDir:             cca.StripTopDir,
 
 		ExcludeContainers: cca.excludeContainer,
@@ -91,6 +92,9 @@ func newRemoveEnumerator(cca *CookedCopyCmdArgs) (enumerator *CopyEnumerator, er
 		filters = append(filters, &IncludeAfterDateFilter{Threshold: *cca.IncludeAfter})
 	}
 
+	filters = append(filters, buildSizeFilters(cca.IncludeSizeMin, cca.IncludeSizeMax)...)
+	filters = append(filters, buildExpressionFilters(cca.filterExpression)...)
+
 	// decide our folder transfer strategy
 	// (Must enumerate folders when deleting from a folder-aware location. Can't do folder deletion just based on file
 	// deletion, because that would not handle folders that were empty at the start of the job).
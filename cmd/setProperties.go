@@ -174,6 +174,13 @@ func init() {
 	setPropCmd.PersistentFlags().StringVar(&raw.excludePath, "exclude-path", "", "Exclude these paths when removing. "+
 		"This option does not support wildcard characters (*). Checks relative path prefix. "+
 		"\n For example: myFolder;myFolder/subDirName/file.pdf")
+	setPropCmd.PersistentFlags().StringVar(&raw.includeSizeMin, "include-size-min", "", "Include only those files whose size is at least the given value. "+
+		"\n The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). E.g. 500, 64K or 2GiB.")
+	setPropCmd.PersistentFlags().StringVar(&raw.includeSizeMax, "include-size-max", "", "Include only those files whose size is at most the given value. "+
+		"\n The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). E.g. 500, 64K or 2GiB.")
+	setPropCmd.PersistentFlags().StringVar(&raw.filter, "filter", "", "Include only those files for which the given expression is true. "+
+		"\n The fields are "+knownFilterExpressionFields()+". "+
+		"\n E.g. \"tags.env == prod and age > 90d and not tier in (Archive, Cold)\". See 'azcopy copy --help' for the syntax.")
 	setPropCmd.PersistentFlags().StringVar(&raw.listOfFilesToCopy, "list-of-files", "", "Defines the location of text file which has the list of only files to be copied.")
 	setPropCmd.PersistentFlags().StringVar(&raw.blockBlobTier, "block-blob-tier", "None", "Changes the access tier of the block blobs to the given tier. (default 'None'). "+
 		"\n Valid options are Hot, Cold, Cool, Archive")
@@ -58,9 +58,11 @@ func setPropertiesEnumerator(cca *CookedCopyCmdArgs) (enumerator *CopyEnumerator
 		PermanentDelete:   cca.permanentDeleteOption,
 		TrailingDotOption: cca.trailingDot,
 
-		Recursive:             cca.Recursive,
-		IncludeDirectoryStubs: cca.IncludeDirectoryStubs,
-		StripTopDir:           cca.StripTopDir,
+		Recursive:               cca.Recursive,
+		GetPropertiesInFrontend: cca.filterExpression != nil, // the expression may read properties that listing Files doesn't return
+		IncludeDirectoryStubs:   cca.IncludeDirectoryStubs,
+		PreserveBlobTags:        cca.filterExpression.needsBlobTags(),
+		StripTopDir:             cca.StripTopDir,
 
 		ExcludeContainers: cca.excludeContainer,
 		HardlinkHandling:  cca.hardlinks,
@@ -80,6 +82,8 @@ func setPropertiesEnumerator(cca *CookedCopyCmdArgs) (enumerator *CopyEnumerator
 	filters := append(includeFilters, excludeFilters...)
 	filters = append(filters, excludePathFilters...)
 	filters = append(filters, includeSoftDelete...)
+	filters = append(filters, buildSizeFilters(cca.IncludeSizeMin, cca.IncludeSizeMax)...)
+	filters = append(filters, buildExpressionFilters(cca.filterExpression)...)
 
 	fpo, message := NewFolderPropertyOption(cca.FromTo, cca.Recursive, cca.StripTopDir, filters, false, false, false, strings.EqualFold(cca.Destination.Value, common.Dev_Null), cca.IncludeDirectoryStubs)
 	// do not print Info message if in dry run mode
@@ -58,7 +58,14 @@ type rawSyncCmdArgs struct {
 	legacyExclude         string // for warning messages only
 	includeRegex          string
 	excludeRegex          string
+	includeSizeMin        string
+	includeSizeMax        string
+	filter                string
+	ignoreFile            string
+	rename                []string
+	renameFile            string
 	compareHash           string
+	compareBy             string
 	localHashStorageMode  string
 
 	includeDirectoryStubs   bool // Includes hdi_isfolder objects in the sync even w/o preservePermissions.
@@ -81,6 +88,30 @@ type rawSyncCmdArgs struct {
 	// this flag is to disable comparator and overwrite files at destination irrespective
 	mirrorMode bool
 
+	// compare the source with a snapshot of the last sync, rather than with a listing of the destination
+	incremental bool
+
+	// sync both ways, from a baseline of what the last bidirectional sync left on either side
+	bidirectional  bool
+	conflictPolicy string
+
+	// move files renamed at the source within the destination, rather than uploading them again
+	detectMoves bool
+
+	// archive the extra files at the destination under this prefix, rather than deleting them, and prune archives older than the retention
+	archivePrefix        string
+	archiveRetentionDays int
+
+	// write what the sync decides for every path it compares to this file
+	diffReport string
+
+	// keep running after the sync, uploading the changes made at the source
+	watch                    bool
+	watchDebounceSeconds     float64
+	watchMinIntervalSeconds  float64
+	watchPoll                bool
+	watchPollIntervalSeconds float64
+
 	s2sPreserveAccessTier bool
 	// Opt-in flag to preserve the blob index tags during service to service transfer.
 	s2sPreserveBlobTags bool
@@ -133,6 +164,12 @@ func (raw rawSyncCmdArgs) toOptions() (cooked cookedSyncCmdArgs, err error) {
 		cpkByName:                        raw.cpkScopeInfo,
 		cpkByValue:                       raw.cpkInfo,
 		mirrorMode:                       raw.mirrorMode,
+		incremental:                      raw.incremental,
+		bidirectional:                    raw.bidirectional,
+		detectMoves:                      raw.detectMoves,
+		watch:                            raw.watch,
+		diffReportPath:                   raw.diffReport,
+		watchPoll:                        raw.watchPoll,
 		deleteDestinationFileIfNecessary: raw.deleteDestinationFileIfNecessary,
 		includeDirectoryStubs:            raw.includeDirectoryStubs,
 		includeRoot:                      raw.includeRoot,
@@ -141,6 +178,28 @@ func (raw rawSyncCmdArgs) toOptions() (cooked cookedSyncCmdArgs, err error) {
 	if err != nil {
 		return cooked, err
 	}
+
+	if raw.archivePrefix != "" {
+		if cooked.archivePrefix, err = cleanSyncArchivePrefix(raw.archivePrefix); err != nil {
+			return cooked, err
+		}
+		cooked.archiveTime = time.Now().UTC()
+	}
+	if raw.archiveRetentionDays < 0 {
+		return cooked, errors.New("archive-retention-days cannot be negative")
+	}
+	cooked.archiveRetention = time.Duration(raw.archiveRetentionDays) * 24 * time.Hour
+	if raw.watch {
+		if raw.watchDebounceSeconds < 0 || raw.watchMinIntervalSeconds < 0 {
+			return cooked, errors.New("watch-debounce-seconds and watch-min-interval-seconds cannot be negative")
+		}
+		if raw.watchPollIntervalSeconds <= 0 {
+			return cooked, errors.New("watch-poll-interval-seconds must be greater than zero")
+		}
+		cooked.watchDebounce = time.Duration(raw.watchDebounceSeconds * float64(time.Second))
+		cooked.watchMinInterval = time.Duration(raw.watchMinIntervalSeconds * float64(time.Second))
+		cooked.watchPollInterval = time.Duration(raw.watchPollIntervalSeconds * float64(time.Second))
+	}
 	cooked.fromTo, err = ValidateFromTo(raw.src, raw.dst, raw.fromTo)
 	if err != nil {
 		return cooked, err
@@ -149,13 +208,14 @@ func (raw rawSyncCmdArgs) toOptions() (cooked cookedSyncCmdArgs, err error) {
 	switch cooked.fromTo {
 	case common.EFromTo.Unknown():
 		return cooked, fmt.Errorf("unable to infer the source '%s' / destination '%s'. ", raw.src, raw.dst)
-	case common.EFromTo.LocalBlob(), common.EFromTo.LocalFile(), common.EFromTo.LocalBlobFS(), common.EFromTo.LocalFileNFS():
+	case common.EFromTo.LocalBlob(), common.EFromTo.LocalFile(), common.EFromTo.LocalBlobFS(), common.EFromTo.LocalFileNFS(), common.EFromTo.LocalWebDAV():
 		cooked.destination, err = SplitResourceString(raw.dst, cooked.fromTo.To())
 		common.PanicIfErr(err)
-	case common.EFromTo.BlobLocal(), common.EFromTo.FileLocal(), common.EFromTo.BlobFSLocal(), common.EFromTo.FileNFSLocal():
+	case common.EFromTo.BlobLocal(), common.EFromTo.FileLocal(), common.EFromTo.BlobFSLocal(), common.EFromTo.FileNFSLocal(), common.EFromTo.WebDAVLocal(), common.EFromTo.HttpLocal():
 		cooked.source, err = SplitResourceString(raw.src, cooked.fromTo.From())
 		common.PanicIfErr(err)
-	case common.EFromTo.BlobBlob(), common.EFromTo.FileFile(), common.EFromTo.FileNFSFileNFS(), common.EFromTo.BlobFile(), common.EFromTo.FileBlob(), common.EFromTo.BlobFSBlobFS(), common.EFromTo.BlobFSBlob(), common.EFromTo.BlobFSFile(), common.EFromTo.BlobBlobFS(), common.EFromTo.FileBlobFS():
+	case common.EFromTo.BlobBlob(), common.EFromTo.FileFile(), common.EFromTo.FileNFSFileNFS(), common.EFromTo.BlobFile(), common.EFromTo.FileBlob(), common.EFromTo.BlobFSBlobFS(), common.EFromTo.BlobFSBlob(), common.EFromTo.BlobFSFile(), common.EFromTo.BlobBlobFS(), common.EFromTo.FileBlobFS(),
+		common.EFromTo.WebDAVBlob(), common.EFromTo.WebDAVFile(), common.EFromTo.HttpBlob(), common.EFromTo.S3Blob(), common.EFromTo.GCPBlob():
 		cooked.destination, err = SplitResourceString(raw.dst, cooked.fromTo.To())
 		common.PanicIfErr(err)
 		cooked.source, err = SplitResourceString(raw.src, cooked.fromTo.From())
@@ -219,11 +279,22 @@ func (raw rawSyncCmdArgs) toOptions() (cooked cookedSyncCmdArgs, err error) {
 		return cooked, err
 	}
 
+	if err = cooked.compareBy.Parse(raw.compareBy); err != nil {
+		return cooked, err
+	}
+	if cooked.compareBy == common.ESyncCompareBy.Checksum() && cooked.compareHash == common.ESyncHashType.None() {
+		cooked.compareHash = common.ESyncHashType.MD5() // comparing by checksum needs a hash of some kind
+	}
+
+	if err = cooked.conflictPolicy.Parse(raw.conflictPolicy); err != nil {
+		return cooked, err
+	}
+
 	switch cooked.compareHash {
 	case common.ESyncHashType.MD5():
 		// Save any new MD5s on files we download.
 		cooked.putMd5 = true
-	default: // no need to put a hash of any kind.
+	default: // the other hashes are computed while indexing local files, and kept in metadata at remote locations.
 	}
 
 	if err = common.LocalHashStorageMode.Parse(raw.localHashStorageMode); err != nil {
@@ -242,6 +313,23 @@ func (raw rawSyncCmdArgs) toOptions() (cooked cookedSyncCmdArgs, err error) {
 	cooked.includeRegex = parsePatterns(raw.includeRegex)
 	cooked.excludeRegex = parsePatterns(raw.excludeRegex)
 
+	cooked.includeSizeMin, cooked.includeSizeMax, err = parseSizeFilterRange(raw.includeSizeMin, raw.includeSizeMax)
+	if err != nil {
+		return cooked, err
+	}
+
+	cooked.filterExpression, err = parseFilterExpression(raw.filter)
+	if err != nil {
+		return cooked, err
+	}
+
+	cooked.ignoreFile = raw.ignoreFile
+
+	cooked.rename, err = newRenameRules(raw.rename, raw.renameFile)
+	if err != nil {
+		return cooked, err
+	}
+
 	return cooked, nil
 }
 
@@ -313,10 +401,103 @@ func (cooked *cookedSyncCmdArgs) validate() (err error) {
 			"blob index tags is a property of blobs only therefore both source and destination must be blob storage")
 	}
 
+	if cooked.ignoreFile != "" && cooked.fromTo.From() != common.ELocation.Local() {
+		return errors.New("--ignore-file only applies to syncs from the local file system")
+	}
+
+	// sync lists tags only to preserve them, since whatever it lists is copied to the destination
+	if cooked.filterExpression.needsBlobTags() && !cooked.s2sPreserveBlobTags {
+		return errors.New("--filter can only compare blob index tags when syncing with --s2s-preserve-blob-tags")
+	}
+
 	if cooked.cpkByName != "" && cooked.cpkByValue {
 		return errors.New("cannot use both cpk-by-name and cpk-by-value at the same time")
 	}
 
+	if cooked.incremental && cooked.mirrorMode {
+		return errors.New("cannot use both incremental and mirror-mode at the same time, since mirror-mode overwrites the destination regardless of what has changed")
+	}
+
+	if cooked.bidirectional {
+		switch cooked.fromTo {
+		case common.EFromTo.LocalBlob(), common.EFromTo.LocalFile(), common.EFromTo.LocalBlobFS(),
+			common.EFromTo.BlobLocal(), common.EFromTo.FileLocal(), common.EFromTo.BlobFSLocal():
+		default:
+			return fmt.Errorf("bidirectional sync is only supported between a local directory and Blob or Files storage, not for %s", cooked.fromTo)
+		}
+
+		if cooked.mirrorMode || cooked.incremental {
+			return errors.New("cannot use bidirectional with mirror-mode or incremental, since both only look for changes at the source")
+		}
+	}
+
+	if cooked.compareBy != common.ESyncCompareBy.Default() {
+		if cooked.mirrorMode || cooked.incremental || cooked.bidirectional {
+			return fmt.Errorf("cannot use compare-by %s with mirror-mode, incremental or bidirectional, since they compare files their own way", cooked.compareBy)
+		}
+
+		// local files have no content headers or metadata to compare
+		if cooked.compareBy == common.ESyncCompareBy.MetadataAware() && !cooked.fromTo.IsS2S() {
+			return fmt.Errorf("compare-by %s is only supported between remote locations, not for %s", cooked.compareBy, cooked.fromTo)
+		}
+	}
+
+	if cooked.detectMoves {
+		switch cooked.fromTo {
+		case common.EFromTo.LocalBlob(), common.EFromTo.LocalFile(), common.EFromTo.LocalBlobFS():
+		default:
+			return fmt.Errorf("detect-moves is only supported when uploading to Blob, Files or ADLS Gen2 storage, not for %s", cooked.fromTo)
+		}
+
+		if cooked.compareHash == common.ESyncHashType.None() {
+			return errors.New("detect-moves needs compare-hash, since moved files are recognized by their size and hash")
+		}
+
+		// a move deletes the old copy of the file, without asking
+		if cooked.deleteDestination != common.EDeleteDestination.True() {
+			return errors.New("detect-moves needs delete-destination=true, since moving a file removes it from its old location")
+		}
+
+		if cooked.incremental || cooked.bidirectional {
+			return errors.New("cannot use detect-moves with incremental or bidirectional")
+		}
+	}
+
+	// those compare the source with paths recorded as they were at the source, or go both ways
+	if cooked.rename != nil && (cooked.incremental || cooked.bidirectional || cooked.detectMoves) {
+		return errors.New("cannot use rename with incremental, bidirectional or detect-moves")
+	}
+
+	if cooked.archivePrefix != "" {
+		switch cooked.fromTo.To() {
+		case common.ELocation.Blob(), common.ELocation.File(), common.ELocation.BlobFS():
+		default:
+			return fmt.Errorf("archive-prefix is only supported for Blob, Files or ADLS Gen2 destinations, not for %s", cooked.fromTo)
+		}
+
+		if cooked.deleteDestination == common.EDeleteDestination.False() {
+			return errors.New("archive-prefix needs delete-destination, since only the files it would delete are archived")
+		}
+	} else if cooked.archiveRetention > 0 {
+		return errors.New("archive-retention-days needs archive-prefix")
+	}
+
+	if cooked.diffReportPath != "" && cooked.bidirectional {
+		return errors.New("cannot use diff-report with bidirectional")
+	}
+
+	if cooked.watch {
+		switch cooked.fromTo {
+		case common.EFromTo.LocalBlob(), common.EFromTo.LocalFile(), common.EFromTo.LocalBlobFS():
+		default:
+			return fmt.Errorf("watch is only supported when uploading to Blob, Files or ADLS Gen2 storage, not for %s", cooked.fromTo)
+		}
+
+		if cooked.dryrunMode || cooked.incremental || cooked.bidirectional || cooked.detectMoves {
+			return errors.New("cannot use watch with dry-run, incremental, bidirectional or detect-moves")
+		}
+	}
+
 	if OutputLevel == common.EOutputVerbosity.Quiet() || OutputLevel == common.EOutputVerbosity.Essential() {
 		if cooked.deleteDestination == common.EDeleteDestination.Prompt() {
 			err = fmt.Errorf("cannot set output level '%s' with delete-destination option '%s'", OutputLevel.String(), cooked.deleteDestination.String())
@@ -410,10 +591,15 @@ type cookedSyncCmdArgs struct {
 	// defines whether first part has been ordered or not.
 	// 0 means first part is not ordered and 1 means first part is ordered.
 	atomicFirstPartOrdered uint32
+	// defines whether the job a bidirectional sync copies to the source with has been ordered, in the same way.
+	atomicReverseJobOrdered uint32
 
 	// deletion count keeps track of how many extra files from the destination were removed
 	atomicDeletionCount uint32
 
+	// move count keeps track of how many files were moved within the destination, instead of being transferred again
+	atomicMoveCount uint32
+
 	source                  common.ResourceString
 	destination             common.ResourceString
 	fromTo                  common.FromTo
@@ -430,9 +616,15 @@ type cookedSyncCmdArgs struct {
 	excludeFileAttributes []string
 	includeRegex          []string
 	excludeRegex          []string
+	includeSizeMin        *int64
+	includeSizeMax        *int64
+	filterExpression      *expressionFilter
+	ignoreFile            string
+	rename                *renameRules
 
 	// options
 	compareHash             common.SyncHashType
+	compareBy               common.SyncCompareBy
 	preservePermissions     common.PreservePermissionsOption
 	preserveInfo            bool
 	preservePOSIXProperties bool
@@ -479,6 +671,38 @@ type cookedSyncCmdArgs struct {
 
 	mirrorMode bool
 
+	// incremental syncs compare the source with a snapshot of the last successful sync, instead of listing the destination
+	incremental bool
+	snapshot    *syncSnapshotWriter // records the snapshot for the next incremental sync
+
+	// bidirectional syncs copy and delete both ways, according to what has changed on either side since the baseline
+	bidirectional  bool
+	conflictPolicy common.SyncConflictPolicy
+	baseline       *syncBaselineWriter // records the baseline for the next bidirectional sync
+	reverseJobID   common.JobID        // the job of its own the transfers to the source go in, so that it can be resumed with the source's SAS
+
+	// files renamed or moved at the source are moved within the destination, rather than uploaded again
+	detectMoves bool
+
+	// the files delete-destination removes are moved under archivePrefix/<archiveTime> within the destination instead,
+	// and the archives of the syncs that ran more than archiveRetention ago are pruned
+	archivePrefix    string
+	archiveTime      time.Time
+	archiveRetention time.Duration
+
+	// the decision made for every path compared is written to the file at diffReportPath
+	diffReportPath string
+	diffReport     *syncDiffReport
+
+	// after the sync, the source is watched for changes, which are uploaded by a job of their own once it has been quiet for watchDebounce,
+	// with at least watchMinInterval between jobs; it is polled every watchPollInterval if watchPoll is set, or file system events aren't available
+	watch             bool
+	watchDebounce     time.Duration
+	watchMinInterval  time.Duration
+	watchPoll         bool
+	watchPollInterval time.Duration
+	watcher           *syncWatcher
+
 	dryrunMode  bool
 	trailingDot common.TrailingDotOption
 
@@ -501,6 +725,33 @@ func (cca *cookedSyncCmdArgs) getDeletionCount() uint32 {
 	return atomic.LoadUint32(&cca.atomicDeletionCount)
 }
 
+func (cca *cookedSyncCmdArgs) incrementMoveCount() {
+	atomic.AddUint32(&cca.atomicMoveCount, 1)
+}
+
+func (cca *cookedSyncCmdArgs) getMoveCount() uint32 {
+	return atomic.LoadUint32(&cca.atomicMoveCount)
+}
+
+// commitSyncSnapshot keeps the snapshot recorded by an incremental sync, or the baseline recorded by a bidirectional one, for the next sync.
+// It must only be called once the source and destination are in sync.
+func (cca *cookedSyncCmdArgs) commitSyncSnapshot() {
+	var err error
+	var kind string
+	switch {
+	case cca.snapshot != nil:
+		err, kind = cca.snapshot.commit(), "snapshot for the next incremental sync"
+	case cca.baseline != nil:
+		err, kind = cca.baseline.commitAt(time.Now()), "baseline for the next bidirectional sync"
+	}
+
+	if err != nil {
+		msg := fmt.Sprintf("Failed to save the %s: %v", kind, err)
+		glcm.Warn(msg)
+		common.LogToJobLogWithPrefix(msg, common.LogWarning)
+	}
+}
+
 // setFirstPartOrdered sets the value of atomicFirstPartOrdered to 1
 func (cca *cookedSyncCmdArgs) setFirstPartOrdered() {
 	atomic.StoreUint32(&cca.atomicFirstPartOrdered, 1)
@@ -511,6 +762,61 @@ func (cca *cookedSyncCmdArgs) firstPartOrdered() bool {
 	return atomic.LoadUint32(&cca.atomicFirstPartOrdered) > 0
 }
 
+// setReverseJobOrdered sets the value of atomicReverseJobOrdered to 1
+func (cca *cookedSyncCmdArgs) setReverseJobOrdered() {
+	atomic.StoreUint32(&cca.atomicReverseJobOrdered, 1)
+}
+
+// reverseJobOrdered returns the value of atomicReverseJobOrdered.
+func (cca *cookedSyncCmdArgs) reverseJobOrdered() bool {
+	return atomic.LoadUint32(&cca.atomicReverseJobOrdered) > 0
+}
+
+// anyJobOrdered tells whether the sync has ordered a job, in either direction
+func (cca *cookedSyncCmdArgs) anyJobOrdered() bool {
+	return cca.firstPartOrdered() || cca.reverseJobOrdered()
+}
+
+// getSyncJobSummary returns the summary of the sync's job. When a bidirectional sync also copies to the source, the counts of
+// both its jobs are added up, and its status is that of whichever job is still running, or else the worse of the two.
+// The job ID is that of the job to the destination, unless there is only the one to the source.
+func (cca *cookedSyncCmdArgs) getSyncJobSummary() common.ListJobSummaryResponse {
+	if !cca.reverseJobOrdered() {
+		return jobsAdmin.GetJobSummary(cca.jobID)
+	}
+	reverse := jobsAdmin.GetJobSummary(cca.reverseJobID)
+	if !cca.firstPartOrdered() {
+		return reverse
+	}
+
+	summary := jobsAdmin.GetJobSummary(cca.jobID)
+	if total := summary.TotalTransfers + reverse.TotalTransfers; total > 0 {
+		summary.PercentComplete = (summary.PercentComplete*float32(summary.TotalTransfers) + reverse.PercentComplete*float32(reverse.TotalTransfers)) / float32(total)
+	}
+	if !reverse.JobStatus.IsJobDone() || summary.JobStatus == common.EJobStatus.Completed() {
+		summary.JobStatus = reverse.JobStatus
+	}
+	summary.CompleteJobOrdered = summary.CompleteJobOrdered && reverse.CompleteJobOrdered
+	summary.TotalTransfers += reverse.TotalTransfers
+	summary.FileTransfers += reverse.FileTransfers
+	summary.FolderPropertyTransfers += reverse.FolderPropertyTransfers
+	summary.SymlinkTransfers += reverse.SymlinkTransfers
+	summary.FoldersCompleted += reverse.FoldersCompleted
+	summary.TransfersCompleted += reverse.TransfersCompleted
+	summary.FoldersFailed += reverse.FoldersFailed
+	summary.TransfersFailed += reverse.TransfersFailed
+	summary.FoldersSkipped += reverse.FoldersSkipped
+	summary.TransfersSkipped += reverse.TransfersSkipped
+	summary.BytesOverWire += reverse.BytesOverWire
+	summary.TotalBytesTransferred += reverse.TotalBytesTransferred
+	summary.TotalBytesEnumerated += reverse.TotalBytesEnumerated
+	summary.TotalBytesExpected += reverse.TotalBytesExpected
+	summary.HardlinksConvertedCount += reverse.HardlinksConvertedCount
+	summary.FailedTransfers = append(summary.FailedTransfers, reverse.FailedTransfers...)
+	summary.SkippedTransfers = append(summary.SkippedTransfers, reverse.SkippedTransfers...)
+	return summary
+}
+
 // setScanningComplete sets the value of atomicScanningStatus to 1.
 func (cca *cookedSyncCmdArgs) setScanningComplete() {
 	atomic.StoreUint32(&cca.atomicScanningStatus, 1)
@@ -549,6 +855,12 @@ func (cca *cookedSyncCmdArgs) waitUntilJobCompletion(blocking bool) {
 }
 
 func (cca *cookedSyncCmdArgs) Cancel(lcm common.LifecycleMgr) {
+	// once watching, cancelling stops the watch, along with any job it is running
+	if cca.watcher != nil && cca.watcher.watching() {
+		cca.watcher.stop()
+		return
+	}
+
 	// prompt for confirmation, except when enumeration is complete
 	if !cca.isEnumerationComplete {
 		answer := lcm.Prompt("The enumeration (source/destination comparison) is not complete, "+
@@ -567,10 +879,19 @@ func (cca *cookedSyncCmdArgs) Cancel(lcm common.LifecycleMgr) {
 		}
 	}
 
+	if cca.watcher != nil {
+		cca.watcher.stop()
+	}
+
 	err := cookedCancelCmdArgs{jobID: cca.jobID}.process()
 	if err != nil {
 		lcm.Error("error occurred while cancelling the job " + cca.jobID.String() + ". Failed with error " + err.Error())
 	}
+	if cca.reverseJobOrdered() {
+		if err = (cookedCancelCmdArgs{jobID: cca.reverseJobID}).process(); err != nil {
+			lcm.Error("error occurred while cancelling the job " + cca.reverseJobID.String() + ". Failed with error " + err.Error())
+		}
+	}
 }
 
 type scanningProgressJsonTemplate struct {
@@ -596,7 +917,7 @@ func (cca *cookedSyncCmdArgs) reportScanningProgress(lcm common.LifecycleMgr, th
 
 		// text output
 		throughputString := ""
-		if cca.firstPartOrdered() {
+		if cca.anyJobOrdered() {
 			throughputString = fmt.Sprintf(", 2-sec Throughput (Mb/s): %v", jobsAdmin.ToFixed(throughput, 4))
 		}
 		return fmt.Sprintf("%v Files Scanned at Source, %v Files Scanned at Destination%s",
@@ -608,21 +929,27 @@ func (cca *cookedSyncCmdArgs) getJsonOfSyncJobSummary(summary common.ListJobSumm
 	wrapped := common.ListSyncJobSummaryResponse{ListJobSummaryResponse: summary}
 	wrapped.DeleteTotalTransfers = cca.getDeletionCount()
 	wrapped.DeleteTransfersCompleted = cca.getDeletionCount()
+	wrapped.MoveTransfersCompleted = cca.getMoveCount()
 	jsonOutput, err := json.Marshal(wrapped)
 	common.PanicIfErr(err)
 	return string(jsonOutput)
 }
 
 func (cca *cookedSyncCmdArgs) ReportProgressOrExit(lcm common.LifecycleMgr) (totalKnownCount uint32) {
+	// the jobs that follow the sync in watch mode report their own outcome
+	if cca.watcher != nil && cca.watcher.watching() {
+		return
+	}
+
 	duration := time.Since(cca.jobStartTime) // report the total run time of the job
 	var summary common.ListJobSummaryResponse
 	var throughput float64
 	var jobDone bool
 
 	// fetch a job status and compute throughput if the first part was dispatched
-	if cca.firstPartOrdered() {
-		summary = jobsAdmin.GetJobSummary(cca.jobID)
-		lcm = jobsAdmin.GetJobLCMWrapper(cca.jobID)
+	if cca.anyJobOrdered() {
+		summary = cca.getSyncJobSummary()
+		lcm = jobsAdmin.GetJobLCMWrapper(summary.JobID)
 		jobDone = summary.JobStatus.IsJobDone()
 		totalKnownCount = summary.TotalTransfers
 
@@ -665,10 +992,14 @@ func (cca *cookedSyncCmdArgs) ReportProgressOrExit(lcm common.LifecycleMgr) (tot
 			exitCode = common.EExitCode.Error()
 		}
 
+		if exitCode == common.EExitCode.Success() {
+			cca.commitSyncSnapshot()
+		}
+
 		summary.SkippedSymlinkCount = atomic.LoadUint32(&cca.atomicSkippedSymlinkCount)
 		summary.SkippedSpecialFileCount = atomic.LoadUint32(&cca.atomicSkippedSpecialFileCount)
 
-		lcm.Exit(func(format common.OutputFormat) string {
+		cca.exitOrWatch(lcm, func(format common.OutputFormat) string {
 			if format == common.EOutputFormat.Json() {
 				return cca.getJsonOfSyncJobSummary(summary)
 			}
@@ -676,7 +1007,7 @@ func (cca *cookedSyncCmdArgs) ReportProgressOrExit(lcm common.LifecycleMgr) (tot
 
 			output := fmt.Sprintf(
 				`
-Job %s Summary
+Job %s Summary%s
 Files Scanned at Source: %v
 Files Scanned at Destination: %v
 Elapsed Time (Minutes): %v
@@ -686,6 +1017,7 @@ Total Number of Copy Transfers: %v
 Number of Copy Transfers Completed: %v
 Number of Copy Transfers Failed: %v
 Number of Deletions at Destination: %v
+Number of Moves at Destination: %v
 Number of Symbolic Links Skipped: %v
 Number of Special Files Skipped: %v
 Number of Hardlinks Converted: %v
@@ -694,6 +1026,7 @@ Total Number of Bytes Enumerated: %v
 Final Job Status: %v%s%s
 `,
 				summary.JobID.String(),
+				common.Iff(cca.firstPartOrdered() && cca.reverseJobOrdered(), fmt.Sprintf(", with Job %s Copying to the Source", cca.reverseJobID), ""),
 				atomic.LoadUint64(&cca.atomicSourceFilesScanned),
 				atomic.LoadUint64(&cca.atomicDestinationFilesScanned),
 				jobsAdmin.ToFixed(duration.Minutes(), 4),
@@ -703,6 +1036,7 @@ Final Job Status: %v%s%s
 				summary.TransfersCompleted,
 				summary.TransfersFailed,
 				cca.atomicDeletionCount,
+				cca.atomicMoveCount,
 				summary.SkippedSymlinkCount,
 				summary.SkippedSpecialFileCount,
 				summary.HardlinksConvertedCount,
@@ -837,6 +1171,12 @@ func init() {
 			}
 
 			cooked.commandString = copyHandlerUtil{}.ConstructCommandStringFromArgs()
+			if cooked.watch {
+				if cooked.watcher, err = newSyncWatcher(&cooked); err != nil {
+					glcm.Error("Cannot watch the source due to error: " + err.Error())
+				}
+			}
+
 			err = cooked.process()
 			if err != nil {
 				glcm.Error("Cannot perform sync due to error: " + err.Error() + getErrorCodeUrl(err))
@@ -844,6 +1184,9 @@ func init() {
 			if cooked.dryrunMode {
 				glcm.Exit(nil, common.EExitCode.Success())
 			}
+			if cooked.watcher != nil {
+				cooked.watchForChanges()
+			}
 
 			glcm.SurrenderControl()
 		},
@@ -930,6 +1273,35 @@ func init() {
 		"Exclude the relative path of the files that match with the regular expressions. "+
 			"\n Separate regular expressions with ';'.")
 
+	syncCmd.PersistentFlags().StringVar(&raw.includeSizeMin, "include-size-min", "",
+		"Include only those files whose size is at least the given value. "+
+			"\n The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). E.g. 500, 64K or 2GiB. "+
+			"\n Only the size at the source is compared, and the files at the destination whose counterparts at the source are excluded are left as they are.")
+
+	syncCmd.PersistentFlags().StringVar(&raw.includeSizeMax, "include-size-max", "",
+		"Include only those files whose size is at most the given value. "+
+			"\n The value is a number of bytes, optionally followed by K, M, G or T (powers of 1024). E.g. 500, 64K or 2GiB. "+
+			"\n Only the size at the source is compared, and the files at the destination whose counterparts at the source are excluded are left as they are.")
+
+	syncCmd.PersistentFlags().StringVar(&raw.filter, "filter", "",
+		"Include only those files for which the given expression is true at the source. "+
+			"\n The files at the destination whose counterparts at the source are excluded are left as they are, rather than deleted. "+
+			"\n The fields are "+knownFilterExpressionFields()+". "+
+			"\n E.g. \"tags.env == prod and age > 90d and not tier in (Archive, Cold)\". See 'azcopy copy --help' for the syntax.")
+
+	syncCmd.PersistentFlags().StringVar(&raw.ignoreFile, "ignore-file", "",
+		"Exclude the paths matched by the rules in the given file, which uses the syntax of .gitignore, when syncing from the local file system. "+
+			"\n The rules of any "+azcopyIgnoreFileName+" files in the source directories are applied too, and take precedence. "+
+			"\n The excluded paths are left alone at the destination, even with --delete-destination.")
+
+	syncCmd.PersistentFlags().StringArrayVar(&raw.rename, "rename", nil,
+		"Change the path of each file at the destination with a rule written like a sed substitution, "+
+			"\n e.g. 's#^logs/(\\d{4})-(\\d{2})/#logs/year=$1/month=$2/#'. Files are compared with those at the paths they're renamed to. "+
+			"\n Give the flag more than once for several rules. See 'azcopy copy --help' for the syntax.")
+
+	syncCmd.PersistentFlags().StringVar(&raw.renameFile, "rename-file", "",
+		"Read rename rules from the given file, one to a line, and apply them after those given with --rename.")
+
 	syncCmd.PersistentFlags().StringVar(&raw.deleteDestination, "delete-destination", "false",
 		"Defines whether to delete extra files from the destination that are not present at the source. "+
 			"\n Could be set to true, false, or prompt. "+
@@ -972,6 +1344,62 @@ func init() {
 			"\n overwrites the conflicting files and blobs at the destination if this flag is set to true. "+
 			"\n Default is false.")
 
+	syncCmd.PersistentFlags().BoolVar(&raw.incremental, "incremental", false,
+		"False by default. Compare the source with a snapshot of what the last successful sync between the same source and destination left there, "+
+			"\n instead of listing the destination, and only transfer the source files whose size, last modified time or hash has changed since. "+
+			"\n The first sync with this flag lists the destination as usual. Snapshots are kept alongside the job plan files, and are ignored if the filters or options of the sync change. "+
+			"\n Changes made directly to the destination are not noticed, so run a sync without this flag now and then.")
+
+	syncCmd.PersistentFlags().BoolVar(&raw.bidirectional, "bidirectional", false,
+		"False by default. Sync both ways between a local directory and Blob or Files storage: copy whatever has changed at either the source or the destination "+
+			"\n since the last bidirectional sync between them to the other side, and, as allowed by --delete-destination, delete from either side what was deleted from the other. "+
+			"\n What the sync leaves on both sides is kept alongside the job plan files as the baseline for the next one. "+
+			"\n The first sync has no baseline, so every file that differs between the two sides is a conflict: use --conflict-policy=NewerWins, or --compare-hash=MD5, to settle them.")
+
+	syncCmd.PersistentFlags().StringVar(&raw.conflictPolicy, "conflict-policy", common.ESyncConflictPolicy.Report().String(),
+		"Report by default. What a bidirectional sync does with a file changed at both the source and the destination since the last sync. "+
+			"\n Available options: Report (leave both versions as they are, and list the file), NewerWins (copy the version modified last over the other), "+
+			"\n KeepBoth (rename the local version to <name>.conflict-<time><ext> and sync it, keeping the remote version under the original name). "+
+			"\n Except with Report, a file changed on one side and deleted from the other is restored.")
+
+	syncCmd.PersistentFlags().BoolVar(&raw.detectMoves, "detect-moves", false,
+		"False by default. When uploading to Blob, Files or ADLS Gen2 storage, recognize files renamed or moved at the source "+
+			"\n by matching the files only at the destination with those only at the source that have the same size and hash, "+
+			"\n and move them within the destination (a server-side copy and delete on Blob storage, a rename on Files and ADLS Gen2) instead of uploading them again. "+
+			"\n Needs --compare-hash and --delete-destination=true. If a move fails, the file is uploaded as usual.")
+
+	syncCmd.PersistentFlags().StringVar(&raw.archivePrefix, "archive-prefix", "",
+		"Empty by default. Rather than deleting the extra files at a Blob, Files or ADLS Gen2 destination, as --delete-destination does, "+
+			"\n move them under this prefix within the destination, in a folder named after the time of the sync (e.g. .azcopy-deleted/2026-10-16T093000Z/path), "+
+			"\n with a server-side copy and delete. The prefix is left out of the sync on both sides.")
+
+	syncCmd.PersistentFlags().IntVar(&raw.archiveRetentionDays, "archive-retention-days", 0,
+		"0 by default, which keeps archives forever. With --archive-prefix, delete the archive folders of syncs that ran more than this many days ago.")
+
+	syncCmd.PersistentFlags().StringVar(&raw.diffReport, "diff-report", "",
+		"Empty by default. Write a record of what the sync decides for every path it compares to this file: "+
+			"\n the action (create, overwrite, delete or skip), the reason for it, and the size, last modified time and hash of the file at the source and at the destination. "+
+			"\n The report is in CSV if the file name ends with .csv, and in JSON Lines otherwise. Use it with --dry-run to review a sync before running it.")
+
+	syncCmd.PersistentFlags().BoolVar(&raw.watch, "watch", false,
+		"False by default. When uploading to Blob, Files or ADLS Gen2 storage, keep running after the sync, "+
+			"\n watching the local directory for files created, modified or deleted, and syncing them with a small job of their own once the directory has been quiet for a moment. "+
+			"\n Changes are picked up from inotify on Linux, and by polling the directory elsewhere, or if inotify runs out of watches. Press Ctrl+C to stop. "+
+			"\n The size and last modified time of every file in the directory are kept in memory while watching, so watching a very large directory takes a lot of memory.")
+
+	syncCmd.PersistentFlags().Float64Var(&raw.watchDebounceSeconds, "watch-debounce-seconds", 2,
+		"2 by default. With --watch, how long the source must be free of changes before they are synced, so that a file still being written isn't uploaded over and over. "+
+			"\n Changes are synced within a minute of the first of them (or this long, if longer) even if the source never settles.")
+
+	syncCmd.PersistentFlags().Float64Var(&raw.watchMinIntervalSeconds, "watch-min-interval-seconds", 10,
+		"10 by default. With --watch, the least time between the start of two jobs, which limits the rate of jobs when the source changes constantly.")
+
+	syncCmd.PersistentFlags().BoolVar(&raw.watchPoll, "watch-poll", false,
+		"False by default. With --watch, poll the source for changes instead of relying on inotify, e.g. for network file systems, which don't report changes made by other machines.")
+
+	syncCmd.PersistentFlags().Float64Var(&raw.watchPollIntervalSeconds, "watch-poll-interval-seconds", 30,
+		"30 by default. With --watch, how often the source is scanned for changes when it is polled.")
+
 	syncCmd.PersistentFlags().BoolVar(&raw.dryrun, "dry-run", false,
 		"False by default. Prints the path of files that would be copied or removed by the sync command. "+
 			"\n This flag does not copy or remove the actual files.")
@@ -990,7 +1418,18 @@ func init() {
 
 	syncCmd.PersistentFlags().StringVar(&raw.compareHash, "compare-hash", "None",
 		"Inform sync to rely on hashes as an alternative to LMT. "+
-			"\n Missing hashes at a remote source will throw an error. (None, MD5) Default: None")
+			"\n Missing hashes at a remote source will throw an error. (None, MD5, CRC64, SHA256, XXHash64) Default: None"+
+			"\n MD5 is kept in the Content-MD5 property of remote objects; the others are kept in their metadata (e.g. azcopy_sha256), "+
+			"\n where sync records them when uploading. A remote source without one is compared by LMT, "+
+			"\n and a remote destination without one is overwritten, which records it for the next sync. "+
+			"\n CRC64 is the CRC-64 Azure Storage uses to validate transfers, and XXHash64 is the quickest to compute.")
+
+	syncCmd.PersistentFlags().StringVar(&raw.compareBy, "compare-by", common.ESyncCompareBy.Default().String(),
+		"Default by default. How sync tells whether a file present at both the source and the destination needs transferring. "+
+			"\n Available options: Default (the source is more recent, or, with --compare-hash, the hashes differ), Size (the sizes differ), "+
+			"\n LMTAndSize (the sizes differ, or the source is more recent), Checksum (the hashes differ, whatever the times; --compare-hash picks the hash, MD5 if none is given), "+
+			"\n MetadataAware (as Default, or the content headers or metadata differ; between remote locations only). "+
+			"\n Size and Checksum ignore times entirely, e.g. after restoring from a backup.")
 
 	syncCmd.PersistentFlags().StringVar(&common.LocalHashDir, "hash-meta-dir", "",
 		"When using `--local-hash-storage-mode=HiddenFiles` "+
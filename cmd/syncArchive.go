@@ -0,0 +1,140 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// the archive holds a folder per sync, named after the time it ran; there are no colons, since Azure Files doesn't allow them
+const syncArchiveTimeFormat = "2006-01-02T150405Z"
+
+// syncArchivePath is where the sync that ran at the given time archives the files it removes, relative to the root of the destination
+func syncArchivePath(prefix string, at time.Time) string {
+	return path.Join(prefix, at.UTC().Format(syncArchiveTimeFormat))
+}
+
+// cleanSyncArchivePrefix validates the archive prefix, which must be a path within the destination
+func cleanSyncArchivePrefix(prefix string) (string, error) {
+	cleaned := path.Clean(strings.ReplaceAll(prefix, `\`, "/"))
+	cleaned = strings.Trim(cleaned, "/")
+	if cleaned == "" || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") || path.IsAbs(prefix) {
+		return "", fmt.Errorf("the archive prefix '%s' must be a relative path within the destination", prefix)
+	}
+	return cleaned, nil
+}
+
+// archive moves an extra file into the archive, keeping its path relative to the root
+func (b *remoteResourceDeleter) archive(objectPath string, object StoredObject) error {
+	return b.archiver.movePath(objectPath, path.Join(b.rootPath, b.archivePath, object.relativePath))
+}
+
+// syncArchiveFilter keeps the archive, and everything in it, out of the sync,
+// so that archived files are neither compared nor archived again
+type syncArchiveFilter struct {
+	prefix string
+}
+
+func (f *syncArchiveFilter) DoesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *syncArchiveFilter) AppliesOnlyToFiles() bool {
+	return false
+}
+
+func (f *syncArchiveFilter) DoesPass(storedObject StoredObject) bool {
+	relativePath := strings.ReplaceAll(storedObject.relativePath, `\`, "/")
+	return relativePath != f.prefix && !strings.HasPrefix(relativePath, f.prefix+"/")
+}
+
+// syncArchiveExpired tells whether an object in the archive belongs to a folder older than the cutoff.
+// Objects that aren't in a folder named by syncArchivePath are never pruned.
+func syncArchiveExpired(relativePath string, cutoff time.Time) bool {
+	folder, _, _ := strings.Cut(strings.ReplaceAll(relativePath, `\`, "/"), "/")
+	archivedAt, err := time.Parse(syncArchiveTimeFormat, folder)
+	if err != nil {
+		return false
+	}
+	return archivedAt.Before(cutoff)
+}
+
+// pruneSyncArchive deletes the folders of the archive that are older than the retention period
+func pruneSyncArchive(ctx context.Context, cca *cookedSyncCmdArgs, credInfo common.CredentialInfo, client *common.ServiceClient) error {
+	archiveURL, err := url.Parse(cca.destination.Value)
+	if err != nil {
+		return err
+	}
+	archiveURL.Path = common.GenerateFullPath(archiveURL.Path, cca.archivePrefix)
+	archiveRoot := cca.destination.CloneWithValue(archiveURL.String())
+
+	location := cca.fromTo.To()
+	traverser, err := InitResourceTraverser(archiveRoot, location, ctx, InitResourceTraverserOptions{
+		Credential:        &credInfo,
+		TrailingDotOption: cca.trailingDot,
+		Recursive:         true,
+	})
+	if err != nil {
+		return err
+	}
+
+	// folders are deleted once everything in them is
+	fpo := common.EFolderPropertiesOption.AllFoldersExceptRoot()
+	if location == common.ELocation.Blob() {
+		fpo = common.EFolderPropertiesOption.NoFolders()
+	}
+
+	rawURL, err := archiveRoot.FullURL()
+	if err != nil {
+		return err
+	}
+	deleter, err := newRemoteResourceDeleter(ctx, client, rawURL, location, fpo, cca.forceIfReadOnly)
+	if err != nil {
+		return err
+	}
+	pruner := newInteractiveDeleteProcessor(deleter.delete, common.EDeleteDestination.True(), location.String(), archiveRoot, nil, cca.dryrunMode)
+
+	cutoff := cca.archiveTime.Add(-cca.archiveRetention)
+	err = traverser.Traverse(noPreProccessor, func(object StoredObject) error {
+		if !syncArchiveExpired(object.relativePath, cutoff) {
+			return nil
+		}
+		return pruner.removeImmediately(object)
+	}, nil)
+
+	// there's nothing to prune before the first archive
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,732 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// A bidirectional sync decides, path by path, which way to copy or delete by comparing both sides with a baseline:
+// what the last bidirectional sync between the same source and destination left on either side.
+// Baselines are kept alongside snapshots, in the same format (see syncSnapshot.go), with one record per path
+// holding the state of both sides, and a trailer recording when the sync that wrote them finished.
+const syncBaselineMagic = "azcopy-sync-baseline-v1\n"
+
+const (
+	syncStatusCopiedToDestination    = "copied to the destination"
+	syncStatusCopiedToSource         = "copied to the source"
+	syncStatusDeletedFromDestination = "deleted from the destination"
+	syncStatusDeletedFromSource      = "deleted from the source"
+	syncStatusConflict               = "left as it is"
+
+	syncReasonUnchanged                  = "neither side has changed since the last sync"
+	syncReasonNewAtSource                = "it is new at the source"
+	syncReasonNewAtDestination           = "it is new at the destination"
+	syncReasonSourceChanged              = "the source has changed since the last sync"
+	syncReasonDestinationChanged         = "the destination has changed since the last sync"
+	syncReasonSourceDeleted              = "the source has deleted it since the last sync"
+	syncReasonDestinationDeleted         = "the destination has deleted it since the last sync"
+	syncReasonBothDeleted                = "neither side has it any more"
+	syncReasonSameChange                 = "both sides have changed it the same way"
+	syncReasonConflict                   = "both sides have changed it since the last sync"
+	syncReasonConflictSourceNewer        = "both sides have changed it since the last sync, and the source's version is newer"
+	syncReasonConflictDestinationNewer   = "both sides have changed it since the last sync, and the destination's version is newer"
+	syncReasonConflictChangedOverDeleted = "one side has deleted it since the last sync, but the other has changed it"
+)
+
+// syncBaselineState tells what the last sync knew of one side of a path
+type syncBaselineState uint8
+
+const (
+	syncBaselineAbsent  syncBaselineState = iota // the path didn't exist on this side
+	syncBaselineListed                           // the object was listed as recorded
+	syncBaselineWritten                          // the sync copied the recorded object to this side, but couldn't list it there afterwards
+)
+
+type syncBaselineSide struct {
+	state  syncBaselineState
+	object StoredObject
+}
+
+func listedSyncBaselineSide(object *StoredObject) syncBaselineSide {
+	if object == nil {
+		return syncBaselineSide{}
+	}
+	return syncBaselineSide{state: syncBaselineListed, object: *object}
+}
+
+func writtenSyncBaselineSide(object *StoredObject) syncBaselineSide {
+	return syncBaselineSide{state: syncBaselineWritten, object: *object}
+}
+
+// changed tells whether current, the object now on this side (nil if there is none), differs from what the baseline recorded.
+// An object the last sync wrote counts as changed once it was modified after that sync finished, unless its hash shows otherwise.
+func (b syncBaselineSide) changed(current *StoredObject, writtenBy time.Time, preferSMBTime bool) bool {
+	switch {
+	case b.state == syncBaselineAbsent:
+		return current != nil
+	case current == nil:
+		return true
+	case current.entityType != b.object.entityType:
+		return true
+	case current.entityType == common.EEntityType.Folder():
+		return false // only whether folders exist is synced both ways
+	case current.size != b.object.size:
+		return true
+	case current.md5 != nil && b.object.md5 != nil:
+		return !bytes.Equal(current.md5, b.object.md5)
+	case b.state == syncBaselineWritten:
+		return current.lastModified(preferSMBTime).After(writtenBy)
+	default:
+		changed, _ := compareWithSnapshot(*current, b.object)
+		return changed
+	}
+}
+
+type syncBaselineEntry struct {
+	source      syncBaselineSide
+	destination syncBaselineSide
+}
+
+func (e syncBaselineEntry) isEmpty() bool {
+	return e.source.state == syncBaselineAbsent && e.destination.state == syncBaselineAbsent
+}
+
+// syncBaseline holds the entries of a baseline by path, lower-cased if either side is case-insensitive
+type syncBaseline struct {
+	entries map[string]syncBaselineEntry
+
+	// the time by which the sync that wrote the baseline had finished
+	writtenBy time.Time
+}
+
+func newSyncBaseline() *syncBaseline {
+	return &syncBaseline{entries: make(map[string]syncBaselineEntry)}
+}
+
+// take removes the entry for key from the baseline, returning it
+func (b *syncBaseline) take(key string) syncBaselineEntry {
+	entry := b.entries[key]
+	delete(b.entries, key)
+	return entry
+}
+
+func syncBaselinePath(cca *cookedSyncCmdArgs) string {
+	return filepath.Join(common.AzcopyJobPlanFolder, syncSnapshotFolderName, syncStateKey(cca)+".baseline")
+}
+
+func appendSyncBaselineRecord(b []byte, relativePath string, entry syncBaselineEntry) []byte {
+	b = appendIndexString(b, relativePath)
+	for _, side := range []syncBaselineSide{entry.source, entry.destination} {
+		b = append(b, byte(side.state))
+		if side.state != syncBaselineAbsent {
+			b = appendSyncSnapshotState(b, side.object)
+		}
+	}
+	return b
+}
+
+func (r *indexRecordDecoder) syncBaselineSide(relativePath string) (side syncBaselineSide) {
+	side.state = syncBaselineState(r.byte())
+	if side.state > syncBaselineWritten && r.err == nil {
+		r.err = errCorruptIndexRecord
+	}
+	if side.state != syncBaselineAbsent {
+		side.object.relativePath = relativePath
+		side.object.name = path.Base(relativePath)
+		r.syncSnapshotState(&side.object)
+	}
+	return side
+}
+
+// loadSyncBaseline reads the baseline at path. As with snapshots, an error satisfying os.IsNotExist means
+// there is no baseline yet, and errSyncSnapshotSettingsChanged that it was taken with different settings.
+func loadSyncBaseline(path, fingerprint string, caseInsensitive bool) (*syncBaseline, error) {
+	file, reader, err := openSyncSnapshotReader(path, syncBaselineMagic, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	baseline := newSyncBaseline()
+	var record []byte
+	for {
+		record, err = readSyncSnapshotRecord(reader, record)
+		if err == io.EOF {
+			return nil, errCorruptSyncSnapshot // baselines are only kept once their trailer is written
+		} else if err != nil {
+			return nil, err
+		}
+
+		if len(record) == 0 {
+			// the trailer: an empty record, followed by one holding the time the sync finished
+			if record, err = readSyncSnapshotRecord(reader, record); err != nil {
+				return nil, errCorruptSyncSnapshot
+			}
+			r := &indexRecordDecoder{b: record}
+			baseline.writtenBy = r.time()
+			if r.err == nil && len(r.b) != 0 {
+				r.err = errCorruptIndexRecord
+			}
+			return baseline, r.err
+		}
+
+		r := &indexRecordDecoder{b: record}
+		relativePath := r.string()
+		entry := syncBaselineEntry{source: r.syncBaselineSide(relativePath)}
+		entry.destination = r.syncBaselineSide(relativePath)
+		if r.err == nil && len(r.b) != 0 {
+			r.err = errCorruptIndexRecord
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		if caseInsensitive {
+			relativePath = strings.ToLower(relativePath)
+		}
+		baseline.entries[relativePath] = entry
+	}
+}
+
+// syncBaselineWriter records the baseline for the next bidirectional sync
+type syncBaselineWriter struct {
+	*syncSnapshotWriter
+
+	// settle records the entries that wait on the sync's transfers, once they are done
+	settle func() error
+}
+
+func newSyncBaselineWriter(path, fingerprint string, jobID common.JobID) (*syncBaselineWriter, error) {
+	w, err := newSyncRecordWriter(path, syncBaselineMagic+fingerprint+"\n", jobID)
+	if err != nil {
+		return nil, err
+	}
+	return &syncBaselineWriter{syncSnapshotWriter: w}, nil
+}
+
+func (w *syncBaselineWriter) addEntry(relativePath string, entry syncBaselineEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || w.err != nil {
+		return
+	}
+
+	w.record = appendSyncBaselineRecord(w.record[:0], relativePath, entry)
+	w.writeRecord(w.record)
+}
+
+// commitAt replaces the previous baseline, once the sync has finished at writtenBy.
+// The previous baseline is kept if the entries waiting on the transfers can't be settled.
+func (w *syncBaselineWriter) commitAt(writtenBy time.Time) error {
+	if w.settle != nil {
+		if err := w.settle(); err != nil {
+			w.discard()
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	if !w.closed && w.err == nil {
+		w.writeRecord(nil)
+		w.writeRecord(appendIndexTime(nil, writtenBy))
+	}
+	w.mu.Unlock()
+
+	return w.commit()
+}
+
+type syncBidirectionalAction uint8
+
+const (
+	syncActionNone syncBidirectionalAction = iota
+	syncActionCopyToDestination
+	syncActionCopyToSource
+	syncActionDeleteFromDestination
+	syncActionDeleteFromSource
+	syncActionKeepBoth
+	syncActionConflict
+)
+
+// decideSyncAction works out what to do with a path from how each side has changed since the baseline.
+// A side that has changed wins over one that hasn't; when both have, the paths conflict, unless they changed the same way.
+func decideSyncAction(source, destination *StoredObject, baseline syncBaselineEntry, writtenBy time.Time, preferSMBTime bool) (syncBidirectionalAction, string) {
+	sourceChanged := baseline.source.changed(source, writtenBy, preferSMBTime)
+	destinationChanged := baseline.destination.changed(destination, writtenBy, preferSMBTime)
+
+	switch {
+	case !sourceChanged && !destinationChanged:
+		return syncActionNone, syncReasonUnchanged
+	case !destinationChanged:
+		if source != nil {
+			return syncActionCopyToDestination, common.Iff(baseline.source.state == syncBaselineAbsent, syncReasonNewAtSource, syncReasonSourceChanged)
+		} else if destination != nil {
+			return syncActionDeleteFromDestination, syncReasonSourceDeleted
+		}
+		return syncActionNone, syncReasonBothDeleted
+	case !sourceChanged:
+		if destination != nil {
+			return syncActionCopyToSource, common.Iff(baseline.destination.state == syncBaselineAbsent, syncReasonNewAtDestination, syncReasonDestinationChanged)
+		} else if source != nil {
+			return syncActionDeleteFromSource, syncReasonDestinationDeleted
+		}
+		return syncActionNone, syncReasonBothDeleted
+	case source == nil && destination == nil:
+		return syncActionNone, syncReasonBothDeleted
+	case source != nil && destination != nil && haveSameSyncContent(*source, *destination, preferSMBTime):
+		return syncActionNone, syncReasonSameChange
+	default:
+		return syncActionConflict, syncReasonConflict
+	}
+}
+
+// haveSameSyncContent tells whether two objects can be taken to hold the same content, going by their hashes if both have one
+func haveSameSyncContent(a, b StoredObject, preferSMBTime bool) bool {
+	switch {
+	case a.entityType != b.entityType:
+		return false
+	case a.entityType == common.EEntityType.Folder():
+		return true
+	case a.size != b.size:
+		return false
+	case a.md5 != nil && b.md5 != nil:
+		return bytes.Equal(a.md5, b.md5)
+	default:
+		return a.lastModified(preferSMBTime).Equal(b.lastModified(preferSMBTime))
+	}
+}
+
+// resolveSyncConflict applies the conflict policy to a path changed on both sides.
+// Whatever the policy, a file isn't replaced by a folder, or the other way around.
+func resolveSyncConflict(policy common.SyncConflictPolicy, source, destination *StoredObject, preferSMBTime bool) (syncBidirectionalAction, string) {
+	switch {
+	case policy == common.ESyncConflictPolicy.Report():
+		return syncActionConflict, syncReasonConflict
+	case destination == nil:
+		return syncActionCopyToDestination, syncReasonConflictChangedOverDeleted
+	case source == nil:
+		return syncActionCopyToSource, syncReasonConflictChangedOverDeleted
+	case source.entityType != destination.entityType:
+		return syncActionConflict, syncReasonConflict
+	case policy == common.ESyncConflictPolicy.KeepBoth():
+		return syncActionKeepBoth, syncReasonConflict
+	case destination.isMoreRecentThan(*source, preferSMBTime):
+		return syncActionCopyToSource, syncReasonConflictDestinationNewer
+	default:
+		return syncActionCopyToDestination, syncReasonConflictSourceNewer
+	}
+}
+
+// syncConflictName is the name the local version of a conflicting file is kept under, e.g. dir/report.conflict-20240102-030405.docx
+func syncConflictName(relativePath string, at time.Time) string {
+	dir, base := path.Split(relativePath)
+	ext := path.Ext(base)
+	return dir + strings.TrimSuffix(base, ext) + ".conflict-" + at.UTC().Format("20060102-150405") + ext
+}
+
+// syncBidirectionalComparator builds on the source comparator: the destination is indexed first, and the source is compared
+// against the index. Each path is then decided by how both sides have changed since the baseline, and may be copied or deleted
+// either way. Whatever is left in the index once the source has been traversed only exists at the destination.
+type syncBidirectionalComparator struct {
+	*syncSourceComparator
+
+	// transfers to the source go in a job of their own, going the other way
+	copyToSource objectProcessor
+
+	// the objects copied to either side, as listed at the other. Once the transfers are done, the side they went to is listed again,
+	// so that the baseline holds the times and ETags that side gave them, rather than comparing them with this machine's clock.
+	writtenToDestination *objectIndexer
+	writtenToSource      *objectIndexer
+	relist               func(atSource bool) (ResourceTraverser, error)
+
+	deleteFromDestination objectProcessor
+	deleteFromSource      objectProcessor
+
+	baseline     *syncBaseline
+	nextBaseline *syncBaselineWriter // nil when nothing is to be recorded, as in a dry run
+	policy       common.SyncConflictPolicy
+
+	// keeping both versions of a file means renaming its local version, which may be at either side
+	localRoot     string
+	sourceIsLocal bool
+	dryrunMode    bool
+	keepBoth      []syncBaselineEntry // the conflicts to keep both versions of, once traversal is over and renaming is safe
+
+	conflicts uint32
+}
+
+func (f *syncBidirectionalComparator) key(relativePath string) string {
+	if f.destinationIndex.isDestinationCaseInsensitive {
+		return strings.ToLower(relativePath)
+	}
+	return relativePath
+}
+
+func (f *syncBidirectionalComparator) processIfNecessary(sourceObject StoredObject) error {
+	key := f.key(sourceObject.relativePath)
+	destinationObject, present, err := f.destinationIndex.lookup(key)
+	if err != nil {
+		return err
+	}
+	if !present {
+		return f.reconcile(key, &sourceObject, nil)
+	}
+
+	if err = f.destinationIndex.remove(key); err != nil {
+		return err
+	}
+	return f.reconcile(key, &sourceObject, &destinationObject)
+}
+
+// processDestinationOnly handles what is left in the index once the source has been traversed
+func (f *syncBidirectionalComparator) processDestinationOnly(destinationObject StoredObject) error {
+	return f.reconcile(f.key(destinationObject.relativePath), nil, &destinationObject)
+}
+
+func (f *syncBidirectionalComparator) recordBaseline(relativePath string, entry syncBaselineEntry) {
+	if f.nextBaseline != nil && !entry.isEmpty() {
+		f.nextBaseline.addEntry(relativePath, entry)
+	}
+}
+
+// recordWritten notes that object, listed at one side, is copied to the other, to be recorded in the baseline once it is there
+func (f *syncBidirectionalComparator) recordWritten(toSource bool, object StoredObject) error {
+	if f.nextBaseline == nil {
+		return nil
+	}
+	return common.Iff(toSource, f.writtenToSource, f.writtenToDestination).store(object)
+}
+
+// settleBaseline records the objects the sync copied, each with the object it was copied from and the one the other side now lists.
+// An object that isn't listed any more is recorded as written, and counts as changed if it is modified after the sync finished.
+func (f *syncBidirectionalComparator) settleBaseline() (err error) {
+	defer func() {
+		if closeErr := f.closeWritten(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	for _, atSource := range []bool{false, true} {
+		written := common.Iff(atSource, f.writtenToSource, f.writtenToDestination)
+		if written.counter == 0 {
+			continue
+		}
+		entry := func(copied, listed syncBaselineSide) syncBaselineEntry {
+			if atSource {
+				return syncBaselineEntry{source: listed, destination: copied}
+			}
+			return syncBaselineEntry{source: copied, destination: listed}
+		}
+
+		traverser, err := f.relist(atSource)
+		if err != nil {
+			return err
+		}
+		err = traverser.Traverse(noPreProccessor, func(object StoredObject) error {
+			key := f.key(object.relativePath)
+			copied, present, err := written.lookup(key)
+			if err != nil || !present {
+				return err
+			}
+			f.recordBaseline(copied.relativePath, entry(listedSyncBaselineSide(&copied), listedSyncBaselineSide(&object)))
+			return written.remove(key)
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to list the %s again: %w", common.Iff(atSource, "source", "destination"), err)
+		}
+
+		err = written.traverse(func(copied StoredObject) error {
+			f.recordBaseline(copied.relativePath, entry(listedSyncBaselineSide(&copied), writtenSyncBaselineSide(&copied)))
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeWritten releases the record of the objects copied, removing it from disk if it was moved there
+func (f *syncBidirectionalComparator) closeWritten() error {
+	err := f.writtenToDestination.close()
+	if closeErr := f.writtenToSource.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (f *syncBidirectionalComparator) reconcile(key string, source, destination *StoredObject) error {
+	baseline := f.baseline.take(key)
+	action, reason := decideSyncAction(source, destination, baseline, f.baseline.writtenBy, f.preferSMBTime)
+	if action == syncActionConflict {
+		action, reason = resolveSyncConflict(f.policy, source, destination, f.preferSMBTime)
+	}
+
+	relativePath := common.Iff(source != nil, source, destination).relativePath
+	switch action {
+	case syncActionCopyToDestination:
+		syncComparatorLog(relativePath, syncStatusCopiedToDestination, reason, false)
+		if err := f.recordWritten(false, *source); err != nil {
+			return err
+		}
+		return f.copyTransferScheduler(*source)
+	case syncActionCopyToSource:
+		syncComparatorLog(relativePath, syncStatusCopiedToSource, reason, false)
+		if err := f.recordWritten(true, *destination); err != nil {
+			return err
+		}
+		return f.copyToSource(*destination)
+	case syncActionDeleteFromDestination:
+		// recorded as it was, so that a deletion the user declines doesn't bring the object back next time
+		f.recordBaseline(relativePath, syncBaselineEntry{destination: listedSyncBaselineSide(destination)})
+		return f.deleteFromDestination(*destination)
+	case syncActionDeleteFromSource:
+		f.recordBaseline(relativePath, syncBaselineEntry{source: listedSyncBaselineSide(source)})
+		return f.deleteFromSource(*source)
+	case syncActionKeepBoth:
+		f.keepBoth = append(f.keepBoth, syncBaselineEntry{listedSyncBaselineSide(source), listedSyncBaselineSide(destination)})
+		return nil
+	case syncActionConflict:
+		f.reportConflict(relativePath, reason, baseline)
+		return nil
+	default:
+		syncComparatorLog(relativePath, syncStatusSkipped, reason, false)
+		f.recordBaseline(relativePath, syncBaselineEntry{listedSyncBaselineSide(source), listedSyncBaselineSide(destination)})
+		return nil
+	}
+}
+
+// reportConflict leaves a conflicting path as it is, keeping its old baseline so that it still conflicts next time
+func (f *syncBidirectionalComparator) reportConflict(relativePath, reason string, baseline syncBaselineEntry) {
+	atomic.AddUint32(&f.conflicts, 1)
+	syncComparatorLog(relativePath, syncStatusConflict, reason, true)
+	f.recordBaseline(relativePath, baseline)
+}
+
+// resolveKeepBoth renames the local version of each conflicting file to its conflict name, and sends it to the remote side,
+// from which the remote version comes to take its place
+func (f *syncBidirectionalComparator) resolveKeepBoth(now time.Time) error {
+	for _, conflict := range f.keepBoth {
+		source, destination := conflict.source.object, conflict.destination.object
+		local := common.Iff(f.sourceIsLocal, source, destination)
+
+		renamed := local
+		renamed.relativePath = syncConflictName(local.relativePath, now)
+		renamed.name = path.Base(renamed.relativePath)
+		if err := f.renameLocal(local.relativePath, renamed.relativePath); err != nil {
+			f.reportConflict(local.relativePath, fmt.Sprintf("%s, and the local version couldn't be renamed: %v", syncReasonConflict, err), syncBaselineEntry{})
+			continue
+		}
+		syncComparatorLog(local.relativePath, syncStatusCopiedToDestination+" and "+syncStatusCopiedToSource,
+			fmt.Sprintf("%s; the local version was kept as %s", syncReasonConflict, renamed.relativePath), false)
+
+		// the renamed local version goes to the remote side, and the remote version comes to the local side
+		if err := f.recordWritten(!f.sourceIsLocal, renamed); err != nil {
+			return err
+		}
+		if err := f.recordWritten(f.sourceIsLocal, common.Iff(f.sourceIsLocal, destination, source)); err != nil {
+			return err
+		}
+
+		var err error
+		if f.sourceIsLocal {
+			if err = f.copyTransferScheduler(renamed); err == nil {
+				err = f.copyToSource(destination)
+			}
+		} else {
+			if err = f.copyToSource(renamed); err == nil {
+				err = f.copyTransferScheduler(source)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	f.keepBoth = nil
+	return nil
+}
+
+func (f *syncBidirectionalComparator) renameLocal(from, to string) error {
+	fromPath, toPath := common.GenerateFullPath(f.localRoot, from), common.GenerateFullPath(f.localRoot, to)
+	if f.dryrunMode {
+		glcm.Dryrun(func(format common.OutputFormat) string {
+			return fmt.Sprintf("DRYRUN: rename %v to %v", fromPath, toPath)
+		})
+		return nil
+	}
+
+	if _, err := os.Lstat(toPath); err == nil {
+		return fmt.Errorf("%s already exists", toPath)
+	}
+	return os.Rename(fromPath, toPath)
+}
+
+func (f *syncBidirectionalComparator) reportConflicts() {
+	if n := atomic.LoadUint32(&f.conflicts); n > 0 {
+		msg := fmt.Sprintf("%d paths have changed at both the source and the destination since the last sync, and were left as they are. "+
+			"They are listed in the scanning log; choose a --conflict-policy other than %s to settle them.", n, common.ESyncConflictPolicy.Report())
+		glcm.Warn(msg)
+		common.LogToJobLogWithPrefix(msg, common.LogWarning)
+	}
+}
+
+// newBidirectionalDeleteProcessor deletes from either side of a bidirectional sync
+func newBidirectionalDeleteProcessor(cca *cookedSyncCmdArgs, fpo common.FolderPropertyOption, root common.ResourceString, location common.Location, client *common.ServiceClient) (*interactiveDeleteProcessor, error) {
+	if location == common.ELocation.Local() {
+		return newSyncLocalDeleteProcessorAt(cca, fpo, root), nil
+	}
+	return newSyncDeleteProcessorAt(cca, fpo, root, location, client)
+}
+
+// newBidirectionalSyncEnumerator sets up a sync that goes both ways. The destination is indexed first, as for downloads and S2S;
+// transfers to the destination are scheduled by forward as usual, and those to the source go in a job of their own,
+// which can then be resumed with credentials for its own source, the sync's destination. relist lists either side again.
+func newBidirectionalSyncEnumerator(cca *cookedSyncCmdArgs, sourceTraverser, destinationTraverser ResourceTraverser,
+	relist func(atSource bool) (ResourceTraverser, error), indexer *objectIndexer, filters []ObjectFilter, copyJobTemplate *common.CopyJobPartOrderRequest, forward *copyTransferProcessor, sourceIsDir bool) (*syncEnumerator, error) {
+	if !sourceIsDir {
+		return nil, errors.New("bidirectional sync is only supported between directories")
+	}
+
+	reverseFromTo := common.FromToValue(cca.fromTo.To(), cca.fromTo.From())
+	indexer.isDestinationCaseInsensitive = IsDestinationCaseInsensitive(cca.fromTo) || IsDestinationCaseInsensitive(reverseFromTo)
+
+	baselinePath, fingerprint := syncBaselinePath(cca), syncSnapshotFingerprint(cca)
+	baseline, err := loadSyncBaseline(baselinePath, fingerprint, indexer.isDestinationCaseInsensitive)
+	switch {
+	case err == nil:
+	case os.IsNotExist(err):
+		logSyncSnapshotMessage(cca, "There is no baseline from an earlier bidirectional sync, so files that differ between the source and the destination are conflicts.")
+	case errors.Is(err, errSyncSnapshotSettingsChanged):
+		logSyncSnapshotMessage(cca, "The filters or options of the sync have changed since the last bidirectional sync, so its baseline is ignored, and files that differ between the source and the destination are conflicts.")
+	default:
+		msg := fmt.Sprintf("The baseline of the last bidirectional sync can't be read, so files that differ between the source and the destination are conflicts: %v", err)
+		glcm.Warn(msg)
+		common.LogToJobLogWithPrefix(msg, common.LogWarning)
+	}
+	if baseline == nil {
+		baseline = newSyncBaseline()
+	}
+
+	// the transfers to the source make up a job of their own, going the other way
+	reverseFpo, _ := NewFolderPropertyOption(reverseFromTo, cca.recursive, !cca.includeRoot, filters, cca.preserveInfo, cca.preservePermissions.IsTruthy(), false, false, cca.includeDirectoryStubs)
+	reverseTemplate := *copyJobTemplate
+	reverseTemplate.FromTo = reverseFromTo
+	reverseTemplate.Fpo = reverseFpo
+	reverseTemplate.SourceRoot, reverseTemplate.DestinationRoot = copyJobTemplate.DestinationRoot, copyJobTemplate.SourceRoot
+	reverseTemplate.SrcServiceClient, reverseTemplate.DstServiceClient = copyJobTemplate.DstServiceClient, copyJobTemplate.SrcServiceClient
+	reverseTemplate.JobID = common.NewJobID()
+	reverseTemplate.PartNum = 0
+	reverseTemplate.IsFinalPart = false
+	reverseTemplate.Transfers = common.Transfers{}
+	cca.reverseJobID = reverseTemplate.JobID
+	reportReverseJobOrdered := func(jobStarted bool) {
+		if jobStarted {
+			cca.setReverseJobOrdered()
+			glcm.Info(fmt.Sprintf("Files are copied to the source by job %s.", cca.reverseJobID))
+		}
+	}
+	reverse := newCopyTransferProcessor(&reverseTemplate, forward.numOfTransfersPerPart, cca.destination, cca.source,
+		reportReverseJobOrdered, forward.reportFinalPartDispatched, cca.preserveAccessTier, cca.dryrunMode)
+
+	// either job may be the only one, so the sync only follows the job to the destination once it has started
+	forward.reportFirstPartDispatched = func(jobStarted bool) {
+		if jobStarted {
+			cca.setFirstPartOrdered()
+		}
+	}
+
+	deleteFromDestination, err := newBidirectionalDeleteProcessor(cca, copyJobTemplate.Fpo, cca.destination, cca.fromTo.To(), copyJobTemplate.DstServiceClient)
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate destination cleaner due to: %s", err.Error())
+	}
+	deleteFromSource, err := newBidirectionalDeleteProcessor(cca, reverseFpo, cca.source, cca.fromTo.From(), copyJobTemplate.SrcServiceClient)
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate source cleaner due to: %s", err.Error())
+	}
+	deleteFromSource.missingFromToDisplay, deleteFromSource.deleteFromToDisplay = "the destination", "the source"
+
+	comparator := &syncBidirectionalComparator{
+		syncSourceComparator:  newSyncSourceComparator(indexer, forward.scheduleCopyTransfer, cca.compareHash, cca.preserveInfo, false, false),
+		copyToSource:          reverse.scheduleCopyTransfer,
+		writtenToDestination:  newSpillingObjectIndexer(indexer.spillThreshold, filepath.Join(common.AzcopyJobPlanFolder, cca.jobID.String()+"-sync-written-destination")),
+		writtenToSource:       newSpillingObjectIndexer(indexer.spillThreshold, filepath.Join(common.AzcopyJobPlanFolder, cca.jobID.String()+"-sync-written-source")),
+		relist:                relist,
+		deleteFromDestination: newFpoAwareProcessor(copyJobTemplate.Fpo, deleteFromDestination.removeImmediately),
+		deleteFromSource:      newFpoAwareProcessor(reverseFpo, deleteFromSource.removeImmediately),
+		baseline:              baseline,
+		policy:                cca.conflictPolicy,
+		localRoot:             common.Iff(cca.fromTo.From() == common.ELocation.Local(), cca.source, cca.destination).ValueLocal(),
+		sourceIsLocal:         cca.fromTo.From() == common.ELocation.Local(),
+		dryrunMode:            cca.dryrunMode,
+	}
+
+	if !cca.dryrunMode {
+		if cca.baseline, err = newSyncBaselineWriter(baselinePath, fingerprint, cca.jobID); err != nil {
+			return nil, fmt.Errorf("unable to record the baseline for the next bidirectional sync: %w", err)
+		}
+		glcm.RegisterCloseFunc(cca.baseline.discard)
+		glcm.RegisterCloseFunc(func() { _ = comparator.closeWritten() })
+		comparator.nextBaseline = cca.baseline
+		cca.baseline.settle = comparator.settleBaseline
+	}
+	comparator.writtenToDestination.isDestinationCaseInsensitive = indexer.isDestinationCaseInsensitive
+	comparator.writtenToSource.isDestinationCaseInsensitive = indexer.isDestinationCaseInsensitive
+
+	finalize := func() (err error) {
+		// whatever is left in the index only exists at the destination
+		if err = indexer.traverse(comparator.processDestinationOnly, nil); err != nil {
+			return err
+		}
+		if err = comparator.resolveKeepBoth(time.Now()); err != nil {
+			return err
+		}
+		comparator.reportConflicts()
+
+		forwardInitiated, err := forward.dispatchFinalPart()
+		if err != nil && err != NothingScheduledError {
+			return err
+		}
+		reverseInitiated, err := reverse.dispatchFinalPart()
+		// sync cleanly exits if nothing is scheduled either way.
+		if err != nil && err != NothingScheduledError {
+			return err
+		}
+
+		quitIfInSync(forwardInitiated || reverseInitiated, cca.getDeletionCount() > 0, cca)
+		cca.setScanningComplete()
+		return nil
+	}
+
+	return newSyncEnumerator(destinationTraverser, sourceTraverser, indexer, filters, comparator.processIfNecessary, finalize), nil
+}
@@ -21,6 +21,7 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/Azure/azure-storage-azcopy/v10/common"
 	"reflect"
@@ -35,10 +36,27 @@ const (
 	syncOverwriteReasonNewerHash              = "the source has a differing hash"
 	syncOverwriteReasonNewerLMT               = "the source is more recent than the destination"
 	syncOverwriteReasonNewerLMTAndMissingHash = "the source lacks an associated hash (please upload with --put-md5 for hash comparison) and is more recent than the destination"
+	syncSkipReasonSameETag                    = "the source has the same ETag as when it was last synced"
+	syncOverwriteReasonNewerETag              = "the source has a different ETag than when it was last synced"
+	syncOverwriteReasonDifferentSize          = "the source has a different size than the destination"
+	syncOverwriteReasonMissingValidators      = "the source has neither an ETag nor a Last-Modified time to compare"
+	syncSkipReasonUnchangedSinceSnapshot      = "the source is unchanged since the last sync"
+	syncOverwriteReasonChangedSinceSnapshot   = "the source has changed since the last sync"
+	syncSkipReasonSameSize                    = "the source has the same size as the destination, and times are not compared"
+	syncSkipReasonSameSizeAndTime             = "the source has the same size as the destination, and is not more recent"
+	syncOverwriteReasonMissingHashNoTime      = "the source or the destination lacks an associated hash, and times are not compared"
+	syncOverwriteReasonDifferentProperties    = "the source has different content headers or metadata than the destination"
+	syncOverwriteReasonMirror                 = "mirror mode overwrites the destination without comparing"
 	syncStatusSkipped                         = "skipped"
 	syncStatusOverwritten                     = "overwritten"
 )
 
+// logSyncComparison logs the decision made about a file present at both the source and the destination, and adds it to the diff report, if any
+func logSyncComparison(report *syncDiffReport, source, destination StoredObject, status, reason string) {
+	syncComparatorLog(source.relativePath, status, reason, false)
+	report.compared(status, reason, source, destination)
+}
+
 func syncComparatorLog(fileName, status, skipReason string, stdout bool) {
 	out := fmt.Sprintf("File %s was %s because %s", fileName, status, skipReason)
 
@@ -68,10 +86,14 @@ type syncDestinationComparator struct {
 
 	preferSMBTime     bool
 	disableComparison bool
+	etagSource        bool // compare by the ETag, size and time a web server, S3 or Google Cloud Storage reports, rather than by time alone
+	fromSnapshot      bool // the objects indexed come from the snapshot of the last sync, rather than from the destination
+	compareBy         common.SyncCompareBy
+	diffReport        *syncDiffReport // if set, records the decision about each file present on both sides
 }
 
-func newSyncDestinationComparator(i *objectIndexer, copyScheduler, cleaner objectProcessor, comparisonHashType common.SyncHashType, preferSMBTime, disableComparison bool) *syncDestinationComparator {
-	return &syncDestinationComparator{sourceIndex: i, copyTransferScheduler: copyScheduler, destinationCleaner: cleaner, preferSMBTime: preferSMBTime, disableComparison: disableComparison, comparisonHashType: comparisonHashType}
+func newSyncDestinationComparator(i *objectIndexer, copyScheduler, cleaner objectProcessor, comparisonHashType common.SyncHashType, preferSMBTime, disableComparison, etagSource bool) *syncDestinationComparator {
+	return &syncDestinationComparator{sourceIndex: i, copyTransferScheduler: copyScheduler, destinationCleaner: cleaner, preferSMBTime: preferSMBTime, disableComparison: disableComparison, comparisonHashType: comparisonHashType, etagSource: etagSource}
 }
 
 // it will only schedule transfers for destination objects that are present in the indexer but stale compared to the entry in the map
@@ -80,54 +102,85 @@ func newSyncDestinationComparator(i *objectIndexer, copyScheduler, cleaner objec
 // if file x from the destination exists at the source, then we'd only transfer it if it is considered stale compared to its counterpart at the source
 // if file x does not exist at the source, then it is considered extra, and will be deleted
 func (f *syncDestinationComparator) processIfNecessary(destinationObject StoredObject) error {
-	sourceObjectInMap, present := f.sourceIndex.indexMap[destinationObject.relativePath]
-	if !present && f.sourceIndex.isDestinationCaseInsensitive {
+	sourceObjectInMap, present, err := f.sourceIndex.lookup(destinationObject.relativePath)
+	if err == nil && !present && f.sourceIndex.isDestinationCaseInsensitive {
 		lcRelativePath := strings.ToLower(destinationObject.relativePath)
-		sourceObjectInMap, present = f.sourceIndex.indexMap[lcRelativePath]
+		sourceObjectInMap, present, err = f.sourceIndex.lookup(lcRelativePath)
+	}
+	if err != nil {
+		return err
 	}
 
 	// if the destinationObject is present at source and stale, we transfer the up-to-date version from source
 	if present {
-		defer delete(f.sourceIndex.indexMap, destinationObject.relativePath)
+		if err = f.sourceIndex.remove(destinationObject.relativePath); err != nil {
+			return err
+		}
+
+		if f.fromSnapshot {
+			if transfer, reason := compareWithSnapshot(sourceObjectInMap, destinationObject); transfer {
+				logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusOverwritten, reason)
+				return f.copyTransferScheduler(sourceObjectInMap)
+			} else {
+				logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusSkipped, reason)
+				return nil
+			}
+		}
 
 		if f.disableComparison {
 			syncComparatorLog(sourceObjectInMap.relativePath, syncStatusOverwritten, syncOverwriteReasonNewerHash, false)
+			f.diffReport.compared(syncStatusOverwritten, syncOverwriteReasonMirror, sourceObjectInMap, destinationObject)
 			return f.copyTransferScheduler(sourceObjectInMap)
 		}
 
-		if f.comparisonHashType != common.ESyncHashType.None() && sourceObjectInMap.entityType == common.EEntityType.File() {
-			switch f.comparisonHashType {
-			case common.ESyncHashType.MD5():
-				if sourceObjectInMap.md5 == nil {
-					if sourceObjectInMap.isMoreRecentThan(destinationObject, f.preferSMBTime) {
-						syncComparatorLog(sourceObjectInMap.relativePath, syncStatusOverwritten, syncOverwriteReasonNewerLMTAndMissingHash, false)
-						return f.copyTransferScheduler(sourceObjectInMap)
-					} else {
-						// skip if dest is more recent
-						syncComparatorLog(sourceObjectInMap.relativePath, syncStatusSkipped, syncSkipReasonTimeAndMissingHash, false)
-						return nil
-					}
+		if f.compareBy != common.ESyncCompareBy.Default() && sourceObjectInMap.entityType == common.EEntityType.File() {
+			if decided, transfer, reason := compareByStrategy(f.compareBy, f.comparisonHashType, sourceObjectInMap, destinationObject, f.preferSMBTime); decided {
+				if transfer {
+					logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusOverwritten, reason)
+					return f.copyTransferScheduler(sourceObjectInMap)
 				}
+				logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusSkipped, reason)
+				return nil
+			}
+		}
 
-				if !reflect.DeepEqual(sourceObjectInMap.md5, destinationObject.md5) {
-					syncComparatorLog(sourceObjectInMap.relativePath, syncStatusOverwritten, syncOverwriteReasonNewerHash, false)
-
-					// hash inequality = source "newer" in this model.
+		if f.comparisonHashType != common.ESyncHashType.None() && sourceObjectInMap.entityType == common.EEntityType.File() {
+			sourceHash := sourceObjectInMap.syncHash(f.comparisonHashType)
+			if sourceHash == nil {
+				if sourceObjectInMap.isMoreRecentThan(destinationObject, f.preferSMBTime) {
+					logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusOverwritten, syncOverwriteReasonNewerLMTAndMissingHash)
 					return f.copyTransferScheduler(sourceObjectInMap)
+				} else {
+					// skip if dest is more recent
+					logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusSkipped, syncSkipReasonTimeAndMissingHash)
+					return nil
 				}
-			default:
-				panic("sanity check: unsupported hash type " + f.comparisonHashType.String())
 			}
 
-			syncComparatorLog(sourceObjectInMap.relativePath, syncStatusSkipped, syncSkipReasonSameHash, false)
+			if !reflect.DeepEqual(sourceHash, destinationObject.syncHash(f.comparisonHashType)) {
+				logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusOverwritten, syncOverwriteReasonNewerHash)
+
+				// hash inequality = source "newer" in this model.
+				return f.copyTransferScheduler(sourceObjectInMap)
+			}
+
+			logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusSkipped, syncSkipReasonSameHash)
 			return nil
+		} else if f.etagSource && sourceObjectInMap.entityType == common.EEntityType.File() {
+			if transfer, reason := compareSourceETag(sourceObjectInMap, destinationObject); transfer {
+				logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusOverwritten, reason)
+				return f.copyTransferScheduler(sourceObjectInMap)
+			} else {
+				logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusSkipped, reason)
+				return nil
+			}
 		} else if sourceObjectInMap.isMoreRecentThan(destinationObject, f.preferSMBTime) {
-			syncComparatorLog(sourceObjectInMap.relativePath, syncStatusOverwritten, syncOverwriteReasonNewerLMT, false)
+			logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusOverwritten, syncOverwriteReasonNewerLMT)
 			return f.copyTransferScheduler(sourceObjectInMap)
 		}
 
 		// skip if dest is more recent
-		syncComparatorLog(sourceObjectInMap.relativePath, syncStatusSkipped, syncSkipReasonTime, false)
+		logSyncComparison(f.diffReport, sourceObjectInMap, destinationObject, syncStatusSkipped, syncSkipReasonTime)
 	} else {
 		// purposefully ignore the error from destinationCleaner
 		// it's a tolerable error, since it just means some extra destination object might hang around a bit longer
@@ -144,6 +197,9 @@ type syncSourceComparator struct {
 	// the processor responsible for scheduling copy transfers
 	copyTransferScheduler objectProcessor
 
+	// if set, receives the source objects that don't exist at the destination, instead of the copyTransferScheduler
+	newObjectScheduler objectProcessor
+
 	// storing the destination objects
 	destinationIndex *objectIndexer
 
@@ -151,10 +207,15 @@ type syncSourceComparator struct {
 
 	preferSMBTime     bool
 	disableComparison bool
+	etagSource        bool // compare by the ETag, size and time a web server, S3 or Google Cloud Storage reports, rather than by time alone
+	fromSnapshot      bool // the objects indexed come from the snapshot of the last sync, rather than from the destination
+	compareBy         common.SyncCompareBy
+	diffReport        *syncDiffReport // if set, records the decision about each file present on both sides
+	rename            *renameRules    // if set, each source object is compared with the destination object at the path it is renamed to
 }
 
-func newSyncSourceComparator(i *objectIndexer, copyScheduler objectProcessor, comparisonHashType common.SyncHashType, preferSMBTime, disableComparison bool) *syncSourceComparator {
-	return &syncSourceComparator{destinationIndex: i, copyTransferScheduler: copyScheduler, preferSMBTime: preferSMBTime, disableComparison: disableComparison, comparisonHashType: comparisonHashType}
+func newSyncSourceComparator(i *objectIndexer, copyScheduler objectProcessor, comparisonHashType common.SyncHashType, preferSMBTime, disableComparison, etagSource bool) *syncSourceComparator {
+	return &syncSourceComparator{destinationIndex: i, copyTransferScheduler: copyScheduler, preferSMBTime: preferSMBTime, disableComparison: disableComparison, comparisonHashType: comparisonHashType, etagSource: etagSource}
 }
 
 // it will only transfer source items that are:
@@ -164,58 +225,193 @@ func newSyncSourceComparator(i *objectIndexer, copyScheduler objectProcessor, co
 // note: we remove the StoredObject if it is present so that when we have finished
 // the index will contain all objects which exist at the destination but were NOT seen at the source
 func (f *syncSourceComparator) processIfNecessary(sourceObject StoredObject) error {
-	relPath := sourceObject.relativePath
+	relPath, err := f.rename.destinationPath(sourceObject)
+	if err != nil {
+		return err
+	}
 
 	if f.destinationIndex.isDestinationCaseInsensitive {
 		relPath = strings.ToLower(relPath)
 	}
-	destinationObjectInMap, present := f.destinationIndex.indexMap[relPath]
+	destinationObjectInMap, present, err := f.destinationIndex.lookup(relPath)
+	if err != nil {
+		return err
+	}
 
 	if present {
-		defer delete(f.destinationIndex.indexMap, relPath)
+		// removed up front, so that the object can't be deleted from the destination by the finalizer
+		if err = f.destinationIndex.remove(relPath); err != nil {
+			return err
+		}
+
+		if f.fromSnapshot {
+			if transfer, reason := compareWithSnapshot(sourceObject, destinationObjectInMap); transfer {
+				logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusOverwritten, reason)
+				return f.copyTransferScheduler(sourceObject)
+			} else {
+				logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusSkipped, reason)
+				return nil
+			}
+		}
 
 		// if destination is stale, schedule source for transfer
 		if f.disableComparison {
 			syncComparatorLog(sourceObject.relativePath, syncStatusOverwritten, syncOverwriteReasonNewerHash, false)
+			f.diffReport.compared(syncStatusOverwritten, syncOverwriteReasonMirror, sourceObject, destinationObjectInMap)
 			return f.copyTransferScheduler(sourceObject)
 		}
 
-		if f.comparisonHashType != common.ESyncHashType.None() && sourceObject.entityType == common.EEntityType.File() {
-			switch f.comparisonHashType {
-			case common.ESyncHashType.MD5():
-				if sourceObject.md5 == nil {
-					if sourceObject.isMoreRecentThan(destinationObjectInMap, f.preferSMBTime) {
-						syncComparatorLog(sourceObject.relativePath, syncStatusOverwritten, syncOverwriteReasonNewerLMTAndMissingHash, false)
-						return f.copyTransferScheduler(sourceObject)
-					} else {
-						// skip if dest is more recent
-						syncComparatorLog(sourceObject.relativePath, syncStatusSkipped, syncSkipReasonTimeAndMissingHash, false)
-						return nil
-					}
+		if f.compareBy != common.ESyncCompareBy.Default() && sourceObject.entityType == common.EEntityType.File() {
+			if decided, transfer, reason := compareByStrategy(f.compareBy, f.comparisonHashType, sourceObject, destinationObjectInMap, f.preferSMBTime); decided {
+				if transfer {
+					logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusOverwritten, reason)
+					return f.copyTransferScheduler(sourceObject)
 				}
+				logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusSkipped, reason)
+				return nil
+			}
+		}
 
-				if !reflect.DeepEqual(sourceObject.md5, destinationObjectInMap.md5) {
-					// hash inequality = source "newer" in this model.
-					syncComparatorLog(sourceObject.relativePath, syncStatusOverwritten, syncOverwriteReasonNewerHash, false)
+		if f.comparisonHashType != common.ESyncHashType.None() && sourceObject.entityType == common.EEntityType.File() {
+			sourceHash := sourceObject.syncHash(f.comparisonHashType)
+			if sourceHash == nil {
+				if sourceObject.isMoreRecentThan(destinationObjectInMap, f.preferSMBTime) {
+					logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusOverwritten, syncOverwriteReasonNewerLMTAndMissingHash)
 					return f.copyTransferScheduler(sourceObject)
+				} else {
+					// skip if dest is more recent
+					logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusSkipped, syncSkipReasonTimeAndMissingHash)
+					return nil
 				}
-			default:
-				panic("sanity check: unsupported hash type " + f.comparisonHashType.String())
 			}
 
-			syncComparatorLog(sourceObject.relativePath, syncStatusSkipped, syncSkipReasonSameHash, false)
+			if !reflect.DeepEqual(sourceHash, destinationObjectInMap.syncHash(f.comparisonHashType)) {
+				// hash inequality = source "newer" in this model.
+				logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusOverwritten, syncOverwriteReasonNewerHash)
+				return f.copyTransferScheduler(sourceObject)
+			}
+
+			logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusSkipped, syncSkipReasonSameHash)
 			return nil
+		} else if f.etagSource && sourceObject.entityType == common.EEntityType.File() {
+			if transfer, reason := compareSourceETag(sourceObject, destinationObjectInMap); transfer {
+				logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusOverwritten, reason)
+				return f.copyTransferScheduler(sourceObject)
+			} else {
+				logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusSkipped, reason)
+				return nil
+			}
 		} else if sourceObject.isMoreRecentThan(destinationObjectInMap, f.preferSMBTime) {
 			// if destination is stale, schedule source
-			syncComparatorLog(sourceObject.relativePath, syncStatusOverwritten, syncOverwriteReasonNewerLMT, false)
+			logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusOverwritten, syncOverwriteReasonNewerLMT)
 			return f.copyTransferScheduler(sourceObject)
 		}
 
 		// skip if dest is more recent
-		syncComparatorLog(sourceObject.relativePath, syncStatusSkipped, syncSkipReasonTime, false)
+		logSyncComparison(f.diffReport, sourceObject, destinationObjectInMap, syncStatusSkipped, syncSkipReasonTime)
 		return nil
 	}
 
 	// if source does not exist at the destination, then schedule it for transfer
+	if f.newObjectScheduler != nil {
+		return f.newObjectScheduler(sourceObject)
+	}
 	return f.copyTransferScheduler(sourceObject)
 }
+
+// compareSourceETag decides whether a file served over HTTP or WebDAV differs from its copy at the destination, much as wget -N does.
+// Files of different sizes always differ. Otherwise, the ETag recorded when the file was last synced is compared, if there is one;
+// failing that, the source's Last-Modified time.
+func compareSourceETag(source, destination StoredObject) (transfer bool, reason string) {
+	if source.size != destination.size {
+		return true, syncOverwriteReasonDifferentSize
+	}
+
+	if recorded, ok := common.TryReadMetadata(destination.Metadata, common.SyncSourceETagMetadataKey); ok && recorded != nil && source.eTag != "" {
+		if *recorded == source.eTag {
+			return false, syncSkipReasonSameETag
+		}
+		return true, syncOverwriteReasonNewerETag
+	}
+
+	if source.lastModifiedTime.IsZero() {
+		return true, syncOverwriteReasonMissingValidators
+	}
+	if source.isMoreRecentThan(destination, false) {
+		return true, syncOverwriteReasonNewerLMT
+	}
+	return false, syncSkipReasonTime
+}
+
+// compareWithSnapshot decides whether a source object has changed since the last sync recorded it in its snapshot.
+// Any difference in size, last modified time, ETag or hash counts, since the destination was left holding the recorded version.
+func compareWithSnapshot(source, recorded StoredObject) (transfer bool, reason string) {
+	if source.entityType != recorded.entityType ||
+		source.size != recorded.size ||
+		!source.lastModifiedTime.Equal(recorded.lastModifiedTime) ||
+		!source.smbLastModifiedTime.Equal(recorded.smbLastModifiedTime) ||
+		(source.eTag != "" && recorded.eTag != "" && source.eTag != recorded.eTag) ||
+		(source.md5 != nil && recorded.md5 != nil && !reflect.DeepEqual(source.md5, recorded.md5)) {
+		return true, syncOverwriteReasonChangedSinceSnapshot
+	}
+	return false, syncSkipReasonUnchangedSinceSnapshot
+}
+
+// compareByStrategy applies a --compare-by strategy other than the default to a file present at both the source and the destination.
+// decided is false when the strategy leaves the rest to the default comparison, as MetadataAware does once the properties match.
+func compareByStrategy(compareBy common.SyncCompareBy, hashType common.SyncHashType, source, destination StoredObject, preferSMBTime bool) (decided, transfer bool, reason string) {
+	switch compareBy {
+	case common.ESyncCompareBy.Size():
+		if source.size != destination.size {
+			return true, true, syncOverwriteReasonDifferentSize
+		}
+		return true, false, syncSkipReasonSameSize
+	case common.ESyncCompareBy.LMTAndSize():
+		if source.size != destination.size {
+			return true, true, syncOverwriteReasonDifferentSize
+		} else if source.isMoreRecentThan(destination, preferSMBTime) {
+			return true, true, syncOverwriteReasonNewerLMT
+		}
+		return true, false, syncSkipReasonSameSizeAndTime
+	case common.ESyncCompareBy.Checksum():
+		sourceHash, destinationHash := source.syncHash(hashType), destination.syncHash(hashType)
+		switch {
+		case source.size != destination.size:
+			return true, true, syncOverwriteReasonDifferentSize
+		case len(sourceHash) == 0 || len(destinationHash) == 0:
+			// without both hashes, there is no telling whether the content is the same
+			return true, true, syncOverwriteReasonMissingHashNoTime
+		case !bytes.Equal(sourceHash, destinationHash):
+			return true, true, syncOverwriteReasonNewerHash
+		default:
+			return true, false, syncSkipReasonSameHash
+		}
+	case common.ESyncCompareBy.MetadataAware():
+		if !haveSameSyncProperties(source, destination) {
+			return true, true, syncOverwriteReasonDifferentProperties
+		}
+	}
+
+	return false, false, ""
+}
+
+// haveSameSyncProperties tells whether two objects have the same content headers and metadata.
+// Metadata keys are compared regardless of case, since services may change it, and the keys azcopy keeps for itself are ignored.
+func haveSameSyncProperties(a, b StoredObject) bool {
+	if a.contentType != b.contentType || a.contentEncoding != b.contentEncoding || a.contentLanguage != b.contentLanguage ||
+		a.contentDisposition != b.contentDisposition || a.cacheControl != b.cacheControl {
+		return false
+	}
+
+	comparableMetadata := func(metadata common.Metadata) map[string]string {
+		out := make(map[string]string, len(metadata))
+		for key, value := range metadata {
+			key = strings.ToLower(key)
+			if value != nil && !strings.HasPrefix(key, "azcopy_") {
+				out[key] = *value
+			}
+		}
+		return out
+	}
+	return reflect.DeepEqual(comparableMetadata(a.Metadata), comparableMetadata(b.Metadata))
+}
@@ -0,0 +1,260 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// the actions a diff report records for each path
+const (
+	syncDiffActionCreate    = "create"
+	syncDiffActionOverwrite = "overwrite"
+	syncDiffActionDelete    = "delete"
+	syncDiffActionSkip      = "skip"
+)
+
+const (
+	syncCreateReasonMissingAtDestination  = "the destination lacks the file"
+	syncDeleteReasonMissingAtSource       = "the source lacks the file"
+	syncSkipReasonMissingAtSourceNoDelete = "the source lacks the file, and delete-destination is false"
+	syncSkipReasonFiltered                = "the file is excluded by the filters"
+)
+
+// syncDiffObject describes one side of a compared path
+type syncDiffObject struct {
+	Size             int64
+	LastModifiedTime time.Time
+	Hash             string `json:",omitempty"` // base64, like the Content-MD5 header
+}
+
+// syncDiffRecord is a line of the diff report. Source or Destination is nil when the path is missing from that side.
+type syncDiffRecord struct {
+	Path        string
+	EntityType  string
+	Action      string
+	Reason      string
+	HashType    string
+	Source      *syncDiffObject
+	Destination *syncDiffObject
+}
+
+var syncDiffReportCSVHeader = []string{
+	"Path", "EntityType", "Action", "Reason", "HashType",
+	"SourceSize", "SourceLastModifiedTime", "SourceHash",
+	"DestinationSize", "DestinationLastModifiedTime", "DestinationHash",
+}
+
+// syncDiffReport writes what the sync decided for every path it compared, as JSON Lines, or as CSV if the file name ends with .csv.
+// Its methods do nothing on a nil report, so that the sync needn't check whether one was asked for.
+type syncDiffReport struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+	csv    *csv.Writer // nil for JSON Lines
+	err    error       // the first error writing the report
+
+	hashType          common.SyncHashType
+	preferSMBTime     bool
+	deleteDestination common.DeleteDestination
+}
+
+func newSyncDiffReport(path string, hashType common.SyncHashType, preferSMBTime bool, deleteDestination common.DeleteDestination) (*syncDiffReport, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// without a hash to compare by, the MD5 the services keep is reported
+	if hashType == common.ESyncHashType.None() {
+		hashType = common.ESyncHashType.MD5()
+	}
+
+	r := &syncDiffReport{file: file, writer: bufio.NewWriter(file), hashType: hashType, preferSMBTime: preferSMBTime, deleteDestination: deleteDestination}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		r.csv = csv.NewWriter(r.writer)
+		r.err = r.csv.Write(syncDiffReportCSVHeader)
+	}
+	return r, nil
+}
+
+func (r *syncDiffReport) describe(object *StoredObject) *syncDiffObject {
+	if object == nil {
+		return nil
+	}
+
+	described := &syncDiffObject{Size: object.size, LastModifiedTime: object.lastModified(r.preferSMBTime)}
+	if hash := object.syncHash(r.hashType); len(hash) > 0 {
+		described.Hash = base64.StdEncoding.EncodeToString(hash)
+	}
+	return described
+}
+
+// record adds a path to the report; source or destination is nil when the path is missing from that side
+func (r *syncDiffReport) record(action, reason string, source, destination *StoredObject) {
+	if r == nil {
+		return
+	}
+
+	object := source
+	if object == nil {
+		object = destination
+	}
+	record := syncDiffRecord{
+		Path:        object.relativePath,
+		EntityType:  object.entityType.String(),
+		Action:      action,
+		Reason:      reason,
+		HashType:    r.hashType.String(),
+		Source:      r.describe(source),
+		Destination: r.describe(destination),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+
+	if r.csv != nil {
+		row := []string{record.Path, record.EntityType, record.Action, record.Reason, record.HashType}
+		for _, side := range []*syncDiffObject{record.Source, record.Destination} {
+			if side == nil {
+				row = append(row, "", "", "")
+			} else {
+				row = append(row, strconv.FormatInt(side.Size, 10), side.LastModifiedTime.UTC().Format(time.RFC3339Nano), side.Hash)
+			}
+		}
+		r.err = r.csv.Write(row)
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err == nil {
+		line = append(line, '\n')
+		_, err = r.writer.Write(line)
+	}
+	r.err = err
+}
+
+// compared records the decision about a path present at both the source and the destination
+func (r *syncDiffReport) compared(status, reason string, source, destination StoredObject) {
+	r.record(common.Iff(status == syncStatusOverwritten, syncDiffActionOverwrite, syncDiffActionSkip), reason, &source, &destination)
+}
+
+// creations records the paths missing at the destination on their way to the processor that schedules their transfer
+func (r *syncDiffReport) creations(next objectProcessor) objectProcessor {
+	if r == nil {
+		return next
+	}
+	return func(object StoredObject) error {
+		r.record(syncDiffActionCreate, syncCreateReasonMissingAtDestination, &object, nil)
+		return next(object)
+	}
+}
+
+// deletions records the paths missing at the source on their way to the processor that removes them from the destination
+func (r *syncDiffReport) deletions(next objectProcessor) objectProcessor {
+	if r == nil {
+		return next
+	}
+	return func(object StoredObject) error {
+		if r.deleteDestination == common.EDeleteDestination.False() {
+			r.record(syncDiffActionSkip, syncSkipReasonMissingAtSourceNoDelete, nil, &object)
+		} else {
+			r.record(syncDiffActionDelete, syncDeleteReasonMissingAtSource, nil, &object)
+		}
+		return next(object)
+	}
+}
+
+// close flushes the report, returning the first error met writing it
+func (r *syncDiffReport) close() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return r.err
+	}
+
+	if r.csv != nil && r.err == nil {
+		r.csv.Flush()
+		r.err = r.csv.Error()
+	}
+	if err := r.writer.Flush(); r.err == nil {
+		r.err = err
+	}
+	if err := r.file.Close(); r.err == nil {
+		r.err = err
+	}
+	r.file = nil
+	return r.err
+}
+
+// syncDiffReportFilterer passes the filters on to the traverser, each wrapped so that the paths it excludes are reported.
+// The wrapped filters don't offer a prefix to list by, since the paths such a prefix would leave unlisted are to be reported too
+type syncDiffReportFilterer struct {
+	ResourceTraverser
+	report   *syncDiffReport
+	isSource bool
+}
+
+func (t *syncDiffReportFilterer) Traverse(preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	reportingFilters := make([]ObjectFilter, len(filters))
+	for i, filter := range filters {
+		reportingFilters[i] = &syncDiffReportingFilter{ObjectFilter: filter, report: t.report, isSource: t.isSource}
+	}
+	return t.ResourceTraverser.Traverse(preprocessor, processor, reportingFilters)
+}
+
+// syncDiffReportingFilter reports the objects its filter excludes
+type syncDiffReportingFilter struct {
+	ObjectFilter
+	report   *syncDiffReport
+	isSource bool
+}
+
+func (f *syncDiffReportingFilter) DoesPass(object StoredObject) bool {
+	if f.ObjectFilter.DoesPass(object) {
+		return true
+	}
+
+	if f.isSource {
+		f.report.record(syncDiffActionSkip, syncSkipReasonFiltered, &object, nil)
+	} else {
+		f.report.record(syncDiffActionSkip, syncSkipReasonFiltered, nil, &object)
+	}
+	return false
+}
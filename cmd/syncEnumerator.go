@@ -24,6 +24,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync/atomic"
@@ -57,14 +59,28 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		}
 	}
 
+	if cca.fromTo.IsS2S() && (cca.fromTo.From() == common.ELocation.Http() || cca.fromTo.From() == common.ELocation.WebDAV()) {
+		if err = checkNoHTTPSourceCredentialForS2S(cca.source.Value); err != nil {
+			return nil, err
+		}
+	}
+
 	includeDirStubs := (cca.fromTo.From().SupportsHnsACLs() && cca.fromTo.To().SupportsHnsACLs() && cca.preservePermissions.IsTruthy()) || cca.includeDirectoryStubs
 
 	// TODO: enable symlink support in a future release after evaluating the implications
 	// TODO: Consider passing an errorChannel so that enumeration errors during sync can be conveyed to the caller.
 	// GetProperties is enabled by default as sync supports both upload and download.
 	// This property only supports Files and S3 at the moment, but provided that Files sync is coming soon, enable to avoid stepping on Files sync work
+	// uploads leave out what .azcopyignore files exclude, as git leaves out what .gitignore files do
+	var ignore *azcopyIgnore
+	if cca.fromTo.From() == common.ELocation.Local() {
+		if ignore, err = newUploadIgnore(cca.source.ValueLocal(), cca.ignoreFile); err != nil {
+			return nil, err
+		}
+	}
+
 	dest := cca.fromTo.To()
-	sourceTraverser, err := InitResourceTraverser(cca.source, cca.fromTo.From(), ctx, InitResourceTraverserOptions{
+	sourceOptions := InitResourceTraverserOptions{
 		DestResourceType: &dest,
 
 		Credential: &srcCredInfo,
@@ -92,8 +108,10 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		IncludeDirectoryStubs:   includeDirStubs,
 		PreserveBlobTags:        cca.s2sPreserveBlobTags,
 		HardlinkHandling:        cca.hardlinks,
-	})
 
+		Ignore: ignore,
+	}
+	sourceTraverser, err := InitResourceTraverser(cca.source, cca.fromTo.From(), ctx, sourceOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -108,7 +126,7 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 	// TODO: enable symlink support in a future release after evaluating the implications
 	// GetProperties is enabled by default as sync supports both upload and download.
 	// This property only supports Files and S3 at the moment, but provided that Files sync is coming soon, enable to avoid stepping on Files sync work
-	destinationTraverser, err := InitResourceTraverser(cca.destination, cca.fromTo.To(), ctx, InitResourceTraverserOptions{
+	destinationOptions := InitResourceTraverserOptions{
 		Credential: &dstCredInfo,
 		IncrementEnumeration: func(entityType common.EntityType) {
 			if entityType == common.EEntityType.File() {
@@ -127,7 +145,9 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		IncludeDirectoryStubs:   includeDirStubs,
 		PreserveBlobTags:        cca.s2sPreserveBlobTags,
 		HardlinkHandling:        common.EHardlinkHandlingType.Follow(),
-	})
+		ReadSyncSourceETags:     isSyncETagSource(cca.fromTo.From()) && dest == common.ELocation.Local(),
+	}
+	destinationTraverser, err := InitResourceTraverser(cca.destination, cca.fromTo.To(), ctx, destinationOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -195,6 +215,22 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 	filters = append(filters, buildRegexFilters(cca.includeRegex, true)...)
 	filters = append(filters, buildRegexFilters(cca.excludeRegex, false)...)
 
+	// the source's traverser already leaves out the ignored paths; as a filter, the rules keep them out of the
+	// comparison at the destination too, so that they aren't deleted there
+	if ignore != nil {
+		filters = append(filters, ignore)
+	}
+
+	if cca.archivePrefix != "" {
+		filters = append(filters, &syncArchiveFilter{prefix: cca.archivePrefix})
+	}
+
+	// the size and properties of a file are only judged at the source, and the files at the destination whose counterparts they exclude are left alone
+	sharedFilters := filters
+	sourceOnlyFilters := buildSizeFilters(cca.includeSizeMin, cca.includeSizeMax)
+	sourceOnlyFilters = append(sourceOnlyFilters, buildExpressionFilters(cca.filterExpression)...)
+	filters = append(filters, sourceOnlyFilters...)
+
 	// after making all filters, log any search prefix computed from them
 	if prefixFilter := FilterSet(filters).GetEnumerationPreFilter(cca.recursive); prefixFilter != "" {
 		common.LogToJobLogWithPrefix("Search prefix, which may be used to optimize scanning, is: "+prefixFilter, common.LogInfo) // "May be used" because we don't know here which enumerators will use it
@@ -243,6 +279,7 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		S2SInvalidMetadataHandleOption: common.EInvalidMetadataHandleOption.RenameIfInvalid(),
 		CpkOptions:                     cca.cpkOptions,
 		S2SPreserveBlobTags:            cca.s2sPreserveBlobTags,
+		SyncHashType:                   cca.compareHash,
 
 		S2SSourceCredentialType: cca.s2sSourceCredentialType,
 		FileAttributes: common.FileTransferAttributes{
@@ -312,19 +349,130 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		return nil, err
 	}
 
+	if cca.archivePrefix != "" && cca.archiveRetention > 0 {
+		// a failure to prune is no reason not to sync
+		if err := pruneSyncArchive(ctx, cca, dstCredInfo, copyJobTemplate.DstServiceClient); err != nil {
+			msg := fmt.Sprintf("unable to prune the archive of deleted files: %v", err)
+			glcm.Warn(msg)
+			common.LogToJobLogWithPrefix(msg, common.LogWarning)
+		}
+	}
+
 	transferScheduler := newSyncTransferProcessor(cca, NumOfFilesPerDispatchJobPart, fpo, copyJobTemplate)
 
+	// Web and WebDAV servers offer nothing but an ETag to tell whether a file has changed, so it's recorded on the destination for the next sync to compare.
+	// S3 and Google Cloud Storage report ETags too, which tell a changed object apart more reliably than the time it was copied to the destination.
+	etagSource := isSyncETagSource(cca.fromTo.From())
+	scheduleCopyTransfer := transferScheduler.scheduleCopyTransfer
+	if etagSource {
+		scheduleCopyTransfer = recordSyncSourceETag(scheduleCopyTransfer)
+	}
+
+	// the diff report lists what the sync decides for every path, including those the filters exclude
+	if cca.diffReportPath != "" {
+		cca.diffReport, err = newSyncDiffReport(cca.diffReportPath, cca.compareHash, cca.preserveInfo, cca.deleteDestination)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the diff report: %w", err)
+		}
+		glcm.RegisterCloseFunc(func() { _ = cca.diffReport.close() })
+		sourceTraverser = &syncDiffReportFilterer{ResourceTraverser: sourceTraverser, report: cca.diffReport, isSource: true}
+	}
+
+	// an incremental sync compares the source with what the last one recorded, rather than with a listing of the destination
+	fromSnapshot := false
+	if cca.incremental {
+		snapshotPath := syncSnapshotPath(cca)
+		fingerprint := syncSnapshotFingerprint(cca)
+
+		snapshotTraverser, err := openSyncSnapshot(snapshotPath, fingerprint, destinationTraverser)
+		switch {
+		case err == nil:
+			destinationTraverser = snapshotTraverser
+			fromSnapshot = true
+			logSyncSnapshotMessage(cca, "Comparing the source with the snapshot of the last sync, instead of listing the destination.")
+		case os.IsNotExist(err):
+			// the first incremental sync lists the destination, and records the snapshot for the next one
+		case errors.Is(err, errSyncSnapshotSettingsChanged):
+			logSyncSnapshotMessage(cca, "Listing the destination, since the filters or options of the sync have changed since the last snapshot was taken.")
+		default:
+			msg := fmt.Sprintf("Listing the destination, since the snapshot of the last sync can't be read: %v", err)
+			glcm.Warn(msg)
+			common.LogToJobLogWithPrefix(msg, common.LogWarning)
+		}
+
+		if !cca.dryrunMode {
+			cca.snapshot, err = newSyncSnapshotWriter(snapshotPath, fingerprint, cca.jobID)
+			if err != nil {
+				return nil, fmt.Errorf("unable to record the snapshot for the next incremental sync: %w", err)
+			}
+			glcm.RegisterCloseFunc(cca.snapshot.discard)
+			sourceTraverser = &syncSnapshotRecorder{ResourceTraverser: sourceTraverser, snapshot: cca.snapshot}
+		}
+	}
+
+	if cca.diffReport != nil {
+		destinationTraverser = &syncDiffReportFilterer{ResourceTraverser: destinationTraverser, report: cca.diffReport}
+	}
+
 	// set up the comparator so that the source/destination can be compared
-	indexer := newObjectIndexer()
+	// the index of whichever side is enumerated first moves to disk, alongside the job's plan files, if it gets too large for memory
+	spillThreshold, err := syncIndexSpillThreshold()
+	if err != nil {
+		return nil, err
+	}
+	indexer := newSpillingObjectIndexer(spillThreshold, filepath.Join(common.AzcopyJobPlanFolder, cca.jobID.String()+"-sync-index"))
+
+	// so do the destinations given to renamed files, which are checked for collisions
+	if cca.rename != nil {
+		cca.rename.spillAt(spillThreshold, filepath.Join(common.AzcopyJobPlanFolder, cca.jobID.String()+"-renames"))
+		glcm.RegisterCloseFunc(func() { _ = cca.rename.reset() })
+	}
+
+	if cca.bidirectional {
+		// once the transfers are done, a side they went to is listed again, without adding to the files scanned
+		relist := func(atSource bool) (ResourceTraverser, error) {
+			if atSource {
+				options := sourceOptions
+				options.IncrementEnumeration = nil
+				return InitResourceTraverser(cca.source, cca.fromTo.From(), ctx, options)
+			}
+			options := destinationOptions
+			options.IncrementEnumeration = nil
+			return InitResourceTraverser(cca.destination, cca.fromTo.To(), ctx, options)
+		}
+		return newBidirectionalSyncEnumerator(cca, sourceTraverser, destinationTraverser, relist, indexer, filters, copyJobTemplate, transferScheduler, sourceIsDir)
+	}
+
+	// the jobs that follow the sync in watch mode schedule transfers and deletions in the same way
+	if cca.watcher != nil {
+		if err = cca.watcher.setUpJobs(cca, copyJobTemplate, filters, fpo); err != nil {
+			return nil, fmt.Errorf("unable to set up the watch due to: %s", err.Error())
+		}
+	}
+
+	// past here, the filters are applied to both sides, and those judged only at the source are applied by its traverser
+	var sourceFilterer *syncSourceFilterer
+	if len(sourceOnlyFilters) > 0 {
+		sourceFilterer = newSyncSourceFilterer(sourceTraverser, sourceOnlyFilters, cca.rename, IsDestinationCaseInsensitive(cca.fromTo),
+			spillThreshold, filepath.Join(common.AzcopyJobPlanFolder, cca.jobID.String()+"-sync-excluded"))
+		sourceTraverser = sourceFilterer
+		filters = sharedFilters
+	}
+
 	var comparator objectProcessor
 	var finalize func() error
 
 	switch cca.fromTo {
-	case common.EFromTo.LocalBlob(), common.EFromTo.LocalFile(), common.EFromTo.LocalFileNFS():
+	case common.EFromTo.LocalBlob(), common.EFromTo.LocalFile(), common.EFromTo.LocalFileNFS(), common.EFromTo.LocalWebDAV():
 		// Upload implies transferring from a local disk to a remote resource.
 		// In this scenario, the local disk (source) is scanned/indexed first because it is assumed that local file systems will be faster to enumerate than remote resources
 		// Then the destination is scanned and filtered based on what the destination contains
-		destinationCleaner, err := newSyncDeleteProcessor(cca, fpo, copyJobTemplate.DstServiceClient)
+		var destinationCleaner *interactiveDeleteProcessor
+		if cca.fromTo.To() == common.ELocation.WebDAV() {
+			destinationCleaner, err = newSyncWebDAVDeleteProcessor(cca, fpo, copyJobTemplate.DstServiceClient)
+		} else {
+			destinationCleaner, err = newSyncDeleteProcessor(cca, fpo, copyJobTemplate.DstServiceClient)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("unable to instantiate destination cleaner due to: %s", err.Error())
 		}
@@ -333,22 +481,56 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		// when uploading, we can delete remote objects immediately, because as we traverse the remote location
 		// we ALREADY have available a complete map of everything that exists locally
 		// so as soon as we see a remote destination object we can know whether it exists in the local source
-
-		comparator = newSyncDestinationComparator(indexer, transferScheduler.scheduleCopyTransfer, destCleanerFunc, cca.compareHash, cca.preserveInfo, cca.mirrorMode).processIfNecessary
+		// unless moves are detected, in which case the deletions wait until the files that were moved at the source have been moved at the destination
+		destCleanerFunc = cca.diffReport.deletions(destCleanerFunc)
+		scheduleNewFile := transferScheduler.scheduleCopyTransfer
+		var moveDetector *syncMoveDetector
+		if cca.detectMoves {
+			mover, err := newSyncMover(cca, copyJobTemplate.DstServiceClient)
+			if err != nil {
+				return nil, fmt.Errorf("unable to instantiate destination mover due to: %s", err.Error())
+			}
+			moveDetector = newSyncMoveDetector(cca.compareHash, mover.move, transferScheduler.scheduleCopyTransfer, destCleanerFunc, cca.incrementMoveCount,
+				spillThreshold, filepath.Join(common.AzcopyJobPlanFolder, cca.jobID.String()+"-sync-moves"))
+			destCleanerFunc = moveDetector.deferDeletion
+			scheduleNewFile = moveDetector.moveOrTransfer
+		}
+		destCleanerFunc = sourceFilterer.keepExcluded(destCleanerFunc)
+
+		indexer.rename = cca.rename
+		destinationComparator := newSyncDestinationComparator(indexer, scheduleCopyTransfer, destCleanerFunc, cca.compareHash, cca.preserveInfo, cca.mirrorMode, etagSource)
+		destinationComparator.fromSnapshot = fromSnapshot
+		destinationComparator.compareBy = cca.compareBy
+		destinationComparator.diffReport = cca.diffReport
+		comparator = destinationComparator.processIfNecessary
 		finalize = func() error {
+			if err = sourceFilterer.close(); err != nil {
+				return err
+			}
+
 			// schedule every local file that doesn't exist at the destination
-			err = indexer.traverse(transferScheduler.scheduleCopyTransfer, filters)
+			err = indexer.traverse(cca.diffReport.creations(scheduleNewFile), filters)
 			if err != nil {
 				return err
 			}
 
+			if moveDetector != nil {
+				if err = moveDetector.finish(); err != nil {
+					return err
+				}
+			}
+
+			if err = cca.diffReport.close(); err != nil {
+				return fmt.Errorf("unable to write the diff report: %w", err)
+			}
+
 			jobInitiated, err := transferScheduler.dispatchFinalPart()
 			// sync cleanly exits if nothing is scheduled.
 			if err != nil && err != NothingScheduledError {
 				return err
 			}
 
-			quitIfInSync(jobInitiated, cca.getDeletionCount() > 0, cca)
+			quitIfInSync(jobInitiated, cca.getDeletionCount() > 0 || cca.getMoveCount() > 0, cca)
 			cca.setScanningComplete()
 			return nil
 		}
@@ -358,7 +540,27 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 		indexer.isDestinationCaseInsensitive = IsDestinationCaseInsensitive(cca.fromTo)
 		// in all other cases (download and S2S), the destination is scanned/indexed first
 		// then the source is scanned and filtered based on what the destination contains
-		comparator = newSyncSourceComparator(indexer, transferScheduler.scheduleCopyTransfer, cca.compareHash, cca.preserveInfo, cca.mirrorMode).processIfNecessary
+		sourceComparator := newSyncSourceComparator(indexer, scheduleCopyTransfer, cca.compareHash, cca.preserveInfo, cca.mirrorMode, etagSource)
+		sourceComparator.fromSnapshot = fromSnapshot
+		sourceComparator.compareBy = cca.compareBy
+		sourceComparator.diffReport = cca.diffReport
+		sourceComparator.rename = cca.rename
+		comparator = sourceComparator.processIfNecessary
+
+		// the files only at the source are held until the source has been listed, when the destination files it lacks are known,
+		// so that those moved at the source can be moved within the destination
+		newObjectScheduler := scheduleCopyTransfer
+		var moveDetector *syncMoveDetector
+		if cca.detectMoves {
+			mover, err := newSyncMover(cca, copyJobTemplate.DstServiceClient)
+			if err != nil {
+				return nil, fmt.Errorf("unable to instantiate destination mover due to: %s", err.Error())
+			}
+			moveDetector = newSyncMoveDetector(cca.compareHash, mover.move, scheduleCopyTransfer, nil, cca.incrementMoveCount,
+				spillThreshold, filepath.Join(common.AzcopyJobPlanFolder, cca.jobID.String()+"-sync-moves"))
+			newObjectScheduler = moveDetector.deferTransfer
+		}
+		sourceComparator.newObjectScheduler = cca.diffReport.creations(newObjectScheduler)
 
 		finalize = func() error {
 			// remove the extra files at the destination that were not present at the source
@@ -376,10 +578,28 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 				deleteScheduler = newFpoAwareProcessor(fpo, newSyncLocalDeleteProcessor(cca, fpo).removeImmediately)
 			}
 
-			err = indexer.traverse(deleteScheduler, nil)
+			if moveDetector != nil {
+				moveDetector.destinationCleaner = deleteScheduler
+				deleteScheduler = moveDetector.deferDeletion
+			}
+
+			err = indexer.traverse(sourceFilterer.keepExcluded(cca.diffReport.deletions(deleteScheduler)), nil)
 			if err != nil {
 				return err
 			}
+			if err = sourceFilterer.close(); err != nil {
+				return err
+			}
+
+			if moveDetector != nil {
+				if err = moveDetector.finish(); err != nil {
+					return err
+				}
+			}
+
+			if err = cca.diffReport.close(); err != nil {
+				return fmt.Errorf("unable to write the diff report: %w", err)
+			}
 
 			// let the deletions happen first
 			// otherwise if the final part is executed too quickly, we might quit before deletions could finish
@@ -389,7 +609,7 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 				return err
 			}
 
-			quitIfInSync(jobInitiated, cca.getDeletionCount() > 0, cca)
+			quitIfInSync(jobInitiated, cca.getDeletionCount() > 0 || cca.getMoveCount() > 0, cca)
 			cca.setScanningComplete()
 			return nil
 		}
@@ -398,6 +618,34 @@ func (cca *cookedSyncCmdArgs) initEnumerator(ctx context.Context) (enumerator *s
 	}
 }
 
+// isSyncETagSource tells whether sync compares the files of a source at location by their ETags, recording them at the destination
+func isSyncETagSource(location common.Location) bool {
+	switch location {
+	case common.ELocation.Http(), common.ELocation.WebDAV(), common.ELocation.S3(), common.ELocation.GCP():
+		return true
+	default:
+		return false
+	}
+}
+
+// recordSyncSourceETag asks for the ETag of each file to be recorded on the destination (as metadata, or alongside the hashes of local files),
+// so that the next sync can tell whether the file has changed at the source
+func recordSyncSourceETag(scheduleCopyTransfer objectProcessor) objectProcessor {
+	return func(object StoredObject) error {
+		if object.entityType == common.EEntityType.File() && object.eTag != "" {
+			metadata := make(common.Metadata, len(object.Metadata)+1)
+			for k, v := range object.Metadata {
+				metadata[k] = v
+			}
+			eTag := object.eTag
+			metadata[common.SyncSourceETagMetadataKey] = &eTag
+			object.Metadata = metadata
+		}
+
+		return scheduleCopyTransfer(object)
+	}
+}
+
 func IsDestinationCaseInsensitive(fromTo common.FromTo) bool {
 	if fromTo.IsDownload() && runtime.GOOS == "windows" {
 		return true
@@ -410,13 +658,15 @@ func IsDestinationCaseInsensitive(fromTo common.FromTo) bool {
 func quitIfInSync(transferJobInitiated, anyDestinationFileDeleted bool, cca *cookedSyncCmdArgs) {
 	if !transferJobInitiated && !anyDestinationFileDeleted {
 		cca.reportScanningProgress(glcm, 0)
-		glcm.Exit(func(format common.OutputFormat) string {
+		cca.commitSyncSnapshot()
+		cca.exitOrWatch(glcm, func(format common.OutputFormat) string {
 			return "The source and destination are already in sync."
 		}, common.EExitCode.Success())
 	} else if !transferJobInitiated && anyDestinationFileDeleted {
 		// some files were deleted but no transfer scheduled
 		cca.reportScanningProgress(glcm, 0)
-		glcm.Exit(func(format common.OutputFormat) string {
+		cca.commitSyncSnapshot()
+		cca.exitOrWatch(glcm, func(format common.OutputFormat) string {
 			return "The source and destination are now in sync."
 		}, common.EExitCode.Success())
 	}
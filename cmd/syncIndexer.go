@@ -21,7 +21,12 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
 )
 
 // the objectIndexer is essential for the generic sync enumerator to work
@@ -37,38 +42,139 @@ type objectIndexer struct {
 	// Apple File System (APFS) can be configured to be case-sensitive or case-insensitive.
 	// So for such locations, the key in the indexMap will be lowercase to avoid infinite syncing.
 	isDestinationCaseInsensitive bool
+
+	// if set, the objects are indexed by the paths the rename rules give them at the destination, so that they can be looked up by destination paths
+	rename *renameRules
+
+	// once more than spillThreshold objects are indexed, they move from indexMap to an index on disk, in spillDir.
+	// Zero means the index always stays in memory.
+	spillThreshold int
+	spillDir       string
+	spilled        *diskObjectIndex
 }
 
 func newObjectIndexer() *objectIndexer {
 	return &objectIndexer{indexMap: make(map[string]StoredObject)}
 }
 
+// newSpillingObjectIndexer returns an indexer that moves to disk, in spillDir, once it holds more than spillThreshold objects.
+// spillDir is created when needed, and removed by close.
+func newSpillingObjectIndexer(spillThreshold int, spillDir string) *objectIndexer {
+	i := newObjectIndexer()
+	i.spillThreshold, i.spillDir = spillThreshold, spillDir
+	return i
+}
+
+// syncIndexSpillThreshold returns the number of objects a sync indexes in memory, before moving its index to disk
+func syncIndexSpillThreshold() (int, error) {
+	envVar := common.EEnvironmentVariable.SyncIndexSpillThreshold()
+	value := common.GetEnvironmentVariable(envVar)
+	threshold, err := strconv.Atoi(value)
+	if err != nil || threshold < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number, but is %q", envVar.Name, value)
+	}
+	return threshold, nil
+}
+
 // process the given stored object by indexing it using its relative path
 func (i *objectIndexer) store(storedObject StoredObject) (err error) {
-	// TODO we might buffer too much data in memory, figure out whether we should limit the max number of files
-	// TODO previously we used 10M as the max, but it was proven to be too small for some users
-
 	// It is safe to index all StoredObjects just by relative path, regardless of their entity type, because
 	// no filesystem allows a file and a folder to have the exact same full path.  This is true of
 	// Linux file systems, Windows, Azure Files and ADLS Gen 2 (and logically should be true of all file systems).
+	key := storedObject.relativePath
+	if i.rename != nil {
+		if key, err = i.rename.destinationPath(storedObject); err != nil {
+			return err
+		}
+	}
 	if i.isDestinationCaseInsensitive {
-		lcRelativePath := strings.ToLower(storedObject.relativePath)
-		i.indexMap[lcRelativePath] = storedObject
+		key = strings.ToLower(key)
+	}
+
+	if i.spilled != nil {
+		err = i.spilled.put(key, storedObject)
 	} else {
-		i.indexMap[storedObject.relativePath] = storedObject
+		i.indexMap[key] = storedObject
+		if i.spillThreshold > 0 && len(i.indexMap) > i.spillThreshold {
+			err = i.spill()
+		}
 	}
+	if err != nil {
+		return err
+	}
+
 	i.counter += 1
 	return
 }
 
+// spill moves the index from memory to disk, where it stays until closed
+func (i *objectIndexer) spill() error {
+	index, err := newDiskObjectIndex(i.spillDir, diskObjectIndexInitialBuckets)
+	if err != nil {
+		return fmt.Errorf("failed to create the sync index on disk: %w", err)
+	}
+
+	for key, storedObject := range i.indexMap {
+		if err = index.put(key, storedObject); err != nil {
+			_ = index.close()
+			return fmt.Errorf("failed to move the sync index to disk: %w", err)
+		}
+	}
+
+	i.spilled, i.indexMap = index, make(map[string]StoredObject)
+	return nil
+}
+
+// lookup returns the object indexed under key, which the caller has lower-cased if the destination is case-insensitive
+func (i *objectIndexer) lookup(key string) (StoredObject, bool, error) {
+	if i.spilled != nil {
+		return i.spilled.get(key)
+	}
+
+	storedObject, present := i.indexMap[key]
+	return storedObject, present, nil
+}
+
+// remove takes the object indexed under key out of the index, so that traverse won't see it
+func (i *objectIndexer) remove(key string) error {
+	if i.spilled != nil {
+		return i.spilled.remove(key)
+	}
+
+	delete(i.indexMap, key)
+	return nil
+}
+
 // go through the remaining stored objects in the map to process them
 func (i *objectIndexer) traverse(processor objectProcessor, filters []ObjectFilter) (err error) {
-	for _, value := range i.indexMap {
-		err = processIfPassedFilters(filters, value, processor)
+	process := func(value StoredObject) error {
+		err := processIfPassedFilters(filters, value, processor)
 		_, err = getProcessingError(err)
-		if err != nil {
+		return err
+	}
+
+	if i.spilled != nil {
+		return i.spilled.traverse(process)
+	}
+
+	for _, value := range i.indexMap {
+		if err = process(value); err != nil {
 			return
 		}
 	}
 	return
 }
+
+// close releases the index, deleting it from disk if it was moved there
+func (i *objectIndexer) close() error {
+	if i.spilled == nil {
+		return nil
+	}
+
+	err := i.spilled.close()
+	i.spilled = nil
+	if removeErr := os.RemoveAll(i.spillDir); err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -0,0 +1,547 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/lease"
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+const (
+	diskObjectIndexInitialBuckets = 1 << 16
+	diskObjectIndexMaxLoad        = 4 // entries per bucket, on average, before the buckets double
+	diskObjectIndexEntrySize      = 32
+	diskObjectIndexBlockEntries   = 4096 // entries read at a time when rehashing or traversing
+)
+
+// diskObjectIndex is a hash table of StoredObjects kept on disk, for syncs with too many objects to index in memory.
+// Each object is appended to a data file, and gets a fixed-size entry in an entries file holding its place in the data file,
+// the hash of its key and the next entry in its hash chain. Only the first entry of each chain is kept in memory,
+// which comes to a couple of bytes per object, rather than the hundreds a StoredObject takes.
+// Removed objects are only marked as such; the files are deleted along with the index.
+type diskObjectIndex struct {
+	mu sync.Mutex
+
+	data       *os.File
+	dataWriter *bufio.Writer
+	dataSize   int64 // including whatever dataWriter holds
+
+	entries    *os.File
+	entryCount int64 // including removed entries
+	live       int
+
+	buckets []int64 // the first entry of each chain, plus one, so that zero marks an empty chain
+	seed    maphash.Seed
+}
+
+// diskObjectIndexEntry locates one object in the data file
+type diskObjectIndexEntry struct {
+	offset int64 // -1 once removed
+	hash   uint64
+	next   int64 // the next entry of the chain, plus one
+	length uint32
+}
+
+func (e *diskObjectIndexEntry) marshal(b []byte) {
+	binary.LittleEndian.PutUint64(b[0:], uint64(e.offset))
+	binary.LittleEndian.PutUint64(b[8:], e.hash)
+	binary.LittleEndian.PutUint64(b[16:], uint64(e.next))
+	binary.LittleEndian.PutUint32(b[24:], e.length)
+}
+
+func (e *diskObjectIndexEntry) unmarshal(b []byte) {
+	e.offset = int64(binary.LittleEndian.Uint64(b[0:]))
+	e.hash = binary.LittleEndian.Uint64(b[8:])
+	e.next = int64(binary.LittleEndian.Uint64(b[16:]))
+	e.length = binary.LittleEndian.Uint32(b[24:])
+}
+
+func newDiskObjectIndex(dir string, initialBuckets int) (*diskObjectIndex, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	data, err := os.OpenFile(filepath.Join(dir, "objects"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.OpenFile(filepath.Join(dir, "entries"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		_ = data.Close()
+		return nil, err
+	}
+
+	return &diskObjectIndex{
+		data:       data,
+		dataWriter: bufio.NewWriterSize(data, 1024*1024),
+		entries:    entries,
+		buckets:    make([]int64, initialBuckets),
+		seed:       maphash.MakeSeed(),
+	}, nil
+}
+
+func (d *diskObjectIndex) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.live
+}
+
+// put indexes storedObject under key, replacing whatever was indexed under it before
+func (d *diskObjectIndex) put(key string, storedObject StoredObject) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h := maphash.String(d.seed, key)
+	if index, entry, _, found, err := d.find(key, h); err != nil {
+		return err
+	} else if found {
+		if err = d.markRemoved(index, entry); err != nil {
+			return err
+		}
+	}
+
+	record := appendStoredObject(appendIndexString(nil, key), storedObject)
+	if _, err := d.dataWriter.Write(record); err != nil {
+		return err
+	}
+
+	bucket := h & uint64(len(d.buckets)-1)
+	entry := diskObjectIndexEntry{offset: d.dataSize, hash: h, next: d.buckets[bucket], length: uint32(len(record))}
+	if err := d.writeEntry(d.entryCount, entry); err != nil {
+		return err
+	}
+
+	d.buckets[bucket] = d.entryCount + 1
+	d.entryCount++
+	d.dataSize += int64(len(record))
+	d.live++
+
+	if d.entryCount > int64(len(d.buckets))*diskObjectIndexMaxLoad {
+		return d.grow()
+	}
+	return nil
+}
+
+func (d *diskObjectIndex) get(key string) (StoredObject, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, _, storedObject, found, err := d.find(key, maphash.String(d.seed, key))
+	return storedObject, found, err
+}
+
+func (d *diskObjectIndex) remove(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	index, entry, _, found, err := d.find(key, maphash.String(d.seed, key))
+	if err != nil || !found {
+		return err
+	}
+	return d.markRemoved(index, entry)
+}
+
+// find walks the chain of key's hash, reading only the objects whose hash matches
+func (d *diskObjectIndex) find(key string, h uint64) (index int64, entry diskObjectIndexEntry, storedObject StoredObject, found bool, err error) {
+	for next := d.buckets[h&uint64(len(d.buckets)-1)]; next != 0; next = entry.next {
+		index = next - 1
+		if entry, err = d.readEntry(index); err != nil {
+			return
+		}
+		if entry.offset < 0 || entry.hash != h {
+			continue
+		}
+
+		var recordKey string
+		if recordKey, storedObject, err = d.readRecord(entry); err != nil {
+			return
+		}
+		if recordKey == key {
+			found = true
+			return
+		}
+	}
+
+	return 0, entry, StoredObject{}, false, nil
+}
+
+func (d *diskObjectIndex) markRemoved(index int64, entry diskObjectIndexEntry) error {
+	entry.offset = -1
+	if err := d.writeEntry(index, entry); err != nil {
+		return err
+	}
+
+	d.live--
+	return nil
+}
+
+func (d *diskObjectIndex) readEntry(index int64) (entry diskObjectIndexEntry, err error) {
+	var b [diskObjectIndexEntrySize]byte
+	if _, err = d.entries.ReadAt(b[:], index*diskObjectIndexEntrySize); err != nil {
+		return
+	}
+	entry.unmarshal(b[:])
+	return
+}
+
+func (d *diskObjectIndex) writeEntry(index int64, entry diskObjectIndexEntry) error {
+	var b [diskObjectIndexEntrySize]byte
+	entry.marshal(b[:])
+	_, err := d.entries.WriteAt(b[:], index*diskObjectIndexEntrySize)
+	return err
+}
+
+func (d *diskObjectIndex) readRecord(entry diskObjectIndexEntry) (string, StoredObject, error) {
+	// the record may still be buffered
+	if d.dataWriter.Buffered() > 0 {
+		if err := d.dataWriter.Flush(); err != nil {
+			return "", StoredObject{}, err
+		}
+	}
+
+	record := make([]byte, entry.length)
+	if _, err := d.data.ReadAt(record, entry.offset); err != nil {
+		return "", StoredObject{}, err
+	}
+	return decodeIndexRecord(record)
+}
+
+// grow doubles the buckets, relinking the chains of every live entry. Removed entries are left out of the new chains.
+func (d *diskObjectIndex) grow() error {
+	buckets := make([]int64, len(d.buckets)*2)
+	mask := uint64(len(buckets) - 1)
+
+	block := make([]byte, diskObjectIndexBlockEntries*diskObjectIndexEntrySize)
+	for first := int64(0); first < d.entryCount; first += diskObjectIndexBlockEntries {
+		count := min(d.entryCount-first, diskObjectIndexBlockEntries)
+		b := block[:count*diskObjectIndexEntrySize]
+		if _, err := d.entries.ReadAt(b, first*diskObjectIndexEntrySize); err != nil {
+			return err
+		}
+
+		for i := int64(0); i < count; i++ {
+			var entry diskObjectIndexEntry
+			entry.unmarshal(b[i*diskObjectIndexEntrySize:])
+			if entry.offset < 0 {
+				continue
+			}
+
+			bucket := entry.hash & mask
+			entry.next, buckets[bucket] = buckets[bucket], first+i+1
+			entry.marshal(b[i*diskObjectIndexEntrySize:])
+		}
+
+		if _, err := d.entries.WriteAt(b, first*diskObjectIndexEntrySize); err != nil {
+			return err
+		}
+	}
+
+	d.buckets = buckets
+	return nil
+}
+
+// traverse passes every object still in the index to process, in the order they were put.
+// Both files are read sequentially, so this costs far less than looking each object up.
+func (d *diskObjectIndex) traverse(process func(StoredObject) error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.dataWriter.Flush(); err != nil {
+		return err
+	}
+
+	entries := bufio.NewReaderSize(io.NewSectionReader(d.entries, 0, d.entryCount*diskObjectIndexEntrySize), diskObjectIndexBlockEntries*diskObjectIndexEntrySize)
+	data := bufio.NewReaderSize(io.NewSectionReader(d.data, 0, d.dataSize), 1024*1024)
+	var position int64
+	var b [diskObjectIndexEntrySize]byte
+
+	for i := int64(0); i < d.entryCount; i++ {
+		if _, err := io.ReadFull(entries, b[:]); err != nil {
+			return err
+		}
+		var entry diskObjectIndexEntry
+		entry.unmarshal(b[:])
+		if entry.offset < 0 {
+			continue
+		}
+
+		if _, err := data.Discard(int(entry.offset - position)); err != nil {
+			return err
+		}
+		record := make([]byte, entry.length)
+		if _, err := io.ReadFull(data, record); err != nil {
+			return err
+		}
+		position = entry.offset + int64(entry.length)
+
+		_, storedObject, err := decodeIndexRecord(record)
+		if err != nil {
+			return err
+		}
+		if err = process(storedObject); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *diskObjectIndex) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return errors.Join(d.data.Close(), d.entries.Close())
+}
+
+// The functions below serialize StoredObjects for the index on disk. Every field must be covered,
+// as the objects are scheduled for transfer or deletion straight from the index.
+
+func appendIndexString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendIndexBytes distinguishes nil from empty, since a nil MD5 means that the hash is unknown
+func appendIndexBytes(b []byte, value []byte) []byte {
+	if value == nil {
+		return binary.AppendUvarint(b, 0)
+	}
+	b = binary.AppendUvarint(b, uint64(len(value))+1)
+	return append(b, value...)
+}
+
+func appendIndexTime(b []byte, t time.Time) []byte {
+	encoded, _ := t.MarshalBinary() // only fails for offsets that aren't a whole number of minutes
+	return appendIndexBytes(b, encoded)
+}
+
+func appendStoredObject(b []byte, s StoredObject) []byte {
+	b = appendIndexString(b, s.name)
+	b = append(b, byte(s.entityType))
+	b = appendIndexTime(b, s.lastModifiedTime)
+	b = appendIndexTime(b, s.smbLastModifiedTime)
+	b = binary.AppendVarint(b, s.size)
+	b = appendIndexBytes(b, s.md5)
+	b = appendIndexString(b, string(s.blobType))
+	b = appendIndexString(b, s.contentDisposition)
+	b = appendIndexString(b, s.cacheControl)
+	b = appendIndexString(b, s.contentLanguage)
+	b = appendIndexString(b, s.contentEncoding)
+	b = appendIndexString(b, s.contentType)
+	b = appendIndexString(b, s.relativePath)
+	b = appendIndexString(b, s.ContainerName)
+	b = appendIndexString(b, s.DstContainerName)
+	b = appendIndexString(b, s.eTag)
+	b = appendIndexString(b, s.sourceURL)
+	b = appendIndexString(b, string(s.blobAccessTier))
+	b = appendIndexString(b, string(s.archiveStatus))
+
+	if s.Metadata == nil {
+		b = binary.AppendUvarint(b, 0)
+	} else {
+		b = binary.AppendUvarint(b, uint64(len(s.Metadata))+1)
+		for k, v := range s.Metadata {
+			b = appendIndexString(b, k)
+			if v == nil {
+				b = appendIndexBytes(b, nil)
+			} else {
+				b = appendIndexBytes(b, []byte(*v))
+			}
+		}
+	}
+
+	b = appendIndexString(b, s.blobVersionID)
+
+	if s.blobTags == nil {
+		b = binary.AppendUvarint(b, 0)
+	} else {
+		b = binary.AppendUvarint(b, uint64(len(s.blobTags))+1)
+		for k, v := range s.blobTags {
+			b = appendIndexString(b, k)
+			b = appendIndexString(b, v)
+		}
+	}
+
+	b = appendIndexString(b, s.blobSnapshotID)
+	if s.blobDeleted {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = appendIndexString(b, string(s.leaseState))
+	b = appendIndexString(b, string(s.leaseStatus))
+	b = appendIndexString(b, string(s.leaseDuration))
+	return b
+}
+
+var errCorruptIndexRecord = errors.New("corrupt record in the sync index on disk")
+
+// indexRecordDecoder reads back what the append functions wrote. The first error sticks, and every later read returns zero values.
+type indexRecordDecoder struct {
+	b   []byte
+	err error
+}
+
+func (r *indexRecordDecoder) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.err = errCorruptIndexRecord
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *indexRecordDecoder) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.err = errCorruptIndexRecord
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *indexRecordDecoder) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.b) == 0 {
+		r.err = errCorruptIndexRecord
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *indexRecordDecoder) take(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.b)) {
+		r.err = errCorruptIndexRecord
+		return nil
+	}
+	v := r.b[:n:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *indexRecordDecoder) string() string {
+	return string(r.take(r.uvarint()))
+}
+
+func (r *indexRecordDecoder) bytes() []byte {
+	n := r.uvarint()
+	if n == 0 || r.err != nil {
+		return nil
+	}
+	return append([]byte{}, r.take(n-1)...)
+}
+
+func (r *indexRecordDecoder) time() time.Time {
+	var t time.Time
+	if encoded := r.bytes(); r.err == nil {
+		if err := t.UnmarshalBinary(encoded); err != nil {
+			r.err = fmt.Errorf("%w: %v", errCorruptIndexRecord, err)
+		}
+	}
+	return t
+}
+
+func decodeIndexRecord(record []byte) (key string, s StoredObject, err error) {
+	r := &indexRecordDecoder{b: record}
+
+	key = r.string()
+	s.name = r.string()
+	s.entityType = common.EntityType(r.byte())
+	s.lastModifiedTime = r.time()
+	s.smbLastModifiedTime = r.time()
+	s.size = r.varint()
+	s.md5 = r.bytes()
+	s.blobType = blob.BlobType(r.string())
+	s.contentDisposition = r.string()
+	s.cacheControl = r.string()
+	s.contentLanguage = r.string()
+	s.contentEncoding = r.string()
+	s.contentType = r.string()
+	s.relativePath = r.string()
+	s.ContainerName = r.string()
+	s.DstContainerName = r.string()
+	s.eTag = r.string()
+	s.sourceURL = r.string()
+	s.blobAccessTier = blob.AccessTier(r.string())
+	s.archiveStatus = blob.ArchiveStatus(r.string())
+
+	if n := r.uvarint(); n > 0 && r.err == nil {
+		s.Metadata = make(common.Metadata, n-1)
+		for j := uint64(1); j < n && r.err == nil; j++ {
+			k := r.string()
+			if v := r.bytes(); v != nil {
+				value := string(v)
+				s.Metadata[k] = &value
+			} else {
+				s.Metadata[k] = nil
+			}
+		}
+	}
+
+	s.blobVersionID = r.string()
+
+	if n := r.uvarint(); n > 0 && r.err == nil {
+		s.blobTags = make(common.BlobTags, n-1)
+		for j := uint64(1); j < n && r.err == nil; j++ {
+			k := r.string()
+			s.blobTags[k] = r.string()
+		}
+	}
+
+	s.blobSnapshotID = r.string()
+	s.blobDeleted = r.byte() == 1
+	s.leaseState = lease.StateType(r.string())
+	s.leaseStatus = lease.StatusType(r.string())
+	s.leaseDuration = lease.DurationType(r.string())
+
+	if r.err == nil && len(r.b) != 0 {
+		r.err = errCorruptIndexRecord
+	}
+	return key, s, r.err
+}
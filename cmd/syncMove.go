@@ -0,0 +1,414 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azfile/file"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/Azure/azure-storage-azcopy/v10/ste"
+)
+
+// how often the destination is polled while a blob is copied to its new name
+const syncMoveCopyPollInterval = time.Second
+
+// errSyncMoveOldCopyLeft is returned by a mover when the file is at its new name, but its old copy couldn't be removed.
+// The file isn't transferred again, and the old copy is deleted with the other extra objects.
+var errSyncMoveOldCopyLeft = errors.New("the old copy was left behind")
+
+// files are matched by their size and hash
+type syncMoveKey struct {
+	size int64
+	hash string
+}
+
+// syncMoveConcurrency is the number of moves that run at once. Each is a request or two to the destination,
+// or, for blobs, a copy within the account that is polled until it completes.
+const syncMoveConcurrency = 32
+
+// syncMoveDetector spots files that were renamed or moved at the source, by matching the files that only exist at the destination
+// with those that only exist at the source, by size and hash. Rather than uploading such a file again and deleting its old copy,
+// the old copy is moved to its new name within the destination, alongside the enumeration.
+// The objects to delete from the destination are held until the moves are done, so that only those that weren't moved are deleted,
+// and so that folders are only deleted once everything has been moved out of them. The objects held move to disk, like the sync's
+// index, once there are too many of them to keep in memory.
+type syncMoveDetector struct {
+	hashType common.SyncHashType
+
+	// moves the old copy of a file within the destination, to the name of the source file
+	mover func(oldObject, newObject StoredObject) error
+
+	copyTransferScheduler objectProcessor
+	destinationCleaner    objectProcessor
+
+	// the objects that only exist at the destination, less those being moved
+	extra *objectIndexer
+	// the relative paths of the extra files that could have been moved, by size and hash
+	candidates map[syncMoveKey][]string
+	// the files only at the source, held until every extra file is known when the destination is indexed first
+	pending *objectIndexer
+
+	// the moves in progress take up slots; those that fail are transferred once all are done
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	failed []syncMoveFailure
+	// the old copies of files that were moved, but couldn't be removed
+	leftBehind []StoredObject
+
+	// count the moves that happened
+	incrementMoveCount func()
+}
+
+// syncMoveFailure is a file that couldn't be moved at the destination, and is transferred instead
+type syncMoveFailure struct {
+	oldObject, newObject StoredObject
+}
+
+// newSyncMoveDetector returns a detector whose held objects move to disk, in spillDir-extra and spillDir-pending, once there are more than spillThreshold
+// of either kind. Zero keeps them in memory.
+func newSyncMoveDetector(hashType common.SyncHashType, mover func(oldObject, newObject StoredObject) error, copyScheduler, cleaner objectProcessor,
+	incrementMoveCount func(), spillThreshold int, spillDir string) *syncMoveDetector {
+	return &syncMoveDetector{
+		hashType:              hashType,
+		mover:                 mover,
+		copyTransferScheduler: copyScheduler,
+		destinationCleaner:    cleaner,
+		incrementMoveCount:    incrementMoveCount,
+		extra:                 newSpillingObjectIndexer(spillThreshold, spillDir+"-extra"),
+		candidates:            make(map[syncMoveKey][]string),
+		pending:               newSpillingObjectIndexer(spillThreshold, spillDir+"-pending"),
+		slots:                 make(chan struct{}, syncMoveConcurrency),
+	}
+}
+
+// moveKey returns the key a file can be matched by; empty files and files without a hash can't be matched
+func (d *syncMoveDetector) moveKey(object StoredObject) (syncMoveKey, bool) {
+	if object.entityType != common.EEntityType.File() || object.size == 0 {
+		return syncMoveKey{}, false
+	}
+
+	hash := object.syncHash(d.hashType)
+	if len(hash) == 0 {
+		return syncMoveKey{}, false
+	}
+
+	return syncMoveKey{size: object.size, hash: string(hash)}, true
+}
+
+// deferDeletion takes the place of the destination cleaner, holding each extra object until the moves are done
+func (d *syncMoveDetector) deferDeletion(destinationObject StoredObject) error {
+	if err := d.extra.store(destinationObject); err != nil {
+		return err
+	}
+	if key, ok := d.moveKey(destinationObject); ok {
+		d.candidates[key] = append(d.candidates[key], destinationObject.relativePath)
+	}
+	return nil
+}
+
+// deferTransfer holds the files only at the source that could be matched, and schedules the rest right away.
+// It's only needed when the destination is indexed first, since the extra files aren't all known until the source has been listed.
+func (d *syncMoveDetector) deferTransfer(sourceObject StoredObject) error {
+	if _, ok := d.moveKey(sourceObject); ok {
+		return d.pending.store(sourceObject)
+	}
+	return d.copyTransferScheduler(sourceObject)
+}
+
+// moveOrTransfer starts moving an extra file with the same size and hash to the name of the source file, if there is one.
+// Otherwise the source file is transferred as usual, as it is by finish if the move fails.
+func (d *syncMoveDetector) moveOrTransfer(sourceObject StoredObject) error {
+	key, ok := d.moveKey(sourceObject)
+	if !ok || len(d.candidates[key]) == 0 {
+		return d.copyTransferScheduler(sourceObject)
+	}
+
+	relativePath := d.candidates[key][0]
+	if d.candidates[key] = d.candidates[key][1:]; len(d.candidates[key]) == 0 {
+		delete(d.candidates, key)
+	}
+	oldObject, _, err := d.extra.lookup(relativePath)
+	if err != nil {
+		return err
+	}
+	// the old copy is no longer to be deleted, unless the move fails or leaves it behind
+	if err = d.extra.remove(relativePath); err != nil {
+		return err
+	}
+
+	d.slots <- struct{}{}
+	d.wg.Add(1)
+	go func() {
+		defer func() {
+			<-d.slots
+			d.wg.Done()
+		}()
+
+		err := d.mover(oldObject, sourceObject)
+		if errors.Is(err, errSyncMoveOldCopyLeft) {
+			msg := fmt.Sprintf("moved %s to %s at the destination, but %s; it will be deleted with the other extra files",
+				oldObject.relativePath, sourceObject.relativePath, err.Error())
+			glcm.Info(msg)
+			if azcopyScanningLogger != nil {
+				azcopyScanningLogger.Log(common.LogWarning, msg)
+			}
+
+			d.mu.Lock()
+			d.leftBehind = append(d.leftBehind, oldObject)
+			d.mu.Unlock()
+		} else if err != nil {
+			msg := fmt.Sprintf("unable to move %s to %s at the destination, so it will be transferred again: %s",
+				oldObject.relativePath, sourceObject.relativePath, err.Error())
+			glcm.Info(msg)
+			if azcopyScanningLogger != nil {
+				azcopyScanningLogger.Log(common.LogWarning, msg)
+			}
+
+			d.mu.Lock()
+			d.failed = append(d.failed, syncMoveFailure{oldObject, sourceObject})
+			d.mu.Unlock()
+			return
+		}
+
+		if d.incrementMoveCount != nil {
+			d.incrementMoveCount()
+		}
+	}()
+	return nil
+}
+
+// finish transfers or moves the files held by deferTransfer, waits for the moves, transferring the files that couldn't be moved,
+// then deletes the extra objects that weren't moved, along with the old copies that moves left behind
+func (d *syncMoveDetector) finish() (err error) {
+	defer func() {
+		if closeErr := d.close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	err = d.pending.traverse(d.moveOrTransfer, nil)
+	d.wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	// the old copy of a file that couldn't be moved is deleted with the other extra objects
+	for _, failure := range d.failed {
+		if err = d.extra.store(failure.oldObject); err != nil {
+			return err
+		}
+		if err = d.copyTransferScheduler(failure.newObject); err != nil {
+			return err
+		}
+	}
+	d.failed = nil
+	for _, oldObject := range d.leftBehind {
+		if err = d.extra.store(oldObject); err != nil {
+			return err
+		}
+	}
+	d.leftBehind = nil
+
+	if err = d.extra.traverse(d.destinationCleaner, nil); err != nil {
+		return err
+	}
+	d.candidates = make(map[syncMoveKey][]string)
+	return nil
+}
+
+// close releases the objects held, deleting them from disk if they were moved there
+func (d *syncMoveDetector) close() error {
+	err := d.extra.close()
+	if closeErr := d.pending.close(); err == nil {
+		err = closeErr
+	}
+	d.extra = newSpillingObjectIndexer(d.extra.spillThreshold, d.extra.spillDir)
+	d.pending = newSpillingObjectIndexer(d.pending.spillThreshold, d.pending.spillDir)
+	return err
+}
+
+// remoteResourceMover moves files within a Blob container, a file share or an ADLS Gen2 filesystem,
+// so that files renamed at the source aren't uploaded again
+type remoteResourceMover struct {
+	remoteClient    *common.ServiceClient
+	containerName   string // name of target container/share/filesystem
+	rootPath        string
+	root            common.ResourceString
+	ctx             context.Context
+	targetLocation  common.Location
+	forceIfReadOnly bool
+	dryrunMode      bool
+}
+
+func newSyncMover(cca *cookedSyncCmdArgs, dstClient *common.ServiceClient) (*remoteResourceMover, error) {
+	rawURL, err := cca.destination.FullURL()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
+
+	mover, err := newRemoteResourceMover(ctx, dstClient, rawURL, cca.fromTo.To(), cca.forceIfReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	mover.root = cca.destination
+	mover.dryrunMode = cca.dryrunMode
+
+	return mover, nil
+}
+
+func newRemoteResourceMover(ctx context.Context, remoteClient *common.ServiceClient, rawRootURL *url.URL, targetLocation common.Location, forceIfReadOnly bool) (*remoteResourceMover, error) {
+	containerName, rootPath, err := common.SplitContainerNameFromPath(rawRootURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteResourceMover{
+		remoteClient:    remoteClient,
+		containerName:   containerName,
+		rootPath:        rootPath,
+		ctx:             ctx,
+		targetLocation:  targetLocation,
+		forceIfReadOnly: forceIfReadOnly,
+	}, nil
+}
+
+// move gives the old copy of a file at the destination the name of the new object, using a copy followed by a delete on Blob storage,
+// and the rename APIs of Azure Files and ADLS Gen2
+func (m *remoteResourceMover) move(oldObject, newObject StoredObject) error {
+	if m.dryrunMode {
+		glcm.Dryrun(func(format common.OutputFormat) string {
+			if format == common.EOutputFormat.Json() {
+				tx := DryrunTransfer{
+					Source:      common.GenerateFullPath(m.root.Value, oldObject.relativePath),
+					Destination: common.GenerateFullPath(m.root.Value, newObject.relativePath),
+					BlobType:    common.FromBlobType(oldObject.blobType),
+					EntityType:  oldObject.entityType,
+					FromTo:      common.FromToValue(m.targetLocation, m.targetLocation),
+				}
+
+				jsonOutput, err := json.Marshal(tx)
+				common.PanicIfErr(err)
+				return string(jsonOutput)
+			}
+
+			return fmt.Sprintf("DRYRUN: move %v to %v",
+				common.GenerateFullPath(m.root.Value, oldObject.relativePath),
+				common.GenerateFullPath(m.root.Value, newObject.relativePath))
+		})
+		return nil
+	}
+
+	msg := fmt.Sprintf("Moving %s to %s, since it was moved at the source", oldObject.relativePath, newObject.relativePath)
+	glcm.Info(msg)
+	if azcopyScanningLogger != nil {
+		azcopyScanningLogger.Log(common.LogInfo, msg)
+	}
+
+	return m.movePath(path.Join(m.rootPath, oldObject.relativePath), path.Join(m.rootPath, newObject.relativePath))
+}
+
+// movePath moves a file between two paths within the container, share or filesystem
+func (m *remoteResourceMover) movePath(fromPath, toPath string) error {
+	switch m.targetLocation {
+	case common.ELocation.Blob():
+		return m.moveBlob(fromPath, toPath)
+	case common.ELocation.File():
+		fsc, err := m.remoteClient.FileServiceClient()
+		if err != nil {
+			return err
+		}
+		shareClient := fsc.NewShareClient(m.containerName)
+		fileClient := shareClient.NewRootDirectoryClient().NewFileClient(fromPath)
+
+		// unlike a blob, a file can only be renamed into a directory that exists
+		tracker := ste.NewFolderCreationTracker(common.EFolderPropertiesOption.NoFolders(), nil)
+		newFileClient := shareClient.NewRootDirectoryClient().NewFileClient(toPath)
+		if err = (ste.AzureFileParentDirCreator{}).CreateParentDirToRoot(m.ctx, newFileClient, shareClient, tracker); err != nil {
+			return err
+		}
+
+		_, err = fileClient.Rename(m.ctx, toPath, &file.RenameOptions{
+			ReplaceIfExists: to.Ptr(true),
+			IgnoreReadOnly:  to.Ptr(m.forceIfReadOnly),
+		})
+		return err
+	case common.ELocation.BlobFS():
+		dsc, err := m.remoteClient.DatalakeServiceClient()
+		if err != nil {
+			return err
+		}
+		_, err = dsc.NewFileSystemClient(m.containerName).NewFileClient(fromPath).Rename(m.ctx, toPath, nil)
+		return err
+	default:
+		panic("not implemented, check your code")
+	}
+}
+
+// moveBlob copies the blob to its new name within the container, then deletes the old one.
+// Copies within an account complete on the service side, without the data passing through azcopy.
+func (m *remoteResourceMover) moveBlob(fromPath, toPath string) error {
+	bsc, err := m.remoteClient.BlobServiceClient()
+	if err != nil {
+		return err
+	}
+	containerClient := bsc.NewContainerClient(m.containerName)
+	fromClient := containerClient.NewBlobClient(fromPath)
+	toClient := containerClient.NewBlobClient(toPath)
+
+	resp, err := toClient.StartCopyFromURL(m.ctx, fromClient.URL(), nil)
+	if err != nil {
+		return err
+	}
+
+	status := resp.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		time.Sleep(syncMoveCopyPollInterval)
+		props, err := toClient.GetProperties(m.ctx, nil)
+		if err != nil {
+			return err
+		}
+		status = props.CopyStatus
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("the copy to %s ended with status %s", toPath, *status)
+	}
+
+	if _, err = fromClient.Delete(m.ctx, nil); err != nil {
+		// the blob is already at its new name, so there's no need to upload it again; only the old copy is left behind
+		return fmt.Errorf("%w: error %s deleting %s after copying it to %s", errSyncMoveOldCopyLeft, err.Error(), fromPath, toPath)
+	}
+
+	return nil
+}
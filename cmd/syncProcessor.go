@@ -24,11 +24,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"strings"
 
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-storage-azcopy/v10/common"
 	"github.com/Azure/azure-storage-azcopy/v10/ste"
@@ -44,8 +46,10 @@ func newSyncTransferProcessor(cca *cookedSyncCmdArgs,
 
 	// note that the source and destination, along with the template are given to the generic processor's constructor
 	// this means that given an object with a relative path, this processor already knows how to schedule the right kind of transfers
-	return newCopyTransferProcessor(copyJobTemplate, numOfTransfersPerPart, cca.source, cca.destination,
+	processor := newCopyTransferProcessor(copyJobTemplate, numOfTransfersPerPart, cca.source, cca.destination,
 		reportFirstPart, reportFinalPart, cca.preserveAccessTier, cca.dryrunMode)
+	processor.rename = cca.rename
+	return processor
 }
 
 // base for delete processors targeting different resources
@@ -67,6 +71,14 @@ type interactiveDeleteProcessor struct {
 	// examples: a directory path, or url to container
 	objectLocationToDisplay string
 
+	// used for prompt message, to name the side the object is missing from, and the side it is deleted from
+	// "the source" and "the destination", except when a bidirectional sync deletes from the source
+	missingFromToDisplay string
+	deleteFromToDisplay  string
+
+	// if set, the files are moved under this path within the location instead of being deleted, as --archive-prefix has them be
+	archivePathToDisplay string
+
 	// count the deletions that happened
 	incrementDeletionCount func()
 
@@ -101,6 +113,10 @@ func (d *interactiveDeleteProcessor) removeImmediately(object StoredObject) (err
 				jsonOutput, err := json.Marshal(tx)
 				common.PanicIfErr(err)
 				return string(jsonOutput)
+			} else if d.archives(object) {
+				return fmt.Sprintf("DRYRUN: move %v to %v",
+					common.GenerateFullPath(d.objectLocationToDisplay, object.relativePath),
+					common.GenerateFullPath(d.objectLocationToDisplay, path.Join(d.archivePathToDisplay, object.relativePath)))
 			} else { // remove for sync
 				return fmt.Sprintf("DRYRUN: remove %v",
 					common.GenerateFullPath(d.objectLocationToDisplay, object.relativePath))
@@ -124,10 +140,18 @@ func (d *interactiveDeleteProcessor) removeImmediately(object StoredObject) (err
 	return nil // Missing a file is an error, but it's not show-stopping. We logged it earlier; that's OK.
 }
 
+// archives tells whether object is moved to the archive rather than deleted; folders are still deleted, once everything has left them
+func (d *interactiveDeleteProcessor) archives(object StoredObject) bool {
+	return d.archivePathToDisplay != "" && object.entityType != common.EEntityType.Folder()
+}
+
 func (d *interactiveDeleteProcessor) promptForConfirmation(object StoredObject) (shouldDelete bool, keepPrompting bool) {
-	answer := glcm.Prompt(fmt.Sprintf("The %s '%s' does not exist at the source. "+
-		"Do you wish to delete it from the destination(%s)?",
-		d.objectTypeToDisplay, object.relativePath, d.objectLocationToDisplay),
+	question := fmt.Sprintf("Do you wish to delete it from %s(%s)?", d.deleteFromToDisplay, d.objectLocationToDisplay)
+	if d.archives(object) {
+		question = fmt.Sprintf("Do you wish to move it from %s(%s) to %s?", d.deleteFromToDisplay, d.objectLocationToDisplay, d.archivePathToDisplay)
+	}
+	answer := glcm.Prompt(fmt.Sprintf("The %s '%s' does not exist at %s. %s",
+		d.objectTypeToDisplay, object.relativePath, d.missingFromToDisplay, question),
 		common.PromptDetails{
 			PromptType:   common.EPromptType.DeleteDestination(),
 			PromptTarget: object.relativePath,
@@ -144,7 +168,11 @@ func (d *interactiveDeleteProcessor) promptForConfirmation(object StoredObject)
 		// print nothing, since the deleter is expected to log the message when the delete happens
 		return true, true
 	case common.EResponseOption.YesForAll():
-		glcm.Info(fmt.Sprintf("Confirmed. All the extra %ss will be deleted.", d.objectTypeToDisplay))
+		if d.archivePathToDisplay != "" {
+			glcm.Info(fmt.Sprintf("Confirmed. All the extra %ss will be moved to %s.", d.objectTypeToDisplay, d.archivePathToDisplay))
+		} else {
+			glcm.Info(fmt.Sprintf("Confirmed. All the extra %ss will be deleted.", d.objectTypeToDisplay))
+		}
 		return true, false
 	case common.EResponseOption.No():
 		glcm.Info(fmt.Sprintf("Keeping extra %s: %s", d.objectTypeToDisplay, object.relativePath))
@@ -165,6 +193,8 @@ func newInteractiveDeleteProcessor(deleter objectProcessor, deleteDestination co
 		deleter:                 deleter,
 		objectTypeToDisplay:     objectTypeToDisplay,
 		objectLocationToDisplay: objectLocationToDisplay.Value,
+		missingFromToDisplay:    "the source",
+		deleteFromToDisplay:     "the destination",
 		incrementDeletionCount:  incrementDeletionCounter,
 		shouldPromptUser:        deleteDestination == common.EDeleteDestination.Prompt(),
 		shouldDelete:            deleteDestination == common.EDeleteDestination.True(), // if shouldPromptUser is true, this will start as false, but we will determine its value later
@@ -175,8 +205,13 @@ func newInteractiveDeleteProcessor(deleter objectProcessor, deleteDestination co
 const LocalFileObjectType = "local file"
 
 func newSyncLocalDeleteProcessor(cca *cookedSyncCmdArgs, fpo common.FolderPropertyOption) *interactiveDeleteProcessor {
-	localDeleter := localFileDeleter{rootPath: cca.destination.ValueLocal(), fpo: fpo, folderManager: common.NewFolderDeletionManager(context.Background(), fpo, azcopyScanningLogger)}
-	return newInteractiveDeleteProcessor(localDeleter.deleteFile, cca.deleteDestination, LocalFileObjectType, cca.destination, cca.incrementDeletionCount, cca.dryrunMode)
+	return newSyncLocalDeleteProcessorAt(cca, fpo, cca.destination)
+}
+
+// newSyncLocalDeleteProcessorAt deletes from the local directory at root, which is the destination unless the sync is bidirectional
+func newSyncLocalDeleteProcessorAt(cca *cookedSyncCmdArgs, fpo common.FolderPropertyOption, root common.ResourceString) *interactiveDeleteProcessor {
+	localDeleter := localFileDeleter{rootPath: root.ValueLocal(), fpo: fpo, folderManager: common.NewFolderDeletionManager(context.Background(), fpo, azcopyScanningLogger)}
+	return newInteractiveDeleteProcessor(localDeleter.deleteFile, cca.deleteDestination, LocalFileObjectType, root, cca.incrementDeletionCount, cca.dryrunMode)
 }
 
 type localFileDeleter struct {
@@ -220,20 +255,136 @@ func (l *localFileDeleter) deleteFile(object StoredObject) error {
 	return nil
 }
 
-func newSyncDeleteProcessor(cca *cookedSyncCmdArgs, fpo common.FolderPropertyOption, dstClient *common.ServiceClient) (*interactiveDeleteProcessor, error) {
+const WebDAVObjectType = "WebDAV resource"
+
+func newSyncWebDAVDeleteProcessor(cca *cookedSyncCmdArgs, fpo common.FolderPropertyOption, dstClient *common.ServiceClient) (*interactiveDeleteProcessor, error) {
 	rawURL, err := cca.destination.FullURL()
 	if err != nil {
 		return nil, err
 	}
 
+	pipeline, err := dstClient.HTTPPipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+	deleter := &webDAVResourceDeleter{
+		rootURL:       rawURL,
+		ctx:           ctx,
+		pipeline:      pipeline,
+		fpo:           fpo,
+		folderManager: common.NewFolderDeletionManager(ctx, fpo, azcopyScanningLogger),
+	}
+
+	return newInteractiveDeleteProcessor(deleter.delete, cca.deleteDestination, WebDAVObjectType, cca.destination, cca.incrementDeletionCount, cca.dryrunMode), nil
+}
+
+// webDAVResourceDeleter removes extra resources from a WebDAV destination with DELETE
+type webDAVResourceDeleter struct {
+	rootURL       *url.URL
+	ctx           context.Context
+	pipeline      *azruntime.Pipeline
+	fpo           common.FolderPropertyOption
+	folderManager common.FolderDeletionManager
+}
+
+func (w *webDAVResourceDeleter) getObjectURL(object StoredObject) *url.URL {
+	objectURL := *w.rootURL
+	objectURL.RawPath = ""
+	objectURL.Path = path.Join(w.rootURL.Path, strings.ReplaceAll(object.relativePath, "\\", "/"))
+	return &objectURL
+}
+
+func (w *webDAVResourceDeleter) deleteResource(objectURL *url.URL) error {
+	req, err := azruntime.NewRequest(w.ctx, http.MethodDelete, objectURL.String())
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.pipeline.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// a 404 means something else got there first, which is just as good
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("DELETE request returned status %d: %s", resp.StatusCode, resp.Status)
+	}
+	return nil
+}
+
+func (w *webDAVResourceDeleter) delete(object StoredObject) error {
+	if object.isSourceRootFolder() {
+		return nil // never remove the root of the sync
+	}
+
+	objectURL := w.getObjectURL(object)
+	w.folderManager.RecordChildExists(objectURL)
+
+	if object.entityType == common.EEntityType.File() {
+		msg := "Deleting extra object: " + object.relativePath
+		glcm.Info(msg)
+		if azcopyScanningLogger != nil {
+			azcopyScanningLogger.Log(common.LogInfo, msg)
+		}
+
+		err := w.deleteResource(objectURL)
+		w.folderManager.RecordChildDeleted(objectURL)
+		if err != nil {
+			msg := fmt.Sprintf("error %s deleting the object %s", err.Error(), object.relativePath)
+			glcm.Info(msg + "; check the scanning log file for more details")
+			if azcopyScanningLogger != nil {
+				azcopyScanningLogger.Log(common.LogError, msg+": "+err.Error())
+			}
+		}
+		return err
+	} else if object.entityType == common.EEntityType.Folder() && w.fpo != common.EFolderPropertiesOption.NoFolders() {
+		msg := "Deleting extra folder: " + object.relativePath
+		glcm.Info(msg)
+		if azcopyScanningLogger != nil {
+			azcopyScanningLogger.Log(common.LogInfo, msg)
+		}
+
+		// DELETE on a collection is recursive, so only issue it once we know the folder holds nothing we kept
+		w.folderManager.RequestDeletion(objectURL, func(ctx context.Context, logger common.ILogger) bool {
+			return w.deleteResource(objectURL) == nil
+		})
+	}
+
+	return nil
+}
+
+func newSyncDeleteProcessor(cca *cookedSyncCmdArgs, fpo common.FolderPropertyOption, dstClient *common.ServiceClient) (*interactiveDeleteProcessor, error) {
+	return newSyncDeleteProcessorAt(cca, fpo, cca.destination, cca.fromTo.To(), dstClient)
+}
+
+// newSyncDeleteProcessorAt deletes from the remote resource at root, which is the destination unless the sync is bidirectional
+func newSyncDeleteProcessorAt(cca *cookedSyncCmdArgs, fpo common.FolderPropertyOption, root common.ResourceString, location common.Location, client *common.ServiceClient) (*interactiveDeleteProcessor, error) {
+	rawURL, err := root.FullURL()
+	if err != nil {
+		return nil, err
+	}
+
 	ctx := context.WithValue(context.TODO(), ste.ServiceAPIVersionOverride, ste.DefaultServiceApiVersion)
 
-	deleter, err := newRemoteResourceDeleter(ctx, dstClient, rawURL, cca.fromTo.To(), fpo, cca.forceIfReadOnly)
+	deleter, err := newRemoteResourceDeleter(ctx, client, rawURL, location, fpo, cca.forceIfReadOnly)
 	if err != nil {
 		return nil, err
 	}
 
-	return newInteractiveDeleteProcessor(deleter.delete, cca.deleteDestination, cca.fromTo.To().String(), cca.destination, cca.incrementDeletionCount, cca.dryrunMode), nil
+	if cca.archivePrefix != "" {
+		// the extra files are moved into the archive, rather than deleted; their folders are still deleted once empty
+		if deleter.archiver, err = newRemoteResourceMover(ctx, client, rawURL, location, cca.forceIfReadOnly); err != nil {
+			return nil, err
+		}
+		deleter.archivePath = syncArchivePath(cca.archivePrefix, cca.archiveTime)
+	}
+
+	processor := newInteractiveDeleteProcessor(deleter.delete, cca.deleteDestination, location.String(), root, cca.incrementDeletionCount, cca.dryrunMode)
+	processor.archivePathToDisplay = deleter.archivePath
+	return processor, nil
 }
 
 type remoteResourceDeleter struct {
@@ -245,6 +396,10 @@ type remoteResourceDeleter struct {
 	folderManager   common.FolderDeletionManager
 	folderOption    common.FolderPropertyOption
 	forceIfReadOnly bool
+
+	// if set, files are moved under archivePath, relative to the root, instead of being deleted
+	archiver    *remoteResourceMover
+	archivePath string
 }
 
 func newRemoteResourceDeleter(ctx context.Context, remoteClient *common.ServiceClient, rawRootURL *url.URL, targetLocation common.Location, fpo common.FolderPropertyOption, forceIfReadOnly bool) (*remoteResourceDeleter, error) {
@@ -295,6 +450,9 @@ func (b *remoteResourceDeleter) delete(object StoredObject) error {
 	if object.entityType == common.EEntityType.File() {
 		// TODO: use b.targetLocation.String() in the next line, instead of "object", if we can make it come out as string
 		msg := "Deleting extra object: " + object.relativePath
+		if b.archiver != nil {
+			msg = fmt.Sprintf("Archiving extra object: %s to %s", object.relativePath, path.Join(b.archivePath, object.relativePath))
+		}
 		glcm.Info(msg)
 		if azcopyScanningLogger != nil {
 			azcopyScanningLogger.Log(common.LogInfo, msg)
@@ -315,7 +473,11 @@ func (b *remoteResourceDeleter) delete(object StoredObject) error {
 			b.folderManager.RecordChildExists(objURL)
 			defer b.folderManager.RecordChildDeleted(objURL)
 
-			_, err = blobClient.Delete(b.ctx, nil)
+			if b.archiver != nil {
+				err = b.archive(objectPath, object)
+			} else {
+				_, err = blobClient.Delete(b.ctx, nil)
+			}
 		case common.ELocation.File(), common.ELocation.FileNFS():
 			fsc, _ := sc.FileServiceClient()
 			fileClient := fsc.NewShareClient(b.containerName).NewRootDirectoryClient().NewFileClient(objectPath)
@@ -327,9 +489,13 @@ func (b *remoteResourceDeleter) delete(object StoredObject) error {
 			b.folderManager.RecordChildExists(objURL)
 			defer b.folderManager.RecordChildDeleted(objURL)
 
-			err = common.DoWithOverrideReadOnlyOnAzureFiles(b.ctx, func() (interface{}, error) {
-				return fileClient.Delete(b.ctx, nil)
-			}, fileClient, b.forceIfReadOnly)
+			if b.archiver != nil {
+				err = b.archive(objectPath, object)
+			} else {
+				err = common.DoWithOverrideReadOnlyOnAzureFiles(b.ctx, func() (interface{}, error) {
+					return fileClient.Delete(b.ctx, nil)
+				}, fileClient, b.forceIfReadOnly)
+			}
 		case common.ELocation.BlobFS():
 			dsc, _ := sc.DatalakeServiceClient()
 			fileClient := dsc.NewFileSystemClient(b.containerName).NewFileClient(objectPath)
@@ -341,7 +507,11 @@ func (b *remoteResourceDeleter) delete(object StoredObject) error {
 			b.folderManager.RecordChildExists(objURL)
 			defer b.folderManager.RecordChildDeleted(objURL)
 
-			_, err = fileClient.Delete(b.ctx, nil)
+			if b.archiver != nil {
+				err = b.archive(objectPath, object)
+			} else {
+				_, err = fileClient.Delete(b.ctx, nil)
+			}
 		default:
 			panic("not implemented, check your code")
 		}
@@ -0,0 +1,398 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// A sync snapshot records what the source looked like when a sync last completed successfully.
+// An incremental sync compares the source with it, instead of listing the destination.
+// Snapshots are gzip streams: a header holding the magic string and the fingerprint of the settings
+// they were taken with, followed by one length-prefixed record per object.
+const (
+	syncSnapshotMagic      = "azcopy-sync-snapshot-v1\n"
+	syncSnapshotFolderName = "sync-snapshots"
+	syncSnapshotMaxRecord  = 1 << 20 // paths are far shorter than this, so anything longer means the snapshot is corrupt
+)
+
+var errSyncSnapshotSettingsChanged = errors.New("the snapshot was taken with different filters or options")
+var errCorruptSyncSnapshot = errors.New("corrupt sync snapshot")
+
+// syncSnapshotPath returns where the snapshot of syncs between the source and destination is kept
+func syncSnapshotPath(cca *cookedSyncCmdArgs) string {
+	return filepath.Join(common.AzcopyJobPlanFolder, syncSnapshotFolderName, syncStateKey(cca)+".snapshot")
+}
+
+// syncStateKey identifies the source and destination of a sync, for naming what is kept from one sync to the next
+func syncStateKey(cca *cookedSyncCmdArgs) string {
+	source, destination := cca.source.Value, cca.destination.Value
+	if cca.fromTo.From() == common.ELocation.Local() {
+		if abs, err := filepath.Abs(cca.source.ValueLocal()); err == nil {
+			source = abs
+		}
+	}
+	if cca.fromTo.To() == common.ELocation.Local() {
+		if abs, err := filepath.Abs(cca.destination.ValueLocal()); err == nil {
+			destination = abs
+		}
+	}
+
+	key := sha256.Sum256([]byte(cca.fromTo.String() + "\n" + source + "\n" + destination))
+	return hex.EncodeToString(key[:])
+}
+
+// syncSnapshotFingerprint identifies the settings that decide which objects a sync looks at, and what it records about them.
+// A snapshot taken with different ones can't stand in for the destination.
+func syncSnapshotFingerprint(cca *cookedSyncCmdArgs) string {
+	filterExpression := ""
+	if cca.filterExpression != nil {
+		filterExpression = cca.filterExpression.expression
+	}
+
+	settings, _ := json.Marshal(struct {
+		Recursive             bool
+		IncludePatterns       []string
+		ExcludePatterns       []string
+		ExcludePaths          []string
+		IncludeFileAttributes []string
+		ExcludeFileAttributes []string
+		IncludeRegex          []string
+		ExcludeRegex          []string
+		IncludeSizeMin        *int64
+		IncludeSizeMax        *int64
+		FilterExpression      string
+		IgnoreFile            string
+		IncludeDirectoryStubs bool
+		IncludeRoot           bool
+		SymlinkHandling       common.SymlinkHandlingType
+		Hardlinks             common.HardlinkHandlingType
+		PreserveInfo          bool
+		PreservePermissions   common.PreservePermissionsOption
+		CompareHash           common.SyncHashType
+		CompareBy             common.SyncCompareBy
+		TrailingDot           common.TrailingDotOption
+		ArchivePrefix         string
+	}{
+		cca.recursive,
+		cca.includePatterns,
+		cca.excludePatterns,
+		cca.excludePaths,
+		cca.includeFileAttributes,
+		cca.excludeFileAttributes,
+		cca.includeRegex,
+		cca.excludeRegex,
+		cca.includeSizeMin,
+		cca.includeSizeMax,
+		filterExpression,
+		cca.ignoreFile,
+		cca.includeDirectoryStubs,
+		cca.includeRoot,
+		cca.symlinkHandling,
+		cca.hardlinks,
+		cca.preserveInfo,
+		cca.preservePermissions,
+		cca.compareHash,
+		cca.compareBy,
+		cca.trailingDot,
+		cca.archivePrefix,
+	})
+
+	sum := sha256.Sum256(settings)
+	return hex.EncodeToString(sum[:])
+}
+
+func logSyncSnapshotMessage(cca *cookedSyncCmdArgs, msg string) {
+	if !cca.dryrunMode {
+		glcm.Info(msg)
+	}
+	common.LogToJobLogWithPrefix(msg, common.LogInfo)
+}
+
+func appendSyncSnapshotRecord(b []byte, s StoredObject) []byte {
+	b = appendIndexString(b, s.relativePath)
+	b = appendIndexString(b, s.name)
+	return appendSyncSnapshotState(b, s)
+}
+
+// appendSyncSnapshotState records what a sync compares an object by
+func appendSyncSnapshotState(b []byte, s StoredObject) []byte {
+	b = append(b, byte(s.entityType))
+	b = binary.AppendVarint(b, s.size)
+	b = appendIndexTime(b, s.lastModifiedTime)
+	b = appendIndexTime(b, s.smbLastModifiedTime)
+	b = appendIndexBytes(b, s.md5)
+	b = appendIndexString(b, s.eTag)
+	return b
+}
+
+func decodeSyncSnapshotRecord(record []byte) (s StoredObject, err error) {
+	r := &indexRecordDecoder{b: record}
+
+	s.relativePath = r.string()
+	s.name = r.string()
+	r.syncSnapshotState(&s)
+
+	if r.err == nil && len(r.b) != 0 {
+		r.err = errCorruptIndexRecord
+	}
+	return s, r.err
+}
+
+func (r *indexRecordDecoder) syncSnapshotState(s *StoredObject) {
+	s.entityType = common.EntityType(r.byte())
+	s.size = r.varint()
+	s.lastModifiedTime = r.time()
+	s.smbLastModifiedTime = r.time()
+	s.md5 = r.bytes()
+	s.eTag = r.string()
+}
+
+// syncSnapshotWriter records the source objects of a sync into a new snapshot.
+// The snapshot only replaces the previous one once committed, after everything has been transferred.
+type syncSnapshotWriter struct {
+	mu       sync.Mutex
+	path     string
+	tempPath string
+	file     *os.File
+	buffer   *bufio.Writer
+	zipper   *gzip.Writer
+	record   []byte
+	err      error // the first error hit while recording, which stops the snapshot from being committed
+	closed   bool
+}
+
+func newSyncSnapshotWriter(path, fingerprint string, jobID common.JobID) (*syncSnapshotWriter, error) {
+	return newSyncRecordWriter(path, syncSnapshotMagic+fingerprint+"\n", jobID)
+}
+
+// newSyncRecordWriter starts a file of length-prefixed records, in the format of snapshots, that replaces path once committed
+func newSyncRecordWriter(path, header string, jobID common.JobID) (*syncSnapshotWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	tempPath := path + "." + jobID.String() + ".tmp"
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &syncSnapshotWriter{path: path, tempPath: tempPath, file: file, buffer: bufio.NewWriterSize(file, 1<<20)}
+	w.zipper = gzip.NewWriter(w.buffer)
+	if _, err = io.WriteString(w.zipper, header); err != nil {
+		w.discard()
+		return nil, err
+	}
+	return w, nil
+}
+
+// add records an object. Failing to do so only costs the next sync its shortcut, so rather than failing this sync,
+// the error is held back until the snapshot is committed.
+func (w *syncSnapshotWriter) add(storedObject StoredObject) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || w.err != nil {
+		return
+	}
+
+	w.record = appendSyncSnapshotRecord(w.record[:0], storedObject)
+	w.writeRecord(w.record)
+}
+
+// writeRecord appends a record, with the lock held
+func (w *syncSnapshotWriter) writeRecord(record []byte) {
+	var length [binary.MaxVarintLen64]byte
+	if _, err := w.zipper.Write(length[:binary.PutUvarint(length[:], uint64(len(record)))]); err != nil {
+		w.err = err
+	} else if _, err = w.zipper.Write(record); err != nil {
+		w.err = err
+	}
+}
+
+// commit replaces the previous snapshot with the one recorded
+func (w *syncSnapshotWriter) commit() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	err := w.err
+	if err == nil {
+		err = w.zipper.Close()
+	}
+	if err == nil {
+		err = w.buffer.Flush()
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(w.tempPath, w.path)
+	}
+	if err != nil {
+		_ = os.Remove(w.tempPath)
+	}
+	return err
+}
+
+// discard drops what was recorded, leaving the previous snapshot in place
+func (w *syncSnapshotWriter) discard() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	_ = w.file.Close()
+	_ = os.Remove(w.tempPath)
+}
+
+// syncSnapshotRecorder passes the objects of the source on, recording each of them into the snapshot as it goes
+type syncSnapshotRecorder struct {
+	ResourceTraverser
+	snapshot *syncSnapshotWriter
+}
+
+func (t *syncSnapshotRecorder) Traverse(preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	return t.ResourceTraverser.Traverse(preprocessor, func(storedObject StoredObject) error {
+		t.snapshot.add(storedObject)
+		return processor(storedObject)
+	}, filters)
+}
+
+// syncSnapshotTraverser stands in for the destination of an incremental sync, listing what the previous sync left there
+// according to its snapshot. Whether the destination is a directory is still asked of the destination itself.
+type syncSnapshotTraverser struct {
+	ResourceTraverser
+	path        string
+	fingerprint string
+}
+
+// openSyncSnapshot checks that the snapshot at path can stand in for destination.
+// An error satisfying os.IsNotExist means there is no snapshot yet, and errSyncSnapshotSettingsChanged that it is outdated.
+func openSyncSnapshot(path, fingerprint string, destination ResourceTraverser) (*syncSnapshotTraverser, error) {
+	file, _, err := openSyncSnapshotReader(path, syncSnapshotMagic, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	_ = file.Close()
+
+	return &syncSnapshotTraverser{ResourceTraverser: destination, path: path, fingerprint: fingerprint}, nil
+}
+
+// openSyncSnapshotReader opens a file written by a syncSnapshotWriter, positioned at its first record
+func openSyncSnapshotReader(path, magic, fingerprint string) (*os.File, *bufio.Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	zipReader, err := gzip.NewReader(bufio.NewReaderSize(file, 1<<20))
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, fmt.Errorf("%w: %v", errCorruptSyncSnapshot, err)
+	}
+	reader := bufio.NewReaderSize(zipReader, 1<<16)
+
+	header := make([]byte, len(magic)+len(fingerprint)+1)
+	if _, err = io.ReadFull(reader, header); err != nil || !bytes.HasPrefix(header, []byte(magic)) {
+		_ = file.Close()
+		return nil, nil, errCorruptSyncSnapshot
+	}
+	if string(header[len(magic):]) != fingerprint+"\n" {
+		_ = file.Close()
+		return nil, nil, errSyncSnapshotSettingsChanged
+	}
+
+	return file, reader, nil
+}
+
+// readSyncSnapshotRecord reads the next record into buffer, returning io.EOF once there are none left
+func readSyncSnapshotRecord(reader *bufio.Reader, buffer []byte) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil || length > syncSnapshotMaxRecord {
+		return nil, errCorruptSyncSnapshot
+	}
+
+	if uint64(cap(buffer)) < length {
+		buffer = make([]byte, length)
+	}
+	buffer = buffer[:length]
+	if _, err = io.ReadFull(reader, buffer); err != nil {
+		return nil, errCorruptSyncSnapshot
+	}
+	return buffer, nil
+}
+
+func (t *syncSnapshotTraverser) Traverse(preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	file, reader, err := openSyncSnapshotReader(t.path, syncSnapshotMagic, t.fingerprint)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var record []byte
+	for {
+		record, err = readSyncSnapshotRecord(reader, record)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		storedObject, err := decodeSyncSnapshotRecord(record)
+		if err != nil {
+			return err
+		}
+		if preprocessor != nil {
+			preprocessor(&storedObject)
+		}
+
+		err = processIfPassedFilters(filters, storedObject, processor)
+		_, err = getProcessingError(err)
+		if err != nil {
+			return err
+		}
+	}
+}
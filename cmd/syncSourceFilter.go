@@ -0,0 +1,116 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"strings"
+	"sync"
+)
+
+// syncSourceFilterer applies the filters that only the source is judged by, such as those on size or the --filter expression, which the copy of a file
+// at the destination may not match even when the two are in sync. The paths they exclude are remembered, by their paths at the destination,
+// so that the files there whose counterparts at the source are excluded are left alone, rather than deleted as extra files.
+type syncSourceFilterer struct {
+	ResourceTraverser
+	filters []ObjectFilter
+
+	mu       sync.Mutex // the local traverser filters files from several goroutines as it hashes them
+	excluded *objectIndexer
+	rename   *renameRules
+	err      error
+}
+
+func newSyncSourceFilterer(traverser ResourceTraverser, filters []ObjectFilter, rename *renameRules, isDestinationCaseInsensitive bool, spillThreshold int, spillDir string) *syncSourceFilterer {
+	excluded := newSpillingObjectIndexer(spillThreshold, spillDir)
+	excluded.isDestinationCaseInsensitive = isDestinationCaseInsensitive
+	return &syncSourceFilterer{ResourceTraverser: traverser, filters: filters, excluded: excluded, rename: rename}
+}
+
+func (t *syncSourceFilterer) Traverse(preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	sourceFilters := make([]ObjectFilter, 0, len(filters)+len(t.filters))
+	sourceFilters = append(sourceFilters, filters...)
+	for _, filter := range t.filters {
+		sourceFilters = append(sourceFilters, &syncSourceExclusionRecorder{ObjectFilter: filter, filterer: t})
+	}
+
+	if err := t.ResourceTraverser.Traverse(preprocessor, processor, sourceFilters); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *syncSourceFilterer) recordExcluded(object StoredObject) {
+	// the excluded files don't take their paths at the destination from the files that are synced
+	renamed, err := t.rename.renamedPath(object)
+	object.relativePath = renamed
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil {
+		err = t.excluded.store(object)
+	}
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// keepExcluded passes on to next the objects at the destination, unless their counterparts at the source were excluded
+func (t *syncSourceFilterer) keepExcluded(next objectProcessor) objectProcessor {
+	if t == nil {
+		return next
+	}
+
+	return func(object StoredObject) error {
+		key := object.relativePath
+		if t.excluded.isDestinationCaseInsensitive {
+			key = strings.ToLower(key)
+		}
+		if _, excluded, err := t.excluded.lookup(key); err != nil || excluded {
+			return err
+		}
+		return next(object)
+	}
+}
+
+// close releases the paths excluded at the source, which are only needed until the destination has been compared with the source
+func (t *syncSourceFilterer) close() error {
+	if t == nil {
+		return nil
+	}
+	return t.excluded.close()
+}
+
+// syncSourceExclusionRecorder records the objects its filter excludes at the source
+type syncSourceExclusionRecorder struct {
+	ObjectFilter
+	filterer *syncSourceFilterer
+}
+
+func (f *syncSourceExclusionRecorder) DoesPass(object StoredObject) bool {
+	if f.ObjectFilter.DoesPass(object) {
+		return true
+	}
+	f.filterer.recordExcluded(object)
+	return false
+}
@@ -0,0 +1,459 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/Azure/azure-storage-azcopy/v10/jobsAdmin"
+)
+
+// however busy the source, its changes are synced no later than this after the first of them (or the debounce period, if longer)
+const syncWatchMaxDelay = time.Minute
+
+// syncWatchNotifier reports the paths under the watched directory that may have changed
+type syncWatchNotifier interface {
+	// Events receives paths relative to the watched directory, with "" asking for all of it to be rescanned.
+	// It is closed if the notifier fails.
+	Events() <-chan string
+	Close() error
+}
+
+// syncPollingNotifier asks for the whole tree to be rescanned periodically, where file system events aren't available
+type syncPollingNotifier struct {
+	events chan string
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newSyncPollingNotifier(interval time.Duration) *syncPollingNotifier {
+	n := &syncPollingNotifier{events: make(chan string, 1), done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-n.done:
+				return
+			case <-ticker.C:
+				// a rescan that is already waiting covers this one too
+				select {
+				case n.events <- "":
+				default:
+				}
+			}
+		}
+	}()
+	return n
+}
+
+func (n *syncPollingNotifier) Events() <-chan string {
+	return n.events
+}
+
+func (n *syncPollingNotifier) Close() error {
+	n.once.Do(func() { close(n.done) })
+	return nil
+}
+
+// syncWatchFile is what is known of a local file, to tell whether it has changed since it was last synced
+type syncWatchFile struct {
+	size int64
+	lmt  time.Time
+}
+
+// syncWatchTree tracks the files under the watched directory.
+// It holds the size and last modified time of every file in memory for as long as the watch runs, which for a directory of millions of files is a few hundred MB
+type syncWatchTree struct {
+	root      string
+	recursive bool
+	files     map[string]syncWatchFile // keyed by the path relative to the root, with the azcopy path separator
+}
+
+func newSyncWatchTree(root string, recursive bool) (*syncWatchTree, error) {
+	t := &syncWatchTree{root: root, recursive: recursive, files: make(map[string]syncWatchFile)}
+	if _, _, err := t.rescan(""); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// rescan compares what is under rel ("" for the whole tree) with what was known of it,
+// returning the files that have been created or modified, and those that have been deleted, since the last rescan
+func (t *syncWatchTree) rescan(rel string) (changed, deleted []StoredObject, err error) {
+	seen := make(map[string]bool)
+
+	start := filepath.Join(t.root, filepath.FromSlash(rel))
+	err = filepath.WalkDir(start, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// files can vanish from under the walk; they are picked up as deletions below
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		relPath, err := filepath.Rel(t.root, fullPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			relPath = ""
+		}
+
+		if d.IsDir() {
+			if relPath != "" && !t.recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// like the sync itself, the watch skips symbolic links and special files
+		if !d.Type().IsRegular() || (!t.recursive && strings.Contains(relPath, "/")) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		seen[relPath] = true
+		current := syncWatchFile{size: info.Size(), lmt: info.ModTime()}
+		if known, ok := t.files[relPath]; !ok || known.size != current.size || !known.lmt.Equal(current.lmt) {
+			t.files[relPath] = current
+			changed = append(changed, newStoredObject(nil, info.Name(), relPath, common.EEntityType.File(), current.lmt, current.size, noContentProps, noBlobProps, noMetadata, ""))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for relPath := range t.files {
+		if seen[relPath] || !syncWatchPathIsUnder(relPath, rel) {
+			continue
+		}
+		// what was known of the file is kept, since the rename rules may need its last modified time to find it at the destination
+		known := t.files[relPath]
+		delete(t.files, relPath)
+		deleted = append(deleted, newStoredObject(nil, getObjectNameOnly(relPath), relPath, common.EEntityType.File(), known.lmt, known.size, noContentProps, noBlobProps, noMetadata, ""))
+	}
+
+	sort.Slice(changed, func(i, j int) bool { return changed[i].relativePath < changed[j].relativePath })
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].relativePath < deleted[j].relativePath })
+	return changed, deleted, nil
+}
+
+// syncWatchPathIsUnder is true when relPath is dir itself, or within it
+func syncWatchPathIsUnder(relPath, dir string) bool {
+	return dir == "" || relPath == dir || strings.HasPrefix(relPath, dir+"/")
+}
+
+// coalesceSyncWatchPaths drops the paths within others of the list, since rescanning a directory covers everything in it
+func coalesceSyncWatchPaths(paths []string) []string {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	var coalesced []string
+	for _, p := range sorted {
+		if n := len(coalesced); n > 0 && syncWatchPathIsUnder(p, coalesced[n-1]) {
+			continue
+		}
+		coalesced = append(coalesced, p)
+	}
+	return coalesced
+}
+
+// syncWatchFlushTime returns when the changes seen from firstEvent to lastEvent are synced:
+// once the source has been quiet for the debounce period, but no later than syncWatchMaxDelay after the first of them,
+// and no sooner than minInterval after the last job started
+func syncWatchFlushTime(firstEvent, lastEvent, lastJob time.Time, debounce, minInterval time.Duration) time.Time {
+	at := lastEvent.Add(debounce)
+	if latest := firstEvent.Add(max(debounce, syncWatchMaxDelay)); at.After(latest) {
+		at = latest
+	}
+	if earliest := lastJob.Add(minInterval); at.Before(earliest) {
+		at = earliest
+	}
+	return at
+}
+
+// syncWatcher keeps the destination in sync with a local directory once the initial sync has finished,
+// by running a small job for the files changed at the source whenever it has settled
+type syncWatcher struct {
+	tree     *syncWatchTree
+	notifier syncWatchNotifier
+
+	debounce     time.Duration
+	minInterval  time.Duration
+	pollInterval time.Duration
+
+	// set up by the initial sync, and reused by every job that follows it
+	jobTemplate       *common.CopyJobPartOrderRequest
+	filters           []ObjectFilter
+	deleteDestination objectProcessor
+
+	syncDone     chan struct{} // closed once the initial sync has finished
+	syncDoneOnce sync.Once
+	stopCh       chan struct{} // closed when the user cancels
+	stopOnce     sync.Once
+}
+
+// newSyncWatcher starts watching the source, before the initial sync runs so that no change made during it is missed
+func newSyncWatcher(cca *cookedSyncCmdArgs) (*syncWatcher, error) {
+	root := cca.source.ValueLocal()
+	if info, err := os.Stat(root); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("watch needs the source to be a directory, but %s is a file", root)
+	}
+
+	tree, err := newSyncWatchTree(root, cca.recursive)
+	if err != nil {
+		return nil, fmt.Errorf("unable to scan the source to watch: %w", err)
+	}
+
+	w := &syncWatcher{
+		tree:         tree,
+		debounce:     cca.watchDebounce,
+		minInterval:  cca.watchMinInterval,
+		pollInterval: cca.watchPollInterval,
+		syncDone:     make(chan struct{}),
+		stopCh:       make(chan struct{}),
+	}
+
+	if !cca.watchPoll {
+		w.notifier, err = newSyncInotifyNotifier(root, cca.recursive)
+		if err != nil {
+			glcm.Warn(fmt.Sprintf("Polling the source for changes every %v, since file system events aren't available: %v", w.pollInterval, err))
+		}
+	}
+	if w.notifier == nil {
+		w.notifier = newSyncPollingNotifier(w.pollInterval)
+	}
+
+	return w, nil
+}
+
+// setUpJobs has the jobs that follow the sync schedule their transfers from the sync's job template, and delete from the destination as it does
+func (w *syncWatcher) setUpJobs(cca *cookedSyncCmdArgs, template *common.CopyJobPartOrderRequest, filters []ObjectFilter, fpo common.FolderPropertyOption) error {
+	deleter, err := newSyncDeleteProcessor(cca, fpo, template.DstServiceClient)
+	if err != nil {
+		return err
+	}
+
+	w.jobTemplate = template
+	w.filters = filters
+	w.deleteDestination = newFpoAwareProcessor(fpo, deleter.removeImmediately)
+	return nil
+}
+
+// finishSync is called once the initial sync has finished, and returns false if the user has cancelled, in which case there is nothing to watch
+func (w *syncWatcher) finishSync() bool {
+	if w.stopped() {
+		return false
+	}
+	w.syncDoneOnce.Do(func() { close(w.syncDone) })
+	return true
+}
+
+func (w *syncWatcher) watching() bool {
+	select {
+	case <-w.syncDone:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *syncWatcher) stop() {
+	w.stopOnce.Do(func() { close(w.stopCh) })
+}
+
+func (w *syncWatcher) stopped() bool {
+	select {
+	case <-w.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// exitOrWatch ends the sync, unless it goes on to watch the source, in which case the outcome of the initial sync is only reported
+func (cca *cookedSyncCmdArgs) exitOrWatch(lcm common.LifecycleMgr, builder common.OutputBuilder, exitCode common.ExitCode) {
+	if cca.watcher == nil || !cca.watcher.finishSync() {
+		lcm.Exit(builder, exitCode)
+		return
+	}
+
+	lcm.Exit(builder, common.EExitCode.NoExit())
+}
+
+// watchForChanges syncs the changes made at the source until the user cancels
+func (cca *cookedSyncCmdArgs) watchForChanges() {
+	w := cca.watcher
+	defer w.notifier.Close()
+	<-w.syncDone
+
+	glcm.Info(fmt.Sprintf("Watching %s for changes. Press Ctrl+C to stop.", w.tree.root))
+
+	pending := make(map[string]bool)
+	var firstEvent, lastEvent, lastJob time.Time
+	for {
+		var flush <-chan time.Time
+		if len(pending) > 0 {
+			flush = time.After(time.Until(syncWatchFlushTime(firstEvent, lastEvent, lastJob, w.debounce, w.minInterval)))
+		}
+
+		select {
+		case <-w.stopCh:
+			glcm.Exit(func(format common.OutputFormat) string {
+				return "Stopped watching for changes."
+			}, common.EExitCode.Success())
+		case rel, ok := <-w.notifier.Events():
+			if !ok {
+				glcm.Warn(fmt.Sprintf("File system events are no longer available; polling the source for changes every %v instead.", w.pollInterval))
+				w.notifier = newSyncPollingNotifier(w.pollInterval)
+				rel = "" // in case some were missed
+			}
+			if len(pending) == 0 {
+				firstEvent = time.Now()
+			}
+			lastEvent = time.Now()
+			pending[rel] = true
+		case <-flush:
+			paths := make([]string, 0, len(pending))
+			for rel := range pending {
+				paths = append(paths, rel)
+			}
+			pending = make(map[string]bool)
+
+			var changed, deleted []StoredObject
+			for _, rel := range coalesceSyncWatchPaths(paths) {
+				c, d, err := w.tree.rescan(rel)
+				if err != nil {
+					glcm.Warn(fmt.Sprintf("Unable to scan %s for changes: %v", rel, err))
+					continue
+				}
+				changed = append(changed, c...)
+				deleted = append(deleted, d...)
+			}
+
+			if len(changed) > 0 || len(deleted) > 0 {
+				lastJob = time.Now()
+				if err := cca.runWatchJob(changed, deleted); err != nil {
+					glcm.Warn(fmt.Sprintf("Unable to sync the changes at the source: %v", err))
+				}
+			}
+		}
+	}
+}
+
+// runWatchJob uploads the files changed at the source, and removes those deleted from it at the destination, as a job of its own
+func (cca *cookedSyncCmdArgs) runWatchJob(changed, deleted []StoredObject) error {
+	w := cca.watcher
+
+	// each job checks only its own files for collisions, so that the destinations given before don't grow without bound,
+	// nor keep a file from taking the place of one deleted since
+	if err := cca.rename.reset(); err != nil {
+		return err
+	}
+
+	template := *w.jobTemplate
+	template.JobID = common.NewJobID()
+	template.PartNum = 0
+	template.IsFinalPart = false
+	template.Transfers = common.Transfers{}
+	transferScheduler := newCopyTransferProcessor(&template, NumOfFilesPerDispatchJobPart, cca.source, cca.destination, nil, nil, cca.preserveAccessTier, false)
+	transferScheduler.rename = cca.rename
+
+	for _, object := range changed {
+		if _, err := getProcessingError(processIfPassedFilters(w.filters, object, transferScheduler.scheduleCopyTransfer)); err != nil {
+			return err
+		}
+	}
+
+	// the files deleted at the source are deleted from wherever they were renamed to, unless a file changed by this job has been renamed to the same place,
+	// as happens when a file is renamed at the source by only the case of its name, and the rules change the case
+	deleteDestination := w.deleteDestination
+	if cca.rename != nil {
+		deleteDestination = func(object StoredObject) (err error) {
+			var taken bool
+			if object.relativePath, taken, err = cca.rename.vacatedPath(object); err != nil || taken {
+				return err
+			}
+			return w.deleteDestination(object)
+		}
+	}
+
+	deletionsBefore := cca.getDeletionCount()
+	for _, object := range deleted {
+		if _, err := getProcessingError(processIfPassedFilters(w.filters, object, deleteDestination)); err != nil {
+			return err
+		}
+	}
+	deletions := cca.getDeletionCount() - deletionsBefore
+
+	jobStarted, err := transferScheduler.dispatchFinalPart()
+	if err != nil && err != NothingScheduledError {
+		return err
+	}
+	if !jobStarted {
+		if deletions > 0 {
+			glcm.Info(fmt.Sprintf("Deleted %v files from the destination.", deletions))
+		}
+		return nil
+	}
+
+	summary := jobsAdmin.GetJobSummary(template.JobID)
+	cancelled := false
+	for !summary.JobStatus.IsJobDone() {
+		select {
+		case <-w.stopCh:
+			if !cancelled {
+				cancelled = true
+				if err := (cookedCancelCmdArgs{jobID: template.JobID}).process(); err != nil {
+					glcm.Warn(fmt.Sprintf("Unable to cancel job %s: %v", template.JobID, err))
+				}
+			}
+			time.Sleep(time.Second)
+		case <-time.After(time.Second):
+		}
+		summary = jobsAdmin.GetJobSummary(template.JobID)
+	}
+
+	glcm.Info(fmt.Sprintf("Job %s: %v files uploaded, %v failed, %v deleted from the destination. Final job status: %v",
+		template.JobID, summary.TransfersCompleted, summary.TransfersFailed, deletions, summary.JobStatus))
+	return nil
+}
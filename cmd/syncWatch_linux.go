@@ -0,0 +1,188 @@
+//go:build linux
+// +build linux
+
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const syncInotifyMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_ATTRIB |
+	unix.IN_DELETE | unix.IN_DELETE_SELF | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+
+// syncInotifyNotifier reports changes under a directory with inotify, which needs a watch on every directory in the tree
+type syncInotifyNotifier struct {
+	file      *os.File
+	fd        int // kept apart from file, since asking file for it would make it blocking
+	root      string
+	recursive bool
+	events    chan string
+
+	mu          sync.Mutex
+	directories map[int]string // the relative path of the directory behind each watch descriptor
+}
+
+func newSyncInotifyNotifier(root string, recursive bool) (syncWatchNotifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+
+	// a non-blocking file is read through the runtime's poller, so that closing it ends a pending read
+	n := &syncInotifyNotifier{
+		file:        os.NewFile(uintptr(fd), "inotify"),
+		fd:          fd,
+		root:        root,
+		recursive:   recursive,
+		events:      make(chan string, 1024),
+		directories: make(map[int]string),
+	}
+
+	if err = n.addWatches(""); err != nil {
+		_ = n.file.Close()
+		if errors.Is(err, unix.ENOSPC) {
+			return nil, fmt.Errorf("the tree has more directories than fs.inotify.max_user_watches allows: %w", err)
+		}
+		return nil, err
+	}
+
+	go n.readEvents()
+	return n, nil
+}
+
+// addWatches watches the directory at rel, and the directories within it if the watch is recursive
+func (n *syncInotifyNotifier) addWatches(rel string) error {
+	return filepath.WalkDir(filepath.Join(n.root, filepath.FromSlash(rel)), func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil // removed since, which a later event reports
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(n.root, fullPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			relPath = ""
+		}
+
+		wd, err := unix.InotifyAddWatch(n.fd, fullPath, syncInotifyMask)
+		if err != nil {
+			if errors.Is(err, unix.ENOENT) {
+				return filepath.SkipDir
+			}
+			return fmt.Errorf("inotify_add_watch %s: %w", fullPath, err)
+		}
+
+		n.mu.Lock()
+		n.directories[wd] = relPath
+		n.mu.Unlock()
+
+		if relPath != "" && !n.recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+func (n *syncInotifyNotifier) readEvents() {
+	defer close(n.events)
+
+	var buf [unix.SizeofInotifyEvent * 4096]byte
+	for {
+		count, err := n.file.Read(buf[:])
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= count; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+
+			n.handleEvent(int(event.Wd), event.Mask, name)
+		}
+	}
+}
+
+func (n *syncInotifyNotifier) handleEvent(wd int, mask uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		// some events were lost, so everything has to be rescanned
+		n.events <- ""
+		return
+	}
+
+	n.mu.Lock()
+	dir, ok := n.directories[wd]
+	if mask&unix.IN_IGNORED != 0 {
+		delete(n.directories, wd)
+	}
+	n.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	if name == "" {
+		// the event is about the watched directory itself, e.g. its removal
+		if mask&unix.IN_DELETE_SELF != 0 {
+			n.events <- dir
+		}
+		return
+	}
+
+	rel := path.Join(dir, name)
+
+	// the files created in a new directory before it is watched are found by rescanning it
+	if mask&unix.IN_ISDIR != 0 && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 && n.recursive {
+		if err := n.addWatches(rel); err != nil {
+			n.events <- ""
+		}
+	}
+
+	n.events <- rel
+}
+
+func (n *syncInotifyNotifier) Events() <-chan string {
+	return n.events
+}
+
+func (n *syncInotifyNotifier) Close() error {
+	return n.file.Close()
+}
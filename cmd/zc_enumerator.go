@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/url"
@@ -81,6 +82,11 @@ type StoredObject struct {
 	ContainerName string
 	// destination container name. Included in the processor after resolving container names.
 	DstContainerName string
+	// entity tag, only included by traversers of generic HTTP endpoints (e.g. WebDAV), S3 and Google Cloud Storage.
+	eTag string
+	// absolute source URL, only included by the URL list traverser, where each object may come from a different host.
+	// When set, it is used as the source of the transfer in place of the source root and relative path.
+	sourceURL string
 	// access tier, only included by blob traverser.
 	blobAccessTier blob.AccessTier
 	archiveStatus  blob.ArchiveStatus
@@ -98,16 +104,48 @@ type StoredObject struct {
 }
 
 func (s *StoredObject) isMoreRecentThan(storedObject2 StoredObject, preferSMBTime bool) bool {
-	lmtA := s.lastModifiedTime
+	return s.lastModified(preferSMBTime).After(storedObject2.lastModified(preferSMBTime))
+}
+
+// lastModified is the time syncs compare the object by
+func (s *StoredObject) lastModified(preferSMBTime bool) time.Time {
 	if preferSMBTime && !s.smbLastModifiedTime.IsZero() {
-		lmtA = s.smbLastModifiedTime
+		return s.smbLastModifiedTime
+	}
+	return s.lastModifiedTime
+}
+
+// syncHash returns the hash of the object's content that syncs compare by, or nil if it isn't known.
+// MD5 comes from the content properties; the other types are kept in metadata.
+func (s *StoredObject) syncHash(hashType common.SyncHashType) []byte {
+	if hashType == common.ESyncHashType.MD5() {
+		return s.md5
+	}
+
+	encoded, ok := common.TryReadMetadata(s.Metadata, hashType.MetadataKey())
+	if !ok || encoded == nil {
+		return nil
 	}
-	lmtB := storedObject2.lastModifiedTime
-	if preferSMBTime && !storedObject2.smbLastModifiedTime.IsZero() {
-		lmtB = storedObject2.smbLastModifiedTime
+	sum, err := base64.StdEncoding.DecodeString(*encoded)
+	if err != nil {
+		return nil // treat it like no hash is present
 	}
+	return sum
+}
 
-	return lmtA.After(lmtB)
+// setSyncHash records a hash of the object's content where syncHash finds it.
+// Kept in metadata, it also goes along with the object to the destination.
+func (s *StoredObject) setSyncHash(hashType common.SyncHashType, sum []byte) {
+	switch hashType {
+	case common.ESyncHashType.None():
+	case common.ESyncHashType.MD5():
+		s.md5 = sum
+	default:
+		if s.Metadata == nil {
+			s.Metadata = common.Metadata{}
+		}
+		s.Metadata[hashType.MetadataKey()] = to.Ptr(base64.StdEncoding.EncodeToString(sum))
+	}
 }
 
 func (s *StoredObject) isSingleSourceFile() bool {
@@ -358,6 +396,8 @@ type InitResourceTraverserOptions struct {
 	IncrementEnumeration enumerationCounterFunc
 
 	ListOfFiles      <-chan string        // Creates a list of files traverser
+	ListOfURLs       <-chan string        // Http; creates a traverser over a list of absolute URLs
+	HTTPMirrors      []string             // Http; other URLs serving the same file, or the roots of trees identical to the listing
 	ListOfVersionIDs <-chan string        // Used by Blob/DFS
 	ErrorChannel     chan<- ErrorFileInfo // Used by local traverser
 
@@ -374,10 +414,15 @@ type InitResourceTraverserOptions struct {
 	IncludeDirectoryStubs   bool // Blob, BlobFS
 	PreserveBlobTags        bool // Blob, BlobFS
 	StripTopDir             bool // Local
+	ReadSyncSourceETags     bool // Local; surfaces the source ETags recorded by earlier syncs from HTTP, WebDAV, S3 or GCP
 
 	ExcludeContainers []string // Blob account
 	ListVersions      bool     // Blob
 	HardlinkHandling  common.HardlinkHandlingType
+
+	Ignore *azcopyIgnore // Local; skips the paths excluded by .azcopyignore files and --ignore-file
+
+	MaxDepth int // Local, Blob, BlobFS, Files, S3; how many levels below the root a recursive traversal lists, or 0 for no limit
 }
 
 func (o *InitResourceTraverserOptions) PerformChecks() error {
@@ -674,6 +719,28 @@ func InitResourceTraverser(resource common.ResourceString, resourceLocation comm
 		}
 
 	case common.ELocation.Http():
+		if opts.ListOfURLs != nil {
+			// every line carries its own absolute URL, so there is no source resource to parse
+			output, err = newHTTPURLListTraverser(&options, ctx, &opts)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		resourceURL, err := resource.FullURL()
+		if err != nil {
+			return nil, err
+		}
+
+		recommendHttpsIfNecessary(*resourceURL)
+
+		output, err = newHTTPTraverser(resourceURL.String(), &options, ctx, &opts)
+		if err != nil {
+			return nil, err
+		}
+
+	case common.ELocation.WebDAV():
 		resourceURL, err := resource.FullURL()
 		if err != nil {
 			return nil, err
@@ -681,7 +748,7 @@ func InitResourceTraverser(resource common.ResourceString, resourceLocation comm
 
 		recommendHttpsIfNecessary(*resourceURL)
 
-		output, err = newHTTPTraverser(resourceURL.String(), ctx, &opts)
+		output, err = newWebDAVTraverser(resourceURL.String(), &options, ctx, &opts)
 		if err != nil {
 			return nil, err
 		}
@@ -791,6 +858,13 @@ func (e *syncEnumerator) enumerate() (err error) {
 		}
 	}
 
+	// the index may be on disk, which is only needed for the duration of the enumeration
+	defer func() {
+		if closeErr := e.objectIndexer.close(); err == nil {
+			err = closeErr
+		}
+	}()
+
 	// enumerate the primary resource and build lookup map
 	err = e.primaryTraverser.Traverse(noPreProccessor, e.objectIndexer.store, e.filters)
 	handleAcceptableErrors()
@@ -0,0 +1,662 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The --filter flag takes a boolean expression over the properties of each object, for conditions the other
+// filter flags can't combine, e.g.
+//
+//	tags.env == prod and age > 90d and not (tier == Archive or name like '*.tmp')
+//
+// An expression is a comparison, or several joined with and, or, not (also &&, ||, !) and parentheses.
+// A comparison is a field, an operator and a value:
+//   - ==, !=, <, <=, > and >= compare a field with a value; = is the same as ==
+//   - like matches a glob pattern, as --include-pattern does
+//   - matches matches a regular expression
+//   - in (a, b, ...) is true if the field equals any of the values
+//
+// exists(metadata.key) or exists(tags.key) is true if the object has that metadata or tag.
+// Values can be quoted with ' or ", and must be if they contain spaces or any of ()=!<>,&|. So can keys, as in tags."cost center".
+// Text fields that the location doesn't have, or that weren't listed, are empty. Comparisons of lmt or age
+// are false for objects whose last modified time isn't known.
+
+type filterExpressionFieldKind int
+
+const (
+	filterExpressionString   filterExpressionFieldKind = iota
+	filterExpressionSize                               // bytes, written like --include-size-min
+	filterExpressionTime                               // written in ISO8601, like --include-after
+	filterExpressionDuration                           // written like 90d, 2w or 36h
+)
+
+// filterExpressionField reads one property of an object. The value is false if the object doesn't have it.
+type filterExpressionField struct {
+	name string
+	kind filterExpressionFieldKind
+	// caseInsensitive fields hold service-defined values such as tiers, which users shouldn't have to capitalize exactly
+	caseInsensitive bool
+
+	text   func(o *StoredObject, now time.Time) (string, bool)
+	number func(o *StoredObject, now time.Time) (int64, bool)
+}
+
+func stringFilterField(name string, caseInsensitive bool, get func(o *StoredObject) string) filterExpressionField {
+	return filterExpressionField{
+		name:            name,
+		kind:            filterExpressionString,
+		caseInsensitive: caseInsensitive,
+		text: func(o *StoredObject, _ time.Time) (string, bool) {
+			v := get(o)
+			return v, v != ""
+		},
+	}
+}
+
+// filterExpressionFields are the fields an expression can use, by lower-case name.
+// metadata.<key> and tags.<key> are resolved by filterExpressionFieldNamed.
+var filterExpressionFields = func() map[string]filterExpressionField {
+	lmt := func(o *StoredObject, _ time.Time) (int64, bool) {
+		return o.lastModifiedTime.UnixNano(), !o.lastModifiedTime.IsZero()
+	}
+
+	fields := []filterExpressionField{
+		stringFilterField("name", false, func(o *StoredObject) string { return o.name }),
+		stringFilterField("path", false, func(o *StoredObject) string { return o.relativePath }),
+		{
+			name: "size",
+			kind: filterExpressionSize,
+			number: func(o *StoredObject, _ time.Time) (int64, bool) {
+				return o.size, true
+			},
+		},
+		{name: "lmt", kind: filterExpressionTime, number: lmt},
+		{name: "lastModified", kind: filterExpressionTime, number: lmt},
+		{
+			name: "age",
+			kind: filterExpressionDuration,
+			number: func(o *StoredObject, now time.Time) (int64, bool) {
+				return int64(now.Sub(o.lastModifiedTime)), !o.lastModifiedTime.IsZero()
+			},
+		},
+		stringFilterField("type", true, func(o *StoredObject) string { return o.entityType.String() }),
+		stringFilterField("blobType", true, func(o *StoredObject) string { return string(o.blobType) }),
+		stringFilterField("tier", true, func(o *StoredObject) string { return string(o.blobAccessTier) }),
+		stringFilterField("archiveStatus", true, func(o *StoredObject) string { return string(o.archiveStatus) }),
+		stringFilterField("contentType", true, func(o *StoredObject) string { return o.contentType }),
+		stringFilterField("contentEncoding", true, func(o *StoredObject) string { return o.contentEncoding }),
+		stringFilterField("leaseState", true, func(o *StoredObject) string { return string(o.leaseState) }),
+		stringFilterField("leaseStatus", true, func(o *StoredObject) string { return string(o.leaseStatus) }),
+	}
+
+	byName := make(map[string]filterExpressionField, len(fields))
+	for _, f := range fields {
+		byName[strings.ToLower(f.name)] = f
+	}
+	return byName
+}()
+
+func filterExpressionFieldNamed(name string) (filterExpressionField, bool) {
+	if field, ok := filterExpressionFields[strings.ToLower(name)]; ok {
+		return field, true
+	}
+
+	prefix, key, found := strings.Cut(name, ".")
+	if !found || key == "" {
+		return filterExpressionField{}, false
+	}
+
+	switch strings.ToLower(prefix) {
+	case "metadata":
+		// metadata keys are case-insensitive in the service, so they are matched that way here too
+		return filterExpressionField{
+			name: name,
+			kind: filterExpressionString,
+			text: func(o *StoredObject, _ time.Time) (string, bool) {
+				for k, v := range o.Metadata {
+					if strings.EqualFold(k, key) && v != nil {
+						return *v, true
+					}
+				}
+				return "", false
+			},
+		}, true
+	case "tags":
+		// the traversers keep tags query-escaped, as they are sent to the service
+		return filterExpressionField{
+			name: name,
+			kind: filterExpressionString,
+			text: func(o *StoredObject, _ time.Time) (string, bool) {
+				for k, v := range o.blobTags {
+					if unescaped, err := url.QueryUnescape(k); err == nil && unescaped == key {
+						value, err := url.QueryUnescape(v)
+						return value, err == nil
+					}
+				}
+				return "", false
+			},
+		}, true
+	}
+	return filterExpressionField{}, false
+}
+
+func knownFilterExpressionFields() string {
+	names := make([]string, 0, len(filterExpressionFields)+2)
+	for _, f := range filterExpressionFields {
+		names = append(names, f.name)
+	}
+	sort.Strings(names)
+	return strings.Join(append(names, "metadata.<key>", "tags.<key>"), ", ")
+}
+
+type filterExpressionNode interface {
+	eval(o *StoredObject, now time.Time) bool
+}
+
+type filterExpressionAnd struct{ left, right filterExpressionNode }
+
+func (n filterExpressionAnd) eval(o *StoredObject, now time.Time) bool {
+	return n.left.eval(o, now) && n.right.eval(o, now)
+}
+
+type filterExpressionOr struct{ left, right filterExpressionNode }
+
+func (n filterExpressionOr) eval(o *StoredObject, now time.Time) bool {
+	return n.left.eval(o, now) || n.right.eval(o, now)
+}
+
+type filterExpressionNot struct{ operand filterExpressionNode }
+
+func (n filterExpressionNot) eval(o *StoredObject, now time.Time) bool {
+	return !n.operand.eval(o, now)
+}
+
+type filterExpressionExists struct{ field filterExpressionField }
+
+func (n filterExpressionExists) eval(o *StoredObject, now time.Time) bool {
+	_, ok := n.field.text(o, now)
+	return ok
+}
+
+type filterExpressionComparison struct {
+	field    filterExpressionField
+	operator string // ==, !=, <, <=, >, >=, like, matches or in
+
+	texts   []string
+	numbers []int64
+	pattern *regexp.Regexp
+}
+
+func (n filterExpressionComparison) eval(o *StoredObject, now time.Time) bool {
+	if n.field.kind != filterExpressionString {
+		value, ok := n.field.number(o, now)
+		if !ok {
+			return false
+		}
+		switch n.operator {
+		case "==", "in":
+			for _, operand := range n.numbers {
+				if value == operand {
+					return true
+				}
+			}
+			return false
+		case "!=":
+			return value != n.numbers[0]
+		case "<":
+			return value < n.numbers[0]
+		case "<=":
+			return value <= n.numbers[0]
+		case ">":
+			return value > n.numbers[0]
+		case ">=":
+			return value >= n.numbers[0]
+		}
+		return false
+	}
+
+	value, _ := n.field.text(o, now)
+	switch n.operator {
+	case "==", "in":
+		for _, operand := range n.texts {
+			if n.equal(value, operand) {
+				return true
+			}
+		}
+		return false
+	case "!=":
+		return !n.equal(value, n.texts[0])
+	case "like":
+		if n.field.caseInsensitive {
+			value = strings.ToLower(value)
+		}
+		matched, _ := path.Match(n.texts[0], value) // the pattern was checked when parsed
+		return matched
+	case "matches":
+		return n.pattern.MatchString(value)
+	}
+	return false
+}
+
+func (n filterExpressionComparison) equal(a, b string) bool {
+	if n.field.caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// expressionFilter is the ObjectFilter behind --filter
+type expressionFilter struct {
+	expression string
+	root       filterExpressionNode
+	// now is fixed when the expression is parsed, so that age means the same for every object in the job
+	now time.Time
+	// usesBlobTags is set when the expression reads tags, which the blob traversers only list when asked to
+	usesBlobTags bool
+}
+
+func (f *expressionFilter) DoesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *expressionFilter) AppliesOnlyToFiles() bool {
+	return true // most fields describe file content, so folders aren't held to them
+}
+
+func (f *expressionFilter) DoesPass(storedObject StoredObject) bool {
+	return f.root.eval(&storedObject, f.now)
+}
+
+// needsBlobTags is safe to call on a nil filter, i.e. when --filter wasn't given
+func (f *expressionFilter) needsBlobTags() bool {
+	return f != nil && f.usesBlobTags
+}
+
+func buildExpressionFilters(f *expressionFilter) []ObjectFilter {
+	if f == nil {
+		return []ObjectFilter{}
+	}
+	return []ObjectFilter{f}
+}
+
+// parseFilterExpression compiles the value of --filter. An empty expression gives a nil filter.
+func parseFilterExpression(expression string) (*expressionFilter, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+
+	tokens, err := lexFilterExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &filterExpressionParser{expression: expression, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != filterTokenEnd {
+		return nil, p.errorAt(t, "unexpected %s after the end of the expression", t)
+	}
+
+	return &expressionFilter{expression: expression, root: root, now: time.Now(), usesBlobTags: p.usesBlobTags}, nil
+}
+
+type filterTokenKind int
+
+const (
+	filterTokenEnd filterTokenKind = iota
+	filterTokenWord
+	filterTokenString // quoted, so never taken for a keyword
+	filterTokenSymbol // an operator, a parenthesis or a comma
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	text  string
+	start int // byte offset into the expression
+}
+
+func (t filterToken) String() string {
+	switch t.kind {
+	case filterTokenEnd:
+		return "end of expression"
+	case filterTokenString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// isKeyword reports whether t is the unquoted keyword (or one of its symbolic forms)
+func (t filterToken) isKeyword(keyword string, symbols ...string) bool {
+	if t.kind == filterTokenWord && strings.EqualFold(t.text, keyword) {
+		return true
+	}
+	for _, s := range symbols {
+		if t.kind == filterTokenSymbol && t.text == s {
+			return true
+		}
+	}
+	return false
+}
+
+const filterExpressionDelimiters = "()=!<>,&|'\""
+
+func lexFilterExpression(expression string) ([]filterToken, error) {
+	tokens := make([]filterToken, 0)
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, filterToken{kind: filterTokenSymbol, text: string(c), start: i})
+			i++
+		case strings.HasPrefix(expression[i:], "&&") || strings.HasPrefix(expression[i:], "||") ||
+			strings.HasPrefix(expression[i:], "==") || strings.HasPrefix(expression[i:], "!=") ||
+			strings.HasPrefix(expression[i:], "<=") || strings.HasPrefix(expression[i:], ">="):
+			tokens = append(tokens, filterToken{kind: filterTokenSymbol, text: expression[i : i+2], start: i})
+			i += 2
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			tokens = append(tokens, filterToken{kind: filterTokenSymbol, text: string(c), start: i})
+			i++
+		case c == '&' || c == '|':
+			return nil, filterExpressionError(expression, i, "'%c' must be doubled, as in '%c%c'", c, c, c)
+		case c == '\'' || c == '"':
+			var value strings.Builder
+			j := i + 1
+			for ; j < len(expression) && expression[j] != c; j++ {
+				if expression[j] == '\\' && j+1 < len(expression) {
+					j++ // the next character is taken as it is
+				}
+				value.WriteByte(expression[j])
+			}
+			if j == len(expression) {
+				return nil, filterExpressionError(expression, i, "the string starting here is never closed with %c", c)
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenString, text: value.String(), start: i})
+			i = j + 1
+		default:
+			j := i
+			for j < len(expression) && !strings.ContainsRune(filterExpressionDelimiters+" \t\n\r", rune(expression[j])) {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: filterTokenWord, text: expression[i:j], start: i})
+			i = j
+		}
+	}
+	return append(tokens, filterToken{kind: filterTokenEnd, start: len(expression)}), nil
+}
+
+func filterExpressionError(expression string, offset int, format string, args ...interface{}) error {
+	return fmt.Errorf("invalid filter expression %q at column %d: %s", expression, offset+1, fmt.Sprintf(format, args...))
+}
+
+type filterExpressionParser struct {
+	expression   string
+	tokens       []filterToken
+	position     int
+	usesBlobTags bool
+}
+
+func (p *filterExpressionParser) peek() filterToken {
+	return p.tokens[p.position]
+}
+
+func (p *filterExpressionParser) next() filterToken {
+	t := p.tokens[p.position]
+	if t.kind != filterTokenEnd {
+		p.position++
+	}
+	return t
+}
+
+func (p *filterExpressionParser) errorAt(t filterToken, format string, args ...interface{}) error {
+	return filterExpressionError(p.expression, t.start, format, args...)
+}
+
+func (p *filterExpressionParser) expect(symbol string) error {
+	if t := p.next(); !t.isKeyword("", symbol) {
+		return p.errorAt(t, "expected '%s', found %s", symbol, t)
+	}
+	return nil
+}
+
+// parseOr parses the whole grammar, lowest precedence first:
+//
+//	or         = and { ("or" | "||") and }
+//	and        = unary { ("and" | "&&") unary }
+//	unary      = ("not" | "!") unary | "(" or ")" | "exists" "(" field ")" | comparison
+//	comparison = field operator value | field "in" "(" value { "," value } ")"
+func (p *filterExpressionParser) parseOr() (filterExpressionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("or", "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = filterExpressionOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterExpressionParser) parseAnd() (filterExpressionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("and", "&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = filterExpressionAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterExpressionParser) parseUnary() (filterExpressionNode, error) {
+	t := p.peek()
+	switch {
+	case t.isKeyword("not", "!"):
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return filterExpressionNot{operand: operand}, nil
+	case t.isKeyword("", "("):
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case t.isKeyword("exists") && p.tokens[p.position+1].isKeyword("", "("):
+		p.next()
+		p.next()
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		if field.kind != filterExpressionString {
+			return nil, p.errorAt(t, "exists only applies to text fields such as metadata.<key> and tags.<key>, not %s", field.name)
+		}
+		if err = p.expect(")"); err != nil {
+			return nil, err
+		}
+		return filterExpressionExists{field: field}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterExpressionParser) parseField() (filterExpressionField, error) {
+	t := p.next()
+	if t.kind != filterTokenWord {
+		return filterExpressionField{}, p.errorAt(t, "expected a field name, found %s", t)
+	}
+	name := t.text
+	if key := p.peek(); strings.HasSuffix(name, ".") && key.kind == filterTokenString && key.start == t.start+len(t.text) {
+		// a key that needs quoting, as in metadata."cost center"
+		name += p.next().text
+	}
+
+	field, ok := filterExpressionFieldNamed(name)
+	if !ok {
+		return filterExpressionField{}, p.errorAt(t, "unknown field '%s'; the fields are %s", name, knownFilterExpressionFields())
+	}
+	if strings.HasPrefix(strings.ToLower(name), "tags.") {
+		p.usesBlobTags = true
+	}
+	return field, nil
+}
+
+func (p *filterExpressionParser) parseComparison() (filterExpressionNode, error) {
+	field, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+
+	operatorToken := p.next()
+	operator := strings.ToLower(operatorToken.text)
+	switch {
+	case operatorToken.kind == filterTokenSymbol && operator == "=":
+		operator = "=="
+	case operatorToken.kind == filterTokenSymbol && (operator == "==" || operator == "!=" || operator == "<" ||
+		operator == "<=" || operator == ">" || operator == ">="):
+	case operatorToken.kind == filterTokenWord && (operator == "like" || operator == "matches" || operator == "in"):
+	default:
+		return nil, p.errorAt(operatorToken, "expected an operator (==, !=, <, <=, >, >=, like, matches or in) after %s, found %s", field.name, operatorToken)
+	}
+
+	isText := field.kind == filterExpressionString
+	switch operator {
+	case "<", "<=", ">", ">=":
+		if isText {
+			return nil, p.errorAt(operatorToken, "%s is text, so it can't be compared with %s; use ==, !=, like, matches or in", field.name, operator)
+		}
+	case "like", "matches":
+		if !isText {
+			return nil, p.errorAt(operatorToken, "%s is not text, so it can't be compared with %s", field.name, operator)
+		}
+	}
+
+	comparison := filterExpressionComparison{field: field, operator: operator}
+	values := make([]filterToken, 0, 1)
+	if operator == "in" {
+		if err = p.expect("("); err != nil {
+			return nil, err
+		}
+		for {
+			values = append(values, p.next())
+			if !p.peek().isKeyword("", ",") {
+				break
+			}
+			p.next()
+		}
+		if err = p.expect(")"); err != nil {
+			return nil, err
+		}
+	} else {
+		values = append(values, p.next())
+	}
+
+	for _, v := range values {
+		if v.kind != filterTokenWord && v.kind != filterTokenString {
+			return nil, p.errorAt(v, "expected a value to compare %s with, found %s", field.name, v)
+		}
+
+		switch field.kind {
+		case filterExpressionString:
+			comparison.texts = append(comparison.texts, v.text)
+		case filterExpressionSize:
+			size, err := parseSizeFilterString(v.text, field.name)
+			if err != nil {
+				return nil, p.errorAt(v, "%s", err.Error())
+			}
+			comparison.numbers = append(comparison.numbers, size)
+		case filterExpressionTime:
+			// the earliest reading of an ambiguous local time, as --include-after takes
+			t, err := parseISO8601(v.text, true)
+			if err != nil {
+				return nil, p.errorAt(v, "%s must be compared with an ISO8601 date/time, e.g. 2020-08-19 or 2020-08-19T15:04:00Z: %s", field.name, err.Error())
+			}
+			comparison.numbers = append(comparison.numbers, t.UnixNano())
+		case filterExpressionDuration:
+			d, err := parseFilterExpressionDuration(v.text)
+			if err != nil {
+				return nil, p.errorAt(v, "%s must be compared with a duration such as 90d, 2w or 36h, not '%s'", field.name, v.text)
+			}
+			comparison.numbers = append(comparison.numbers, int64(d))
+		}
+	}
+
+	switch operator {
+	case "like":
+		pattern := comparison.texts[0]
+		if field.caseInsensitive {
+			pattern = strings.ToLower(pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, p.errorAt(values[0], "'%s' is not a valid pattern: %s", comparison.texts[0], err.Error())
+		}
+		comparison.texts[0] = pattern
+	case "matches":
+		pattern := comparison.texts[0]
+		if field.caseInsensitive {
+			pattern = "(?i)" + pattern
+		}
+		comparison.pattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, p.errorAt(values[0], "'%s' is not a valid regular expression: %s", comparison.texts[0], err.Error())
+		}
+	}
+
+	return comparison, nil
+}
+
+// parseFilterExpressionDuration takes what time.ParseDuration does, plus whole numbers of days (d) and weeks (w)
+func parseFilterExpressionDuration(s string) (time.Duration, error) {
+	lower := strings.ToLower(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, err := strconv.ParseInt(strings.TrimSuffix(lower, suffix), 10, 64); err == nil && strings.HasSuffix(lower, suffix) {
+			return time.Duration(n) * unit, nil
+		}
+	}
+	return time.ParseDuration(lower)
+}
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -390,6 +391,139 @@ func (_ IncludeBeforeDateFilter) FormatAsUTC(t time.Time) string {
 	return formatAsUTC(t)
 }
 
+// IncludeSizeMinFilter includes files of at least Threshold bytes
+type IncludeSizeMinFilter struct {
+	Threshold int64
+}
+
+func (f *IncludeSizeMinFilter) DoesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *IncludeSizeMinFilter) AppliesOnlyToFiles() bool {
+	return true // folders have no size of their own
+}
+
+func (f *IncludeSizeMinFilter) DoesPass(storedObject StoredObject) bool {
+	return storedObject.size >= f.Threshold
+}
+
+// IncludeSizeMaxFilter includes files of at most Threshold bytes
+type IncludeSizeMaxFilter struct {
+	Threshold int64
+}
+
+func (f *IncludeSizeMaxFilter) DoesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *IncludeSizeMaxFilter) AppliesOnlyToFiles() bool {
+	return true
+}
+
+func (f *IncludeSizeMaxFilter) DoesPass(storedObject StoredObject) bool {
+	return storedObject.size <= f.Threshold
+}
+
+func buildSizeFilters(minSize, maxSize *int64) []ObjectFilter {
+	filters := make([]ObjectFilter, 0)
+	if minSize != nil {
+		filters = append(filters, &IncludeSizeMinFilter{Threshold: *minSize})
+	}
+	if maxSize != nil {
+		filters = append(filters, &IncludeSizeMaxFilter{Threshold: *maxSize})
+	}
+	return filters
+}
+
+// pathDepth is the number of levels a relative path is below the root of the traversal, e.g. 1 for "a" and 2 for "a/b"
+func pathDepth(relativePath string) int {
+	relativePath = strings.Trim(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING)
+	if relativePath == "" {
+		return 0
+	}
+	return strings.Count(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING) + 1
+}
+
+// MaxDepthFilter excludes what is more than MaxDepth levels below the root of the source.
+// The traversers that can avoid listing such objects at all do so too, but this covers the others.
+type MaxDepthFilter struct {
+	MaxDepth int
+}
+
+func (f *MaxDepthFilter) DoesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (f *MaxDepthFilter) AppliesOnlyToFiles() bool {
+	return false // folders deeper than the limit are left out along with what's in them
+}
+
+func (f *MaxDepthFilter) DoesPass(storedObject StoredObject) bool {
+	return pathDepth(storedObject.relativePath) <= f.MaxDepth
+}
+
+// buildMaxDepthFilters returns the filter for a depth limit, where 0 means there is none
+func buildMaxDepthFilters(maxDepth int) []ObjectFilter {
+	if maxDepth <= 0 {
+		return []ObjectFilter{}
+	}
+	return []ObjectFilter{&MaxDepthFilter{MaxDepth: maxDepth}}
+}
+
+// parseSizeFilterString parses the value of a size filter flag. On top of what ParseSizeString accepts, it takes
+// a plain number of bytes, T for terabytes, and a trailing B or iB, so that 500, 64KB, 2GiB and 1T are all valid.
+// Every unit is a power of 1024, as in ParseSizeString.
+func parseSizeFilterString(s string, name string) (int64, error) {
+	message := name + " must be a number of bytes, optionally followed by K, M, G or T. E.g. 500, 64K, 2GiB or 1T"
+
+	lower := strings.ToLower(s)
+	switch {
+	case len(lower) > 2 && strings.HasSuffix(lower, "ib") && strings.ContainsRune("kmgt", rune(lower[len(lower)-3])):
+		lower = lower[:len(lower)-2] // KiB, MiB, GiB or TiB
+	case strings.HasSuffix(lower, "b"):
+		lower = lower[:len(lower)-1]
+	}
+
+	var bytes int64
+	var err error
+	if n, parseErr := strconv.ParseInt(lower, 10, 64); parseErr == nil {
+		bytes = n
+	} else if strings.HasSuffix(lower, "t") {
+		bytes, err = ParseSizeString(lower[:len(lower)-1]+"g", name)
+		bytes *= 1024
+	} else {
+		bytes, err = ParseSizeString(lower, name)
+	}
+
+	if err != nil || bytes < 0 {
+		return 0, fmt.Errorf("%s, but was '%s'", message, s)
+	}
+	return bytes, nil
+}
+
+// parseSizeFilterRange parses the values of --include-size-min and --include-size-max, either of which may be empty
+func parseSizeFilterRange(rawMin, rawMax string) (minSize, maxSize *int64, err error) {
+	if rawMin != "" {
+		parsed, err := parseSizeFilterString(rawMin, "include-size-min")
+		if err != nil {
+			return nil, nil, err
+		}
+		minSize = &parsed
+	}
+	if rawMax != "" {
+		parsed, err := parseSizeFilterString(rawMax, "include-size-max")
+		if err != nil {
+			return nil, nil, err
+		}
+		maxSize = &parsed
+	}
+	if minSize != nil && maxSize != nil && *minSize > *maxSize {
+		return nil, nil, fmt.Errorf("include-size-min (%s) cannot be larger than include-size-max (%s)", rawMin, rawMax)
+	}
+	return minSize, maxSize, nil
+}
+
 type permDeleteFilter struct {
 	deleteSnapshots bool
 	deleteVersions  bool
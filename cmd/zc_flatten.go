@@ -0,0 +1,85 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// flattener puts every file directly under the destination, by its name alone, for copies with --flatten.
+// Files are given names in the order they are listed, which isn't fixed, so with Suffix which file gets which suffix can differ between runs.
+type flattener struct {
+	collision common.FlattenCollision
+
+	// every name given at the destination, with the source path of the file it was given to
+	mu           sync.Mutex
+	destinations map[string]string
+}
+
+func newFlattener(collision common.FlattenCollision) *flattener {
+	return &flattener{collision: collision, destinations: make(map[string]string)}
+}
+
+// destinationPath returns the path, relative to the destination, of the object whose path would otherwise be relativePath.
+// skip is true for folders, which have no place in a flattened destination, and for files left out because of a collision.
+func (f *flattener) destinationPath(object StoredObject, relativePath string) (flattened string, skip bool, err error) {
+	// a single file is wherever the user pointed the destination at
+	if f == nil || relativePath == "" || relativePath == "\x00" {
+		return relativePath, false, nil
+	}
+	if object.entityType == common.EEntityType.Folder() {
+		return "", true, nil
+	}
+
+	name := path.Base(relativePath)
+	source := common.GenerateFullPath(object.ContainerName, object.relativePath)
+	container := common.Iff(object.DstContainerName != "", object.DstContainerName, object.ContainerName)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	flattened = name
+	existing, taken := f.destinations[common.GenerateFullPath(container, flattened)]
+	if taken && existing != source {
+		switch f.collision {
+		case common.EFlattenCollision.Skip():
+			common.LogToJobLogWithPrefix(fmt.Sprintf("Skipping %s, since %s has already been given the name %s at the destination", source, existing, name), common.LogWarning)
+			return "", true, nil
+		case common.EFlattenCollision.Suffix():
+			extension := path.Ext(name)
+			stem := strings.TrimSuffix(name, extension)
+			for n := 1; taken; n++ {
+				flattened = fmt.Sprintf("%s-%d%s", stem, n, extension)
+				_, taken = f.destinations[common.GenerateFullPath(container, flattened)]
+			}
+		default:
+			return "", false, fmt.Errorf("--flatten gives both %s and %s the name %s at the destination; use --flatten-collision to skip or rename one of them", existing, source, name)
+		}
+	}
+
+	f.destinations[common.GenerateFullPath(container, flattened)] = source
+	return flattened, false, nil
+}
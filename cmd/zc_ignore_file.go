@@ -0,0 +1,311 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// azcopyIgnoreFileName is the name of the files that exclude paths from uploads, in the directory they're in and below
+const azcopyIgnoreFileName = ".azcopyignore"
+
+// ignoreRule is one line of an ignore file, which uses the syntax of .gitignore
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool // the line started with !, so it re-includes what earlier lines excluded
+	dirOnly bool // the line ended with /, so it only matches directories
+	// baseNameOnly is set when the pattern has no / other than a trailing one, so it matches a name at any depth
+	baseNameOnly bool
+}
+
+// matches reports whether the rule matches rel, a path relative to the directory of the file the rule is from
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.baseNameOnly {
+		rel = path.Base(rel)
+	}
+	return r.pattern.MatchString(rel)
+}
+
+// parseIgnoreRules reads the lines of an ignore file. As with git, lines that aren't valid patterns are skipped.
+func parseIgnoreRules(content string) []ignoreRule {
+	rules := make([]ignoreRule, 0)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// trailing spaces don't count unless they're escaped
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+			line = line[:len(line)-1]
+		}
+
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		// a / at the start or in the middle anchors the pattern to the directory of the ignore file
+		rule.baseNameOnly = !strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		pattern, err := regexp.Compile("^" + ignorePatternToRegexp(line) + "$")
+		if err != nil {
+			continue
+		}
+		rule.pattern = pattern
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignorePatternToRegexp translates a gitignore glob: * and ? don't match /, **/ matches any number of directories,
+// and a trailing /** matches everything inside a directory
+func ignorePatternToRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); {
+		rest := pattern[i:]
+		switch {
+		case i == 0 && strings.HasPrefix(rest, "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 3
+		case rest == "/**":
+			b.WriteString("/.*")
+			i += 3
+		case strings.HasPrefix(rest, "/**/"):
+			b.WriteString("/(?:.*/)?")
+			i += 4
+		case rest == "**" && i == 0:
+			b.WriteString(".*")
+			i += 2
+		case rest[0] == '*':
+			b.WriteString("[^/]*")
+			i++
+		case rest[0] == '?':
+			b.WriteString("[^/]")
+			i++
+		case rest[0] == '[':
+			end := strings.IndexByte(rest[1:], ']')
+			if end <= 0 {
+				b.WriteString(`\[`) // not a character class, so a literal [
+				i++
+				continue
+			}
+			class := rest[1 : end+1]
+			if class[0] == '!' {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 2
+		case rest[0] == '\\' && len(rest) > 1:
+			b.WriteString(regexp.QuoteMeta(rest[1:2]))
+			i += 2
+		default:
+			b.WriteString(regexp.QuoteMeta(rest[:1]))
+			i++
+		}
+	}
+	return b.String()
+}
+
+// azcopyIgnore decides which paths under root are excluded by an --ignore-file and the .azcopyignore files in the tree.
+// As with git, a file's rules apply to the paths below its directory and take precedence over the rules of the files above
+// it, which take precedence over the --ignore-file; the last rule that matches decides. Nothing inside an excluded
+// directory can be re-included.
+// The .azcopyignore files are read as the directories are first needed, and the decisions about directories are cached.
+// It's safe for concurrent use.
+type azcopyIgnore struct {
+	root   string
+	global []ignoreRule
+
+	mu          sync.Mutex
+	dirRules    map[string][]ignoreRule // by slash-separated path relative to root
+	ignoredDirs map[string]bool
+}
+
+func newAzcopyIgnore(root string, ignoreFile string) (*azcopyIgnore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &azcopyIgnore{
+		root:        root,
+		dirRules:    make(map[string][]ignoreRule),
+		ignoredDirs: make(map[string]bool),
+	}
+	if ignoreFile != "" {
+		content, err := os.ReadFile(ignoreFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the ignore file: %w", err)
+		}
+		m.global = parseIgnoreRules(string(content))
+	}
+	return m, nil
+}
+
+// newUploadIgnore returns the rules for an upload from source, which may end in wildcards. The .azcopyignore files are
+// looked for from the directory the source names, or from the one its wildcards are in.
+func newUploadIgnore(source string, ignoreFile string) (*azcopyIgnore, error) {
+	root := source
+	if i := strings.Index(root, "*"); i >= 0 {
+		root = root[:strings.LastIndexAny(root[:i], `/\`)+1]
+	}
+	return newAzcopyIgnore(root, ignoreFile)
+}
+
+// ignoresPath reports whether the local path is excluded. Paths outside the root never are.
+// It's safe to call on a nil azcopyIgnore.
+func (m *azcopyIgnore) ignoresPath(localPath string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	absolutePath, err := filepath.Abs(localPath)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(m.root, absolutePath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return m.ignores(filepath.ToSlash(rel), isDir)
+}
+
+// ignores reports whether the slash-separated path relative to the root is excluded
+func (m *azcopyIgnore) ignores(rel string, isDir bool) bool {
+	rel = strings.Trim(rel, "/")
+	if rel == "" || rel == "." {
+		return false // the root itself was asked for
+	}
+
+	parent := path.Dir(rel)
+	if parent == "." {
+		parent = ""
+	}
+	if parent != "" && m.ignoresDir(parent) {
+		return true
+	}
+
+	ignored := false
+	for _, r := range m.global {
+		if r.matches(rel, isDir) {
+			ignored = !r.negate
+		}
+	}
+
+	// the rules of the files nearer to rel come later, so they win
+	dirs := []string{""}
+	if parent != "" {
+		segments := strings.Split(parent, "/")
+		for i := range segments {
+			dirs = append(dirs, strings.Join(segments[:i+1], "/"))
+		}
+	}
+	for _, dir := range dirs {
+		sub := rel
+		if dir != "" {
+			sub = rel[len(dir)+1:]
+		}
+		for _, r := range m.rulesOf(dir) {
+			if r.matches(sub, isDir) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+func (m *azcopyIgnore) ignoresDir(dir string) bool {
+	m.mu.Lock()
+	ignored, ok := m.ignoredDirs[dir]
+	m.mu.Unlock()
+	if ok {
+		return ignored
+	}
+
+	// deciding twice when two goroutines get here at once does no harm, since they agree
+	ignored = m.ignores(dir, true)
+	m.mu.Lock()
+	m.ignoredDirs[dir] = ignored
+	m.mu.Unlock()
+	return ignored
+}
+
+// rulesOf returns the rules of the .azcopyignore file in dir, which are none if there's no such file
+func (m *azcopyIgnore) rulesOf(dir string) []ignoreRule {
+	m.mu.Lock()
+	rules, ok := m.dirRules[dir]
+	m.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	ignoreFilePath := filepath.Join(m.root, filepath.FromSlash(dir), azcopyIgnoreFileName)
+	content, err := os.ReadFile(ignoreFilePath)
+	if err == nil {
+		rules = parseIgnoreRules(string(content))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		WarnStdoutAndScanningLog(fmt.Sprintf("Failed to read %s, so its rules are not applied: %s", ignoreFilePath, err))
+	}
+
+	m.mu.Lock()
+	m.dirRules[dir] = rules
+	m.mu.Unlock()
+	return rules
+}
+
+// azcopyIgnore is also a filter, for what's compared with the local files it applies to, e.g. the destination of a sync.
+// Relative paths there are taken as relative to the root.
+
+func (m *azcopyIgnore) DoesSupportThisOS() (msg string, supported bool) {
+	return "", true
+}
+
+func (m *azcopyIgnore) AppliesOnlyToFiles() bool {
+	return false // directories can be excluded too
+}
+
+func (m *azcopyIgnore) DoesPass(storedObject StoredObject) bool {
+	return !m.ignores(storedObject.relativePath, storedObject.entityType == common.EEntityType.Folder())
+}
@@ -49,6 +49,9 @@ type copyTransferProcessor struct {
 	symlinkHandlingType    common.SymlinkHandlingType
 	dryrunMode             bool
 	hardlinkHandlingType   common.HardlinkHandlingType
+
+	// if set, gives objects a different path relative to the destination than the one they have relative to the source
+	rename *renameRules
 }
 
 func newCopyTransferProcessor(copyJobTemplate *common.CopyJobPartOrderRequest, numOfTransfersPerPart int, source, destination common.ResourceString, reportFirstPartDispatched func(bool), reportFinalPartDispatched func(), preserveAccessTier, dryrunMode bool) *copyTransferProcessor {
@@ -175,8 +178,13 @@ func (s *copyTransferProcessor) scheduleCopyTransfer(storedObject StoredObject)
 	if storedObject.relativePath == "\x00" { // Short circuit when we're talking about root/, because the STE is funky about this.
 		srcRelativePath, dstRelativePath = storedObject.relativePath, storedObject.relativePath
 	} else {
+		var renamedPath string
+		if renamedPath, err = s.rename.destinationPath(storedObject); err != nil {
+			return err
+		}
+
 		srcRelativePath = pathEncodeRules(storedObject.relativePath, s.copyJobTemplate.FromTo, false, true)
-		dstRelativePath = pathEncodeRules(storedObject.relativePath, s.copyJobTemplate.FromTo, false, false)
+		dstRelativePath = pathEncodeRules(renamedPath, s.copyJobTemplate.FromTo, false, false)
 		if srcRelativePath != "" {
 			srcRelativePath = "/" + srcRelativePath
 		}
@@ -276,16 +284,9 @@ func (s *copyTransferProcessor) scheduleCopyTransfer(storedObject StoredObject)
 	}
 
 	if len(s.copyJobTemplate.Transfers.List) == s.numOfTransfersPerPart {
-		resp := s.sendPartToSte()
-
-		// TODO: If we ever do launch errors outside of the final "no transfers" error, make them output nicer things here.
-		if resp.ErrorMsg != "" {
-			return errors.New(string(resp.ErrorMsg))
+		if err = s.dispatchPendingPart(); err != nil {
+			return err
 		}
-
-		// reset the transfers buffer
-		s.copyJobTemplate.Transfers = common.Transfers{}
-		s.copyJobTemplate.PartNum++
 	}
 
 	// only append the transfer after we've checked and dispatched a part
@@ -307,6 +308,26 @@ func (s *copyTransferProcessor) scheduleCopyTransfer(storedObject StoredObject)
 	return nil
 }
 
+// dispatchPendingPart sends the transfers scheduled so far, if any, as a part of their own,
+// so that the next part (possibly from another processor sharing the job) starts afresh
+func (s *copyTransferProcessor) dispatchPendingPart() error {
+	if len(s.copyJobTemplate.Transfers.List) == 0 {
+		return nil
+	}
+
+	resp := s.sendPartToSte()
+
+	// TODO: If we ever do launch errors outside of the final "no transfers" error, make them output nicer things here.
+	if resp.ErrorMsg != "" {
+		return errors.New(string(resp.ErrorMsg))
+	}
+
+	// reset the transfers buffer
+	s.copyJobTemplate.Transfers = common.Transfers{}
+	s.copyJobTemplate.PartNum++
+	return nil
+}
+
 var NothingScheduledError = errors.New("no transfers were scheduled because no files matched the specified criteria")
 var FinalPartCreatedMessage = "Final job part has been created"
 
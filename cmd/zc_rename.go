@@ -0,0 +1,507 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// Rename rules change where objects land at the destination, which is otherwise the same path relative to the destination as
+// they have relative to the source. Each rule is written like a sed substitution, s#pattern#replacement#flags, where any
+// punctuation can stand in for the #, and a \ before it makes it part of the pattern or replacement instead.
+// The pattern is a regular expression matched against the relative path, with / as the separator, and the replacement
+// can refer to what it captured with $1 or ${name}. The flags are i, to match regardless of case, and g, to replace
+// every match rather than the first. The rules apply in order, each to the path the one before it produced.
+//
+// The replacement can also use these helpers, in braces:
+//
+//	{lmt:yyyy/MM/dd}  the last modified time of the object, in UTC, in a format made of yyyy, yy, MM, dd, HH, mm and ss
+//	{lower:...}       whatever is after the colon, in lower case, e.g. {lower:$1}
+//	{upper:...}       likewise in upper case
+//
+// and {{ and }} for literal braces.
+
+// renameTemplate is the replacement of a rename rule
+type renameTemplate []renameTemplateNode
+
+type renameTemplateNode struct {
+	text     string         // literal text, in which $ refers to what the pattern captured, for nodes without a function
+	function string         // lmt, lower or upper
+	inner    renameTemplate // the argument of lower and upper
+}
+
+// renameDateTokens are what a {lmt:...} format is made of, besides literal characters, longest first
+var renameDateTokens = []struct {
+	token  string
+	format func(t time.Time) string
+}{
+	{"yyyy", func(t time.Time) string { return fmt.Sprintf("%04d", t.Year()) }},
+	{"yy", func(t time.Time) string { return fmt.Sprintf("%02d", t.Year()%100) }},
+	{"MM", func(t time.Time) string { return fmt.Sprintf("%02d", int(t.Month())) }},
+	{"dd", func(t time.Time) string { return fmt.Sprintf("%02d", t.Day()) }},
+	{"HH", func(t time.Time) string { return fmt.Sprintf("%02d", t.Hour()) }},
+	{"mm", func(t time.Time) string { return fmt.Sprintf("%02d", t.Minute()) }},
+	{"ss", func(t time.Time) string { return fmt.Sprintf("%02d", t.Second()) }},
+}
+
+// formatRenameDate writes t in the given format, e.g. year=yyyy/month=MM
+func formatRenameDate(format string, t time.Time) string {
+	t = t.UTC()
+	var b strings.Builder
+	for len(format) > 0 {
+		matched := false
+		for _, d := range renameDateTokens {
+			if strings.HasPrefix(format, d.token) {
+				b.WriteString(d.format(t))
+				format = format[len(d.token):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			_, size := utf8.DecodeRuneInString(format)
+			b.WriteString(format[:size])
+			format = format[size:]
+		}
+	}
+	return b.String()
+}
+
+// parseRenameTemplate reads a replacement up to the end of s, or up to the } that closes the helper it is the argument of
+func parseRenameTemplate(s string, nested bool) (t renameTemplate, rest string, err error) {
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			t = append(t, renameTemplateNode{text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "{{"), strings.HasPrefix(s, "}}"):
+			text.WriteByte(s[0])
+			s = s[2:]
+		case strings.HasPrefix(s, "${"):
+			// a named submatch, rather than a helper
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, "", fmt.Errorf("'%s' is missing its closing '}'", s)
+			}
+			text.WriteString(s[:end+1])
+			s = s[end+1:]
+		case s[0] == '}':
+			if !nested {
+				return nil, "", errors.New("unexpected '}'; use '}}' for a literal brace")
+			}
+			flush()
+			return t, s[1:], nil
+		case s[0] == '{':
+			flush()
+			colon := strings.IndexByte(s, ':')
+			if colon < 0 {
+				return nil, "", fmt.Errorf("'%s' is missing a ':'; use '{{' for a literal brace", s)
+			}
+			function := s[1:colon]
+			s = s[colon+1:]
+
+			switch function {
+			case "lmt":
+				end := strings.IndexByte(s, '}')
+				if end < 0 {
+					return nil, "", errors.New("{lmt:...} is missing its closing '}'")
+				}
+				t = append(t, renameTemplateNode{function: function, text: s[:end]})
+				s = s[end+1:]
+			case "lower", "upper":
+				var inner renameTemplate
+				if inner, s, err = parseRenameTemplate(s, true); err != nil {
+					return nil, "", err
+				}
+				t = append(t, renameTemplateNode{function: function, inner: inner})
+			default:
+				return nil, "", fmt.Errorf("unknown helper {%s:...}; the helpers are lmt, lower and upper", function)
+			}
+		default:
+			text.WriteByte(s[0])
+			s = s[1:]
+		}
+	}
+
+	if nested {
+		return nil, "", errors.New("{lower:...} or {upper:...} is missing its closing '}'")
+	}
+	flush()
+	return t, "", nil
+}
+
+// expand writes the replacement of the match of re in src, whose submatches are at match
+func (t renameTemplate) expand(dst []byte, re *regexp.Regexp, src string, match []int, lmt time.Time) []byte {
+	for _, node := range t {
+		switch node.function {
+		case "":
+			dst = re.ExpandString(dst, node.text, src, match)
+		case "lmt":
+			dst = append(dst, formatRenameDate(node.text, lmt)...)
+		case "lower":
+			dst = append(dst, strings.ToLower(string(node.inner.expand(nil, re, src, match, lmt)))...)
+		case "upper":
+			dst = append(dst, strings.ToUpper(string(node.inner.expand(nil, re, src, match, lmt)))...)
+		}
+	}
+	return dst
+}
+
+func (t renameTemplate) usesLastModifiedTime() bool {
+	for _, node := range t {
+		if node.function == "lmt" || node.inner.usesLastModifiedTime() {
+			return true
+		}
+	}
+	return false
+}
+
+// renameRule is one s#pattern#replacement#flags substitution
+type renameRule struct {
+	expression  string // as the user wrote it, for messages
+	pattern     *regexp.Regexp
+	replacement renameTemplate
+	global      bool
+}
+
+// parseRenameRule reads a rule written like a sed substitution
+func parseRenameRule(expression string) (renameRule, error) {
+	rule := renameRule{expression: expression}
+	invalid := func(reason string, args ...interface{}) error {
+		return fmt.Errorf("invalid rename rule '%s': %s", expression, fmt.Sprintf(reason, args...))
+	}
+
+	if !strings.HasPrefix(expression, "s") || len(expression) < 2 {
+		return rule, invalid("rules are written like s#pattern#replacement#")
+	}
+	delimiter, size := utf8.DecodeRuneInString(expression[1:])
+	if delimiter == '\\' || unicode.IsLetter(delimiter) || unicode.IsDigit(delimiter) || unicode.IsSpace(delimiter) {
+		return rule, invalid("'%c' can't separate the parts of a rule; use a character such as # or |", delimiter)
+	}
+
+	// split the rest at each delimiter that isn't escaped, keeping the other escapes for the regular expression
+	var parts []string
+	var part strings.Builder
+	rest := expression[1+size:]
+	for len(rest) > 0 {
+		r, n := utf8.DecodeRuneInString(rest)
+		if r == '\\' && len(rest) > n {
+			if next, m := utf8.DecodeRuneInString(rest[n:]); next == delimiter {
+				part.WriteRune(delimiter)
+				rest = rest[n+m:]
+				continue
+			}
+			part.WriteRune(r)
+			rest = rest[n:]
+			r, n = utf8.DecodeRuneInString(rest)
+		}
+		if r == delimiter && len(parts) < 2 {
+			parts = append(parts, part.String())
+			part.Reset()
+		} else {
+			part.WriteRune(r)
+		}
+		rest = rest[n:]
+	}
+	if len(parts) < 2 {
+		return rule, invalid("it needs three '%c', around the pattern and the replacement", delimiter)
+	}
+	pattern, replacement, flags := parts[0], parts[1], part.String()
+
+	caseInsensitive := false
+	for _, flag := range flags {
+		switch flag {
+		case 'g':
+			rule.global = true
+		case 'i':
+			caseInsensitive = true
+		default:
+			return rule, invalid("unknown flag '%c'; the flags are g and i", flag)
+		}
+	}
+
+	if pattern == "" {
+		return rule, invalid("the pattern is empty")
+	}
+	if caseInsensitive {
+		pattern = "(?i)" + pattern
+	}
+	var err error
+	if rule.pattern, err = regexp.Compile(pattern); err != nil {
+		return rule, invalid("%v", err)
+	}
+	if rule.replacement, _, err = parseRenameTemplate(replacement, false); err != nil {
+		return rule, invalid("%v", err)
+	}
+	return rule, nil
+}
+
+// apply returns p with the first match of the rule's pattern replaced, or every match if the rule is global
+func (r renameRule) apply(p string, lmt time.Time) string {
+	var matches [][]int
+	if r.global {
+		matches = r.pattern.FindAllStringSubmatchIndex(p, -1)
+	} else if match := r.pattern.FindStringSubmatchIndex(p); match != nil {
+		matches = [][]int{match}
+	}
+	if matches == nil {
+		return p
+	}
+
+	result := make([]byte, 0, len(p))
+	last := 0
+	for _, match := range matches {
+		result = append(result, p[last:match[0]]...)
+		result = r.replacement.expand(result, r.pattern, p, match, lmt)
+		last = match[1]
+	}
+	return string(append(result, p[last:]...))
+}
+
+// renameRules map the path of each object relative to the source to the one it gets relative to the destination
+type renameRules struct {
+	rules []renameRule
+
+	// the hash of every file's destination, with the hash of the source path of the file it belongs to, so that no two files are sent to the same place.
+	// Only files are checked, since any number of folders can be merged into one.
+	// Once there are more than spillThreshold, they move to disk, in spillDir; zero means they always stay in memory.
+	mu             sync.Mutex
+	destinations   map[renamePathHash]renamePathHash
+	spillThreshold int
+	spillDir       string
+	spilled        *diskObjectIndex
+}
+
+// renamePathHash stands in for a path when checking the destinations of files for collisions, to take less memory than the path
+type renamePathHash [sha256.Size]byte
+
+// newRenameRules reads the rules given with --rename, followed by those in the file given with --rename-file, one to a line.
+// There are no rules if neither is given.
+func newRenameRules(expressions []string, rulesFile string) (*renameRules, error) {
+	rules := make([]renameRule, 0, len(expressions))
+	for _, expression := range expressions {
+		rule, err := parseRenameRule(expression)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if rulesFile != "" {
+		content, err := os.ReadFile(rulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the rename rules file: %w", err)
+		}
+		for i, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			rule, err := parseRenameRule(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s, line %d: %w", rulesFile, i+1, err)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	return &renameRules{rules: rules, destinations: make(map[renamePathHash]renamePathHash)}, nil
+}
+
+// spillAt moves the destinations of the files to disk, in dir, once there are more than threshold of them
+func (r *renameRules) spillAt(threshold int, dir string) {
+	if r == nil {
+		return
+	}
+	r.spillThreshold, r.spillDir = threshold, dir
+}
+
+// reset forgets the destinations given to files so far, e.g. once a job is done with them, deleting them from disk if they were moved there
+func (r *renameRules) reset() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.destinations = make(map[renamePathHash]renamePathHash)
+	if r.spilled == nil {
+		return nil
+	}
+
+	err := r.spilled.close()
+	r.spilled = nil
+	if removeErr := os.RemoveAll(r.spillDir); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// usesLastModifiedTime reports whether any rule formats the last modified time, which must then be listed for every object
+func (r *renameRules) usesLastModifiedTime() bool {
+	if r == nil {
+		return false
+	}
+	for _, rule := range r.rules {
+		if rule.replacement.usesLastModifiedTime() {
+			return true
+		}
+	}
+	return false
+}
+
+// destinationPath returns the relative path the object is given at the destination.
+// It fails if the rules produce a path that isn't valid, or one that another file has already been given.
+func (r *renameRules) destinationPath(object StoredObject) (string, error) {
+	renamed, err := r.renamedPath(object)
+	if err != nil || r == nil || object.entityType != common.EEntityType.File() {
+		return renamed, err
+	}
+
+	source, destination := renameCollisionPaths(object, renamed)
+	sourceHash, destinationHash := sha256.Sum256([]byte(source)), sha256.Sum256([]byte(destination))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, taken, err := r.claimed(destinationHash)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		if existing != sourceHash {
+			return "", fmt.Errorf("the rename rules map '%s' and another file to '%s'", source, destination)
+		}
+		return renamed, nil
+	}
+	return renamed, r.claim(destinationHash, sourceHash)
+}
+
+// vacatedPath returns the relative path at the destination of a file deleted from the source, without giving the path to it.
+// The path is reported as taken if another file has been given it since the destinations were last reset, in which case the file there belongs to that one.
+func (r *renameRules) vacatedPath(object StoredObject) (renamed string, taken bool, err error) {
+	if renamed, err = r.renamedPath(object); err != nil || r == nil || object.entityType != common.EEntityType.File() {
+		return renamed, false, err
+	}
+
+	source, destination := renameCollisionPaths(object, renamed)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, taken, err := r.claimed(sha256.Sum256([]byte(destination)))
+	if err != nil {
+		return "", false, err
+	}
+	return renamed, taken && existing != sha256.Sum256([]byte(source)), nil
+}
+
+// renamedPath applies the rules to the relative path of the object, failing if they produce a path that isn't valid
+func (r *renameRules) renamedPath(object StoredObject) (string, error) {
+	// the root of the source, or a single file, is wherever the user pointed the destination at
+	if r == nil || object.relativePath == "" || object.relativePath == "\x00" {
+		return object.relativePath, nil
+	}
+
+	renamed := object.relativePath
+	for _, rule := range r.rules {
+		renamed = rule.apply(renamed, object.lastModifiedTime)
+	}
+	renamed = strings.TrimPrefix(renamed, common.AZCOPY_PATH_SEPARATOR_STRING)
+
+	if renamed == "" {
+		return "", fmt.Errorf("the rename rules map '%s' to an empty path", object.relativePath)
+	}
+	for _, segment := range strings.Split(renamed, common.AZCOPY_PATH_SEPARATOR_STRING) {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("the rename rules map '%s' to '%s', which may not contain '%s'", object.relativePath, renamed, segment)
+		}
+	}
+	return renamed, nil
+}
+
+// renameCollisionPaths returns the paths that tell whether two files collide:
+// objects in different containers don't collide, unless they are copied to the same container
+func renameCollisionPaths(object StoredObject, renamed string) (source, destination string) {
+	source = common.GenerateFullPath(object.ContainerName, object.relativePath)
+	destination = common.GenerateFullPath(common.Iff(object.DstContainerName != "", object.DstContainerName, object.ContainerName), renamed)
+	return source, destination
+}
+
+// claimed returns the hash of the source of the file the destination has been given to, if any. r.mu must be held.
+func (r *renameRules) claimed(destination renamePathHash) (source renamePathHash, taken bool, err error) {
+	if r.spilled == nil {
+		source, taken = r.destinations[destination]
+		return source, taken, nil
+	}
+
+	claim, taken, err := r.spilled.get(string(destination[:]))
+	copy(source[:], claim.relativePath)
+	return source, taken, err
+}
+
+// claim gives the destination to the source. r.mu must be held.
+func (r *renameRules) claim(destination, source renamePathHash) error {
+	if r.spilled != nil {
+		return r.spilled.put(string(destination[:]), StoredObject{relativePath: string(source[:])})
+	}
+
+	r.destinations[destination] = source
+	if r.spillThreshold > 0 && len(r.destinations) > r.spillThreshold {
+		return r.spill()
+	}
+	return nil
+}
+
+// spill moves the destinations from memory to disk, where they stay until reset
+func (r *renameRules) spill() error {
+	index, err := newDiskObjectIndex(r.spillDir, diskObjectIndexInitialBuckets)
+	if err != nil {
+		return fmt.Errorf("failed to move the destinations of renamed files to disk: %w", err)
+	}
+
+	for destination, source := range r.destinations {
+		if err = index.put(string(destination[:]), StoredObject{relativePath: string(source[:])}); err != nil {
+			_ = index.close()
+			return fmt.Errorf("failed to move the destinations of renamed files to disk: %w", err)
+		}
+	}
+
+	r.spilled, r.destinations = index, make(map[renamePathHash]renamePathHash)
+	return nil
+}
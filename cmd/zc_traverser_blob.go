@@ -62,6 +62,9 @@ type blobTraverser struct {
 	include common.BlobTraverserIncludeOption
 
 	isDFS bool
+
+	// how many levels below the root a recursive traversal lists, or 0 for no limit
+	maxDepth int
 }
 
 var NonErrorDirectoryStubOverlappable = errors.New("The directory stub exists, and can overlap.")
@@ -351,9 +354,12 @@ func (t *blobTraverser) parallelList(containerClient *container.Client, containe
 			// queue up the sub virtual directories if recursive is true
 			if t.recursive {
 				for _, virtualDir := range lResp.Segment.BlobPrefixes {
-					enqueueDir(*virtualDir.Name)
-					if azcopyScanningLogger != nil {
-						azcopyScanningLogger.Log(common.LogDebug, fmt.Sprintf("Enqueuing sub-directory %s for enumeration.", *virtualDir.Name))
+					// the virtual directories at the depth limit are reported, but not listed
+					if t.maxDepth == 0 || pathDepth(strings.TrimPrefix(*virtualDir.Name, searchPrefix)) < t.maxDepth {
+						enqueueDir(*virtualDir.Name)
+						if azcopyScanningLogger != nil {
+							azcopyScanningLogger.Log(common.LogDebug, fmt.Sprintf("Enqueuing sub-directory %s for enumeration.", *virtualDir.Name))
+						}
 					}
 
 					if t.include.DirStubs() {
@@ -561,6 +567,10 @@ func (t *blobTraverser) serialList(containerClient *container.Client, containerN
 			if !t.recursive && strings.Contains(relativePath, common.AZCOPY_PATH_SEPARATOR_STRING) {
 				continue
 			}
+			// a flat listing can't leave out what's below the depth limit, so it's skipped here
+			if t.maxDepth > 0 && pathDepth(relativePath) > t.maxDepth {
+				continue
+			}
 
 			storedObject := t.createStoredObjectForBlob(preprocessor, blobInfo, relativePath, containerName)
 
@@ -610,6 +620,7 @@ func newBlobTraverser(rawURL string, serviceClient *service.Client, ctx context.
 		cpkOptions:                  opts.CpkOptions,
 		preservePermissions:         opts.PreservePermissions,
 		isDFS:                       common.DerefOrZero(common.FirstOrZero(blobOpts).isDFS),
+		maxDepth:                    opts.MaxDepth,
 	}
 
 	disableHierarchicalScanning := strings.ToLower(common.GetEnvironmentVariable(common.EEnvironmentVariable.DisableHierarchicalScanning()))
@@ -55,6 +55,9 @@ type fileTraverser struct {
 	trailingDot                 common.TrailingDotOption
 	destination                 *common.Location
 	hardlinkHandling            common.HardlinkHandlingType
+
+	// how many levels below the root a recursive traversal lists, or 0 for no limit
+	maxDepth int
 }
 
 func createShareClientFromServiceClient(fileURLParts file.URLParts, client *service.Client) (*share.Client, error) {
@@ -340,6 +343,18 @@ func (t *fileTraverser) Traverse(preprocessor objectMorpher, processor objectPro
 	// This func must be threadsafe/goroutine safe
 	enumerateOneDir := func(dir parallel.Directory, enqueueDir func(parallel.Directory), enqueueOutput func(parallel.DirectoryEntry, error)) error {
 		currentDirectoryClient := dir.(*directory.Client)
+
+		// the subdirectories at the depth limit are reported, but not listed
+		listSubdirectories := t.recursive
+		if listSubdirectories && t.maxDepth > 0 {
+			currentURLParts, err := file.ParseURL(currentDirectoryClient.URL())
+			if err != nil {
+				return err
+			}
+			targetPath := strings.TrimSuffix(targetURLParts.DirectoryOrFilePath, common.AZCOPY_PATH_SEPARATOR_STRING)
+			listSubdirectories = pathDepth(strings.TrimPrefix(currentURLParts.DirectoryOrFilePath, targetPath))+1 < t.maxDepth
+		}
+
 		pager := currentDirectoryClient.NewListFilesAndDirectoriesPager(nil)
 		var marker *string
 		for pager.More() {
@@ -374,7 +389,7 @@ func (t *fileTraverser) Traverse(preprocessor objectMorpher, processor objectPro
 					}
 				}
 				enqueueOutput(newAzFileSubdirectoryEntity(currentDirectoryClient, *dirInfo.Name), nil)
-				if t.recursive {
+				if listSubdirectories {
 					// If recursive is turned on, add sub directories to be processed
 					enqueueDir(currentDirectoryClient.NewSubdirectoryClient(*dirInfo.Name))
 				}
@@ -462,6 +477,7 @@ func newFileTraverser(rawURL string, serviceClient *service.Client, ctx context.
 		trailingDot:                 opts.TrailingDotOption,
 		destination:                 opts.DestResourceType,
 		hardlinkHandling:            opts.HardlinkHandling,
+		maxDepth:                    opts.MaxDepth,
 	}
 	return
 }
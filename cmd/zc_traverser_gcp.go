@@ -70,6 +70,7 @@ func (t *gcpTraverser) Traverse(preprocessor objectMorpher, processor objectProc
 				noBlobProps,
 				gie.NewCommonMetadata(),
 				t.gcpURLParts.BucketName)
+			storedObject.eTag = attrs.Etag
 			err = processIfPassedFilters(filters, storedObject,
 				processor)
 			if err != nil {
@@ -129,6 +130,7 @@ func (t *gcpTraverser) Traverse(preprocessor objectMorpher, processor objectProc
 				noBlobProps,
 				oie.NewCommonMetadata(),
 				t.gcpURLParts.BucketName)
+			storedObject.eTag = attrs.Etag
 
 			err = processIfPassedFilters(filters,
 				storedObject,
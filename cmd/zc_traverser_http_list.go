@@ -0,0 +1,272 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// httpURLListConcurrency bounds how many HEAD requests the URL list traverser keeps in flight
+const httpURLListConcurrency = 32
+
+// httpURLListTraverser enumerates the files named by a list of absolute URLs, which may live on any number of hosts.
+// Each line of the list holds a URL, optionally followed by the URLs of mirrors serving the same file, and then by the path
+// (relative to the destination) the file should be saved under, all separated by whitespace. Without a path, the last segment of the URL path is used.
+// Blank lines and lines starting with # are ignored.
+type httpURLListTraverser struct {
+	listReader <-chan string
+	ctx        context.Context
+
+	// issues the HEAD requests, carrying the same credentials and headers as a single-URL traversal
+	requester *httpTraverser
+
+	// mirrors are only supported for downloads to the local disk; elsewhere, lines listing them are rejected
+	allowMirrors bool
+
+	incrementEnumerationCounter enumerationCounterFunc
+}
+
+// httpURLListEntry is a single parsed line of a URL list
+type httpURLListEntry struct {
+	sourceURL string
+	mirrors   []string
+	target    string
+}
+
+func newHTTPURLListTraverser(clientOptions *azcore.ClientOptions, ctx context.Context, opts *InitResourceTraverserOptions) (*httpURLListTraverser, error) {
+	if opts.ListOfURLs == nil {
+		panic("list of URLs channel must not be nil")
+	}
+
+	incrementFunc := opts.IncrementEnumeration
+	if incrementFunc == nil {
+		incrementFunc = enumerationCounterFuncNoop
+	}
+
+	requester, err := newHTTPRequestTraverser("", clientOptions, ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpURLListTraverser{
+		listReader:                  opts.ListOfURLs,
+		ctx:                         ctx,
+		requester:                   requester,
+		allowMirrors:                opts.DestResourceType != nil && *opts.DestResourceType == common.ELocation.Local(),
+		incrementEnumerationCounter: incrementFunc,
+	}, nil
+}
+
+// IsDirectory is always true: the list acts as a virtual folder holding every target path
+func (t *httpURLListTraverser) IsDirectory(isSource bool) (bool, error) {
+	return true, nil
+}
+
+func (t *httpURLListTraverser) Traverse(preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	type probeResult struct {
+		entry httpURLListEntry
+		line  string // what to report on failure
+		props httpResourceProperties
+		err   error
+	}
+
+	// Probe the URLs concurrently, but hand the results to the processor in list order,
+	// so that the plan files (and any warnings) are deterministic.
+	pending := make(chan chan probeResult, httpURLListConcurrency)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(pending)
+		// if the traversal stops early, the rest of the list is still read, so that whatever produces it isn't left blocked
+		defer func() {
+			for range t.listReader {
+			}
+		}()
+		sem := make(chan struct{}, httpURLListConcurrency)
+
+		for line := range t.listReader {
+			entry, ok, err := parseHTTPURLListLine(line)
+			if !ok && err == nil {
+				continue
+			}
+			if err == nil && len(entry.mirrors) > 0 && !t.allowMirrors {
+				err = errors.New("mirrors are only supported when downloading from HTTP locations to the local disk")
+			}
+
+			resultChan := make(chan probeResult, 1)
+			select {
+			case pending <- resultChan:
+			case <-done:
+				return
+			}
+
+			if err != nil {
+				resultChan <- probeResult{line: line, err: err}
+				continue
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func() {
+				defer func() { <-sem }()
+				props, err := t.requester.head(entry.sourceURL)
+				resultChan <- probeResult{entry: entry, line: entry.sourceURL, props: props, err: err}
+			}()
+		}
+	}()
+
+	// several URLs commonly share a file name; the second one would silently overwrite the first
+	targets := make(map[string]string)
+
+	for resultChan := range pending {
+		var result probeResult
+		select {
+		case result = <-resultChan:
+		case <-t.ctx.Done():
+			return t.ctx.Err()
+		}
+
+		if result.err != nil {
+			WarnStdoutAndScanningLog(fmt.Sprintf("Skipping %s as it cannot be scanned due to error: %s",
+				common.URLStringExtension(result.line).RedactSecretQueryParamForLogging(), result.err))
+			continue
+		}
+
+		if previous, ok := targets[result.entry.target]; ok {
+			WarnStdoutAndScanningLog(fmt.Sprintf("Skipping %s as %s is already saved to %s. Add a target path to the line to keep both.",
+				common.URLStringExtension(result.entry.sourceURL).RedactSecretQueryParamForLogging(),
+				common.URLStringExtension(previous).RedactSecretQueryParamForLogging(),
+				result.entry.target))
+			continue
+		}
+		targets[result.entry.target] = result.entry.sourceURL
+
+		object := StoredObject{
+			name:             path.Base(result.entry.target),
+			entityType:       common.EEntityType.File(),
+			lastModifiedTime: result.props.lastModified,
+			size:             result.props.contentLength,
+			md5:              result.props.contentMD5,
+			contentType:      result.props.contentType,
+			eTag:             result.props.etag,
+			Metadata:         common.Metadata{},
+			relativePath:     result.entry.target,
+			sourceURL:        result.entry.sourceURL,
+		}
+		// the transfer engine picks the mirrors up from here
+		common.SetHTTPMirrors(object.Metadata, result.entry.mirrors)
+
+		if preprocessor != nil {
+			preprocessor(&object)
+		}
+
+		err := processIfPassedFilters(filters, object, processor)
+		_, err = getProcessingError(err)
+		if err != nil {
+			return err
+		}
+
+		t.incrementEnumerationCounter(object.entityType)
+	}
+
+	return nil
+}
+
+// parseHTTPURLListLine parses "<url> [mirror url...] [target path]". ok is false for blank lines and comments.
+func parseHTTPURLListLine(line string) (entry httpURLListEntry, ok bool, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return entry, false, nil
+	}
+
+	rawURL, target := cutHTTPURLListField(line)
+	u, err := parseAbsoluteHTTPURL(rawURL)
+	if err != nil {
+		return entry, false, err
+	}
+
+	// any further URLs are mirrors; whatever follows them is the target path, spaces and all
+	var mirrors []string
+	for target != "" {
+		field, rest := cutHTTPURLListField(target)
+		mirror, err := url.Parse(field)
+		if err != nil || mirror.Scheme == "" || mirror.Host == "" {
+			break
+		}
+		if _, err := parseAbsoluteHTTPURL(field); err != nil {
+			return entry, false, fmt.Errorf("invalid mirror: %w", err)
+		}
+		mirrors = append(mirrors, mirror.String())
+		target = rest
+	}
+
+	if target == "" {
+		target = path.Base(u.Path)
+		if target == "." || target == "/" {
+			return entry, false, errors.New("the URL has no file name; add a target path after it")
+		}
+	}
+
+	target = path.Clean(strings.ReplaceAll(target, `\`, "/"))
+	if strings.HasPrefix(target, "/") || target == ".." || strings.HasPrefix(target, "../") {
+		return entry, false, fmt.Errorf("target path %q must be relative to the destination", target)
+	}
+	if target == "." {
+		return entry, false, errors.New("the target path must name a file")
+	}
+
+	return httpURLListEntry{sourceURL: u.String(), mirrors: mirrors, target: target}, true, nil
+}
+
+// cutHTTPURLListField splits the first whitespace-separated field of a line from the rest of it
+func cutHTTPURLListField(line string) (field, rest string) {
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return line[:i], strings.TrimSpace(line[i:])
+	}
+	return line, ""
+}
+
+// parseAbsoluteHTTPURL parses a URL that HTTP sources can be downloaded from
+func parseAbsoluteHTTPURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("only absolute http:// and https:// URLs are supported")
+	}
+	if _, ok := u.User.Password(); ok {
+		return nil, errHTTPPasswordInURL
+	}
+	return u, nil
+}
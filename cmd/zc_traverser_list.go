@@ -109,6 +109,13 @@ func newListTraverser(resource common.ResourceString, resourceLocation common.Lo
 			source.Value = common.GenerateFullPath(resource.ValueLocal(), relativeChildPath)
 		}
 
+		// the child's depth limit counts from the child, rather than from the root of the list.
+		// Anything the child lists that is too deep for the root is filtered out.
+		maxDepth := 0
+		if options.MaxDepth > 0 {
+			maxDepth = max(options.MaxDepth-pathDepth(relativeChildPath), 1)
+		}
+
 		// Construct a traverser that goes through the child
 		traverser, err := InitResourceTraverser(source, resourceLocation, ctx, InitResourceTraverserOptions{
 			DestResourceType: nil,
@@ -130,6 +137,8 @@ func newListTraverser(resource common.ResourceString, resourceLocation common.Lo
 			GetPropertiesInFrontend: options.GetPropertiesInFrontend,
 			IncludeDirectoryStubs:   options.IncludeDirectoryStubs,
 			PreserveBlobTags:        options.PreserveBlobTags,
+			Ignore:                  options.Ignore,
+			MaxDepth:                maxDepth,
 		})
 		if err != nil {
 			return nil, err
@@ -22,11 +22,9 @@ package cmd
 
 import (
 	"context"
-	"crypto/md5"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
 	"io/fs"
 	"os"
@@ -53,9 +51,16 @@ type localTraverser struct {
 
 	targetHashType common.SyncHashType
 	hashAdapter    common.HashDataAdapter
+	// reads the source ETags recorded by earlier syncs from HTTP; nil unless they're needed
+	sourceETagAdapter common.HashDataAdapter
 	// receives fullPath entries and manages hashing of files lacking metadata.
 	hashTargetChannel chan string
 	hardlinkHandling  common.HardlinkHandlingType
+	// the paths excluded by .azcopyignore files and --ignore-file aren't enumerated; nil unless the traverser is a source
+	ignore *azcopyIgnore
+
+	// how many levels below the root a recursive traversal lists, or 0 for no limit
+	maxDepth int
 }
 
 func (t *localTraverser) IsDirectory(bool) (bool, error) {
@@ -203,13 +208,18 @@ func writeToErrorChannel(errorChannel chan<- ErrorFileInfo, err ErrorFileInfo) {
 // Separate this from the traverser for two purposes:
 // 1) Cleaner code
 // 2) Easier to test individually than to test the entire traverser.
+// walkFunc isn't called for the paths (relative to fullPath) for which skipPath returns true, nor for anything inside
+// such directories, which aren't read at all. skipPath may be nil.
+// Unless maxDepth is 0, nothing more than maxDepth levels below fullPath is walked, and the directories at that depth aren't read.
 func WalkWithSymlinks(appCtx context.Context,
 	fullPath string,
 	walkFunc filepath.WalkFunc,
 	symlinkHandling common.SymlinkHandlingType,
 	errorChannel chan<- ErrorFileInfo,
 	hardlinkHandling common.HardlinkHandlingType,
-	incrementEnumerationCounter enumerationCounterFunc) (err error) {
+	incrementEnumerationCounter enumerationCounterFunc,
+	skipPath func(relativePath string, isDir bool) bool,
+	maxDepth int) (err error) {
 
 	// We want to re-queue symlinks up in their evaluated form because filepath.Walk doesn't evaluate them for us.
 	// So, what is the plan of attack?
@@ -237,14 +247,7 @@ func WalkWithSymlinks(appCtx context.Context,
 	for len(walkQueue) > 0 {
 		queueItem := walkQueue[0]
 		walkQueue = walkQueue[1:]
-		// walk contents of this queueItem in parallel
-		// (for simplicity of coding, we don't parallelize across multiple queueItems)
-		parallel.Walk(appCtx, queueItem.fullPath, EnumerationParallelism, EnumerationParallelStatFiles, func(filePath string, fileInfo os.FileInfo, fileError error) error {
-			if fileError != nil {
-				WarnStdoutAndScanningLog(fmt.Sprintf("Accessing '%s' failed with error: %s", filePath, fileError.Error()))
-				writeToErrorChannel(errorChannel, ErrorFileInfo{FilePath: filePath, FileInfo: fileInfo, ErrorMsg: fileError})
-				return nil
-			}
+		relativePathOf := func(filePath string) string {
 			computedRelativePath := strings.TrimPrefix(cleanLocalPath(filePath), cleanLocalPath(queueItem.fullPath))
 			computedRelativePath = cleanLocalPath(common.GenerateFullPath(queueItem.relativeBase, computedRelativePath))
 			computedRelativePath = strings.TrimPrefix(computedRelativePath, common.AZCOPY_PATH_SEPARATOR_STRING)
@@ -252,12 +255,43 @@ func WalkWithSymlinks(appCtx context.Context,
 			if computedRelativePath == "." {
 				computedRelativePath = ""
 			}
+			return computedRelativePath
+		}
+
+		var skipDir func(dirPath string) bool
+		if skipPath != nil || maxDepth > 0 {
+			skipDir = func(dirPath string) bool {
+				relativePath := relativePathOf(dirPath)
+				if maxDepth > 0 && pathDepth(relativePath) >= maxDepth {
+					return true
+				}
+				return skipPath != nil && skipPath(relativePath, true)
+			}
+		}
+
+		// walk contents of this queueItem in parallel
+		// (for simplicity of coding, we don't parallelize across multiple queueItems)
+		parallel.WalkSkippingDirs(appCtx, queueItem.fullPath, EnumerationParallelism, EnumerationParallelStatFiles, skipDir, func(filePath string, fileInfo os.FileInfo, fileError error) error {
+			if fileError != nil {
+				WarnStdoutAndScanningLog(fmt.Sprintf("Accessing '%s' failed with error: %s", filePath, fileError.Error()))
+				writeToErrorChannel(errorChannel, ErrorFileInfo{FilePath: filePath, FileInfo: fileInfo, ErrorMsg: fileError})
+				return nil
+			}
+			computedRelativePath := relativePathOf(filePath)
 
 			if fileInfo == nil {
 				err := fmt.Errorf("fileInfo is nil for file %s", filePath)
 				WarnStdoutAndScanningLog(err.Error())
 				return nil
 			}
+
+			if skipPath != nil && computedRelativePath != "" && skipPath(computedRelativePath, fileInfo.IsDir()) {
+				return nil
+			}
+			// what is found through a symlink to a directory at the depth limit is too deep
+			if maxDepth > 0 && pathDepth(computedRelativePath) > maxDepth {
+				return nil
+			}
 			if fileInfo.Mode()&os.ModeSymlink != 0 {
 				if symlinkHandling.Preserve() {
 					// Handle it like it's not a symlink
@@ -412,6 +446,24 @@ func WalkWithSymlinks(appCtx context.Context,
 	return
 }
 
+// applyRecordedSourceETag exposes the source ETag recorded when the file was last synced from HTTP, as if it were metadata.
+// It's ignored if the file has been modified since.
+func (t *localTraverser) applyRecordedSourceETag(storedObject *StoredObject) {
+	if storedObject.entityType != common.EEntityType.File() {
+		return
+	}
+
+	data, err := t.sourceETagAdapter.GetHashData(storedObject.relativePath)
+	if err != nil || data == nil || data.SourceETag == "" || !data.LMT.Equal(storedObject.lastModifiedTime) {
+		return // without it, the file is compared by size and time instead
+	}
+
+	if storedObject.Metadata == nil {
+		storedObject.Metadata = common.Metadata{}
+	}
+	storedObject.Metadata[common.SyncSourceETagMetadataKey] = &data.SourceETag
+}
+
 func (t *localTraverser) GetHashData(relPath string) (*common.SyncHashData, error) {
 	if t.targetHashType == common.ESyncHashType.None() {
 		return nil, nil // no-op
@@ -481,7 +533,7 @@ func (t *localTraverser) prepareHashingThreads(preprocessor objectMorpher, proce
 	// set up for threaded hashing
 	t.hashTargetChannel = make(chan string, 1_000) // "reasonable" backlog
 	// Use half of the available CPU cores for hashing to prevent throttling the STE too hard if hashing is still occurring when the first job part gets sent out
-	hashingThreadCount := runtime.NumCPU() / 2
+	hashingThreadCount := max(runtime.NumCPU()/2, 1) // but at least one, or files needing a hash would never be processed
 	hashError := make(chan error, hashingThreadCount)
 	wg := &sync.WaitGroup{}
 	immediateStopHashing := int32(0)
@@ -553,11 +605,7 @@ func (t *localTraverser) prepareHashingThreads(preprocessor objectMorpher, proce
 					return
 				}
 
-				var hasher hash.Hash // set up hasher
-				switch t.targetHashType {
-				case common.ESyncHashType.MD5():
-					hasher = md5.New()
-				}
+				hasher := t.targetHashType.NewHash() // set up hasher
 
 				// hash.Hash provides a writer type, allowing us to do a (small, 32MB to be precise) buffered write into the hasher and avoid memory concerns
 				_, err = io.Copy(hasher, f)
@@ -588,12 +636,7 @@ func (t *localTraverser) prepareHashingThreads(preprocessor objectMorpher, proce
 					newStoredObject(
 						func(storedObject *StoredObject) {
 							// apply the hash data
-							// storedObject.hashData = hashData
-							switch hashData.Mode {
-							case common.ESyncHashType.MD5():
-								storedObject.md5 = sum
-							default: // no-op
-							}
+							storedObject.setSyncHash(hashData.Mode, sum)
 
 							if preprocessor != nil {
 								// apply the original preprocessor
@@ -647,12 +690,9 @@ func (t *localTraverser) prepareHashingThreads(preprocessor objectMorpher, proce
 			}
 		}
 
-		// storedObject.hashData = hashData
-		switch hashData.Mode {
-		case common.ESyncHashType.MD5():
-			md5data, _ := base64.StdEncoding.DecodeString(hashData.Data) // If decode fails, treat it like no hash is present.
-			storedObject.md5 = md5data
-		default: // do nothing, no hash is present.
+		// If decode fails, treat it like no hash is present.
+		if sum, err := base64.StdEncoding.DecodeString(hashData.Data); err == nil {
+			storedObject.setSyncHash(hashData.Mode, sum)
 		}
 
 		// delay the mutex until after potentially long-running operations
@@ -671,6 +711,10 @@ func (t *localTraverser) Traverse(preprocessor objectMorpher, processor objectPr
 		return fmt.Errorf("failed to scan path %s due to %w", t.fullPath, err)
 	}
 
+	if t.sourceETagAdapter != nil {
+		preprocessor = preprocessor.FollowedBy(t.applyRecordedSourceETag)
+	}
+
 	finalizer, hashingProcessor := t.prepareHashingThreads(preprocessor, processor, filters)
 
 	// if the path is a single file, then pass it through the filters and send to processor
@@ -783,7 +827,14 @@ func (t *localTraverser) Traverse(preprocessor objectMorpher, processor objectPr
 			}
 
 			// note: Walk includes root, so no need here to separately create StoredObject for root (as we do for other folder-aware sources)
-			return finalizer(WalkWithSymlinks(t.appCtx, t.fullPath, processFile, t.symlinkHandling, t.errorChannel, t.hardlinkHandling, t.incrementEnumerationCounter))
+			var skipPath func(relativePath string, isDir bool) bool
+			if t.ignore != nil {
+				skipPath = func(relativePath string, isDir bool) bool {
+					return t.ignore.ignoresPath(common.GenerateFullPath(t.fullPath, relativePath), isDir)
+				}
+			}
+
+			return finalizer(WalkWithSymlinks(t.appCtx, t.fullPath, processFile, t.symlinkHandling, t.errorChannel, t.hardlinkHandling, t.incrementEnumerationCounter, skipPath, t.maxDepth))
 		} else {
 			// if recursive is off, we only need to scan the files immediately under the fullPath
 			// We don't transfer any directory properties here, not even the root. (Because the root's
@@ -800,6 +851,9 @@ func (t *localTraverser) Traverse(preprocessor objectMorpher, processor objectPr
 			for _, entry := range entries {
 				// This won't change. It's purely to hand info off to STE about where the symlink lives.
 				relativePath := entry.Name()
+				if t.ignore.ignoresPath(common.GenerateFullPath(t.fullPath, relativePath), entry.IsDir()) {
+					continue
+				}
 				fileInfo, _ := entry.Info()
 				if fileInfo.Mode()&os.ModeSymlink != 0 {
 					if t.symlinkHandling.None() {
@@ -892,6 +946,15 @@ func newLocalTraverser(fullPath string, ctx context.Context, opts InitResourceTr
 		}
 	}
 
+	var sourceETagAdapter common.HashDataAdapter
+	if opts.ReadSyncSourceETags {
+		var err error
+		sourceETagAdapter, err = common.NewHashDataAdapter(common.LocalHashDir, fullPath, common.LocalHashStorageMode)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize hash adapter: %w", err)
+		}
+	}
+
 	traverser := localTraverser{
 		fullPath:                    cleanLocalPath(fullPath),
 		recursive:                   opts.Recursive,
@@ -901,8 +964,11 @@ func newLocalTraverser(fullPath string, ctx context.Context, opts InitResourceTr
 		errorChannel:                opts.ErrorChannel,
 		targetHashType:              opts.SyncHashType,
 		hashAdapter:                 hashAdapter,
+		sourceETagAdapter:           sourceETagAdapter,
 		stripTopDir:                 opts.StripTopDir,
 		hardlinkHandling:            opts.HardlinkHandling,
+		ignore:                      opts.Ignore,
+		maxDepth:                    opts.MaxDepth,
 	}
 	return &traverser, nil
 }
@@ -1,9 +1,14 @@
 package cmd
 
 import (
-	"github.com/stretchr/testify/assert"
+	"context"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestCleanLocalPath(t *testing.T) {
@@ -47,4 +52,77 @@ func TestCleanLocalPathForWindows(t *testing.T) {
 	for orig, expected := range testCases {
 		a.Equal(expected, cleanLocalPath(orig))
 	}
-}
\ No newline at end of file
+}
+func TestLocalTraverserReadsSyncSourceETags(t *testing.T) {
+	a := assert.New(t)
+
+	oldMode := common.LocalHashStorageMode
+	common.LocalHashStorageMode = common.EHashStorageMode.HiddenFiles()
+	defer func() { common.LocalHashStorageMode = oldMode }()
+
+	dir := t.TempDir()
+	for _, name := range []string{"unchanged", "modified", "unrecorded"} {
+		a.NoError(os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	adapter, err := common.NewHashDataAdapter(common.LocalHashDir, dir, common.LocalHashStorageMode)
+	a.NoError(err)
+	for _, name := range []string{"unchanged", "modified"} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		a.NoError(err)
+		a.NoError(adapter.SetHashData(name, &common.SyncHashData{LMT: fi.ModTime(), SourceETag: `"etag-` + name + `"`}))
+	}
+
+	// a file changed since it was synced no longer matches the recorded ETag
+	later := time.Now().Add(time.Hour)
+	a.NoError(os.Chtimes(filepath.Join(dir, "modified"), later, later))
+
+	traverser, err := newLocalTraverser(dir, context.Background(), InitResourceTraverserOptions{ReadSyncSourceETags: true})
+	a.NoError(err)
+
+	processor := dummyProcessor{}
+	a.NoError(traverser.Traverse(noPreProccessor, processor.process, nil))
+
+	eTags := map[string]string{}
+	for _, object := range processor.record {
+		if eTag, ok := common.TryReadMetadata(object.Metadata, common.SyncSourceETagMetadataKey); ok {
+			eTags[object.relativePath] = *eTag
+		}
+	}
+	a.Equal(map[string]string{"unchanged": `"etag-unchanged"`}, eTags)
+}
+
+func TestLocalTraverserComputesSyncHashes(t *testing.T) {
+	a := assert.New(t)
+
+	oldMode := common.LocalHashStorageMode
+	common.LocalHashStorageMode = common.EHashStorageMode.HiddenFiles()
+	defer func() { common.LocalHashStorageMode = oldMode }()
+
+	for _, hashType := range []common.SyncHashType{common.ESyncHashType.CRC64(), common.ESyncHashType.SHA256(), common.ESyncHashType.XXHash64()} {
+		dir := t.TempDir()
+		a.NoError(os.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0644))
+		hasher := hashType.NewHash()
+		_, _ = hasher.Write([]byte("content"))
+		expected := hasher.Sum(nil)
+
+		// the first traversal computes the hash, and the second reads it back from the hash data
+		for pass := 0; pass < 2; pass++ {
+			traverser, err := newLocalTraverser(dir, context.Background(), InitResourceTraverserOptions{SyncHashType: hashType})
+			a.NoError(err)
+
+			processor := dummyProcessor{}
+			a.NoError(traverser.Traverse(noPreProccessor, processor.process, nil))
+			var files []StoredObject
+			for _, object := range processor.record {
+				if object.entityType == common.EEntityType.File() {
+					files = append(files, object)
+				}
+			}
+
+			a.Len(files, 1, hashType.String())
+			a.Equal(expected, files[0].syncHash(hashType), hashType.String())
+			a.Empty(files[0].md5)
+		}
+	}
+}
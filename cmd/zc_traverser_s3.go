@@ -43,6 +43,9 @@ type s3Traverser struct {
 
 	// A generic function to notify that a new stored object has been enumerated
 	incrementEnumerationCounter enumerationCounterFunc
+
+	// how many levels below the root a recursive traversal lists, or 0 for no limit
+	maxDepth int
 }
 
 func (t *s3Traverser) IsDirectory(isSource bool) (bool, error) {
@@ -71,23 +74,14 @@ func (t *s3Traverser) Traverse(preprocessor objectMorpher, processor objectProce
 		return p(storedObject)
 	}
 
-	invalidAzureBlobName := func(objectKey string) bool {
-		/* S3 object name is invalid if it ends with period or
-		   one of virtual directories in path ends with period.
-		   This list is not exhaustive
-		*/
-		return strings.HasSuffix(objectKey, ".") ||
-			strings.Contains(objectKey, "./")
-	}
-	invalidNameErrorMsg := "Skipping S3 object %s, as it is not a valid Blob name. Rename the object and retry the transfer"
 	// Check if resource is a single object.
 	if t.s3URLParts.IsObjectSyntactically() && !t.s3URLParts.IsDirectorySyntactically() && !t.s3URLParts.IsBucketSyntactically() {
 		objectPath := strings.Split(t.s3URLParts.ObjectKey, "/")
 		objectName := objectPath[len(objectPath)-1]
 
 		oi, err := t.s3Client.StatObject(t.s3URLParts.BucketName, t.s3URLParts.ObjectKey, minio.StatObjectOptions{})
-		if invalidAzureBlobName(t.s3URLParts.ObjectKey) {
-			WarnStdoutAndScanningLog(fmt.Sprintf(invalidNameErrorMsg, t.s3URLParts.ObjectKey))
+		if invalidS3AzureBlobName(t.s3URLParts.ObjectKey) {
+			WarnStdoutAndScanningLog(fmt.Sprintf(invalidS3NameErrorMsg, t.s3URLParts.ObjectKey))
 			return common.EAzError.InvalidBlobName()
 		}
 
@@ -108,6 +102,7 @@ func (t *s3Traverser) Traverse(preprocessor objectMorpher, processor objectProce
 				noBlobProps,
 				oie.NewCommonMetadata(),
 				t.s3URLParts.BucketName)
+			storedObject.eTag = oi.ETag
 
 			err = processIfPassedFilters(
 				filters,
@@ -132,69 +127,121 @@ func (t *s3Traverser) Traverse(preprocessor objectMorpher, processor objectProce
 	searchPrefix := t.s3URLParts.ObjectKey
 
 	// It's a bucket or virtual directory.
-	for objectInfo := range t.s3Client.ListObjectsV2(t.s3URLParts.BucketName, searchPrefix, t.recursive, t.ctx.Done()) {
+	// With a depth limit, the objects are listed one directory at a time, so that those below the limit aren't listed at all.
+	levelByLevel := t.recursive && t.maxDepth > 0
+	// the listings stop along with the traversal, rather than being left blocked on objects nobody reads once it fails
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+	for objectInfo := range t.s3Client.ListObjectsV2(t.s3URLParts.BucketName, searchPrefix, t.recursive && !levelByLevel, ctx.Done()) {
 		if objectInfo.Err != nil {
 			return fmt.Errorf("cannot list objects, %v", objectInfo.Err)
 		}
 
 		if objectInfo.StorageClass == "" {
 			// Directories are the only objects without storage classes.
+			if levelByLevel {
+				if err = t.traverseDirectory(ctx, objectInfo.Key, searchPrefix, preprocessor, processor, filters); err != nil {
+					return
+				}
+			}
 			continue
 		}
 
-		if invalidAzureBlobName(objectInfo.Key) {
-			//Throw a warning on console and continue
-			WarnStdoutAndScanningLog(fmt.Sprintf(invalidNameErrorMsg, objectInfo.Key))
-			continue
+		if err = t.processObject(objectInfo, searchPrefix, preprocessor, processor, filters); err != nil {
+			return
 		}
+	}
+	return
+}
 
-		objectPath := strings.Split(objectInfo.Key, "/")
-		objectName := objectPath[len(objectPath)-1]
-
-		// re-join the unescaped path.
-		relativePath := strings.TrimPrefix(objectInfo.Key, searchPrefix)
+// traverseDirectory lists the objects in the directory at prefix, and in the directories under it that are above the depth limit
+func (t *s3Traverser) traverseDirectory(ctx context.Context, prefix, searchPrefix string, preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	if !strings.HasSuffix(prefix, "/") || pathDepth(strings.TrimPrefix(prefix, searchPrefix)) >= t.maxDepth {
+		return nil
+	}
 
-		if strings.HasSuffix(relativePath, "/") {
-			// If a file has a suffix of /, it's still treated as a folder.
-			// Thus, akin to the old code. skip it.
-			continue
+	for objectInfo := range t.s3Client.ListObjectsV2(t.s3URLParts.BucketName, prefix, false, ctx.Done()) {
+		if objectInfo.Err != nil {
+			return fmt.Errorf("cannot list objects, %v", objectInfo.Err)
 		}
 
-		// default to empty props, but retrieve real ones if required
-		oie := common.ObjectInfoExtension{ObjectInfo: minio.ObjectInfo{}}
-		if t.getProperties {
-			oi, err := t.s3Client.StatObject(t.s3URLParts.BucketName, objectInfo.Key, minio.StatObjectOptions{})
-			if err != nil {
+		if objectInfo.StorageClass == "" {
+			if err := t.traverseDirectory(ctx, objectInfo.Key, searchPrefix, preprocessor, processor, filters); err != nil {
 				return err
 			}
-			oie = common.ObjectInfoExtension{ObjectInfo: oi}
+			continue
 		}
-		storedObject := newStoredObject(
-			preprocessor,
-			objectName,
-			relativePath,
-			common.EEntityType.File(),
-			objectInfo.LastModified,
-			objectInfo.Size,
-			&oie,
-			noBlobProps,
-			oie.NewCommonMetadata(),
-			t.s3URLParts.BucketName)
-
-		err = processIfPassedFilters(filters,
-			storedObject,
-			processor)
-		_, err = getProcessingError(err)
+
+		if err := t.processObject(objectInfo, searchPrefix, preprocessor, processor, filters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const invalidS3NameErrorMsg = "Skipping S3 object %s, as it is not a valid Blob name. Rename the object and retry the transfer"
+
+func invalidS3AzureBlobName(objectKey string) bool {
+	/* S3 object name is invalid if it ends with period or
+	   one of virtual directories in path ends with period.
+	   This list is not exhaustive
+	*/
+	return strings.HasSuffix(objectKey, ".") ||
+		strings.Contains(objectKey, "./")
+}
+
+// processObject passes an object listed under searchPrefix on to the processor, if it passes the filters
+func (t *s3Traverser) processObject(objectInfo minio.ObjectInfo, searchPrefix string, preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	if invalidS3AzureBlobName(objectInfo.Key) {
+		//Throw a warning on console and continue
+		WarnStdoutAndScanningLog(fmt.Sprintf(invalidS3NameErrorMsg, objectInfo.Key))
+		return nil
+	}
+
+	objectPath := strings.Split(objectInfo.Key, "/")
+	objectName := objectPath[len(objectPath)-1]
+
+	// re-join the unescaped path.
+	relativePath := strings.TrimPrefix(objectInfo.Key, searchPrefix)
+
+	if strings.HasSuffix(relativePath, "/") {
+		// If a file has a suffix of /, it's still treated as a folder.
+		// Thus, akin to the old code. skip it.
+		return nil
+	}
+
+	// default to empty props, but retrieve real ones if required
+	oie := common.ObjectInfoExtension{ObjectInfo: minio.ObjectInfo{}}
+	if t.getProperties {
+		oi, err := t.s3Client.StatObject(t.s3URLParts.BucketName, objectInfo.Key, minio.StatObjectOptions{})
 		if err != nil {
-			return
+			return err
 		}
+		oie = common.ObjectInfoExtension{ObjectInfo: oi}
 	}
-	return
+	storedObject := newStoredObject(
+		preprocessor,
+		objectName,
+		relativePath,
+		common.EEntityType.File(),
+		objectInfo.LastModified,
+		objectInfo.Size,
+		&oie,
+		noBlobProps,
+		oie.NewCommonMetadata(),
+		t.s3URLParts.BucketName)
+	storedObject.eTag = objectInfo.ETag
+
+	err := processIfPassedFilters(filters,
+		storedObject,
+		processor)
+	_, err = getProcessingError(err)
+	return err
 }
 
 func newS3Traverser(rawURL *url.URL, ctx context.Context, opts InitResourceTraverserOptions) (t *s3Traverser, err error) {
 	t = &s3Traverser{rawURL: rawURL, ctx: ctx, recursive: opts.Recursive, getProperties: opts.GetPropertiesInFrontend,
-		incrementEnumerationCounter: opts.IncrementEnumeration}
+		incrementEnumerationCounter: opts.IncrementEnumeration, maxDepth: opts.MaxDepth}
 
 	// initialize S3 client and URL parts
 	var s3URLParts common.S3URLParts
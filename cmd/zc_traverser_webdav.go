@@ -0,0 +1,372 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// webDAVTraverser enumerates a WebDAV collection (or a single resource) using PROPFIND with Depth: 1,
+// descending into child collections itself when recursive. Unlike plain HTTP, WebDAV has real folders.
+type webDAVTraverser struct {
+	rawURL                      string
+	ctx                         context.Context
+	pipeline                    azruntime.Pipeline
+	recursive                   bool
+	incrementEnumerationCounter enumerationCounterFunc
+
+	// the properties of rawURL itself, fetched lazily by a Depth: 0 PROPFIND
+	root *webDAVResource
+}
+
+// webDAVResource is a single resource described by a PROPFIND response
+type webDAVResource struct {
+	href         *url.URL
+	isCollection bool
+	size         int64
+	lastModified time.Time
+	etag         string
+	contentType  string
+}
+
+// errWebDAVResourceNotFound is returned when a PROPFIND targets a resource that doesn't exist
+var errWebDAVResourceNotFound = errors.New("WebDAV resource not found")
+
+// webDAVPropfindBody asks only for the live properties we map onto StoredObject
+const webDAVPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:">
+  <D:prop>
+    <D:resourcetype/>
+    <D:getcontentlength/>
+    <D:getlastmodified/>
+    <D:getetag/>
+    <D:getcontenttype/>
+  </D:prop>
+</D:propfind>`
+
+// the subset of a RFC 4918 multistatus response we care about
+type webDAVMultistatus struct {
+	XMLName   xml.Name            `xml:"DAV: multistatus"`
+	Responses []webDAVXMLResponse `xml:"DAV: response"`
+}
+
+type webDAVXMLResponse struct {
+	Href     string              `xml:"DAV: href"`
+	Propstat []webDAVXMLPropstat `xml:"DAV: propstat"`
+}
+
+type webDAVXMLPropstat struct {
+	Status string `xml:"DAV: status"`
+	Prop   struct {
+		ResourceType struct {
+			Collection *struct{} `xml:"DAV: collection"`
+		} `xml:"DAV: resourcetype"`
+		ContentLength string `xml:"DAV: getcontentlength"`
+		LastModified  string `xml:"DAV: getlastmodified"`
+		ETag          string `xml:"DAV: getetag"`
+		ContentType   string `xml:"DAV: getcontenttype"`
+	} `xml:"DAV: prop"`
+}
+
+// newWebDAVTraverser sends its requests through the same pipeline as HTTP sources,
+// so that they are retried, logged and authenticated alike.
+func newWebDAVTraverser(rawURL string, clientOptions *azcore.ClientOptions, ctx context.Context, opts *InitResourceTraverserOptions) (*webDAVTraverser, error) {
+	if _, err := common.NewHTTPURLParts(rawURL); err != nil {
+		return nil, fmt.Errorf("invalid WebDAV URL: %w", err)
+	}
+
+	tokenSource, err := common.GetHTTPTokenSource()
+	if err != nil {
+		return nil, err
+	}
+
+	incrementFunc := opts.IncrementEnumeration
+	if incrementFunc == nil {
+		incrementFunc = enumerationCounterFuncNoop
+	}
+
+	pipeline, err := common.NewHTTPPipeline(rawURL, clientOptions, tokenSource)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webDAVTraverser{
+		rawURL:                      rawURL,
+		ctx:                         ctx,
+		pipeline:                    pipeline,
+		recursive:                   opts.Recursive,
+		incrementEnumerationCounter: incrementFunc,
+	}, nil
+}
+
+// IsDirectory reports whether the URL points at a collection.
+// A resource that doesn't exist yet (e.g. a destination) is a directory only if it ends with a slash.
+func (t *webDAVTraverser) IsDirectory(isSource bool) (bool, error) {
+	root, err := t.getRoot()
+	if err != nil {
+		return strings.HasSuffix(t.rawURL, "/"), err
+	}
+
+	return root.isCollection, nil
+}
+
+func (t *webDAVTraverser) getRoot() (*webDAVResource, error) {
+	if t.root != nil {
+		return t.root, nil
+	}
+
+	rootURL, err := url.Parse(t.rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebDAV URL: %w", err)
+	}
+
+	resources, err := t.propfind(rootURL, "0")
+	if err != nil {
+		return nil, err
+	}
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("PROPFIND on %s returned no properties", common.URLExtension{URL: *rootURL}.RedactSecretQueryParamForLogging())
+	}
+
+	t.root = &resources[0]
+	return t.root, nil
+}
+
+func (t *webDAVTraverser) Traverse(preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	p := processor
+	processor = func(storedObject StoredObject) error {
+		t.incrementEnumerationCounter(storedObject.entityType)
+
+		return p(storedObject)
+	}
+
+	root, err := t.getRoot()
+	if err != nil {
+		return err
+	}
+
+	if !root.isCollection {
+		object := t.toStoredObject(*root, path.Base(root.href.Path), "")
+		if preprocessor != nil {
+			preprocessor(&object)
+		}
+
+		err = processIfPassedFilters(filters, object, processor)
+		_, err = getProcessingError(err)
+		return err
+	}
+
+	// the root collection itself, so that its existence carries over to folder-aware destinations
+	rootObject := t.toStoredObject(*root, "", "")
+	if preprocessor != nil {
+		preprocessor(&rootObject)
+	}
+	err = processIfPassedFilters(filters, rootObject, processor)
+	if _, err = getProcessingError(err); err != nil {
+		return err
+	}
+
+	type pendingCollection struct {
+		dirURL       *url.URL
+		relativePath string
+	}
+
+	visited := map[string]bool{root.href.Path: true}
+	queue := []pendingCollection{{dirURL: root.href}}
+
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+
+		children, err := t.propfind(dir.dirURL, "1")
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", common.URLExtension{URL: *dir.dirURL}.RedactSecretQueryParamForLogging(), err)
+		}
+
+		for _, child := range children {
+			if strings.TrimSuffix(child.href.Path, "/") == strings.TrimSuffix(dir.dirURL.Path, "/") {
+				continue // Depth: 1 includes the collection itself
+			}
+
+			name := path.Base(strings.TrimSuffix(child.href.Path, "/"))
+			relativePath := name
+			if dir.relativePath != "" {
+				relativePath = dir.relativePath + common.AZCOPY_PATH_SEPARATOR_STRING + name
+			}
+
+			if child.isCollection {
+				if !t.recursive {
+					continue
+				}
+				if visited[child.href.Path] {
+					continue
+				}
+				visited[child.href.Path] = true
+				queue = append(queue, pendingCollection{dirURL: child.href, relativePath: relativePath})
+			}
+
+			object := t.toStoredObject(child, name, relativePath)
+			if preprocessor != nil {
+				preprocessor(&object)
+			}
+
+			err = processIfPassedFilters(filters, object, processor)
+			_, err = getProcessingError(err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *webDAVTraverser) toStoredObject(r webDAVResource, name, relativePath string) StoredObject {
+	object := StoredObject{
+		name:             name,
+		entityType:       common.Iff(r.isCollection, common.EEntityType.Folder(), common.EEntityType.File()),
+		lastModifiedTime: r.lastModified,
+		size:             r.size,
+		contentType:      r.contentType,
+		eTag:             r.etag,
+		Metadata:         common.Metadata{},
+		relativePath:     relativePath,
+	}
+
+	if r.isCollection {
+		object.size = 0
+		object.contentType = ""
+	}
+
+	return object
+}
+
+// propfind issues a PROPFIND with the given depth against target and returns the described resources,
+// with hrefs resolved against target
+func (t *webDAVTraverser) propfind(target *url.URL, depth string) ([]webDAVResource, error) {
+	req, err := azruntime.NewRequest(t.ctx, "PROPFIND", target.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PROPFIND request: %w", err)
+	}
+	req.Raw().Header.Set("Depth", depth)
+	if err = req.SetBody(streaming.NopCloser(strings.NewReader(webDAVPropfindBody)), "application/xml; charset=utf-8"); err != nil {
+		return nil, err
+	}
+	// the body is read (and size-limited) below
+	azruntime.SkipBodyDownload(req)
+
+	resp, err := t.pipeline.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("PROPFIND request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusMultiStatus:
+	case http.StatusNotFound:
+		return nil, errWebDAVResourceNotFound
+	default:
+		return nil, fmt.Errorf("PROPFIND request returned status %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	return parseWebDAVMultistatus(resp.Request.URL, io.LimitReader(resp.Body, maxHTTPListingSize))
+}
+
+// parseWebDAVMultistatus decodes a multistatus body, keeping only the successful propstat of each response
+func parseWebDAVMultistatus(base *url.URL, body io.Reader) ([]webDAVResource, error) {
+	var ms webDAVMultistatus
+	if err := xml.NewDecoder(body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("failed to parse PROPFIND response: %w", err)
+	}
+
+	resources := make([]webDAVResource, 0, len(ms.Responses))
+	for _, r := range ms.Responses {
+		href, err := url.Parse(strings.TrimSpace(r.Href))
+		if err != nil {
+			continue
+		}
+		href = base.ResolveReference(href)
+		if href.Host != base.Host {
+			continue
+		}
+
+		resource := webDAVResource{href: href}
+		found := false
+		for _, ps := range r.Propstat {
+			if !isWebDAVStatusOK(ps.Status) {
+				continue
+			}
+			found = true
+
+			if ps.Prop.ResourceType.Collection != nil {
+				resource.isCollection = true
+			}
+			if ps.Prop.ContentLength != "" {
+				if size, err := strconv.ParseInt(strings.TrimSpace(ps.Prop.ContentLength), 10, 64); err == nil {
+					resource.size = size
+				}
+			}
+			if ps.Prop.LastModified != "" {
+				if lmt, err := http.ParseTime(strings.TrimSpace(ps.Prop.LastModified)); err == nil {
+					resource.lastModified = lmt
+				}
+			}
+			if ps.Prop.ETag != "" {
+				resource.etag = strings.TrimSpace(ps.Prop.ETag)
+			}
+			if ps.Prop.ContentType != "" {
+				resource.contentType = strings.TrimSpace(ps.Prop.ContentType)
+			}
+		}
+
+		if found {
+			if resource.isCollection && !strings.HasSuffix(resource.href.Path, "/") {
+				// address collections with a trailing slash, so servers don't answer with a redirect
+				resource.href.Path += "/"
+				resource.href.RawPath = ""
+			}
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, nil
+}
+
+// isWebDAVStatusOK checks a propstat status line, e.g. "HTTP/1.1 200 OK"
+func isWebDAVStatusOK(status string) bool {
+	fields := strings.Fields(status)
+	return len(fields) >= 2 && fields[1] == "200"
+}
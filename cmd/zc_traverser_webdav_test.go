@@ -0,0 +1,237 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// newWebDAVServer serves PROPFIND for a small fixed tree:
+//
+//	/dav/a.txt, /dav/sub/, /dav/sub/b.txt, /dav/sub/deeper/, /dav/sub/deeper/c.txt
+func newWebDAVServer(t *testing.T) *httptest.Server {
+	lmt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC).Format(http.TimeFormat)
+	files := map[string]int64{
+		"/dav/a.txt":              10,
+		"/dav/sub/b.txt":          20,
+		"/dav/sub/deeper/c d.txt": 30,
+	}
+	dirs := []string{"/dav/", "/dav/sub/", "/dav/sub/deeper/"}
+
+	fileEntry := func(p string, size int64) string {
+		return fmt.Sprintf(`<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype/><D:getcontentlength>%d</D:getcontentlength><D:getlastmodified>%s</D:getlastmodified><D:getetag>"%s"</D:getetag></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`,
+			(&url.URL{Path: p}).EscapedPath(), size, lmt, strings.ReplaceAll(p, "/", "-"))
+	}
+	dirEntry := func(p string) string {
+		// servers commonly omit the trailing slash on collection hrefs
+		return fmt.Sprintf(`<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype><D:getlastmodified>%s</D:getlastmodified></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat><D:propstat><D:prop><D:getcontentlength/></D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat></D:response>`,
+			strings.TrimSuffix(p, "/"), lmt)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PROPFIND" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		target := r.URL.Path
+		var body strings.Builder
+		body.WriteString(`<?xml version="1.0" encoding="utf-8"?><D:multistatus xmlns:D="DAV:">`)
+
+		if size, ok := files[target]; ok {
+			body.WriteString(fileEntry(target, size))
+		} else {
+			dir := strings.TrimSuffix(target, "/") + "/"
+			found := false
+			for _, d := range dirs {
+				if d == dir {
+					found = true
+				}
+			}
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			body.WriteString(dirEntry(dir))
+			if r.Header.Get("Depth") == "1" {
+				for _, d := range dirs {
+					if d != dir && strings.HasPrefix(d, dir) && !strings.Contains(strings.TrimSuffix(d[len(dir):], "/"), "/") {
+						body.WriteString(dirEntry(d))
+					}
+				}
+				for f, size := range files {
+					if strings.HasPrefix(f, dir) && !strings.Contains(f[len(dir):], "/") {
+						body.WriteString(fileEntry(f, size))
+					}
+				}
+			}
+		}
+
+		body.WriteString(`</D:multistatus>`)
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = w.Write([]byte(body.String()))
+	}))
+}
+
+func collectWebDAVTraverserObjects(t *testing.T, traverser *webDAVTraverser, filters []ObjectFilter) map[string]StoredObject {
+	found := make(map[string]StoredObject)
+	err := traverser.Traverse(nil, func(obj StoredObject) error {
+		found[obj.relativePath] = obj
+		return nil
+	}, filters)
+	assert.NoError(t, err)
+	return found
+}
+
+func TestWebDAVTraverser_Recursive(t *testing.T) {
+	a := assert.New(t)
+	server := newWebDAVServer(t)
+	defer server.Close()
+
+	traverser, err := newWebDAVTraverser(server.URL+"/dav", testHTTPClientOptions, context.Background(), &InitResourceTraverserOptions{Recursive: true})
+	a.NoError(err)
+
+	isDir, err := traverser.IsDirectory(true)
+	a.NoError(err)
+	a.True(isDir)
+
+	found := collectWebDAVTraverserObjects(t, traverser, nil)
+	a.Len(found, 6)
+
+	a.Equal(common.EEntityType.Folder(), found[""].entityType)
+	a.Equal(common.EEntityType.Folder(), found["sub"].entityType)
+	a.Equal(common.EEntityType.Folder(), found["sub/deeper"].entityType)
+
+	a.Equal(common.EEntityType.File(), found["a.txt"].entityType)
+	a.Equal(int64(10), found["a.txt"].size)
+	a.Equal(`"-dav-a.txt"`, found["a.txt"].eTag)
+	a.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), found["a.txt"].lastModifiedTime.UTC())
+
+	a.Equal(int64(20), found["sub/b.txt"].size)
+	a.Equal("c d.txt", found["sub/deeper/c d.txt"].name)
+	a.Equal(int64(30), found["sub/deeper/c d.txt"].size)
+}
+
+func TestWebDAVTraverser_NonRecursive(t *testing.T) {
+	a := assert.New(t)
+	server := newWebDAVServer(t)
+	defer server.Close()
+
+	traverser, err := newWebDAVTraverser(server.URL+"/dav/", testHTTPClientOptions, context.Background(), &InitResourceTraverserOptions{Recursive: false})
+	a.NoError(err)
+
+	found := collectWebDAVTraverserObjects(t, traverser, nil)
+	a.Len(found, 2)
+	a.Contains(found, "")
+	a.Contains(found, "a.txt")
+}
+
+func TestWebDAVTraverser_SingleFile(t *testing.T) {
+	a := assert.New(t)
+	server := newWebDAVServer(t)
+	defer server.Close()
+
+	traverser, err := newWebDAVTraverser(server.URL+"/dav/sub/b.txt", testHTTPClientOptions, context.Background(), &InitResourceTraverserOptions{Recursive: true})
+	a.NoError(err)
+
+	isDir, err := traverser.IsDirectory(true)
+	a.NoError(err)
+	a.False(isDir)
+
+	found := collectWebDAVTraverserObjects(t, traverser, nil)
+	a.Len(found, 1)
+	a.Equal("b.txt", found[""].name)
+	a.Equal(int64(20), found[""].size)
+}
+
+func TestWebDAVTraverser_MissingDestination(t *testing.T) {
+	a := assert.New(t)
+	server := newWebDAVServer(t)
+	defer server.Close()
+
+	traverser, err := newWebDAVTraverser(server.URL+"/dav/new/", testHTTPClientOptions, context.Background(), &InitResourceTraverserOptions{})
+	a.NoError(err)
+
+	isDir, err := traverser.IsDirectory(false)
+	a.ErrorIs(err, errWebDAVResourceNotFound)
+	a.True(isDir)
+
+	traverser, err = newWebDAVTraverser(server.URL+"/dav/new.txt", testHTTPClientOptions, context.Background(), &InitResourceTraverserOptions{})
+	a.NoError(err)
+
+	isDir, _ = traverser.IsDirectory(false)
+	a.False(isDir)
+}
+
+func TestWebDAVTraverser_Filters(t *testing.T) {
+	a := assert.New(t)
+	server := newWebDAVServer(t)
+	defer server.Close()
+
+	traverser, err := newWebDAVTraverser(server.URL+"/dav/", testHTTPClientOptions, context.Background(), &InitResourceTraverserOptions{Recursive: true})
+	a.NoError(err)
+
+	found := collectWebDAVTraverserObjects(t, traverser, []ObjectFilter{&IncludeFilter{patterns: []string{"b.txt"}}})
+	a.Contains(found, "sub/b.txt")
+	a.NotContains(found, "a.txt")
+	a.NotContains(found, "sub/deeper/c d.txt")
+}
+
+func TestWebDAVTraverser_RetriesThroughPipeline(t *testing.T) {
+	a := assert.New(t)
+	dav := newWebDAVServer(t)
+	defer dav.Close()
+
+	// the server is busy at first; the PROPFIND body must be sent again on each retry
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := io.ReadAll(r.Body)
+		a.Contains(string(body), "propfind")
+		if requests < 3 {
+			w.Header().Set("Retry-After-Ms", "10")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		dav.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	traverser, err := newWebDAVTraverser(server.URL+"/dav/", testHTTPClientOptions, context.Background(), &InitResourceTraverserOptions{})
+	a.NoError(err)
+	isDir, err := traverser.IsDirectory(true)
+	a.NoError(err)
+	a.True(isDir)
+	a.Equal(3, requests)
+}
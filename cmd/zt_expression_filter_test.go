@@ -0,0 +1,170 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+func expressionFilterTestObject() StoredObject {
+	owner := "alice"
+	return StoredObject{
+		name:             "report.csv",
+		relativePath:     "2024/q1/report.csv",
+		entityType:       common.EEntityType.File(),
+		size:             5 * 1024 * 1024,
+		lastModifiedTime: time.Now().Add(-100 * 24 * time.Hour),
+		blobType:         blob.BlobTypeBlockBlob,
+		blobAccessTier:   blob.AccessTierCool,
+		contentType:      "text/csv",
+		Metadata:         common.Metadata{"Owner": &owner},
+		blobTags:         common.BlobTags{url.QueryEscape("cost center"): url.QueryEscape("r&d"), "env": "prod"},
+	}
+}
+
+func TestExpressionFilter_Evaluates(t *testing.T) {
+	a := assert.New(t)
+	object := expressionFilterTestObject()
+
+	expectations := map[string]bool{
+		"name == report.csv":                    true,
+		"name = 'report.csv'":                   true,
+		"name like '*.csv'":                     true,
+		"name like '*.CSV'":                     false, // names are case-sensitive
+		"path matches '^2024/q[1-2]/'":          true,
+		"size > 4M":                             true,
+		"size >= 5MiB and size <= 5MiB":         true,
+		"size < 1K":                             false,
+		"age > 90d":                             true,
+		"age > 15w":                             false,
+		"age < 2400h":                           false,
+		"lmt < 2000-01-01":                      false,
+		"lastModified > '2000-01-01T00:00:00Z'": true,
+		"tier == cool":                          true, // service-defined values aren't case-sensitive
+		"tier in (Hot, Cool)":                   true,
+		"tier in (Hot, Archive)":                false,
+		"blobType == BlockBlob && contentType like 'text/*'":   true,
+		"metadata.owner == alice":                              true,
+		"metadata.OWNER == alice":                              true,
+		"metadata.team == ''":                                  true,
+		"exists(metadata.owner) and not exists(metadata.team)": true,
+		"tags.env == prod":                                     true,
+		"tags.\"cost center\" == 'r&d'":                        true, // keys that need quoting
+		"type == file":                                         true,
+		"archiveStatus != ''":                                  false,
+		"not tier == Archive":                                  true,
+		"! (tier == Archive || size > 1G)":                     true,
+		"name like '*.tmp' or size > 1M and tier == Hot":       false, // and binds tighter than or
+		"(name like '*.tmp' or size > 1M) and tier == Cool":    true,
+	}
+
+	for expression, expected := range expectations {
+		f, err := parseFilterExpression(expression)
+		if !a.NoError(err, expression) {
+			continue
+		}
+		a.Equal(expected, f.DoesPass(object), expression)
+	}
+}
+
+func TestExpressionFilter_UnknownValues(t *testing.T) {
+	a := assert.New(t)
+
+	// nothing is known about this object but its name
+	object := StoredObject{name: "a.txt", entityType: common.EEntityType.File()}
+
+	for expression, expected := range map[string]bool{
+		"age > 1d":         false,
+		"not age > 1d":     true,
+		"tier == Hot":      false,
+		"tier != Hot":      true,
+		"tags.env == prod": false,
+	} {
+		f, err := parseFilterExpression(expression)
+		a.NoError(err, expression)
+		a.Equal(expected, f.DoesPass(object), expression)
+	}
+}
+
+func TestExpressionFilter_NeedsBlobTags(t *testing.T) {
+	a := assert.New(t)
+
+	f, err := parseFilterExpression("size > 1K")
+	a.NoError(err)
+	a.False(f.needsBlobTags())
+
+	f, err = parseFilterExpression("size > 1K or exists(tags.env)")
+	a.NoError(err)
+	a.True(f.needsBlobTags())
+
+	// no expression, no filter
+	f, err = parseFilterExpression("  ")
+	a.NoError(err)
+	a.Nil(f)
+	a.False(f.needsBlobTags())
+	a.Empty(buildExpressionFilters(f))
+}
+
+func TestExpressionFilter_ParseErrors(t *testing.T) {
+	a := assert.New(t)
+
+	// each expression fails at the column given, with a message containing the text given
+	errors := []struct {
+		expression string
+		column     string
+		message    string
+	}{
+		{"sise > 1K", "column 1", "unknown field 'sise'"},
+		{"size 1K", "column 6", "expected an operator"},
+		{"size > ", "column 8", "expected a value to compare size with, found end of expression"},
+		{"size > lots", "column 8", "size must be a number of bytes"},
+		{"age > 3d months", "column 10", "unexpected 'months'"},
+		{"age > 3", "column 7", "duration such as 90d"},
+		{"age > 3x", "column 7", "duration such as 90d"},
+		{"lmt > yesterday", "column 7", "ISO8601"},
+		{"name > a", "column 6", "name is text, so it can't be compared with >"},
+		{"size like 1K", "column 6", "size is not text"},
+		{"name == 'a", "column 9", "never closed"},
+		{"name == a & size > 1", "column 11", "must be doubled"},
+		{"(name == a", "column 11", "expected ')'"},
+		{"tier in Hot", "column 9", "expected '('"},
+		{"name matches '('", "column 14", "not a valid regular expression"},
+		{"name like '['", "column 11", "not a valid pattern"},
+		{"exists(size)", "column 1", "exists only applies to text fields"},
+		{"name == a and", "column 14", "expected a field name"},
+		{"metadata. == a", "column 1", "unknown field"},
+	}
+
+	for _, e := range errors {
+		_, err := parseFilterExpression(e.expression)
+		if a.Error(err, e.expression) {
+			a.Contains(err.Error(), e.column, e.expression)
+			a.Contains(err.Error(), e.message, e.expression)
+		}
+	}
+}
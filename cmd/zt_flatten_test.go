@@ -0,0 +1,125 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func flattenTestFile(relativePath string) StoredObject {
+	return newStoredObject(noPreProccessor, relativePath, relativePath, common.EEntityType.File(), time.Now(), 1, noContentProps, noBlobProps, noMetadata, "")
+}
+
+func TestFlattener(t *testing.T) {
+	a := assert.New(t)
+
+	flatten := func(f *flattener, relativePath string) (string, bool, error) {
+		return f.destinationPath(flattenTestFile(relativePath), relativePath)
+	}
+
+	// without --flatten, paths are left alone
+	var none *flattener
+	flattened, skip, err := flatten(none, "a/b/c.txt")
+	a.NoError(err)
+	a.False(skip)
+	a.Equal("a/b/c.txt", flattened)
+
+	f := newFlattener(common.EFlattenCollision.Fail())
+	flattened, skip, err = flatten(f, "vendor/2024/05/data.csv")
+	a.NoError(err)
+	a.False(skip)
+	a.Equal("data.csv", flattened)
+
+	// a single file keeps the name the destination gives it
+	flattened, _, err = flatten(f, "")
+	a.NoError(err)
+	a.Equal("", flattened)
+
+	// folders aren't copied
+	folder := flattenTestFile("vendor/2024")
+	folder.entityType = common.EEntityType.Folder()
+	_, skip, err = f.destinationPath(folder, folder.relativePath)
+	a.NoError(err)
+	a.True(skip)
+
+	_, _, err = flatten(f, "vendor/2024/06/data.csv")
+	a.ErrorContains(err, "vendor/2024/05/data.csv and vendor/2024/06/data.csv")
+
+	// files in different containers only collide when copied to the same one
+	inContainer := flattenTestFile("x/data.csv")
+	inContainer.ContainerName = "other"
+	_, _, err = f.destinationPath(inContainer, inContainer.relativePath)
+	a.NoError(err)
+	inContainer.ContainerName, inContainer.DstContainerName = "third", "other"
+	_, _, err = f.destinationPath(inContainer, inContainer.relativePath)
+	a.Error(err)
+
+	f = newFlattener(common.EFlattenCollision.Skip())
+	_, skip, _ = flatten(f, "a/data.csv")
+	a.False(skip)
+	_, skip, err = flatten(f, "b/data.csv")
+	a.NoError(err)
+	a.True(skip)
+
+	f = newFlattener(common.EFlattenCollision.Suffix())
+	// the suffixes depend on the order the files come in
+	for _, c := range [][2]string{
+		{"a/data.csv", "data.csv"},
+		{"b/data.csv", "data-1.csv"},
+		{"c/data-1.csv", "data-1-1.csv"},
+		{"d/data.csv", "data-2.csv"},
+		{"a/README", "README"},
+		{"b/README", "README-1"},
+	} {
+		flattened, skip, err = flatten(f, c[0])
+		a.NoError(err, c[0])
+		a.False(skip, c[0])
+		a.Equal(c[1], flattened, c[0])
+	}
+}
+
+func TestCopyFlattenAndMaxDepthFlags(t *testing.T) {
+	a := assert.New(t)
+
+	raw := getDefaultCopyRawInput(t.TempDir(), "https://account.blob.core.windows.net/container")
+	raw.recursive, raw.maxDepth, raw.flatten, raw.flattenCollision = true, 2, true, "suffix"
+	cooked, err := raw.cook()
+	a.NoError(err)
+	a.Equal(2, cooked.maxDepth)
+	a.NotNil(cooked.flatten)
+	a.Equal(common.EFlattenCollision.Suffix(), cooked.flatten.collision)
+
+	raw.flattenCollision = "rename"
+	_, err = raw.cook()
+	a.ErrorContains(err, "flatten-collision")
+
+	raw.flattenCollision, raw.recursive = "fail", false
+	_, err = raw.cook()
+	a.ErrorContains(err, "--recursive")
+
+	raw.recursive, raw.maxDepth = true, -1
+	_, err = raw.cook()
+	a.Error(err)
+}
@@ -29,6 +29,8 @@ import (
 	"time"
 
 	chk "gopkg.in/check.v1"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
 )
 
 type genericFilterSuite struct{}
@@ -186,3 +188,103 @@ func findAmbiguousTime() (string, time.Time, time.Time, error) {
 
 	return "", time.Time{}, time.Time{}, noAmbiguousHourError
 }
+
+func TestParseSizeFilterString(t *testing.T) {
+	a := assert.New(t)
+
+	expected := map[string]int64{
+		"0":     0,
+		"500":   500,
+		"500B":  500,
+		"64K":   64 * 1024,
+		"64kb":  64 * 1024,
+		"64KiB": 64 * 1024,
+		"3m":    3 * 1024 * 1024,
+		"2GiB":  2 * 1024 * 1024 * 1024,
+		"1T":    1024 * 1024 * 1024 * 1024,
+		"1TB":   1024 * 1024 * 1024 * 1024,
+	}
+	for s, bytes := range expected {
+		parsed, err := parseSizeFilterString(s, "include-size-min")
+		a.NoError(err, s)
+		a.Equal(bytes, parsed, s)
+	}
+
+	for _, s := range []string{"", "B", "iB", "12iB", "-5", "-5K", "1.5G", "12 K", "12P", "K12"} {
+		_, err := parseSizeFilterString(s, "include-size-min")
+		a.Error(err, s)
+		if err != nil {
+			a.True(strings.HasPrefix(err.Error(), "include-size-min must be"), s)
+		}
+	}
+}
+
+func TestParseSizeFilterRange(t *testing.T) {
+	a := assert.New(t)
+
+	minSize, maxSize, err := parseSizeFilterRange("", "")
+	a.NoError(err)
+	a.Nil(minSize)
+	a.Nil(maxSize)
+	a.Empty(buildSizeFilters(minSize, maxSize))
+
+	minSize, maxSize, err = parseSizeFilterRange("1K", "")
+	a.NoError(err)
+	a.EqualValues(1024, *minSize)
+	a.Nil(maxSize)
+
+	_, _, err = parseSizeFilterRange("2M", "1M")
+	a.Error(err)
+
+	_, _, err = parseSizeFilterRange("", "lots")
+	a.Error(err)
+	a.Contains(err.Error(), "include-size-max")
+}
+
+func TestSizeFilters(t *testing.T) {
+	a := assert.New(t)
+
+	minSize, maxSize := int64(100), int64(200)
+	filters := buildSizeFilters(&minSize, &maxSize)
+	a.Len(filters, 2)
+
+	for size, shouldPass := range map[int64]bool{0: false, 99: false, 100: true, 150: true, 200: true, 201: false} {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, StoredObject{name: "file", size: size, entityType: common.EEntityType.File()}, dummyProcessor.process)
+		if shouldPass {
+			a.NoError(err, size)
+			a.Len(dummyProcessor.record, 1, size)
+		} else {
+			a.Equal(ignoredError, err, size)
+			a.Empty(dummyProcessor.record, size)
+		}
+	}
+
+	// folders have no size of their own, so they aren't held to the range
+	dummyProcessor := &dummyProcessor{}
+	err := processIfPassedFilters(filters, StoredObject{name: "dir", entityType: common.EEntityType.Folder()}, dummyProcessor.process)
+	a.NoError(err)
+	a.Len(dummyProcessor.record, 1)
+}
+
+func TestMaxDepthFilter(t *testing.T) {
+	a := assert.New(t)
+
+	for relativePath, depth := range map[string]int{"": 0, "a": 1, "a/": 1, "/a/b": 2, "a/b/c.txt": 3} {
+		a.Equal(depth, pathDepth(relativePath), relativePath)
+	}
+
+	a.Empty(buildMaxDepthFilters(0))
+	filters := buildMaxDepthFilters(2)
+	a.Len(filters, 1)
+
+	for relativePath, shouldPass := range map[string]bool{"": true, "top.txt": true, "dir": true, "dir/file.txt": true, "dir/sub": true, "dir/sub/file.txt": false} {
+		dummyProcessor := &dummyProcessor{}
+		err := processIfPassedFilters(filters, StoredObject{name: "x", relativePath: relativePath, entityType: common.EEntityType.File()}, dummyProcessor.process)
+		if shouldPass {
+			a.NoError(err, relativePath)
+		} else {
+			a.Equal(ignoredError, err, relativePath)
+		}
+	}
+}
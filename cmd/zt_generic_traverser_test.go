@@ -349,7 +349,7 @@ func TestWalkWithSymlinks_ToFolder(t *testing.T) {
 		fileCount++
 		return nil
 	},
-		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil))
+		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil, nil, 0))
 
 	// 3 files live in base, 3 files live in symlink
 	a.Equal(6, fileCount)
@@ -416,7 +416,7 @@ func TestWalkWithSymlinksBreakLoop(t *testing.T) {
 		fileCount++
 		return nil
 	},
-		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil))
+		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil, nil, 0))
 
 	a.Equal(3, fileCount)
 }
@@ -447,7 +447,7 @@ func TestWalkWithSymlinksDedupe(t *testing.T) {
 		fileCount++
 		return nil
 	},
-		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil))
+		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil, nil, 0))
 
 	a.Equal(6, fileCount)
 }
@@ -479,7 +479,7 @@ func TestWalkWithSymlinksMultitarget(t *testing.T) {
 		fileCount++
 		return nil
 	},
-		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil))
+		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil, nil, 0))
 
 	// 3 files live in base, 3 files live in first symlink, second & third symlink is ignored.
 	a.Equal(6, fileCount)
@@ -513,7 +513,7 @@ func TestWalkWithSymlinksToParentAndChild(t *testing.T) {
 		fileCount++
 		return nil
 	},
-		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil))
+		common.ESymlinkHandlingType.Follow(), nil, common.EHardlinkHandlingType.Follow(), nil, nil, 0))
 
 	// 6 files total live under toroot. tochild should be ignored (or if tochild was traversed first, child will be ignored on toroot).
 	a.Equal(6, fileCount)
@@ -1027,3 +1027,46 @@ func TestSerialAndParallelBlobTraverser(t *testing.T) {
 		}
 	}
 }
+
+func TestLocalTraverser_MaxDepth(t *testing.T) {
+	a := assert.New(t)
+
+	root := t.TempDir()
+	writeIgnoreTestTree(a, root, map[string]string{
+		"top.txt":                "",
+		"vendor-a/drop.csv":      "",
+		"vendor-a/2024/data.csv": "",
+		"vendor-b/empty/":        "",
+	})
+
+	traverser, err := newLocalTraverser(root, context.Background(), InitResourceTraverserOptions{
+		Recursive:       true,
+		SymlinkHandling: common.ESymlinkHandlingType.Skip(),
+		MaxDepth:        2,
+	})
+	a.NoError(err)
+
+	// the directories at the limit are listed, but not what's in them
+	processor := &dummyProcessor{}
+	a.NoError(traverser.Traverse(noPreProccessor, processor.process, nil))
+	a.Equal([]string{
+		"",
+		"top.txt",
+		"vendor-a",
+		"vendor-a/2024",
+		"vendor-a/drop.csv",
+		"vendor-b",
+		"vendor-b/empty",
+	}, sortedRelativePaths(processor))
+
+	traverser, err = newLocalTraverser(root, context.Background(), InitResourceTraverserOptions{
+		Recursive:       true,
+		SymlinkHandling: common.ESymlinkHandlingType.Skip(),
+		MaxDepth:        1,
+	})
+	a.NoError(err)
+
+	processor = &dummyProcessor{}
+	a.NoError(traverser.Traverse(noPreProccessor, processor.process, nil))
+	a.Equal([]string{"", "top.txt", "vendor-a", "vendor-b"}, sortedRelativePaths(processor))
+}
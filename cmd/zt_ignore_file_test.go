@@ -0,0 +1,216 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// writeIgnoreTestTree creates the files and directories under root; names ending in / are directories
+func writeIgnoreTestTree(a *assert.Assertions, root string, files map[string]string) {
+	for name, content := range files {
+		fullPath := filepath.Join(root, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			a.NoError(os.MkdirAll(fullPath, 0755))
+			continue
+		}
+		a.NoError(os.MkdirAll(filepath.Dir(fullPath), 0755))
+		a.NoError(os.WriteFile(fullPath, []byte(content), 0644))
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	a := assert.New(t)
+
+	type check struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}
+	cases := []struct {
+		rules  string
+		checks []check
+	}{
+		{"*.log", []check{{"a.log", false, true}, {"deep/down/a.log", false, true}, {"a.log.txt", false, false}}},
+		{"build/", []check{{"build", true, true}, {"build", false, false}, {"src/build", true, true}}},
+		{"/todo.txt", []check{{"todo.txt", false, true}, {"docs/todo.txt", false, false}}},
+		{"docs/*.md", []check{{"docs/a.md", false, true}, {"docs/sub/a.md", false, false}, {"x/docs/a.md", false, false}}},
+		{"**/cache", []check{{"cache", true, true}, {"a/b/cache", false, true}}},
+		{"out/**", []check{{"out/a", false, true}, {"out/a/b", false, true}, {"out", true, false}}},
+		{"a/**/z", []check{{"a/z", false, true}, {"a/b/c/z", false, true}, {"b/a/z", false, false}}},
+		{"file?.[ch]", []check{{"file1.c", false, true}, {"file1.o", false, false}, {"file12.c", false, false}}},
+		{"[!a]*.txt", []check{{"b.txt", false, true}, {"a.txt", false, false}}},
+		{"*.log\n!keep.log", []check{{"drop.log", false, true}, {"keep.log", false, false}}},
+		{"# comment\n\n\\#hash\n\\!bang", []check{{"# comment", false, false}, {"#hash", false, true}, {"!bang", false, true}}},
+		{"trailing   \nescaped\\ ", []check{{"trailing", false, true}, {"escaped ", false, true}}},
+		{"[unclosed", []check{{"[unclosed", false, true}}},
+	}
+
+	for _, c := range cases {
+		rules := parseIgnoreRules(c.rules)
+		for _, ch := range c.checks {
+			ignored := false
+			for _, r := range rules {
+				if r.matches(ch.path, ch.isDir) {
+					ignored = !r.negate
+				}
+			}
+			a.Equal(ch.ignored, ignored, "rules %q, path %q", c.rules, ch.path)
+		}
+	}
+}
+
+func TestAzcopyIgnore_NestedFiles(t *testing.T) {
+	a := assert.New(t)
+
+	root := t.TempDir()
+	writeIgnoreTestTree(a, root, map[string]string{
+		".azcopyignore":      "*.log\nbuild/\n/secret.txt\nvendor/\n!vendor/",
+		"sub/.azcopyignore":  "!debug.log\n/local-only\n",
+		"sub/deeper/.keep":   "",
+		"global-ignore-file": "*.tmp\n!important.log\n",
+	})
+
+	ignore, err := newAzcopyIgnore(root, filepath.Join(root, "global-ignore-file"))
+	a.NoError(err)
+
+	expectations := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"", true, false},
+		{"a.log", false, true},
+		{"important.log", false, true}, // the .azcopyignore files take precedence over the global file
+		{"a.tmp", false, true},
+		{"sub/a.tmp", false, true},
+		{"secret.txt", false, true},
+		{"sub/secret.txt", false, false}, // anchored to the root
+		{"sub/debug.log", false, false},  // re-included below sub
+		{"debug.log", false, true},
+		{"sub/deeper/debug.log", false, false},
+		{"sub/deeper/other.log", false, true},
+		{"sub/local-only", false, true},
+		{"local-only", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"build/keep.txt", false, true}, // inside an excluded directory
+		{"vendor", true, false},         // the later rule wins
+	}
+	for _, e := range expectations {
+		a.Equal(e.ignored, ignore.ignores(e.path, e.isDir), e.path)
+	}
+
+	a.True(ignore.ignoresPath(filepath.Join(root, "sub", "x.log"), false))
+	a.False(ignore.ignoresPath(filepath.Join(filepath.Dir(root), "x.log"), false)) // outside the root
+
+	// a nil azcopyIgnore excludes nothing
+	var none *azcopyIgnore
+	a.False(none.ignoresPath(filepath.Join(root, "a.log"), false))
+
+	_, err = newAzcopyIgnore(root, filepath.Join(root, "missing"))
+	a.Error(err)
+}
+
+func TestAzcopyIgnore_AsFilter(t *testing.T) {
+	a := assert.New(t)
+
+	root := t.TempDir()
+	writeIgnoreTestTree(a, root, map[string]string{".azcopyignore": "*.log\nbuild/\n"})
+	ignore, err := newAzcopyIgnore(root, "")
+	a.NoError(err)
+
+	// e.g. what's at the destination of a sync
+	a.False(ignore.DoesPass(StoredObject{relativePath: "a.log", entityType: common.EEntityType.File()}))
+	a.False(ignore.DoesPass(StoredObject{relativePath: "build", entityType: common.EEntityType.Folder()}))
+	a.False(ignore.DoesPass(StoredObject{relativePath: "build/out.bin", entityType: common.EEntityType.File()}))
+	a.True(ignore.DoesPass(StoredObject{relativePath: "src/main.go", entityType: common.EEntityType.File()}))
+}
+
+func TestNewUploadIgnore_Wildcards(t *testing.T) {
+	a := assert.New(t)
+
+	root := t.TempDir()
+	writeIgnoreTestTree(a, root, map[string]string{".azcopyignore": "*.log\n"})
+
+	ignore, err := newUploadIgnore(filepath.Join(root, "*"), "")
+	a.NoError(err)
+	a.True(ignore.ignoresPath(filepath.Join(root, "dir", "a.log"), false))
+}
+
+func TestLocalTraverser_SkipsIgnoredPaths(t *testing.T) {
+	a := assert.New(t)
+
+	root := t.TempDir()
+	writeIgnoreTestTree(a, root, map[string]string{
+		".azcopyignore":          "*.log\nnode_modules/\n",
+		"app.go":                 "",
+		"app.log":                "",
+		"node_modules/pkg/a.js":  "",
+		"src/.azcopyignore":      "!keep.log\ngen/\n",
+		"src/keep.log":           "",
+		"src/drop.log":           "",
+		"src/gen/generated.go":   "",
+		"src/lib/lib.go":         "",
+		"src/lib/node_modules/":  "",
+		"src/lib/other.log":      "",
+		"src/lib/not-gen/gen.go": "",
+	})
+
+	ignore, err := newAzcopyIgnore(root, "")
+	a.NoError(err)
+
+	traverser, err := newLocalTraverser(root, context.Background(), InitResourceTraverserOptions{
+		Recursive:       true,
+		SymlinkHandling: common.ESymlinkHandlingType.Skip(),
+		Ignore:          ignore,
+	})
+	a.NoError(err)
+
+	processor := &dummyProcessor{}
+	a.NoError(traverser.Traverse(noPreProccessor, processor.process, nil))
+	a.Equal([]string{
+		"",
+		".azcopyignore",
+		"app.go",
+		"src",
+		"src/.azcopyignore",
+		"src/keep.log",
+		"src/lib",
+		"src/lib/lib.go",
+		"src/lib/not-gen",
+		"src/lib/not-gen/gen.go",
+	}, sortedRelativePaths(processor))
+
+	// without recursion, only the root's rules come into play
+	traverser, err = newLocalTraverser(root, context.Background(), InitResourceTraverserOptions{Ignore: ignore})
+	a.NoError(err)
+	processor = &dummyProcessor{}
+	a.NoError(traverser.Traverse(noPreProccessor, processor.process, nil))
+	a.Equal([]string{".azcopyignore", "app.go"}, sortedRelativePaths(processor))
+}
@@ -0,0 +1,290 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func renameTestFile(relativePath string, lmt time.Time) StoredObject {
+	return newStoredObject(noPreProccessor, filepath.Base(relativePath), relativePath, common.EEntityType.File(), lmt, 1, noContentProps, noBlobProps, noMetadata, "")
+}
+
+func TestRenameRules_Apply(t *testing.T) {
+	a := assert.New(t)
+	lmt := time.Date(2024, 5, 7, 13, 4, 5, 0, time.FixedZone("PDT", -7*3600))
+
+	cases := []struct {
+		rules    []string
+		path     string
+		expected string
+	}{
+		// the example from the docs
+		{[]string{`s#^logs/(\d{4})-(\d{2})/#logs/year=$1/month=$2/#`}, "logs/2024-05/app.log", "logs/year=2024/month=05/app.log"},
+		{[]string{`s#^logs/(\d{4})-(\d{2})/#logs/year=$1/month=$2/#`}, "other/2024-05/app.log", "other/2024-05/app.log"},
+
+		// named groups, and the date the object was last modified, in UTC
+		{[]string{`s|^(?P<name>[^/]+)\.csv$|csv/{lmt:yyyy/MM/dd/HH}/${name}.csv|`}, "sales.csv", "csv/2024/05/07/20/sales.csv"},
+		{[]string{`s#^#dt={lmt:yyyy-MM-dd}/#`}, "a/b.txt", "dt=2024-05-07/a/b.txt"},
+		{[]string{`s#^#{lmt:yy}{lmt:mmss}/#`}, "a", "240405/a"},
+
+		// changing case
+		{[]string{`s#^([^/]+)/#{lower:$1}/#`}, "Region-EU/Data.JSON", "region-eu/Data.JSON"},
+		{[]string{`s#\.([a-z]+)$#.{upper:$1-{lmt:yyyy}}#`}, "x/data.json", "x/data.JSON-2024"},
+
+		// flags, escaped delimiters and literal braces
+		{[]string{`s/-/_/`}, "a-b-c", "a_b-c"},
+		{[]string{`s/-/_/g`}, "a-b-c", "a_b_c"},
+		{[]string{`s/RAW/cooked/i`}, "raw/Raw.txt", "cooked/Raw.txt"},
+		{[]string{`s/^in\/out/in_out/`}, "in/out/f", "in_out/f"},
+		{[]string{`s#^#{{v1}}/#`}, "f", "{v1}/f"},
+
+		// rules apply in order, each to what the last produced
+		{[]string{`s#^Logs/#logs/#`, `s#^logs/(\d{4})/#logs/year=$1/#`}, "Logs/2023/x", "logs/year=2023/x"},
+
+		// a leading slash is dropped
+		{[]string{`s#^archive/##`}, "archive/x", "x"},
+	}
+
+	for _, c := range cases {
+		rules, err := newRenameRules(c.rules, "")
+		a.NoError(err, c.rules)
+		renamed, err := rules.destinationPath(renameTestFile(c.path, lmt))
+		a.NoError(err, c.rules)
+		a.Equal(c.expected, renamed, c.rules)
+	}
+
+	// without rules, paths are left alone
+	var none *renameRules
+	renamed, err := none.destinationPath(renameTestFile("a/b", lmt))
+	a.NoError(err)
+	a.Equal("a/b", renamed)
+	a.False(none.usesLastModifiedTime())
+
+	rules, err := newRenameRules(nil, "")
+	a.NoError(err)
+	a.Nil(rules)
+}
+
+func TestRenameRules_ParseErrors(t *testing.T) {
+	a := assert.New(t)
+
+	for _, rule := range []string{
+		"logs/new",       // not a substitution
+		"s",              // nothing after the s
+		"sxaxbx",         // letters can't be delimiters
+		"s#a#b",          // missing the last delimiter
+		"s##b#",          // empty pattern
+		"s#(#b#",         // bad regular expression
+		"s#a#b#x",        // unknown flag
+		"s#a#{lmt:yyyy#", // unclosed helper
+		"s#a#{lower:$1#", // unclosed helper
+		"s#a#{base:$1}#", // unknown helper
+		"s#a#}#",         // stray brace
+		"s#a#{nocolon}#", // helper without a colon
+	} {
+		_, err := newRenameRules([]string{rule}, "")
+		a.Error(err, rule)
+	}
+}
+
+func TestRenameRules_File(t *testing.T) {
+	a := assert.New(t)
+
+	rulesFile := filepath.Join(t.TempDir(), "rules")
+	a.NoError(os.WriteFile(rulesFile, []byte("# partitions\r\n\ns#^logs/#raw/logs/#\r\n  s#\\.LOG$#.log#i  \n"), 0644))
+
+	rules, err := newRenameRules([]string{`s#^app/#logs/#`}, rulesFile)
+	a.NoError(err)
+	a.Len(rules.rules, 3)
+
+	renamed, err := rules.destinationPath(renameTestFile("app/x.LOG", time.Now()))
+	a.NoError(err)
+	a.Equal("raw/logs/x.log", renamed)
+
+	// errors name the line
+	a.NoError(os.WriteFile(rulesFile, []byte("s#a#b#\ns#a#b\n"), 0644))
+	_, err = newRenameRules(nil, rulesFile)
+	a.ErrorContains(err, "line 2")
+
+	_, err = newRenameRules(nil, filepath.Join(t.TempDir(), "missing"))
+	a.Error(err)
+}
+
+func TestRenameRules_Collisions(t *testing.T) {
+	a := assert.New(t)
+
+	rules, err := newRenameRules([]string{`s#^([^/]+)/#{lower:$1}/#`}, "")
+	a.NoError(err)
+	a.Empty(rules.destinations)
+
+	_, err = rules.destinationPath(renameTestFile("Data/a.csv", time.Now()))
+	a.NoError(err)
+
+	// the same file can be looked up again, e.g. by sync before it is scheduled
+	_, err = rules.destinationPath(renameTestFile("Data/a.csv", time.Now()))
+	a.NoError(err)
+
+	_, err = rules.destinationPath(renameTestFile("DATA/a.csv", time.Now()))
+	a.ErrorContains(err, "'DATA/a.csv' and another file to 'data/a.csv'")
+
+	// even against a file the rules leave alone
+	_, err = rules.destinationPath(renameTestFile("data/a.csv", time.Now()))
+	a.Error(err)
+
+	// folders can be merged
+	folder := renameTestFile("DATA", time.Now())
+	folder.relativePath = "Data/sub"
+	folder.entityType = common.EEntityType.Folder()
+	_, err = rules.destinationPath(folder)
+	a.NoError(err)
+	folder.relativePath = "DATA/sub"
+	_, err = rules.destinationPath(folder)
+	a.NoError(err)
+
+	// as can files in different containers
+	inContainer := renameTestFile("DATA/b.csv", time.Now())
+	inContainer.ContainerName = "one"
+	_, err = rules.destinationPath(inContainer)
+	a.NoError(err)
+	inContainer.ContainerName = "two"
+	_, err = rules.destinationPath(inContainer)
+	a.NoError(err)
+
+	// unless they are copied to the same one
+	inContainer.DstContainerName = "one"
+	_, err = rules.destinationPath(inContainer)
+	a.ErrorContains(err, "'two/DATA/b.csv' and another file to 'one/data/b.csv'")
+
+	// the rules can't send files outside the destination, or nowhere
+	rules, err = newRenameRules([]string{`s#^[^/]+/#../#`}, "")
+	a.NoError(err)
+	_, err = rules.destinationPath(renameTestFile("a/b", time.Now()))
+	a.Error(err)
+
+	rules, err = newRenameRules([]string{`s#.*##`}, "")
+	a.NoError(err)
+	_, err = rules.destinationPath(renameTestFile("a/b", time.Now()))
+	a.Error(err)
+}
+
+func TestRenameRules_SpillAndReset(t *testing.T) {
+	a := assert.New(t)
+	spillDir := filepath.Join(t.TempDir(), "renames")
+
+	rules, err := newRenameRules([]string{`s#^([^/]+)/#{lower:$1}/#`}, "")
+	a.NoError(err)
+	rules.spillAt(1, spillDir)
+
+	// past the threshold, the destinations are checked on disk
+	for _, path := range []string{"Data/a.csv", "Data/b.csv", "Data/a.csv"} {
+		_, err = rules.destinationPath(renameTestFile(path, time.Now()))
+		a.NoError(err)
+	}
+	a.NotNil(rules.spilled)
+	a.Empty(rules.destinations)
+	_, err = rules.destinationPath(renameTestFile("DATA/b.csv", time.Now()))
+	a.ErrorContains(err, "'DATA/b.csv' and another file to 'data/b.csv'")
+
+	// a file deleted from the source is found at the destination, without taking its place from the file renamed to it
+	renamed, taken, err := rules.vacatedPath(renameTestFile("DATA/a.csv", time.Now()))
+	a.NoError(err)
+	a.Equal("data/a.csv", renamed)
+	a.True(taken)
+	_, taken, err = rules.vacatedPath(renameTestFile("Data/a.csv", time.Now()))
+	a.NoError(err)
+	a.False(taken)
+	_, taken, err = rules.vacatedPath(renameTestFile("Data/c.csv", time.Now()))
+	a.NoError(err)
+	a.False(taken)
+
+	// once reset, e.g. by the next watch job, the name can change case at the source
+	a.NoError(rules.reset())
+	_, err = os.Stat(spillDir)
+	a.True(os.IsNotExist(err))
+	_, err = rules.destinationPath(renameTestFile("DATA/b.csv", time.Now()))
+	a.NoError(err)
+
+	var none *renameRules
+	a.NoError(none.reset())
+}
+
+func TestCopyTransferProcessor_Rename(t *testing.T) {
+	a := assert.New(t)
+
+	rules, err := newRenameRules([]string{`s#^logs/(\d{4})-(\d{2})/#logs/year=$1/month=$2/#`}, "")
+	a.NoError(err)
+
+	template := &common.CopyJobPartOrderRequest{FromTo: common.EFromTo.LocalBlob(), Fpo: common.EFolderPropertiesOption.NoFolders(), SymlinkHandlingType: common.ESymlinkHandlingType.Skip()}
+	processor := newCopyTransferProcessor(template, 100, newLocalRes("/data"), newRemoteRes("https://account.blob.core.windows.net/lake"), nil, nil, false, false)
+	processor.rename = rules
+
+	a.NoError(processor.scheduleCopyTransfer(renameTestFile("logs/2024-05/app.log", time.Now())))
+	a.NoError(processor.scheduleCopyTransfer(renameTestFile("readme.txt", time.Now())))
+	a.Error(processor.scheduleCopyTransfer(renameTestFile("logs/year=2024/month=05/app.log", time.Now())))
+
+	a.Len(template.Transfers.List, 2)
+	a.Equal("/logs/2024-05/app.log", template.Transfers.List[0].Source)
+	a.Equal("/logs/year=2024/month=05/app.log", template.Transfers.List[0].Destination)
+	a.Equal("/readme.txt", template.Transfers.List[1].Destination)
+}
+
+func TestSyncComparators_Rename(t *testing.T) {
+	a := assert.New(t)
+	older, newer := time.Now().Add(-time.Hour), time.Now()
+
+	// downloads and S2S look the source objects up in the index of the destination by the paths they're renamed to
+	rules, err := newRenameRules([]string{`s#^src/#dst/#`}, "")
+	a.NoError(err)
+	destinationIndex := newObjectIndexer()
+	a.NoError(destinationIndex.store(renameTestFile("dst/a", newer)))
+	a.NoError(destinationIndex.store(renameTestFile("dst/b", older)))
+	scheduler := dummyProcessor{}
+	sourceComparator := newSyncSourceComparator(destinationIndex, scheduler.process, common.ESyncHashType.None(), false, false, false)
+	sourceComparator.rename = rules
+
+	a.NoError(sourceComparator.processIfNecessary(renameTestFile("src/a", older)))
+	a.NoError(sourceComparator.processIfNecessary(renameTestFile("src/b", newer)))
+	a.Equal([]string{"src/b"}, sortedRelativePaths(&scheduler))
+	a.Empty(destinationIndex.indexMap)
+
+	// uploads index the source by the paths the files are renamed to, to look up the destination objects in it
+	rules, err = newRenameRules([]string{`s#^src/#dst/#`}, "")
+	a.NoError(err)
+	sourceIndex := newObjectIndexer()
+	sourceIndex.rename = rules
+	a.NoError(sourceIndex.store(renameTestFile("src/a", older)))
+	a.NoError(sourceIndex.store(renameTestFile("src/b", newer)))
+	scheduler, cleaner := dummyProcessor{}, dummyProcessor{}
+	destinationComparator := newSyncDestinationComparator(sourceIndex, scheduler.process, cleaner.process, common.ESyncHashType.None(), false, false, false)
+
+	a.NoError(destinationComparator.processIfNecessary(renameTestFile("dst/a", newer)))
+	a.NoError(destinationComparator.processIfNecessary(renameTestFile("dst/b", older)))
+	a.NoError(destinationComparator.processIfNecessary(renameTestFile("src/a", older)))
+	a.Equal([]string{"src/b"}, sortedRelativePaths(&scheduler))
+	a.Equal([]string{"src/a"}, sortedRelativePaths(&cleaner))
+}
@@ -969,6 +969,8 @@ func getDefaultSyncRawInput(sra, dst string) rawSyncCmdArgs {
 		deleteDestination:    deleteDestination.String(),
 		md5ValidationOption:  common.DefaultHashValidationOption.String(),
 		compareHash:          common.ESyncHashType.None().String(),
+		compareBy:            common.ESyncCompareBy.Default().String(),
+		conflictPolicy:       common.ESyncConflictPolicy.Report().String(),
 		localHashStorageMode: common.EHashStorageMode.Default().String(),
 	}
 }
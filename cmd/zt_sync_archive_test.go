@@ -0,0 +1,107 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanSyncArchivePrefix(t *testing.T) {
+	a := assert.New(t)
+
+	for prefix, expected := range map[string]string{
+		".azcopy-deleted":    ".azcopy-deleted",
+		".azcopy-deleted/":   ".azcopy-deleted",
+		`archive\deleted`:    "archive/deleted",
+		"archive/./deleted/": "archive/deleted",
+	} {
+		cleaned, err := cleanSyncArchivePrefix(prefix)
+		a.NoError(err, prefix)
+		a.Equal(expected, cleaned, prefix)
+	}
+
+	for _, prefix := range []string{"/", ".", "..", "../outside", "/absolute", "a/../.."} {
+		_, err := cleanSyncArchivePrefix(prefix)
+		a.Error(err, prefix)
+	}
+}
+
+func TestSyncArchivePath(t *testing.T) {
+	a := assert.New(t)
+
+	at := time.Date(2026, 10, 16, 9, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	a.Equal(".azcopy-deleted/2026-10-16T073000Z", syncArchivePath(".azcopy-deleted", at))
+}
+
+func TestSyncArchiveFilter(t *testing.T) {
+	a := assert.New(t)
+
+	filter := &syncArchiveFilter{prefix: ".azcopy-deleted"}
+	object := func(relativePath string) StoredObject {
+		return StoredObject{relativePath: relativePath, entityType: common.EEntityType.File()}
+	}
+
+	a.False(filter.DoesPass(object(".azcopy-deleted")))
+	a.False(filter.DoesPass(object(".azcopy-deleted/2026-10-16T073000Z/a.txt")))
+	a.False(filter.DoesPass(object(`.azcopy-deleted\2026-10-16T073000Z\a.txt`)))
+	a.True(filter.DoesPass(object(".azcopy-deleted-not/a.txt")))
+	a.True(filter.DoesPass(object("dir/.azcopy-deleted/a.txt")))
+}
+
+func TestSyncArchiveExpired(t *testing.T) {
+	a := assert.New(t)
+
+	cutoff := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	a.True(syncArchiveExpired("2026-09-30T235959Z/dir/a.txt", cutoff))
+	a.True(syncArchiveExpired("2026-09-30T235959Z", cutoff))
+	a.False(syncArchiveExpired("2026-10-01T000000Z/a.txt", cutoff))
+	a.False(syncArchiveExpired("2026-10-02T120000Z/a.txt", cutoff))
+
+	// anything else someone put in the archive is left alone
+	a.False(syncArchiveExpired("notes.txt", cutoff))
+	a.False(syncArchiveExpired("", cutoff))
+}
+
+func TestSyncArchiveDryrun(t *testing.T) {
+	a := assert.New(t)
+	mockedLcm := mockedLifecycleManager{dryrunLog: make(chan string, 50)}
+	mockedLcm.SetOutputFormat(common.EOutputFormat.Text())
+	previous := glcm
+	glcm = &mockedLcm
+	defer func() { glcm = previous }()
+
+	root := common.ResourceString{Value: "https://account.blob.core.windows.net/container"}
+	processor := newInteractiveDeleteProcessor(nil, common.EDeleteDestination.True(), common.ELocation.Blob().String(), root, nil, true)
+	processor.archivePathToDisplay = ".azcopy-deleted/2026-10-16T073000Z"
+
+	// files are moved to the archive, while the folders they leave are deleted
+	a.NoError(processor.removeImmediately(StoredObject{relativePath: "dir/a.txt", entityType: common.EEntityType.File()}))
+	a.NoError(processor.removeImmediately(StoredObject{relativePath: "dir", entityType: common.EEntityType.Folder()}))
+
+	a.Equal([]string{
+		"DRYRUN: move https://account.blob.core.windows.net/container/dir/a.txt to https://account.blob.core.windows.net/container/.azcopy-deleted/2026-10-16T073000Z/dir/a.txt",
+		"DRYRUN: remove https://account.blob.core.windows.net/container/dir",
+	}, mockedLcm.GatherAllLogs(mockedLcm.dryrunLog))
+}
@@ -0,0 +1,273 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func syncTestFile(relativePath string, size int64, lmt time.Time) *StoredObject {
+	return &StoredObject{name: filepath.Base(relativePath), relativePath: relativePath, entityType: common.EEntityType.File(), size: size, lastModifiedTime: lmt}
+}
+
+func TestDecideSyncAction(t *testing.T) {
+	a := assert.New(t)
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	writtenBy := t0.Add(time.Hour)
+
+	file := syncTestFile("f", 10, t0)
+	changed := syncTestFile("f", 11, t0.Add(time.Minute))
+	touched := syncTestFile("f", 10, t0.Add(time.Minute))
+	listed := syncBaselineEntry{listedSyncBaselineSide(file), listedSyncBaselineSide(file)}
+
+	// a copy the last sync made is only taken to have changed once modified after the sync finished
+	uploaded := syncBaselineEntry{listedSyncBaselineSide(file), writtenSyncBaselineSide(file)}
+	copied := syncTestFile("f", 10, writtenBy.Add(-time.Minute))
+	editedAfter := syncTestFile("f", 10, writtenBy.Add(time.Minute))
+
+	tests := []struct {
+		name                string
+		source, destination *StoredObject
+		baseline            syncBaselineEntry
+		expected            syncBidirectionalAction
+	}{
+		{"unchanged", file, file, listed, syncActionNone},
+		{"changed at the source", changed, file, listed, syncActionCopyToDestination},
+		{"touched at the destination", file, touched, listed, syncActionCopyToSource},
+		{"deleted from the source", nil, file, listed, syncActionDeleteFromDestination},
+		{"deleted from the destination", file, nil, listed, syncActionDeleteFromSource},
+		{"deleted from both", nil, nil, listed, syncActionNone},
+		{"new at the source", file, nil, syncBaselineEntry{}, syncActionCopyToDestination},
+		{"new at the destination", nil, file, syncBaselineEntry{}, syncActionCopyToSource},
+		{"new at both, alike", file, file, syncBaselineEntry{}, syncActionNone},
+		{"new at both, different", file, changed, syncBaselineEntry{}, syncActionConflict},
+		{"changed at both", changed, touched, listed, syncActionConflict},
+		{"changed at one, deleted from the other", changed, nil, listed, syncActionConflict},
+		{"written by the last sync", file, copied, uploaded, syncActionNone},
+		{"edited after the last sync", file, editedAfter, uploaded, syncActionCopyToSource},
+	}
+
+	for _, test := range tests {
+		action, _ := decideSyncAction(test.source, test.destination, test.baseline, writtenBy, false)
+		a.Equal(test.expected, action, test.name)
+	}
+
+	// matching hashes outweigh times
+	hashed := *touched
+	hashed.md5 = []byte{1}
+	baselineHashed := *file
+	baselineHashed.md5 = []byte{1}
+	action, _ := decideSyncAction(file, &hashed, syncBaselineEntry{listedSyncBaselineSide(file), listedSyncBaselineSide(&baselineHashed)}, writtenBy, false)
+	a.Equal(syncActionNone, action)
+}
+
+func TestResolveSyncConflict(t *testing.T) {
+	a := assert.New(t)
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	older, newer := syncTestFile("f", 1, t0), syncTestFile("f", 2, t0.Add(time.Minute))
+	folder := &StoredObject{relativePath: "f", entityType: common.EEntityType.Folder()}
+
+	report, newerWins, keepBoth := common.ESyncConflictPolicy.Report(), common.ESyncConflictPolicy.NewerWins(), common.ESyncConflictPolicy.KeepBoth()
+
+	action, _ := resolveSyncConflict(report, newer, older, false)
+	a.Equal(syncActionConflict, action)
+	action, _ = resolveSyncConflict(newerWins, newer, older, false)
+	a.Equal(syncActionCopyToDestination, action)
+	action, _ = resolveSyncConflict(newerWins, older, newer, false)
+	a.Equal(syncActionCopyToSource, action)
+	action, _ = resolveSyncConflict(keepBoth, older, newer, false)
+	a.Equal(syncActionKeepBoth, action)
+
+	// a change wins over a deletion, unless conflicts are only reported
+	action, _ = resolveSyncConflict(keepBoth, nil, newer, false)
+	a.Equal(syncActionCopyToSource, action)
+	action, _ = resolveSyncConflict(newerWins, newer, nil, false)
+	a.Equal(syncActionCopyToDestination, action)
+	action, _ = resolveSyncConflict(report, newer, nil, false)
+	a.Equal(syncActionConflict, action)
+
+	// files and folders never replace each other
+	action, _ = resolveSyncConflict(newerWins, newer, folder, false)
+	a.Equal(syncActionConflict, action)
+
+	a.Equal("dir/report.conflict-20240102-030405.docx", syncConflictName("dir/report.docx", t0))
+	a.Equal("Makefile.conflict-20240102-030405", syncConflictName("Makefile", t0))
+
+	var policy common.SyncConflictPolicy
+	a.NoError(policy.Parse("newerwins"))
+	a.Equal(newerWins, policy)
+	a.Error(policy.Parse("SourceWins"))
+}
+
+func TestSyncBaselineRoundTrip(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "snapshots", "pair.baseline")
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	_, err := loadSyncBaseline(path, "fingerprint", false)
+	a.True(os.IsNotExist(err))
+
+	file := syncTestFile("Dir/A.txt", 10, t0)
+	file.md5 = []byte{1, 2, 3}
+	entries := map[string]syncBaselineEntry{
+		"Dir/A.txt": {listedSyncBaselineSide(file), writtenSyncBaselineSide(file)},
+		"b.txt":     {destination: listedSyncBaselineSide(syncTestFile("b.txt", 3, t0))},
+	}
+
+	writer, err := newSyncBaselineWriter(path, "fingerprint", common.NewJobID())
+	a.NoError(err)
+	for relativePath, entry := range entries {
+		writer.addEntry(relativePath, entry)
+	}
+	a.NoError(writer.commitAt(t0.Add(time.Hour)))
+
+	baseline, err := loadSyncBaseline(path, "fingerprint", true)
+	a.NoError(err)
+	a.True(t0.Add(time.Hour).Equal(baseline.writtenBy))
+	a.Len(baseline.entries, 2)
+
+	entry := baseline.take("dir/a.txt")
+	a.Equal(syncBaselineListed, entry.source.state)
+	a.Equal(syncBaselineWritten, entry.destination.state)
+	a.Equal("Dir/A.txt", entry.destination.object.relativePath)
+	a.Equal(file.md5, entry.destination.object.md5)
+	a.True(t0.Equal(entry.source.object.lastModifiedTime))
+	a.Equal(syncBaselineAbsent, baseline.take("b.txt").source.state)
+	a.Empty(baseline.entries)
+
+	// a baseline without its trailer is incomplete, and one taken with other settings is ignored
+	writer, err = newSyncBaselineWriter(path, "fingerprint", common.NewJobID())
+	a.NoError(err)
+	writer.addEntry("b.txt", entries["b.txt"])
+	a.NoError(writer.commit())
+	_, err = loadSyncBaseline(path, "fingerprint", false)
+	a.ErrorIs(err, errCorruptSyncSnapshot)
+	_, err = loadSyncBaseline(path, "other", false)
+	a.ErrorIs(err, errSyncSnapshotSettingsChanged)
+}
+
+func TestSyncBidirectionalComparator(t *testing.T) {
+	a := assert.New(t)
+	localRoot := t.TempDir()
+	t0 := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	writtenBy := t0.Add(time.Hour)
+	now := writtenBy.Add(time.Hour)
+
+	file := func(relativePath string, size int64) *StoredObject { return syncTestFile(relativePath, size, t0) }
+	listed := func(relativePath string) syncBaselineEntry {
+		return syncBaselineEntry{listedSyncBaselineSide(file(relativePath, 1)), listedSyncBaselineSide(file(relativePath, 1))}
+	}
+
+	baseline := newSyncBaseline()
+	baseline.writtenBy = writtenBy
+	for _, relativePath := range []string{"same.txt", "src-changed.txt", "dst-changed.txt", "src-deleted.txt", "dst-deleted.txt", "both.txt"} {
+		baseline.entries[relativePath] = listed(relativePath)
+	}
+	a.NoError(os.WriteFile(filepath.Join(localRoot, "both.txt"), []byte("local"), 0644))
+
+	indexer := newObjectIndexer()
+	for _, destination := range []*StoredObject{
+		file("same.txt", 1), file("src-changed.txt", 1), file("dst-changed.txt", 2), file("src-deleted.txt", 1), file("new-at-dst.txt", 1), file("both.txt", 3),
+	} {
+		a.NoError(indexer.store(*destination))
+	}
+
+	baselinePath := filepath.Join(t.TempDir(), "pair.baseline")
+	nextBaseline, err := newSyncBaselineWriter(baselinePath, "fingerprint", common.NewJobID())
+	a.NoError(err)
+
+	// once the transfers are done, each side lists what was copied to it with the times it gave them; new-at-dst.txt has gone again
+	conflictName := syncConflictName("both.txt", now)
+	serviceTime := now.Add(time.Hour)
+	relisted := func(atSource bool) (ResourceTraverser, error) {
+		if atSource {
+			return &staticTraverser{objects: []StoredObject{*syncTestFile("dst-changed.txt", 2, now), *syncTestFile("both.txt", 3, now)}}, nil
+		}
+		return &staticTraverser{objects: []StoredObject{*syncTestFile("src-changed.txt", 2, serviceTime), *syncTestFile(conflictName, 4, serviceTime)}}, nil
+	}
+
+	forward, reverse, deletedFromDestination, deletedFromSource := &dummyProcessor{}, &dummyProcessor{}, &dummyProcessor{}, &dummyProcessor{}
+	comparator := &syncBidirectionalComparator{
+		syncSourceComparator:  newSyncSourceComparator(indexer, forward.process, common.ESyncHashType.None(), false, false, false),
+		copyToSource:          reverse.process,
+		writtenToDestination:  newObjectIndexer(),
+		writtenToSource:       newObjectIndexer(),
+		relist:                relisted,
+		deleteFromDestination: deletedFromDestination.process,
+		deleteFromSource:      deletedFromSource.process,
+		baseline:              baseline,
+		nextBaseline:          nextBaseline,
+		policy:                common.ESyncConflictPolicy.KeepBoth(),
+		localRoot:             localRoot,
+		sourceIsLocal:         true,
+	}
+
+	for _, source := range []*StoredObject{file("same.txt", 1), file("src-changed.txt", 2), file("dst-changed.txt", 1), file("dst-deleted.txt", 1), file("both.txt", 4)} {
+		a.NoError(comparator.processIfNecessary(*source))
+	}
+	a.NoError(indexer.traverse(comparator.processDestinationOnly, nil))
+	a.NoError(comparator.resolveKeepBoth(now))
+	nextBaseline.settle = comparator.settleBaseline
+
+	relativePaths := func(d *dummyProcessor) []string {
+		var paths []string
+		for _, storedObject := range d.record {
+			paths = append(paths, storedObject.relativePath)
+		}
+		sort.Strings(paths)
+		return paths
+	}
+	a.Equal([]string{conflictName, "src-changed.txt"}, relativePaths(forward))
+	a.Equal([]string{"both.txt", "dst-changed.txt", "new-at-dst.txt"}, relativePaths(reverse))
+	a.Equal([]string{"src-deleted.txt"}, relativePaths(deletedFromDestination))
+	a.Equal([]string{"dst-deleted.txt"}, relativePaths(deletedFromSource))
+	a.Zero(comparator.conflicts)
+
+	// the local version of the conflict was kept aside
+	_, err = os.Stat(filepath.Join(localRoot, "both.txt"))
+	a.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(localRoot, conflictName))
+	a.NoError(err)
+
+	// the next sync starts from what this one left on both sides
+	a.NoError(nextBaseline.commitAt(now))
+	next, err := loadSyncBaseline(baselinePath, "fingerprint", false)
+	a.NoError(err)
+	a.Len(next.entries, 8)
+	a.Equal(syncBaselineListed, next.entries["src-changed.txt"].destination.state)
+	a.True(serviceTime.Equal(next.entries["src-changed.txt"].destination.object.lastModifiedTime))
+	a.Equal(syncBaselineListed, next.entries["src-changed.txt"].source.state)
+	a.Equal(syncBaselineListed, next.entries["dst-changed.txt"].source.state)
+	a.True(now.Equal(next.entries["dst-changed.txt"].source.object.lastModifiedTime))
+	a.Equal(syncBaselineListed, next.entries["both.txt"].source.state)
+	a.Equal(syncBaselineListed, next.entries[conflictName].destination.state)
+	a.Equal(syncBaselineWritten, next.entries["new-at-dst.txt"].source.state)
+	a.Equal(syncBaselineListed, next.entries["new-at-dst.txt"].destination.state)
+	a.Equal(syncBaselineAbsent, next.entries["src-deleted.txt"].source.state)
+	a.Equal(syncBaselineListed, next.entries["src-deleted.txt"].destination.state)
+}
@@ -0,0 +1,172 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func readSyncDiffReport(a *assert.Assertions, path string) map[string]syncDiffRecord {
+	file, err := os.Open(path)
+	a.NoError(err)
+	defer file.Close()
+
+	records := make(map[string]syncDiffRecord)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record syncDiffRecord
+		a.NoError(json.Unmarshal(scanner.Bytes(), &record))
+		records[record.Path] = record
+	}
+	a.NoError(scanner.Err())
+	return records
+}
+
+func TestSyncDiffReportUpload(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "diff.jsonl")
+	older := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	newer := older.Add(time.Hour)
+
+	report, err := newSyncDiffReport(path, common.ESyncHashType.None(), false, common.EDeleteDestination.True())
+	a.NoError(err)
+
+	// the source is indexed first for uploads
+	indexer := newObjectIndexer()
+	for _, source := range []*StoredObject{
+		syncTestFile("newer.txt", 10, newer),
+		syncTestFile("same.txt", 10, older),
+		syncTestFile("new.txt", 5, older),
+	} {
+		a.NoError(indexer.store(*source))
+	}
+
+	transferred, deleted := &dummyProcessor{}, &dummyProcessor{}
+	comparator := newSyncDestinationComparator(indexer, transferred.process, report.deletions(deleted.process), common.ESyncHashType.None(), false, false, false)
+	comparator.diffReport = report
+
+	destinationNewer := syncTestFile("newer.txt", 12, older)
+	destinationNewer.md5 = []byte{1, 2, 3}
+	for _, destination := range []*StoredObject{destinationNewer, syncTestFile("same.txt", 10, newer), syncTestFile("extra.txt", 7, older)} {
+		a.NoError(comparator.processIfNecessary(*destination))
+	}
+	a.NoError(indexer.traverse(report.creations(transferred.process), nil))
+	a.NoError(report.close())
+
+	a.Equal([]string{"new.txt", "newer.txt"}, sortedRelativePaths(transferred))
+	a.Equal([]string{"extra.txt"}, sortedRelativePaths(deleted))
+
+	records := readSyncDiffReport(a, path)
+	a.Len(records, 4)
+
+	overwritten := records["newer.txt"]
+	a.Equal(syncDiffActionOverwrite, overwritten.Action)
+	a.Equal(syncOverwriteReasonNewerLMT, overwritten.Reason)
+	a.Equal("MD5", overwritten.HashType)
+	a.EqualValues(10, overwritten.Source.Size)
+	a.True(newer.Equal(overwritten.Source.LastModifiedTime))
+	a.EqualValues(12, overwritten.Destination.Size)
+	a.Equal("AQID", overwritten.Destination.Hash)
+
+	a.Equal(syncDiffActionSkip, records["same.txt"].Action)
+	a.Equal(syncSkipReasonTime, records["same.txt"].Reason)
+
+	a.Equal(syncDiffActionCreate, records["new.txt"].Action)
+	a.Nil(records["new.txt"].Destination)
+
+	a.Equal(syncDiffActionDelete, records["extra.txt"].Action)
+	a.Equal(syncDeleteReasonMissingAtSource, records["extra.txt"].Reason)
+	a.Nil(records["extra.txt"].Source)
+	a.EqualValues(7, records["extra.txt"].Destination.Size)
+}
+
+func TestSyncDiffReportCSV(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "diff.CSV")
+	lmt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// extra files are only reported as skipped when they are kept at the destination
+	report, err := newSyncDiffReport(path, common.ESyncHashType.MD5(), false, common.EDeleteDestination.False())
+	a.NoError(err)
+	a.NoError(report.deletions(func(StoredObject) error { return nil })(*syncTestFile("dir/extra, with comma.txt", 3, lmt)))
+	report.compared(syncStatusOverwritten, syncOverwriteReasonMirror, *syncTestFile("a.txt", 1, lmt), *syncTestFile("a.txt", 2, lmt))
+	a.NoError(report.close())
+	a.NoError(report.close())
+
+	file, err := os.Open(path)
+	a.NoError(err)
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	a.NoError(err)
+	a.Len(rows, 3)
+	a.Equal(syncDiffReportCSVHeader, rows[0])
+	a.Equal([]string{"dir/extra, with comma.txt", "File", syncDiffActionSkip, syncSkipReasonMissingAtSourceNoDelete, "MD5", "", "", "", "3", "2024-01-02T03:04:05Z", ""}, rows[1])
+	a.Equal([]string{"a.txt", "File", syncDiffActionOverwrite, syncOverwriteReasonMirror, "MD5", "1", "2024-01-02T03:04:05Z", "", "2", "2024-01-02T03:04:05Z", ""}, rows[2])
+}
+
+// syncFiltersSeenTraverser remembers the filters it was given
+type syncFiltersSeenTraverser struct {
+	staticTraverser
+	filters []ObjectFilter
+}
+
+func (t *syncFiltersSeenTraverser) Traverse(preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	t.filters = filters
+	return t.staticTraverser.Traverse(preprocessor, processor, filters)
+}
+
+func TestSyncDiffReportFilterer(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "diff.jsonl")
+	lmt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	report, err := newSyncDiffReport(path, common.ESyncHashType.None(), false, common.EDeleteDestination.True())
+	a.NoError(err)
+
+	listed := &syncFiltersSeenTraverser{staticTraverser: staticTraverser{objects: []StoredObject{*syncTestFile("keep.txt", 1, lmt), *syncTestFile("skip.tmp", 1, lmt)}}}
+	traverser := &syncDiffReportFilterer{
+		ResourceTraverser: listed,
+		report:            report,
+		isSource:          true,
+	}
+	processed := &dummyProcessor{}
+	a.NoError(traverser.Traverse(noPreProccessor, processed.process, buildExcludeFilters([]string{"*.tmp"}, false)))
+	a.NoError(report.close())
+
+	// the traverser is still given the filters, so that it can leave out what they exclude as it lists
+	a.Len(listed.filters, 1)
+	a.Equal([]string{"keep.txt"}, sortedRelativePaths(processed))
+	records := readSyncDiffReport(a, path)
+	a.Len(records, 1)
+	a.Equal(syncDiffActionSkip, records["skip.tmp"].Action)
+	a.Equal(syncSkipReasonFiltered, records["skip.tmp"].Reason)
+	a.NotNil(records["skip.tmp"].Source)
+	a.Nil(records["skip.tmp"].Destination)
+}
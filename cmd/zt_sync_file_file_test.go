@@ -35,7 +35,7 @@ func TestSyncSourceComparator(t *testing.T) {
 
 	// set up the indexer as well as the source comparator
 	indexer := newObjectIndexer()
-	sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process, common.ESyncHashType.None(), false, false)
+	sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process, common.ESyncHashType.None(), false, false, false)
 
 	// create a sample destination object
 	sampleDestinationObject := StoredObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now(), md5: destMD5}
@@ -89,7 +89,7 @@ func TestSyncSrcCompDisableComparator(t *testing.T) {
 
 	// set up the indexer as well as the source comparator
 	indexer := newObjectIndexer()
-	sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process, common.ESyncHashType.None(), false, true)
+	sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process, common.ESyncHashType.None(), false, true, false)
 
 	// test the comparator in case a given source object is not present at the destination
 	// meaning no entry in the index, so the comparator should pass the given object to schedule a transfer
@@ -139,7 +139,7 @@ func TestSyncDestinationComparator(t *testing.T) {
 
 	// set up the indexer as well as the destination comparator
 	indexer := newObjectIndexer()
-	destinationComparator := newSyncDestinationComparator(indexer, dummyCopyScheduler.process, dummyCleaner.process, common.ESyncHashType.None(), false, false)
+	destinationComparator := newSyncDestinationComparator(indexer, dummyCopyScheduler.process, dummyCleaner.process, common.ESyncHashType.None(), false, false, false)
 
 	// create a sample source object
 	sampleSourceObject := StoredObject{name: "test", relativePath: "/usr/test", lastModifiedTime: time.Now(), md5: srcMD5}
@@ -197,7 +197,7 @@ func TestSyncDestCompDisableComparison(t *testing.T) {
 
 	// set up the indexer as well as the destination comparator
 	indexer := newObjectIndexer()
-	destinationComparator := newSyncDestinationComparator(indexer, dummyCopyScheduler.process, dummyCleaner.process, common.ESyncHashType.None(), false, true)
+	destinationComparator := newSyncDestinationComparator(indexer, dummyCopyScheduler.process, dummyCleaner.process, common.ESyncHashType.None(), false, true, false)
 
 	// create a sample source object
 	currTime := time.Now()
@@ -240,3 +240,216 @@ func TestSyncDestCompDisableComparison(t *testing.T) {
 		a.Equal(key+1, len(dummyCopyScheduler.record))
 	}
 }
+
+func TestSyncComparatorHTTPSource(t *testing.T) {
+	a := assert.New(t)
+	currTime := time.Now()
+	recordedETag := `"v1"`
+
+	destinationStoredObjects := []StoredObject{
+		// recorded ETag matches, even though the server reports a later time
+		{name: "test1", relativePath: "test1", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime, Metadata: common.Metadata{common.SyncSourceETagMetadataKey: &recordedETag}},
+		// recorded ETag differs, even though the server reports an earlier time
+		{name: "test2", relativePath: "test2", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime, Metadata: common.Metadata{common.SyncSourceETagMetadataKey: &recordedETag}},
+		// size differs
+		{name: "test3", relativePath: "test3", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime},
+		// no ETag recorded, and the source is older
+		{name: "test4", relativePath: "test4", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime},
+		// no ETag recorded, and the source is newer
+		{name: "test5", relativePath: "test5", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime},
+		// the server reports neither an ETag nor a time
+		{name: "test6", relativePath: "test6", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime},
+	}
+	sourceStoredObjects := []StoredObject{
+		{name: "test1", relativePath: "test1", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime.Add(time.Hour), eTag: `"v1"`},
+		{name: "test2", relativePath: "test2", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime.Add(-time.Hour), eTag: `"v2"`},
+		{name: "test3", relativePath: "test3", entityType: common.EEntityType.File(), size: 11, lastModifiedTime: currTime.Add(-time.Hour)},
+		{name: "test4", relativePath: "test4", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime.Add(-time.Hour), eTag: `"v1"`},
+		{name: "test5", relativePath: "test5", entityType: common.EEntityType.File(), size: 10, lastModifiedTime: currTime.Add(time.Hour)},
+		{name: "test6", relativePath: "test6", entityType: common.EEntityType.File(), size: 10},
+	}
+	expectTransfer := []bool{false, true, true, false, true, true}
+
+	// downloads index the destination and compare as the source is enumerated
+	dummyCopyScheduler := dummyProcessor{}
+	indexer := newObjectIndexer()
+	sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process, common.ESyncHashType.None(), false, false, true)
+	for key, dstStoredObject := range destinationStoredObjects {
+		a.Nil(indexer.store(dstStoredObject))
+		a.Nil(sourceComparator.processIfNecessary(sourceStoredObjects[key]))
+	}
+	a.Zero(len(indexer.indexMap))
+
+	var scheduled []string
+	for _, object := range dummyCopyScheduler.record {
+		scheduled = append(scheduled, object.relativePath)
+	}
+	var expected []string
+	for key, transfer := range expectTransfer {
+		if transfer {
+			expected = append(expected, sourceStoredObjects[key].relativePath)
+		}
+	}
+	a.Equal(expected, scheduled)
+
+	// the destination comparator reaches the same decisions
+	dummyCopyScheduler = dummyProcessor{}
+	dummyCleaner := dummyProcessor{}
+	destinationComparator := newSyncDestinationComparator(indexer, dummyCopyScheduler.process, dummyCleaner.process, common.ESyncHashType.None(), false, false, true)
+	for key, srcStoredObject := range sourceStoredObjects {
+		a.Nil(indexer.store(srcStoredObject))
+		a.Nil(destinationComparator.processIfNecessary(destinationStoredObjects[key]))
+	}
+
+	scheduled = nil
+	for _, object := range dummyCopyScheduler.record {
+		scheduled = append(scheduled, object.relativePath)
+	}
+	a.Equal(expected, scheduled)
+	a.Zero(len(dummyCleaner.record))
+}
+
+func TestSyncComparatorMetadataHash(t *testing.T) {
+	a := assert.New(t)
+	currTime := time.Now()
+	hashType := common.ESyncHashType.SHA256()
+	file := func(name string, lmt time.Time, hash string) StoredObject {
+		object := StoredObject{name: name, relativePath: name, entityType: common.EEntityType.File(), size: 10, lastModifiedTime: lmt}
+		if hash != "" {
+			object.setSyncHash(hashType, []byte(hash))
+		}
+		return object
+	}
+
+	destinationStoredObjects := []StoredObject{
+		file("same", currTime, "h1"),
+		file("different", currTime, "h1"),
+		file("missing", currTime, ""),
+		file("unhashed-older", currTime, "h1"),
+		file("unhashed-newer", currTime, "h1"),
+	}
+	// remote services may hand back metadata keys capitalized
+	capitalized := common.Metadata{"Azcopy_sha256": destinationStoredObjects[0].Metadata[hashType.MetadataKey()]}
+	destinationStoredObjects[0].Metadata = capitalized
+
+	sourceStoredObjects := []StoredObject{
+		file("same", currTime.Add(time.Hour), "h1"),
+		file("different", currTime.Add(-time.Hour), "h2"),
+		file("missing", currTime.Add(-time.Hour), "h1"),
+		file("unhashed-older", currTime.Add(-time.Hour), ""),
+		file("unhashed-newer", currTime.Add(time.Hour), ""),
+	}
+
+	dummyCopyScheduler := dummyProcessor{}
+	indexer := newObjectIndexer()
+	sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process, hashType, false, false, false)
+	for key, dstStoredObject := range destinationStoredObjects {
+		a.Nil(indexer.store(dstStoredObject))
+		a.Nil(sourceComparator.processIfNecessary(sourceStoredObjects[key]))
+	}
+
+	var scheduled []string
+	for _, object := range dummyCopyScheduler.record {
+		scheduled = append(scheduled, object.relativePath)
+	}
+	a.Equal([]string{"different", "missing", "unhashed-newer"}, scheduled)
+}
+
+func TestSyncComparatorCompareBy(t *testing.T) {
+	a := assert.New(t)
+	currTime := time.Now()
+	text, html := "text/plain", "text/html"
+	file := func(name string, size int64, lmt time.Time, md5 string, contentType string, metadata common.Metadata) StoredObject {
+		return StoredObject{name: name, relativePath: name, entityType: common.EEntityType.File(), size: size, lastModifiedTime: lmt,
+			md5: []byte(md5), contentType: contentType, Metadata: metadata}
+	}
+	owner := "alice"
+
+	// the destination was restored from a backup, so all its times are recent
+	destinationStoredObjects := []StoredObject{
+		file("same", 10, currTime, "h1", text, nil),
+		file("resized", 10, currTime, "h1", text, nil),
+		file("rewritten", 10, currTime, "h1", text, nil),
+		file("unhashed", 10, currTime, "", text, nil),
+		file("retyped", 10, currTime, "h1", html, nil),
+		file("retagged", 10, currTime, "h1", text, common.Metadata{"Owner": &owner}),
+		file("touched", 10, currTime.Add(-2*time.Hour), "h1", text, nil),
+	}
+	sourceStoredObjects := []StoredObject{
+		file("same", 10, currTime.Add(-time.Hour), "h1", text, nil),
+		file("resized", 11, currTime.Add(-time.Hour), "h2", text, nil),
+		file("rewritten", 10, currTime.Add(-time.Hour), "h2", text, nil),
+		file("unhashed", 10, currTime.Add(-time.Hour), "h1", text, nil),
+		file("retyped", 10, currTime.Add(-time.Hour), "h1", text, nil),
+		file("retagged", 10, currTime.Add(-time.Hour), "h1", text, common.Metadata{"owner": &owner, "team": &owner}),
+		file("touched", 10, currTime.Add(-time.Hour), "h1", text, nil),
+	}
+
+	expected := map[common.SyncCompareBy][]string{
+		common.ESyncCompareBy.Size():          {"resized"},
+		common.ESyncCompareBy.LMTAndSize():    {"resized", "touched"},
+		common.ESyncCompareBy.Checksum():      {"resized", "rewritten", "unhashed"},
+		common.ESyncCompareBy.MetadataAware(): {"resized", "rewritten", "unhashed", "retyped", "retagged"}, // and by hash, as --compare-hash asks
+	}
+
+	for compareBy, transferred := range expected {
+		// downloads and S2S index the destination, and compare as the source is enumerated
+		dummyCopyScheduler := dummyProcessor{}
+		indexer := newObjectIndexer()
+		sourceComparator := newSyncSourceComparator(indexer, dummyCopyScheduler.process, common.ESyncHashType.MD5(), false, false, false)
+		sourceComparator.compareBy = compareBy
+		for key, dstStoredObject := range destinationStoredObjects {
+			a.Nil(indexer.store(dstStoredObject))
+			a.Nil(sourceComparator.processIfNecessary(sourceStoredObjects[key]))
+		}
+
+		var scheduled []string
+		for _, object := range dummyCopyScheduler.record {
+			scheduled = append(scheduled, object.relativePath)
+		}
+		a.Equal(transferred, scheduled, compareBy.String())
+
+		// uploads index the source, and compare as the destination is enumerated
+		dummyCopyScheduler = dummyProcessor{}
+		destinationComparator := newSyncDestinationComparator(indexer, dummyCopyScheduler.process, (&dummyProcessor{}).process, common.ESyncHashType.MD5(), false, false, false)
+		destinationComparator.compareBy = compareBy
+		for key, srcStoredObject := range sourceStoredObjects {
+			a.Nil(indexer.store(srcStoredObject))
+			a.Nil(destinationComparator.processIfNecessary(destinationStoredObjects[key]))
+		}
+
+		scheduled = nil
+		for _, object := range dummyCopyScheduler.record {
+			scheduled = append(scheduled, object.relativePath)
+		}
+		a.Equal(transferred, scheduled, compareBy.String())
+	}
+}
+
+func TestRecordSyncSourceETag(t *testing.T) {
+	a := assert.New(t)
+	dummyCopyScheduler := dummyProcessor{}
+	scheduleCopyTransfer := recordSyncSourceETag(dummyCopyScheduler.process)
+
+	original := "value"
+	sharedMetadata := common.Metadata{"key": &original}
+	a.Nil(scheduleCopyTransfer(StoredObject{name: "a", relativePath: "a", entityType: common.EEntityType.File(), eTag: `"abc"`, Metadata: sharedMetadata}))
+	a.Nil(scheduleCopyTransfer(StoredObject{name: "b", relativePath: "b", entityType: common.EEntityType.File()}))
+	a.Nil(scheduleCopyTransfer(StoredObject{name: "c", relativePath: "c", entityType: common.EEntityType.Folder(), eTag: `"def"`}))
+	a.Equal(3, len(dummyCopyScheduler.record))
+
+	eTag, ok := common.TryReadMetadata(dummyCopyScheduler.record[0].Metadata, common.SyncSourceETagMetadataKey)
+	a.True(ok)
+	a.Equal(`"abc"`, *eTag)
+	a.Equal("value", *dummyCopyScheduler.record[0].Metadata["key"])
+
+	// the metadata of the enumerated object isn't modified in place
+	_, ok = common.TryReadMetadata(sharedMetadata, common.SyncSourceETagMetadataKey)
+	a.False(ok)
+
+	// nothing is recorded without an ETag, nor for folders
+	_, ok = common.TryReadMetadata(dummyCopyScheduler.record[1].Metadata, common.SyncSourceETagMetadataKey)
+	a.False(ok)
+	_, ok = common.TryReadMetadata(dummyCopyScheduler.record[2].Metadata, common.SyncSourceETagMetadataKey)
+	a.False(ok)
+}
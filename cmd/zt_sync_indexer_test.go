@@ -0,0 +1,223 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/lease"
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexRecordRoundTrip(t *testing.T) {
+	a := assert.New(t)
+
+	value, empty := "value", ""
+	storedObject := StoredObject{
+		name:                "f.pdf",
+		entityType:          common.EEntityType.Symlink(),
+		lastModifiedTime:    time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC),
+		smbLastModifiedTime: time.Date(2023, 1, 2, 3, 4, 5, 6, time.UTC),
+		size:                -1,
+		md5:                 []byte{1, 2, 3},
+		blobType:            blob.BlobTypeBlockBlob,
+		contentDisposition:  "attachment",
+		cacheControl:        "no-cache",
+		contentLanguage:     "en",
+		contentEncoding:     "gzip",
+		contentType:         "application/pdf",
+		relativePath:        "d/e/f.pdf",
+		ContainerName:       "src",
+		DstContainerName:    "dst",
+		eTag:                `"0x1"`,
+		sourceURL:           "https://example.com/f.pdf",
+		blobAccessTier:      blob.AccessTierCool,
+		archiveStatus:       blob.ArchiveStatusRehydratePendingToHot,
+		Metadata:            common.Metadata{"key": &value, "empty": &empty, "nil": nil},
+		blobVersionID:       "version",
+		blobTags:            common.BlobTags{"tag": "value"},
+		blobSnapshotID:      "snapshot",
+		blobDeleted:         true,
+		leaseState:          lease.StateTypeLeased,
+		leaseStatus:         lease.StatusTypeLocked,
+		leaseDuration:       lease.DurationTypeInfinite,
+	}
+
+	// every field must be set above, so that fields added to StoredObject later can't be left out of the index on disk
+	v := reflect.ValueOf(storedObject)
+	for j := 0; j < v.NumField(); j++ {
+		a.False(v.Field(j).IsZero(), "the test doesn't set %s", v.Type().Field(j).Name)
+	}
+
+	key, decoded, err := decodeIndexRecord(appendStoredObject(appendIndexString(nil, "d/e/f.pdf"), storedObject))
+	a.NoError(err)
+	a.Equal("d/e/f.pdf", key)
+	a.Equal(storedObject, decoded)
+
+	// an unknown hash is distinct from an empty one
+	_, decoded, err = decodeIndexRecord(appendStoredObject(appendIndexString(nil, "k"), StoredObject{name: "n"}))
+	a.NoError(err)
+	a.Nil(decoded.md5)
+	a.Nil(decoded.Metadata)
+	a.Equal("n", decoded.name)
+
+	record := appendStoredObject(appendIndexString(nil, "k"), storedObject)
+	_, _, err = decodeIndexRecord(record[:len(record)-3])
+	a.ErrorIs(err, errCorruptIndexRecord)
+}
+
+func TestDiskObjectIndex(t *testing.T) {
+	a := assert.New(t)
+
+	// start with two buckets, so that they have to grow many times over
+	index, err := newDiskObjectIndex(filepath.Join(t.TempDir(), "index"), 2)
+	a.NoError(err)
+	defer index.close()
+
+	const count = 5000
+	for j := 0; j < count; j++ {
+		path := fmt.Sprintf("dir%d/file%d", j%10, j)
+		a.NoError(index.put(path, StoredObject{relativePath: path, size: int64(j)}))
+	}
+	a.Equal(count, index.len())
+	a.Greater(len(index.buckets), 2)
+
+	// putting a key again replaces its object
+	a.NoError(index.put("dir0/file0", StoredObject{relativePath: "dir0/file0", size: -1}))
+	a.Equal(count, index.len())
+
+	for j := 0; j < count; j += 2 {
+		path := fmt.Sprintf("dir%d/file%d", j%10, j)
+		storedObject, present, err := index.get(path)
+		a.NoError(err)
+		a.True(present, path)
+		if j == 0 {
+			a.EqualValues(-1, storedObject.size)
+		} else {
+			a.EqualValues(j, storedObject.size)
+		}
+
+		a.NoError(index.remove(path))
+		_, present, err = index.get(path)
+		a.NoError(err)
+		a.False(present)
+	}
+	a.Equal(count/2, index.len())
+
+	// removing a missing key is harmless
+	a.NoError(index.remove("missing"))
+	_, present, err := index.get("missing")
+	a.NoError(err)
+	a.False(present)
+
+	var remaining []int64
+	a.NoError(index.traverse(func(storedObject StoredObject) error {
+		remaining = append(remaining, storedObject.size)
+		return nil
+	}))
+	a.Len(remaining, count/2)
+	for j, size := range remaining {
+		a.EqualValues(2*j+1, size) // in the order they were put
+	}
+}
+
+func TestObjectIndexerSpillsToDisk(t *testing.T) {
+	a := assert.New(t)
+
+	spillDir := filepath.Join(t.TempDir(), "sync-index")
+	indexer := newSpillingObjectIndexer(10, spillDir)
+	indexer.isDestinationCaseInsensitive = true
+
+	lmt := time.Now()
+	for j := 0; j < 100; j++ {
+		a.NoError(indexer.store(StoredObject{name: fmt.Sprintf("File%d", j), relativePath: fmt.Sprintf("Dir/File%d", j), entityType: common.EEntityType.File(), lastModifiedTime: lmt}))
+	}
+	a.NotNil(indexer.spilled)
+	a.Empty(indexer.indexMap)
+	a.Equal(100, indexer.spilled.len())
+	a.DirExists(spillDir)
+
+	// the source has even-numbered files, half of which are newer
+	var scheduled []string
+	comparator := newSyncSourceComparator(indexer, func(storedObject StoredObject) error {
+		scheduled = append(scheduled, storedObject.relativePath)
+		return nil
+	}, common.ESyncHashType.None(), false, false, false)
+	for j := 0; j < 100; j += 2 {
+		sourceLMT := lmt.Add(-time.Hour)
+		if j%4 == 0 {
+			sourceLMT = lmt.Add(time.Hour)
+		}
+		a.NoError(comparator.processIfNecessary(StoredObject{name: fmt.Sprintf("file%d", j), relativePath: fmt.Sprintf("dir/file%d", j), entityType: common.EEntityType.File(), lastModifiedTime: sourceLMT}))
+	}
+	a.NoError(comparator.processIfNecessary(StoredObject{name: "new", relativePath: "dir/new", entityType: common.EEntityType.File(), lastModifiedTime: lmt}))
+	a.Len(scheduled, 26)
+	a.Contains(scheduled, "dir/new")
+
+	// what's left exists only at the destination
+	var extra []string
+	a.NoError(indexer.traverse(func(storedObject StoredObject) error {
+		extra = append(extra, storedObject.relativePath)
+		return nil
+	}, nil))
+	sort.Strings(extra)
+	a.Len(extra, 50)
+	for _, path := range extra {
+		var j int
+		_, err := fmt.Sscanf(strings.TrimPrefix(path, "Dir/File"), "%d", &j)
+		a.NoError(err)
+		a.Equal(1, j%2, path)
+	}
+
+	a.NoError(indexer.close())
+	_, err := os.Stat(spillDir)
+	a.True(os.IsNotExist(err))
+}
+
+func TestSyncIndexSpillThreshold(t *testing.T) {
+	a := assert.New(t)
+	name := common.EEnvironmentVariable.SyncIndexSpillThreshold().Name
+
+	t.Setenv(name, "")
+	threshold, err := syncIndexSpillThreshold()
+	a.NoError(err)
+	a.Equal(1000000, threshold)
+
+	t.Setenv(name, "0")
+	threshold, err = syncIndexSpillThreshold()
+	a.NoError(err)
+	a.Zero(threshold)
+
+	for _, invalid := range []string{"-1", "lots"} {
+		t.Setenv(name, invalid)
+		_, err = syncIndexSpillThreshold()
+		a.Error(err, invalid)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func syncMoveTestFile(relativePath string, size int64, md5 string) StoredObject {
+	object := *syncTestFile(relativePath, size, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	object.md5 = []byte(md5)
+	return object
+}
+
+type syncMoveRecord struct {
+	oldPath, newPath string
+}
+
+func sortedRelativePaths(d *dummyProcessor) []string {
+	var paths []string
+	for _, storedObject := range d.record {
+		paths = append(paths, storedObject.relativePath)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestSyncMoveDetector(t *testing.T) {
+	a := assert.New(t)
+
+	// moves run concurrently
+	var mu sync.Mutex
+	var moves []syncMoveRecord
+	mover := func(oldObject, newObject StoredObject) error {
+		if newObject.relativePath == "fails/moved.bin" {
+			return errors.New("rename failed")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		moves = append(moves, syncMoveRecord{oldObject.relativePath, newObject.relativePath})
+		if newObject.relativePath == "copied/kept-old.bin" {
+			// e.g. a blob copied to its new name, whose old copy couldn't be deleted
+			return fmt.Errorf("%w: delete failed", errSyncMoveOldCopyLeft)
+		}
+		return nil
+	}
+
+	// the source is indexed first when uploading
+	indexer := newObjectIndexer()
+	for _, source := range []StoredObject{
+		syncMoveTestFile("same.bin", 10, "a"),
+		syncMoveTestFile("renamed/clip.mov", 20, "b"),
+		syncMoveTestFile("different-hash.bin", 30, "c"),
+		syncMoveTestFile("new.bin", 40, "d"),
+		syncMoveTestFile("empty-new.txt", 0, ""),
+		syncMoveTestFile("fails/moved.bin", 50, "e"),
+		syncMoveTestFile("copied/kept-old.bin", 70, "g"),
+	} {
+		a.NoError(indexer.store(source))
+	}
+
+	transferred, deleted := &dummyProcessor{}, &dummyProcessor{}
+	var moveCount int32
+	detector := newSyncMoveDetector(common.ESyncHashType.MD5(), mover, transferred.process, deleted.process, func() { atomic.AddInt32(&moveCount, 1) }, 0, "")
+	comparator := newSyncDestinationComparator(indexer, transferred.process, detector.deferDeletion, common.ESyncHashType.MD5(), false, false, false)
+
+	folder := StoredObject{name: "original", relativePath: "original", entityType: common.EEntityType.Folder()}
+	for _, destination := range []StoredObject{
+		syncMoveTestFile("same.bin", 10, "a"),
+		folder,
+		syncMoveTestFile("original/clip.mov", 20, "b"),
+		syncMoveTestFile("old-different-hash.bin", 30, "x"),
+		syncMoveTestFile("empty-old.txt", 0, ""),
+		syncMoveTestFile("gone.bin", 60, "f"),
+		syncMoveTestFile("will-fail.bin", 50, "e"),
+		syncMoveTestFile("left-behind.bin", 70, "g"),
+	} {
+		a.NoError(comparator.processIfNecessary(destination))
+	}
+
+	// nothing is deleted until the files new at the source have been matched
+	a.Empty(deleted.record)
+
+	a.NoError(indexer.traverse(detector.moveOrTransfer, nil))
+	a.NoError(detector.finish())
+
+	sort.Slice(moves, func(i, j int) bool { return moves[i].oldPath < moves[j].oldPath })
+	a.Equal([]syncMoveRecord{{"left-behind.bin", "copied/kept-old.bin"}, {"original/clip.mov", "renamed/clip.mov"}}, moves)
+	a.Equal(int32(2), moveCount)
+	// a file whose old copy was left behind is at its new name, so only the old copy is deleted
+	a.Equal([]string{"different-hash.bin", "empty-new.txt", "fails/moved.bin", "new.bin"}, sortedRelativePaths(transferred))
+	a.Equal([]string{"empty-old.txt", "gone.bin", "left-behind.bin", "old-different-hash.bin", "original", "will-fail.bin"}, sortedRelativePaths(deleted))
+}
+
+func TestSyncMoveDetectorDestinationIndexedFirst(t *testing.T) {
+	a := assert.New(t)
+
+	var mu sync.Mutex
+	var moves []syncMoveRecord
+	mover := func(oldObject, newObject StoredObject) error {
+		mu.Lock()
+		defer mu.Unlock()
+		moves = append(moves, syncMoveRecord{oldObject.relativePath, newObject.relativePath})
+		return nil
+	}
+
+	indexer := newObjectIndexer()
+	for _, destination := range []StoredObject{
+		syncMoveTestFile("a/one.bin", 10, "a"),
+		syncMoveTestFile("a/two.bin", 10, "a"),
+		syncMoveTestFile("kept.bin", 20, "b"),
+	} {
+		a.NoError(indexer.store(destination))
+	}
+
+	transferred, deleted := &dummyProcessor{}, &dummyProcessor{}
+	// the objects held move to disk, and are removed from it once the moves are done
+	spillDir := filepath.Join(t.TempDir(), "moves")
+	detector := newSyncMoveDetector(common.ESyncHashType.MD5(), mover, transferred.process, deleted.process, nil, 1, spillDir)
+	comparator := newSyncSourceComparator(indexer, transferred.process, common.ESyncHashType.MD5(), false, false, false)
+	comparator.newObjectScheduler = detector.deferTransfer
+
+	for _, source := range []StoredObject{
+		syncMoveTestFile("kept.bin", 20, "b"),
+		syncMoveTestFile("b/one.bin", 10, "a"),
+		syncMoveTestFile("no-hash.bin", 10, ""),
+	} {
+		a.NoError(comparator.processIfNecessary(source))
+	}
+
+	// files without a hash can't have been moved, so they're transferred right away
+	a.Equal([]string{"no-hash.bin"}, sortedRelativePaths(transferred))
+
+	a.NoError(indexer.traverse(detector.deferDeletion, nil))
+	a.NoError(detector.finish())
+
+	// of two identical files, only one is moved; the other is deleted
+	a.Len(moves, 1)
+	a.Equal("b/one.bin", moves[0].newPath)
+	a.Equal([]string{"no-hash.bin"}, sortedRelativePaths(transferred))
+	a.Len(deleted.record, 1)
+	a.NotEqual(moves[0].oldPath, deleted.record[0].relativePath)
+	for _, dir := range []string{spillDir + "-extra", spillDir + "-pending"} {
+		_, err := os.Stat(dir)
+		a.True(os.IsNotExist(err))
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncCooksS3AndGCPSources(t *testing.T) {
+	a := assert.New(t)
+
+	for src, fromTo := range map[string]common.FromTo{
+		"https://s3.amazonaws.com/bucket/dir":             common.EFromTo.S3Blob(),
+		"https://storage.cloud.google.com/bucket/dir":     common.EFromTo.GCPBlob(),
+		"https://bucket.s3.us-west-2.amazonaws.com/dir/x": common.EFromTo.S3Blob(),
+	} {
+		raw := getDefaultSyncRawInput(src, "https://account.blob.core.windows.net/container/dir")
+		cooked, err := raw.cook()
+		a.NoError(err, src)
+		a.Equal(fromTo, cooked.fromTo, src)
+		a.NotEmpty(cooked.source.Value, src)
+	}
+
+	// only Blob destinations are supported
+	raw := getDefaultSyncRawInput("https://s3.amazonaws.com/bucket/dir", "https://account.file.core.windows.net/share/dir")
+	_, err := raw.cook()
+	a.Error(err)
+}
+
+func TestSyncComparatorETagSource(t *testing.T) {
+	a := assert.New(t)
+	copiedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	object := func(relativePath string, size int64, lmt time.Time, eTag string) StoredObject {
+		o := *syncTestFile(relativePath, size, lmt)
+		o.eTag = eTag
+		return o
+	}
+	recorded := func(o StoredObject, eTag string) StoredObject {
+		o.Metadata = common.Metadata{common.SyncSourceETagMetadataKey: &eTag}
+		return o
+	}
+
+	// the destination is indexed first for S2S syncs; its objects are as the last sync left them
+	indexer := newObjectIndexer()
+	for _, destination := range []StoredObject{
+		recorded(object("same.bin", 10, copiedAt, ""), "etag-1"),
+		recorded(object("changed.bin", 10, copiedAt, ""), "etag-1"),
+		object("never-recorded.bin", 10, copiedAt, ""),
+		recorded(object("resized.bin", 10, copiedAt, ""), "etag-1"),
+		object("gone.bin", 10, copiedAt, ""),
+	} {
+		a.NoError(indexer.store(destination))
+	}
+
+	transferred := &dummyProcessor{}
+	comparator := newSyncSourceComparator(indexer, transferred.process, common.ESyncHashType.None(), false, false, true)
+
+	before := copiedAt.Add(-time.Hour)
+	for _, source := range []StoredObject{
+		object("same.bin", 10, before, "etag-1"),
+		// an object replaced at the source can have an older LMT than its copy, yet its ETag changes
+		object("changed.bin", 10, before, "etag-2"),
+		object("never-recorded.bin", 10, before, "etag-3"),
+		object("resized.bin", 11, before, "etag-1"),
+		object("new.bin", 10, before, "etag-4"),
+	} {
+		a.NoError(comparator.processIfNecessary(source))
+	}
+
+	a.Equal([]string{"changed.bin", "new.bin", "resized.bin"}, sortedRelativePaths(transferred))
+
+	// what's left in the index is deleted from the destination
+	var extra []string
+	a.NoError(indexer.traverse(func(o StoredObject) error {
+		extra = append(extra, o.relativePath)
+		return nil
+	}, nil))
+	a.Equal([]string{"gone.bin"}, extra)
+}
+
+func TestIsSyncETagSource(t *testing.T) {
+	a := assert.New(t)
+
+	for _, location := range []common.Location{common.ELocation.Http(), common.ELocation.WebDAV(), common.ELocation.S3(), common.ELocation.GCP()} {
+		a.True(isSyncETagSource(location), location.String())
+	}
+	for _, location := range []common.Location{common.ELocation.Local(), common.ELocation.Blob(), common.ELocation.File(), common.ELocation.BlobFS()} {
+		a.False(isSyncETagSource(location), location.String())
+	}
+}
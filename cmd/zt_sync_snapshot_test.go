@@ -0,0 +1,203 @@
+// Copyright © 2017 Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// staticTraverser lists a fixed set of objects
+type staticTraverser struct {
+	objects []StoredObject
+}
+
+func (t *staticTraverser) IsDirectory(bool) (bool, error) {
+	return true, nil
+}
+
+func (t *staticTraverser) Traverse(preprocessor objectMorpher, processor objectProcessor, filters []ObjectFilter) error {
+	for _, storedObject := range t.objects {
+		if preprocessor != nil {
+			preprocessor(&storedObject)
+		}
+		_, err := getProcessingError(processIfPassedFilters(filters, storedObject, processor))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestSyncSnapshotRoundTrip(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "snapshots", "pair.snapshot")
+
+	lmt := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	source := &staticTraverser{objects: []StoredObject{
+		{name: "", relativePath: "", entityType: common.EEntityType.Folder(), lastModifiedTime: lmt},
+		{name: "a.txt", relativePath: "a.txt", entityType: common.EEntityType.File(), lastModifiedTime: lmt, size: 10, md5: []byte{1, 2, 3}},
+		{name: "b.pdf", relativePath: "d/b.pdf", entityType: common.EEntityType.File(), lastModifiedTime: lmt, smbLastModifiedTime: lmt.Add(time.Second), size: 20, eTag: `"0x1"`},
+	}}
+
+	// no snapshot has been taken yet
+	_, err := openSyncSnapshot(path, "fingerprint", source)
+	a.True(os.IsNotExist(err))
+
+	writer, err := newSyncSnapshotWriter(path, "fingerprint", common.NewJobID())
+	a.NoError(err)
+	seen := &dummyProcessor{}
+	a.NoError((&syncSnapshotRecorder{ResourceTraverser: source, snapshot: writer}).Traverse(noPreProccessor, seen.process, nil))
+	a.Equal(source.objects, seen.record)
+
+	// nothing is replaced until the snapshot is committed
+	_, err = os.Stat(path)
+	a.True(os.IsNotExist(err))
+	a.NoError(writer.commit())
+	a.NoError(writer.commit())
+
+	_, err = openSyncSnapshot(path, "other settings", source)
+	a.ErrorIs(err, errSyncSnapshotSettingsChanged)
+
+	snapshot, err := openSyncSnapshot(path, "fingerprint", source)
+	a.NoError(err)
+	read := &dummyProcessor{}
+	a.NoError(snapshot.Traverse(noPreProccessor, read.process, nil))
+	a.Equal(source.objects, read.record)
+
+	// the sync's filters apply to the snapshot as they would to the destination
+	read = &dummyProcessor{}
+	a.NoError(snapshot.Traverse(noPreProccessor, read.process, buildExcludeFilters([]string{"*.pdf"}, false)))
+	a.Equal(source.objects[:2], read.record)
+
+	// a discarded snapshot leaves the last one in place
+	writer, err = newSyncSnapshotWriter(path, "fingerprint", common.NewJobID())
+	a.NoError(err)
+	writer.add(StoredObject{name: "c.txt", relativePath: "c.txt", entityType: common.EEntityType.File()})
+	writer.discard()
+	a.NoError(writer.commit())
+
+	read = &dummyProcessor{}
+	a.NoError(snapshot.Traverse(noPreProccessor, read.process, nil))
+	a.Equal(source.objects, read.record)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	a.NoError(err)
+	a.Len(entries, 1)
+}
+
+func TestSyncSnapshotCorrupt(t *testing.T) {
+	a := assert.New(t)
+	path := filepath.Join(t.TempDir(), "pair.snapshot")
+
+	a.NoError(os.WriteFile(path, []byte("not a snapshot"), 0600))
+	_, err := openSyncSnapshot(path, "fingerprint", &staticTraverser{})
+	a.ErrorIs(err, errCorruptSyncSnapshot)
+}
+
+func TestSyncSnapshotPathAndFingerprint(t *testing.T) {
+	a := assert.New(t)
+
+	cca := &cookedSyncCmdArgs{
+		source:      common.ResourceString{Value: "/data"},
+		destination: common.ResourceString{Value: "https://account.blob.core.windows.net/container"},
+		fromTo:      common.EFromTo.LocalBlob(),
+		recursive:   true,
+	}
+	path, fingerprint := syncSnapshotPath(cca), syncSnapshotFingerprint(cca)
+	a.Equal(filepath.Join(common.AzcopyJobPlanFolder, syncSnapshotFolderName), filepath.Dir(path))
+
+	// the SAS isn't part of the key, since it changes from one sync to the next
+	cca.destination.SAS = "sig=abc"
+	a.Equal(path, syncSnapshotPath(cca))
+
+	other := *cca
+	other.destination.Value += "2"
+	a.NotEqual(path, syncSnapshotPath(&other))
+	a.Equal(fingerprint, syncSnapshotFingerprint(&other))
+
+	other = *cca
+	other.excludePatterns = []string{"*.tmp"}
+	a.Equal(path, syncSnapshotPath(&other))
+	a.NotEqual(fingerprint, syncSnapshotFingerprint(&other))
+
+	minSize := int64(1024)
+	expression, err := parseFilterExpression("size > 10")
+	a.NoError(err)
+	for _, change := range []func(*cookedSyncCmdArgs){
+		func(c *cookedSyncCmdArgs) { c.includeSizeMin = &minSize },
+		func(c *cookedSyncCmdArgs) { c.includeSizeMax = &minSize },
+		func(c *cookedSyncCmdArgs) { c.filterExpression = expression },
+		func(c *cookedSyncCmdArgs) { c.ignoreFile = "/data/.azcopyignore" },
+		func(c *cookedSyncCmdArgs) { c.compareBy = common.ESyncCompareBy.Size() },
+	} {
+		other = *cca
+		change(&other)
+		a.NotEqual(fingerprint, syncSnapshotFingerprint(&other))
+	}
+}
+
+func TestSyncComparatorsFromSnapshot(t *testing.T) {
+	a := assert.New(t)
+
+	lmt := time.Now()
+	recorded := StoredObject{name: "a.txt", relativePath: "a.txt", entityType: common.EEntityType.File(), lastModifiedTime: lmt, size: 10, md5: []byte{1}}
+	newer := func(change func(*StoredObject)) StoredObject {
+		s := recorded
+		change(&s)
+		return s
+	}
+
+	for _, c := range []struct {
+		source   StoredObject
+		transfer bool
+	}{
+		{recorded, false},
+		{newer(func(s *StoredObject) { s.md5 = nil }), false},
+		// even an older LMT means the source has changed, since the destination holds whatever the last sync transferred
+		{newer(func(s *StoredObject) { s.lastModifiedTime = lmt.Add(-time.Hour) }), true},
+		{newer(func(s *StoredObject) { s.size = 11 }), true},
+		{newer(func(s *StoredObject) { s.md5 = []byte{2} }), true},
+	} {
+		indexer := newObjectIndexer()
+		scheduler := &dummyProcessor{}
+		comparator := newSyncSourceComparator(indexer, scheduler.process, common.ESyncHashType.None(), false, false, false)
+		comparator.fromSnapshot = true
+		a.NoError(indexer.store(recorded))
+		a.NoError(comparator.processIfNecessary(c.source))
+		a.Equal(c.transfer, len(scheduler.record) == 1)
+		a.Empty(indexer.indexMap)
+
+		indexer = newObjectIndexer()
+		scheduler = &dummyProcessor{}
+		cleaner := &dummyProcessor{}
+		destinationComparator := newSyncDestinationComparator(indexer, scheduler.process, cleaner.process, common.ESyncHashType.None(), false, false, false)
+		destinationComparator.fromSnapshot = true
+		a.NoError(indexer.store(c.source))
+		a.NoError(destinationComparator.processIfNecessary(recorded))
+		a.Equal(c.transfer, len(scheduler.record) == 1)
+		a.Empty(cleaner.record)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncSourceFilterer(t *testing.T) {
+	a := assert.New(t)
+	lmt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	spillDir := filepath.Join(t.TempDir(), "excluded")
+
+	minSize := int64(10)
+	source := &syncFiltersSeenTraverser{staticTraverser: staticTraverser{objects: []StoredObject{
+		*syncTestFile("big.bin", 100, lmt),
+		*syncTestFile("Small.txt", 1, lmt),
+		*syncTestFile("dir/tiny.txt", 2, lmt),
+		*syncTestFile("skip.tmp", 100, lmt),
+	}}}
+	// a threshold of 1 moves the excluded paths to disk
+	filterer := newSyncSourceFilterer(source, buildSizeFilters(&minSize, nil), nil, true, 1, spillDir)
+
+	processed := &dummyProcessor{}
+	a.NoError(filterer.Traverse(noPreProccessor, processed.process, buildExcludeFilters([]string{"*.tmp"}, false)))
+	a.Equal([]string{"big.bin"}, sortedRelativePaths(processed))
+	a.Len(source.filters, 2)
+
+	// the files at the destination are only kept when the size filter excluded their counterparts at the source
+	kept := &dummyProcessor{}
+	keep := filterer.keepExcluded(kept.process)
+	for _, path := range []string{"small.txt", "dir/tiny.txt", "skip.tmp", "extra.txt"} {
+		a.NoError(keep(*syncTestFile(path, 50, lmt)))
+	}
+	a.Equal([]string{"extra.txt", "skip.tmp"}, sortedRelativePaths(kept))
+
+	a.NoError(filterer.close())
+	_, err := os.Stat(spillDir)
+	a.True(os.IsNotExist(err))
+
+	// without filters judged only at the source, every file at the destination is passed on
+	var none *syncSourceFilterer
+	a.NoError(none.keepExcluded(kept.process)(*syncTestFile("small.txt", 1, lmt)))
+	a.Equal([]string{"extra.txt", "skip.tmp", "small.txt"}, sortedRelativePaths(kept))
+	a.NoError(none.close())
+}
+
+func TestSyncSourceFiltererExpression(t *testing.T) {
+	a := assert.New(t)
+	lmt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	prod, test := "prod", "test"
+	kept := syncTestFile("kept.txt", 1, lmt)
+	kept.Metadata = common.Metadata{"env": &prod}
+	excluded := syncTestFile("excluded.txt", 1, lmt)
+	excluded.Metadata = common.Metadata{"env": &test}
+
+	expression, err := parseFilterExpression("metadata.env == prod")
+	a.NoError(err)
+	filterer := newSyncSourceFilterer(&staticTraverser{objects: []StoredObject{*kept, *excluded}}, buildExpressionFilters(expression), nil, false, 0, "")
+
+	processed := &dummyProcessor{}
+	a.NoError(filterer.Traverse(noPreProccessor, processed.process, nil))
+	a.Equal([]string{"kept.txt"}, sortedRelativePaths(processed))
+
+	// the copy at the destination isn't judged by the expression, which its lack of metadata would fail
+	deleted := &dummyProcessor{}
+	keep := filterer.keepExcluded(deleted.process)
+	a.NoError(keep(*syncTestFile("excluded.txt", 1, lmt)))
+	a.NoError(keep(*syncTestFile("extra.txt", 1, lmt)))
+	a.Equal([]string{"extra.txt"}, sortedRelativePaths(deleted))
+	a.NoError(filterer.close())
+}
@@ -0,0 +1,68 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncInotifyNotifier(t *testing.T) {
+	a := assert.New(t)
+	root := t.TempDir()
+
+	n, err := newSyncInotifyNotifier(root, true)
+	a.NoError(err)
+	defer n.Close()
+
+	// waits for the given path to be reported, ignoring anything else
+	expect := func(rel string) {
+		deadline := time.After(5 * time.Second)
+		for {
+			select {
+			case got, ok := <-n.Events():
+				a.True(ok)
+				if got == rel {
+					return
+				}
+			case <-deadline:
+				a.Failf("no event", "for %s", rel)
+				return
+			}
+		}
+	}
+
+	a.NoError(os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644))
+	expect("a.txt")
+
+	// new directories are watched as they are created
+	a.NoError(os.Mkdir(filepath.Join(root, "dir"), 0755))
+	expect("dir")
+	a.NoError(os.WriteFile(filepath.Join(root, "dir", "b.txt"), []byte("b"), 0644))
+	expect("dir/b.txt")
+
+	a.NoError(os.Remove(filepath.Join(root, "a.txt")))
+	expect("a.txt")
+}
@@ -0,0 +1,189 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func syncWatchRelativePaths(objects []StoredObject) []string {
+	paths := make([]string, 0, len(objects))
+	for _, o := range objects {
+		paths = append(paths, o.relativePath)
+	}
+	return paths
+}
+
+func TestSyncWatchTreeRescan(t *testing.T) {
+	a := assert.New(t)
+	root := t.TempDir()
+	write := func(rel, content string) {
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		a.NoError(os.MkdirAll(filepath.Dir(full), 0755))
+		a.NoError(os.WriteFile(full, []byte(content), 0644))
+	}
+	write("a.txt", "a")
+	write("dir/b.txt", "b")
+	write("dir/sub/c.txt", "c")
+
+	tree, err := newSyncWatchTree(root, true)
+	a.NoError(err)
+	a.Len(tree.files, 3)
+
+	// nothing has changed since the tree was scanned
+	changed, deleted, err := tree.rescan("")
+	a.NoError(err)
+	a.Empty(changed)
+	a.Empty(deleted)
+
+	write("a.txt", "modified")
+	write("dir/new.txt", "new")
+	changed, deleted, err = tree.rescan("")
+	a.NoError(err)
+	a.Equal([]string{"a.txt", "dir/new.txt"}, syncWatchRelativePaths(changed))
+	a.Empty(deleted)
+	a.EqualValues(len("modified"), changed[0].size)
+
+	// removing a directory deletes everything that was in it, even when only the directory is rescanned
+	a.NoError(os.RemoveAll(filepath.Join(root, "dir")))
+	changed, deleted, err = tree.rescan("dir")
+	a.NoError(err)
+	a.Empty(changed)
+	a.Equal([]string{"dir/b.txt", "dir/new.txt", "dir/sub/c.txt"}, syncWatchRelativePaths(deleted))
+	a.Len(tree.files, 1)
+
+	// a rescan only reports what is under the path it is given
+	write("x/y.txt", "y")
+	a.NoError(os.Remove(filepath.Join(root, "a.txt")))
+	changed, deleted, err = tree.rescan("x")
+	a.NoError(err)
+	a.Equal([]string{"x/y.txt"}, syncWatchRelativePaths(changed))
+	a.Empty(deleted)
+	_, deleted, err = tree.rescan("a.txt")
+	a.NoError(err)
+	a.Equal([]string{"a.txt"}, syncWatchRelativePaths(deleted))
+}
+
+func TestSyncWatchTreeNotRecursive(t *testing.T) {
+	a := assert.New(t)
+	root := t.TempDir()
+	a.NoError(os.WriteFile(filepath.Join(root, "top.txt"), []byte("top"), 0644))
+	a.NoError(os.MkdirAll(filepath.Join(root, "dir"), 0755))
+	a.NoError(os.WriteFile(filepath.Join(root, "dir", "nested.txt"), []byte("nested"), 0644))
+
+	tree, err := newSyncWatchTree(root, false)
+	a.NoError(err)
+	a.Len(tree.files, 1)
+
+	a.NoError(os.WriteFile(filepath.Join(root, "dir", "other.txt"), []byte("other"), 0644))
+	changed, deleted, err := tree.rescan("dir")
+	a.NoError(err)
+	a.Empty(changed)
+	a.Empty(deleted)
+}
+
+func TestCoalesceSyncWatchPaths(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal([]string{"a", "b/c", "bc"}, coalesceSyncWatchPaths([]string{"bc", "a/x", "b/c/d", "a", "b/c"}))
+	a.Equal([]string{""}, coalesceSyncWatchPaths([]string{"a", "", "b"}))
+	a.Empty(coalesceSyncWatchPaths(nil))
+}
+
+func TestSyncWatchFlushTime(t *testing.T) {
+	a := assert.New(t)
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	debounce, minInterval := 2*time.Second, 10*time.Second
+
+	// synced once the source has been quiet for the debounce period
+	a.Equal(start.Add(5*time.Second), syncWatchFlushTime(start, start.Add(3*time.Second), time.Time{}, debounce, minInterval))
+
+	// but no later than a minute after the first change, however busy the source
+	a.Equal(start.Add(syncWatchMaxDelay), syncWatchFlushTime(start, start.Add(2*time.Minute), time.Time{}, debounce, minInterval))
+
+	// and no sooner than the minimum interval after the last job
+	a.Equal(start.Add(12*time.Second), syncWatchFlushTime(start, start, start.Add(2*time.Second), debounce, minInterval))
+}
+
+func TestSyncWatchPollingNotifier(t *testing.T) {
+	a := assert.New(t)
+
+	n := newSyncPollingNotifier(10 * time.Millisecond)
+	defer n.Close()
+
+	select {
+	case rel := <-n.Events():
+		a.Equal("", rel)
+	case <-time.After(5 * time.Second):
+		a.Fail("the source was never polled")
+	}
+}
+
+func TestSyncCooksWatch(t *testing.T) {
+	a := assert.New(t)
+
+	raw := getDefaultSyncRawInput(t.TempDir(), "https://account.blob.core.windows.net/container/dir")
+	raw.watch = true
+	raw.watchDebounceSeconds = 0.5
+	raw.watchMinIntervalSeconds = 10
+	raw.watchPollIntervalSeconds = 30
+	cooked, err := raw.cook()
+	a.NoError(err)
+	a.Equal(500*time.Millisecond, cooked.watchDebounce)
+	a.Equal(30*time.Second, cooked.watchPollInterval)
+
+	raw.dryrun = true
+	_, err = raw.cook()
+	a.Error(err)
+
+	// only uploads can be watched
+	raw = getDefaultSyncRawInput("https://account.blob.core.windows.net/container/dir", t.TempDir())
+	raw.watch = true
+	raw.watchPollIntervalSeconds = 30
+	_, err = raw.cook()
+	a.Error(err)
+}
+
+func TestSyncWatchSetUpForADLSGen2(t *testing.T) {
+	a := assert.New(t)
+
+	raw := getDefaultSyncRawInput(t.TempDir(), "https://account.dfs.core.windows.net/filesystem/dir")
+	raw.fromTo = common.EFromTo.LocalBlobFS().String()
+	raw.watch = true
+	raw.watchPollIntervalSeconds = 30
+	cooked, err := raw.cook()
+	a.NoError(err)
+
+	cooked.watcher, err = newSyncWatcher(&cooked)
+	a.NoError(err)
+	defer cooked.watcher.notifier.Close()
+
+	// ADLS Gen2 is enumerated with the destination first, and its watch jobs must still be set up
+	a.NoError(cooked.watcher.setUpJobs(&cooked, &common.CopyJobPartOrderRequest{}, nil, common.EFolderPropertiesOption.AllFolders()))
+	a.NotNil(cooked.watcher.jobTemplate)
+	a.NotNil(cooked.watcher.deleteDestination)
+}
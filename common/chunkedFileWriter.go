@@ -22,7 +22,6 @@ package common
 
 import (
 	"context"
-	"crypto/md5"
 	"errors"
 	"hash"
 	"io"
@@ -47,8 +46,9 @@ type ChunkedFileWriter interface {
 	EnqueueChunk(ctx context.Context, id ChunkID, chunkSize int64, chunkContents io.Reader, retryable bool) error
 
 	// Flush will block until all the chunks have been written to disk.  err will be non-nil if and only in any chunk failed to write.
+	// The hash is computed with the algorithm of the source hash the writer was created with, and is nil if there was none.
 	// Flush must be called exactly once, after all chunks have been enqueued with EnqueueChunk.
-	Flush(ctx context.Context) (md5HashOfFileAsWritten []byte, err error)
+	Flush(ctx context.Context) (hashOfFileAsWritten []byte, err error)
 
 	// MaxRetryPerDownloadBody returns the maximum number of retries that will be done for the download of a single chunk body
 	MaxRetryPerDownloadBody() int
@@ -85,7 +85,7 @@ type chunkedFileWriter struct {
 	newUnorderedChunks chan fileChunk
 
 	// used for completion
-	successMd5      chan []byte
+	successHash     chan []byte
 	chunkWriterDone chan bool
 
 	// controls body-read retries. Public so value can be shared with retryReader
@@ -94,7 +94,8 @@ type chunkedFileWriter struct {
 	// how will hashes be validated?
 	md5ValidationOption HashValidationOption
 
-	sourceMd5Exists bool
+	// the hash advertised by the source, which decides the algorithm the saved bytes are hashed with
+	sourceHash Digest
 
 	err error // This field should be set only by workerRoutine
 }
@@ -104,7 +105,7 @@ type fileChunk struct {
 	data []byte
 }
 
-func NewChunkedFileWriter(ctx context.Context, slicePool ByteSlicePooler, cacheLimiter CacheLimiter, chunkLogger ChunkStatusLogger, file io.WriteCloser, numChunks uint32, maxBodyRetries int, md5ValidationOption HashValidationOption, sourceMd5Exists bool) ChunkedFileWriter {
+func NewChunkedFileWriter(ctx context.Context, slicePool ByteSlicePooler, cacheLimiter CacheLimiter, chunkLogger ChunkStatusLogger, file io.WriteCloser, numChunks uint32, maxBodyRetries int, md5ValidationOption HashValidationOption, sourceHash Digest) ChunkedFileWriter {
 	// Set max size for buffered channel. The upper limit here is believed to be generous, given worker routine drains it constantly.
 	// Use num chunks in file if lower than the upper limit, to prevent allocating RAM for lots of large channel buffers when dealing with
 	// very large numbers of very small files.
@@ -115,12 +116,12 @@ func NewChunkedFileWriter(ctx context.Context, slicePool ByteSlicePooler, cacheL
 		slicePool:               slicePool,
 		cacheLimiter:            cacheLimiter,
 		chunkLogger:             chunkLogger,
-		successMd5:              make(chan []byte),
+		successHash:             make(chan []byte),
 		chunkWriterDone:         make(chan bool, 1),
 		newUnorderedChunks:      make(chan fileChunk, chanBufferSize),
 		maxRetryPerDownloadBody: maxBodyRetries,
 		md5ValidationOption:     md5ValidationOption,
-		sourceMd5Exists:         sourceMd5Exists,
+		sourceHash:              sourceHash,
 		currentReservedCapacity: 0,
 	}
 	go w.workerRoutine(ctx)
@@ -202,7 +203,7 @@ func (w *chunkedFileWriter) EnqueueChunk(ctx context.Context, id ChunkID, chunkS
 	}
 }
 
-// Flush waits until all chunks have been flush to disk, then returns the MD5 has of the file's bytes-as-we-saved-them
+// Flush waits until all chunks have been flush to disk, then returns the hash of the file's bytes-as-we-saved-them
 func (w *chunkedFileWriter) Flush(ctx context.Context) ([]byte, error) {
 	// let worker know that no more will be coming
 	close(w.newUnorderedChunks)
@@ -231,8 +232,8 @@ func (w *chunkedFileWriter) Flush(ctx context.Context) ([]byte, error) {
 			return nil, w.err
 		}
 		return nil, ChunkWriterAlreadyFailed // channel returned nil because it was closed and empty
-	case md5AtCompletion := <-w.successMd5:
-		return md5AtCompletion, nil
+	case hashAtCompletion := <-w.successHash:
+		return hashAtCompletion, nil
 	}
 }
 
@@ -248,10 +249,10 @@ func (w *chunkedFileWriter) MaxRetryPerDownloadBody() int {
 func (w *chunkedFileWriter) workerRoutine(ctx context.Context) {
 	nextOffsetToSave := int64(0)
 	unsavedChunksByFileOffset := make(map[int64]fileChunk)
-	md5Hasher := md5.New()
-	if w.md5ValidationOption == EHashValidationOption.NoCheck() || !w.sourceMd5Exists {
+	hasher := w.sourceHash.NewHash()
+	if w.md5ValidationOption == EHashValidationOption.NoCheck() || hasher == nil {
 		// save CPU time by not even computing a hash, if we don't want to check it, or have nothing to check it against
-		md5Hasher = &nullHasher{}
+		hasher = &nullHasher{}
 	}
 
 	defer func() {
@@ -278,7 +279,7 @@ func (w *chunkedFileWriter) workerRoutine(ctx context.Context) {
 				// If channel is closed, we know that flush as been called and we have read everything
 				// So we are finished
 				// We know there was no error, because if there was an error we would have returned before now
-				w.successMd5 <- md5Hasher.Sum(nil)
+				w.successHash <- hasher.Sum(nil)
 				return
 			}
 		case <-ctx.Done(): // If cancelled out in the middle of enqueuing chunks OR processing chunks, they will both cleanly cancel out and we'll get back to here.
@@ -292,7 +293,7 @@ func (w *chunkedFileWriter) workerRoutine(ctx context.Context) {
 
 		// Process all chunks that we can
 		w.setStatusForContiguousAvailableChunks(unsavedChunksByFileOffset, nextOffsetToSave, ctx) // update states of those that have all their prior ones already here
-		err := w.sequentiallyProcessAvailableChunks(unsavedChunksByFileOffset, &nextOffsetToSave, md5Hasher, ctx)
+		err := w.sequentiallyProcessAvailableChunks(unsavedChunksByFileOffset, &nextOffsetToSave, hasher, ctx)
 		if err != nil {
 			w.err = err
 			return // no point in processing any more after a failure
@@ -302,7 +303,7 @@ func (w *chunkedFileWriter) workerRoutine(ctx context.Context) {
 
 // Hashes and saves available chunks that are sequential from nextOffsetToSave. Stops and returns as soon as it hits
 // a gap (i.e. the position of a chunk that hasn't arrived yet)
-func (w *chunkedFileWriter) sequentiallyProcessAvailableChunks(unsavedChunksByFileOffset map[int64]fileChunk, nextOffsetToSave *int64, md5Hasher hash.Hash, ctx context.Context) error {
+func (w *chunkedFileWriter) sequentiallyProcessAvailableChunks(unsavedChunksByFileOffset map[int64]fileChunk, nextOffsetToSave *int64, hasher hash.Hash, ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
@@ -319,7 +320,7 @@ func (w *chunkedFileWriter) sequentiallyProcessAvailableChunks(unsavedChunksByFi
 		*nextOffsetToSave += int64(len(nextChunkInSequence.data)) // update immediately so we won't forget!
 
 		// Save it (hashing exactly what we save)
-		err := w.saveOneChunk(nextChunkInSequence, md5Hasher)
+		err := w.saveOneChunk(nextChunkInSequence, hasher)
 		if err != nil {
 			return err
 		}
@@ -347,7 +348,7 @@ func (w *chunkedFileWriter) setStatusForContiguousAvailableChunks(unsavedChunksB
 }
 
 // Saves one chunk to its destination
-func (w *chunkedFileWriter) saveOneChunk(chunk fileChunk, md5Hasher hash.Hash) error {
+func (w *chunkedFileWriter) saveOneChunk(chunk fileChunk, hasher hash.Hash) error {
 	defer func() {
 		w.cacheLimiter.Remove(int64(len(chunk.data))) // remove this from the tally of scheduled-but-unsaved bytes
 		w.slicePool.ReturnSlice(chunk.data)
@@ -368,7 +369,7 @@ func (w *chunkedFileWriter) saveOneChunk(chunk fileChunk, md5Hasher hash.Hash) e
 		}
 
 		// always hash exactly what we save
-		md5Hasher.Write(slice)
+		hasher.Write(slice)
 		_, err := w.file.Write(slice) // unlike Read, Write must process ALL the data, or have an error.  It can't return "early".
 		if err != nil {
 			return err
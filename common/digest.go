@@ -0,0 +1,247 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Digest is the expected hash of a file's content, along with the algorithm that produced it.
+// Algorithm uses the names of the IANA hash algorithm registry that RFC 9530 draws on: "md5", "sha-256" or "sha-512".
+type Digest struct {
+	Algorithm string
+	Value     []byte
+}
+
+// NewMD5Digest wraps an MD5 hash, as stored by the Blob and File services
+func NewMD5Digest(value []byte) Digest {
+	return Digest{Algorithm: "md5", Value: value}
+}
+
+// IsEmpty is true when there is nothing to validate against
+func (d Digest) IsEmpty() bool {
+	return len(d.Value) == 0
+}
+
+// NewHash returns a hasher for the digest's algorithm, or nil for an empty digest
+func (d Digest) NewHash() hash.Hash {
+	if d.IsEmpty() {
+		return nil
+	}
+	if alg, ok := digestAlgorithmByName(d.Algorithm); ok {
+		return alg.newHash()
+	}
+	return nil
+}
+
+func (d Digest) String() string {
+	return d.Algorithm + "=" + base64.StdEncoding.EncodeToString(d.Value)
+}
+
+type digestAlgorithm struct {
+	name    string
+	newHash func() hash.Hash
+	size    int
+}
+
+// digestAlgorithms lists the supported algorithms, strongest first
+var digestAlgorithms = []digestAlgorithm{
+	{name: "sha-512", newHash: sha512.New, size: sha512.Size},
+	{name: "sha-256", newHash: sha256.New, size: sha256.Size},
+	{name: "md5", newHash: md5.New, size: md5.Size},
+}
+
+func digestAlgorithmByName(name string) (digestAlgorithm, bool) {
+	for _, alg := range digestAlgorithms {
+		if strings.EqualFold(alg.name, name) {
+			return alg, true
+		}
+	}
+	return digestAlgorithm{}, false
+}
+
+// WantReprDigestHeaderValue asks servers that implement RFC 9530 for the digests azcopy can validate, strongest first
+const WantReprDigestHeaderValue = "sha-512=10, sha-256=9, md5=1"
+
+// ParseDigestHeaders returns the strongest digest advertised by an HTTP response.
+// The RFC 9530 Repr-Digest and Content-Digest fields are preferred over the obsolete RFC 3230 Digest field.
+// Algorithms that aren't supported, and values that can't be decoded, are ignored.
+func ParseDigestHeaders(header http.Header) (Digest, bool) {
+	for _, name := range []string{"Repr-Digest", "Content-Digest"} {
+		if d, ok := strongestDigest(parseDigestField(header.Values(name), true)); ok {
+			return d, true
+		}
+	}
+
+	return strongestDigest(parseDigestField(header.Values("Digest"), false))
+}
+
+// parseDigestField parses the members of a digest field. RFC 9530 fields are structured dictionaries,
+// with values such as sha-256=:<base64>:, whereas RFC 3230 ones hold plain base64 values such as SHA-256=<base64>.
+func parseDigestField(values []string, structured bool) map[string][]byte {
+	digests := make(map[string][]byte)
+
+	for _, value := range values {
+		for _, member := range strings.Split(value, ",") {
+			key, encoded, found := strings.Cut(strings.TrimSpace(member), "=")
+			if !found {
+				continue
+			}
+
+			// ignore any parameters of the member
+			encoded, _, _ = strings.Cut(strings.TrimSpace(encoded), ";")
+			encoded = strings.TrimSpace(encoded)
+			if structured {
+				if len(encoded) < 2 || !strings.HasPrefix(encoded, ":") || !strings.HasSuffix(encoded, ":") {
+					continue
+				}
+				encoded = encoded[1 : len(encoded)-1]
+			}
+
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				continue
+			}
+			digests[strings.ToLower(strings.TrimSpace(key))] = decoded
+		}
+	}
+
+	return digests
+}
+
+func strongestDigest(digests map[string][]byte) (Digest, bool) {
+	for _, alg := range digestAlgorithms {
+		if value, ok := digests[alg.name]; ok && len(value) == alg.size {
+			return Digest{Algorithm: alg.name, Value: value}, true
+		}
+	}
+
+	return Digest{}, false
+}
+
+// ErrNotInChecksumFile is returned when a checksum file doesn't list the file being looked up
+var ErrNotInChecksumFile = errors.New("the file is not listed in the checksum file")
+
+// matches the BSD-style lines written by "shasum --tag" and "openssl dgst", e.g. "SHA256 (tool.tar.gz) = <hex>"
+var bsdChecksumLine = regexp.MustCompile(`^[A-Za-z0-9-]+ \((.*)\) ?= ?([0-9A-Fa-f]+)$`)
+
+// ParseChecksumFile finds the digest of fileName in the contents of a checksum file.
+// Files holding the hash of a single download (as published alongside it, e.g. tool.tar.gz.sha256)
+// and lists in the formats written by sha256sum and friends (e.g. SHA256SUMS) are both understood.
+// The algorithm is inferred from the length of the hex-encoded hash.
+func ParseChecksumFile(contents []byte, fileName string) (Digest, error) {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Digest{}, err
+	}
+
+	// a lone hash applies to whatever file the checksum file was published for
+	if len(lines) == 1 && !strings.ContainsAny(lines[0], " \t") {
+		return digestFromHex(lines[0])
+	}
+
+	for _, line := range lines {
+		var name, encoded string
+		if m := bsdChecksumLine.FindStringSubmatch(line); m != nil {
+			name, encoded = m[1], m[2]
+		} else {
+			// GNU style: "<hex>  <name>", with a * before the name for files hashed in binary mode
+			i := strings.IndexAny(line, " \t")
+			if i < 0 {
+				continue
+			}
+			encoded, name = line[:i], strings.TrimPrefix(strings.TrimLeft(line[i:], " \t"), "*")
+		}
+
+		// lists commonly cover several directories; match on the file name alone
+		if path.Base(strings.ReplaceAll(name, `\`, "/")) == fileName {
+			return digestFromHex(encoded)
+		}
+	}
+
+	return Digest{}, ErrNotInChecksumFile
+}
+
+func digestFromHex(encoded string) (Digest, error) {
+	value, err := hex.DecodeString(encoded)
+	if err != nil {
+		return Digest{}, fmt.Errorf("invalid hash in checksum file: %w", err)
+	}
+
+	for _, alg := range digestAlgorithms {
+		if len(value) == alg.size {
+			return Digest{Algorithm: alg.name, Value: value}, nil
+		}
+	}
+
+	return Digest{}, fmt.Errorf("unsupported hash length %d in checksum file", len(value))
+}
+
+// ChecksumFileURL returns the URL of the checksum file that covers the file at fileURL.
+// A checksumFile starting with a dot, such as ".sha256", is a suffix appended to the file's URL;
+// anything else is resolved relative to it, so "SHA256SUMS" names a list in the same directory.
+// Any query string of the file's URL (a SAS, for instance) is kept for a suffix, but not for a separate list.
+func ChecksumFileURL(fileURL, checksumFile string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", err
+	}
+
+	if IsChecksumFileSuffix(checksumFile) {
+		u.Path += checksumFile
+		if u.RawPath != "" {
+			u.RawPath += checksumFile
+		}
+		return u.String(), nil
+	}
+
+	ref, err := url.Parse(checksumFile)
+	if err != nil {
+		return "", fmt.Errorf("invalid checksum file %q: %w", checksumFile, err)
+	}
+	return u.ResolveReference(ref).String(), nil
+}
+
+// IsChecksumFileSuffix is true when checksumFile names a separate checksum file for every download, rather than one shared list
+func IsChecksumFileSuffix(checksumFile string) bool {
+	return strings.HasPrefix(checksumFile, ".") && !strings.HasPrefix(checksumFile, "./") && !strings.HasPrefix(checksumFile, "../")
+}
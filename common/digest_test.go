@@ -0,0 +1,135 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDigestHeaders(t *testing.T) {
+	a := assert.New(t)
+
+	md5Sum := md5.Sum([]byte("data"))
+	sha256Sum := sha256.Sum256([]byte("data"))
+	sha512Sum := sha512.Sum512([]byte("data"))
+	b64 := base64.StdEncoding.EncodeToString
+
+	testCases := []struct {
+		name      string
+		header    http.Header
+		ok        bool
+		algorithm string
+		value     []byte
+	}{
+		{name: "none", header: http.Header{}, ok: false},
+		{name: "repr digest", header: http.Header{"Repr-Digest": {"sha-256=:" + b64(sha256Sum[:]) + ":"}}, ok: true, algorithm: "sha-256", value: sha256Sum[:]},
+		{name: "strongest wins", header: http.Header{"Repr-Digest": {"md5=:" + b64(md5Sum[:]) + ":, sha-512=:" + b64(sha512Sum[:]) + ":"}}, ok: true, algorithm: "sha-512", value: sha512Sum[:]},
+		{name: "several fields", header: http.Header{"Content-Digest": {"md5=:" + b64(md5Sum[:]) + ":", "sha-256=:" + b64(sha256Sum[:]) + ":;note=x"}}, ok: true, algorithm: "sha-256", value: sha256Sum[:]},
+		{name: "repr before content", header: http.Header{"Repr-Digest": {"md5=:" + b64(md5Sum[:]) + ":"}, "Content-Digest": {"sha-256=:" + b64(sha256Sum[:]) + ":"}}, ok: true, algorithm: "md5", value: md5Sum[:]},
+		{name: "legacy digest", header: http.Header{"Digest": {"SHA-256=" + b64(sha256Sum[:]) + ",MD5=" + b64(md5Sum[:])}}, ok: true, algorithm: "sha-256", value: sha256Sum[:]},
+		{name: "unsupported algorithm", header: http.Header{"Repr-Digest": {"unixsum=:AAAA:"}}, ok: false},
+		{name: "not a byte sequence", header: http.Header{"Repr-Digest": {"sha-256=" + b64(sha256Sum[:])}}, ok: false},
+		{name: "wrong length", header: http.Header{"Repr-Digest": {"sha-256=:" + b64(md5Sum[:]) + ":"}}, ok: false},
+		{name: "bad base64", header: http.Header{"Digest": {"SHA-256=!!!"}}, ok: false},
+	}
+
+	for _, tc := range testCases {
+		digest, ok := ParseDigestHeaders(tc.header)
+		a.Equal(tc.ok, ok, tc.name)
+		if tc.ok {
+			a.Equal(tc.algorithm, digest.Algorithm, tc.name)
+			a.Equal(tc.value, digest.Value, tc.name)
+			a.NotNil(digest.NewHash(), tc.name)
+		}
+	}
+}
+
+func TestParseChecksumFile(t *testing.T) {
+	a := assert.New(t)
+
+	sha256Sum := sha256.Sum256([]byte("data"))
+	sha512Sum := sha512.Sum512([]byte("data"))
+	hex256 := hex.EncodeToString(sha256Sum[:])
+	hex512 := hex.EncodeToString(sha512Sum[:])
+	other := strings.Repeat("ab", 32)
+
+	testCases := []struct {
+		name      string
+		contents  string
+		expectErr bool
+		algorithm string
+		value     []byte
+	}{
+		{name: "lone hash", contents: hex256 + "\n", algorithm: "sha-256", value: sha256Sum[:]},
+		{name: "gnu", contents: other + "  other.zip\n" + hex256 + "  tool.zip\n", algorithm: "sha-256", value: sha256Sum[:]},
+		{name: "gnu binary", contents: hex512 + " *tool.zip", algorithm: "sha-512", value: sha512Sum[:]},
+		{name: "gnu nested", contents: "# release\n" + other + "  ./linux/other.zip\n" + hex256 + "  ./linux/tool.zip\n", algorithm: "sha-256", value: sha256Sum[:]},
+		{name: "bsd", contents: "SHA256 (other.zip) = " + other + "\nSHA256 (tool.zip) = " + hex256 + "\n", algorithm: "sha-256", value: sha256Sum[:]},
+		{name: "not listed", contents: other + "  other.zip\n", expectErr: true},
+		{name: "bad hex", contents: "xyz  tool.zip\n", expectErr: true},
+		{name: "unsupported length", contents: "abcd  tool.zip\n", expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		digest, err := ParseChecksumFile([]byte(tc.contents), "tool.zip")
+		if tc.expectErr {
+			a.Error(err, tc.name)
+			continue
+		}
+		a.NoError(err, tc.name)
+		a.Equal(tc.algorithm, digest.Algorithm, tc.name)
+		a.Equal(tc.value, digest.Value, tc.name)
+	}
+
+	_, err := ParseChecksumFile([]byte(other+"  other.zip\n"), "tool.zip")
+	a.ErrorIs(err, ErrNotInChecksumFile)
+}
+
+func TestChecksumFileURL(t *testing.T) {
+	a := assert.New(t)
+
+	testCases := []struct {
+		fileURL      string
+		checksumFile string
+		expected     string
+	}{
+		{"https://mirror.example.com/dist/tool.tar.gz", ".sha256", "https://mirror.example.com/dist/tool.tar.gz.sha256"},
+		{"https://mirror.example.com/dist/tool%20v2.zip?sig=abc", ".sha512", "https://mirror.example.com/dist/tool%20v2.zip.sha512?sig=abc"},
+		{"https://mirror.example.com/dist/tool.tar.gz?sig=abc", "SHA256SUMS", "https://mirror.example.com/dist/SHA256SUMS"},
+		{"https://mirror.example.com/dist/v1/tool.tar.gz", "../SHA256SUMS", "https://mirror.example.com/dist/SHA256SUMS"},
+		{"https://mirror.example.com/dist/tool.tar.gz", "https://sums.example.com/SHA512SUMS", "https://sums.example.com/SHA512SUMS"},
+	}
+
+	for _, tc := range testCases {
+		actual, err := ChecksumFileURL(tc.fileURL, tc.checksumFile)
+		a.NoError(err)
+		a.Equal(tc.expected, actual)
+	}
+}
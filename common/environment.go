@@ -64,10 +64,23 @@ var VisibleEnvironmentVariables = []EnvironmentVariable{
 	EEnvironmentVariable.EnumerationPoolSize(),
 	EEnvironmentVariable.DisableHierarchicalScanning(),
 	EEnvironmentVariable.ParallelStatFiles(),
+	EEnvironmentVariable.SyncIndexSpillThreshold(),
 	EEnvironmentVariable.BufferGB(),
 	EEnvironmentVariable.AWSAccessKeyID(),
 	EEnvironmentVariable.AWSSecretAccessKey(),
 	EEnvironmentVariable.GoogleAppCredentials(),
+	EEnvironmentVariable.HTTPTokenURL(),
+	EEnvironmentVariable.HTTPClientID(),
+	EEnvironmentVariable.HTTPClientSecret(),
+	EEnvironmentVariable.HTTPTokenScope(),
+	EEnvironmentVariable.HTTPTokenFile(),
+	EEnvironmentVariable.HTTPTokenCommand(),
+	EEnvironmentVariable.HTTPUsername(),
+	EEnvironmentVariable.HTTPPassword(),
+	EEnvironmentVariable.HTTPNetrc(),
+	EEnvironmentVariable.HTTPClientCertificate(),
+	EEnvironmentVariable.HTTPClientKey(),
+	EEnvironmentVariable.HTTPCABundle(),
 	EEnvironmentVariable.ShowPerfStates(),
 	EEnvironmentVariable.PacePageBlobs(),
 	EEnvironmentVariable.AutoTuneToCpu(),
@@ -294,6 +307,16 @@ func (EnvironmentVariable) ParallelStatFiles() EnvironmentVariable {
 	}
 }
 
+func (EnvironmentVariable) SyncIndexSpillThreshold() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_SYNC_INDEX_SPILL_THRESHOLD",
+		Description: "The number of objects the sync command indexes in memory, while comparing the source and destination, before moving the index to disk under the job plan folder. " +
+			"Lower it if syncs of very large containers run out of memory, or set it to 0 to always keep the index in memory. " +
+			"The destinations that copy and sync give to files renamed with --rename move to disk past the same number of files.",
+		DefaultValue: "1000000", // a million objects take roughly a gigabyte of memory
+	}
+}
+
 func (EnvironmentVariable) OptimizeSparsePageBlobTransfers() EnvironmentVariable {
 	return EnvironmentVariable{
 		Name:         "AZCOPY_OPTIMIZE_SPARSE_PAGE_BLOB",
@@ -405,6 +428,95 @@ func (EnvironmentVariable) GoogleCloudProject() EnvironmentVariable {
 	}
 }
 
+func (EnvironmentVariable) HTTPTokenURL() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_HTTP_TOKEN_URL",
+		Description: "The OAuth 2.0 token endpoint from which bearer tokens for HTTP and WebDAV locations are obtained with the client credentials grant.",
+	}
+}
+
+func (EnvironmentVariable) HTTPClientID() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_HTTP_CLIENT_ID",
+		Description: "The client ID presented to AZCOPY_HTTP_TOKEN_URL.",
+	}
+}
+
+func (EnvironmentVariable) HTTPClientSecret() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_HTTP_CLIENT_SECRET",
+		Description: "The client secret presented to AZCOPY_HTTP_TOKEN_URL.",
+		Hidden:      true,
+	}
+}
+
+func (EnvironmentVariable) HTTPTokenScope() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_HTTP_TOKEN_SCOPE",
+		Description: "The scope requested from AZCOPY_HTTP_TOKEN_URL, if the token endpoint needs one.",
+	}
+}
+
+func (EnvironmentVariable) HTTPTokenFile() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_HTTP_TOKEN_FILE",
+		Description: "A file holding the bearer token for HTTP and WebDAV locations. The file is read again whenever the token expires or is rejected, so it can be rotated while a job runs.",
+	}
+}
+
+func (EnvironmentVariable) HTTPTokenCommand() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_HTTP_TOKEN_COMMAND",
+		Description: "A shell command that prints a bearer token for HTTP and WebDAV locations, either bare or as JSON with access_token and expires_in. " +
+			"The command is run again whenever the token expires or is rejected.",
+	}
+}
+
+func (EnvironmentVariable) HTTPUsername() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_HTTP_USERNAME",
+		Description: "The user name given to the HTTP source, on its host and port alone, when it asks for Basic or Digest authentication. " +
+			"For lists of URLs, or other servers, use AZCOPY_HTTP_NETRC instead.",
+	}
+}
+
+func (EnvironmentVariable) HTTPPassword() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_HTTP_PASSWORD",
+		Description: "The password given, along with AZCOPY_HTTP_USERNAME, to HTTP sources that ask for Basic or Digest authentication.",
+		Hidden:      true,
+	}
+}
+
+func (EnvironmentVariable) HTTPNetrc() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name: "AZCOPY_HTTP_NETRC",
+		Description: "A file in the .netrc format, used by curl and wget, holding the credentials of each HTTP source that asks for Basic or Digest authentication. " +
+			"It can't be combined with AZCOPY_HTTP_USERNAME.",
+	}
+}
+
+func (EnvironmentVariable) HTTPClientCertificate() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_HTTP_CLIENT_CERTIFICATE",
+		Description: "A PEM file holding the client certificate presented to HTTP sources that require mutual TLS. It may also hold the private key.",
+	}
+}
+
+func (EnvironmentVariable) HTTPClientKey() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_HTTP_CLIENT_KEY",
+		Description: "A PEM file holding the private key of AZCOPY_HTTP_CLIENT_CERTIFICATE, if the certificate file doesn't.",
+	}
+}
+
+func (EnvironmentVariable) HTTPCABundle() EnvironmentVariable {
+	return EnvironmentVariable{
+		Name:        "AZCOPY_HTTP_CA_BUNDLE",
+		Description: "A PEM file of CA certificates trusted, in addition to the system's, to verify the certificates of HTTP sources.",
+	}
+}
+
 // OAuthTokenInfo is only used for internal integration.
 func (EnvironmentVariable) OAuthTokenInfo() EnvironmentVariable {
 	return EnvironmentVariable{Name: "AZCOPY_OAUTH_TOKEN_INFO"}
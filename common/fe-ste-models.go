@@ -602,6 +602,7 @@ func (Location) GCP() Location       { return Location(8) }
 func (Location) None() Location      { return Location(9) } // None is used in case we're transferring properties
 func (Location) FileNFS() Location   { return Location(10) }
 func (Location) Http() Location      { return Location(11) } // Http is for generic HTTP/HTTPS downloads
+func (Location) WebDAV() Location    { return Location(12) }
 
 func (Location) AzureAccount() Location { return Location(100) } // AzureAccount is never used within AzCopy, and won't be detected, (for now)
 
@@ -638,7 +639,7 @@ func FromToValue(from Location, to Location) FromTo {
 
 func (l Location) IsRemote() bool {
 	switch l {
-	case ELocation.BlobFS(), ELocation.Blob(), ELocation.File(), ELocation.S3(), ELocation.GCP(), ELocation.FileNFS(), ELocation.Http():
+	case ELocation.BlobFS(), ELocation.Blob(), ELocation.File(), ELocation.S3(), ELocation.GCP(), ELocation.FileNFS(), ELocation.Http(), ELocation.WebDAV():
 		return true
 	case ELocation.Local(), ELocation.Benchmark(), ELocation.Pipe(), ELocation.Unknown(), ELocation.None():
 		return false
@@ -664,7 +665,7 @@ func (l Location) IsAzure() bool {
 // and folders may have properties). Folders are only virtual, and so not real, in Blob Storage.
 func (l Location) IsFolderAware() bool {
 	switch l {
-	case ELocation.BlobFS(), ELocation.File(), ELocation.Local(), ELocation.FileNFS():
+	case ELocation.BlobFS(), ELocation.File(), ELocation.Local(), ELocation.FileNFS(), ELocation.WebDAV():
 		return true
 	case ELocation.Blob(), ELocation.S3(), ELocation.GCP(), ELocation.Http(), ELocation.Benchmark(), ELocation.Pipe(), ELocation.Unknown(), ELocation.None():
 		return false
@@ -740,6 +741,11 @@ func (FromTo) FileSMBFileSMB() FromTo { return FromToValue(ELocation.File(), ELo
 func (FromTo) FileSMBFileNFS() FromTo { return FromToValue(ELocation.File(), ELocation.FileNFS()) }
 func (FromTo) FileNFSFileSMB() FromTo { return FromToValue(ELocation.FileNFS(), ELocation.File()) }
 func (FromTo) HttpLocal() FromTo      { return FromToValue(ELocation.Http(), ELocation.Local()) }
+func (FromTo) HttpBlob() FromTo       { return FromToValue(ELocation.Http(), ELocation.Blob()) }
+func (FromTo) WebDAVLocal() FromTo    { return FromToValue(ELocation.WebDAV(), ELocation.Local()) }
+func (FromTo) LocalWebDAV() FromTo    { return FromToValue(ELocation.Local(), ELocation.WebDAV()) }
+func (FromTo) WebDAVBlob() FromTo     { return FromToValue(ELocation.WebDAV(), ELocation.Blob()) }
+func (FromTo) WebDAVFile() FromTo     { return FromToValue(ELocation.WebDAV(), ELocation.File()) }
 
 // todo: to we really want these?  Starts to look like a bit of a combinatorial explosion
 func (FromTo) BenchmarkBlob() FromTo {
@@ -1890,6 +1896,19 @@ func (SyncHashType) MD5() SyncHashType {
 	return 1
 }
 
+// CRC64 is the CRC-64 Azure Storage uses to validate transfers
+func (SyncHashType) CRC64() SyncHashType {
+	return 2
+}
+
+func (SyncHashType) SHA256() SyncHashType {
+	return 3
+}
+
+func (SyncHashType) XXHash64() SyncHashType {
+	return 4
+}
+
 func (ht *SyncHashType) Parse(s string) error {
 	val, err := enum.ParseInt(reflect.TypeOf(ht), s, true, true)
 	if err == nil {
@@ -1902,6 +1921,115 @@ func (ht SyncHashType) String() string {
 	return enum.StringInt(ht, reflect.TypeOf(ht))
 }
 
+// //////////////////////////////////////////////////////////////////////////////
+// SyncConflictPolicy decides what a bidirectional sync does with a path that has changed at both the source and the destination
+type SyncConflictPolicy uint8
+
+var ESyncConflictPolicy SyncConflictPolicy = 0
+
+// Report lists the conflict, and leaves both sides as they are
+func (SyncConflictPolicy) Report() SyncConflictPolicy {
+	return 0
+}
+
+// NewerWins copies whichever side was modified last over the other
+func (SyncConflictPolicy) NewerWins() SyncConflictPolicy {
+	return 1
+}
+
+// KeepBoth renames the local version out of the way, so that both versions end up on both sides
+func (SyncConflictPolicy) KeepBoth() SyncConflictPolicy {
+	return 2
+}
+
+func (p *SyncConflictPolicy) Parse(s string) error {
+	val, err := enum.ParseInt(reflect.TypeOf(p), s, true, true)
+	if err == nil {
+		*p = val.(SyncConflictPolicy)
+	}
+	return err
+}
+
+func (p SyncConflictPolicy) String() string {
+	return enum.StringInt(p, reflect.TypeOf(p))
+}
+
+// //////////////////////////////////////////////////////////////////////////////
+// SyncCompareBy decides how sync tells whether a file present at both the source and the destination needs transferring
+type SyncCompareBy uint8
+
+var ESyncCompareBy SyncCompareBy = 0
+
+// Default transfers the file if the source is more recent, or, with --compare-hash, if the hashes differ
+func (SyncCompareBy) Default() SyncCompareBy {
+	return 0
+}
+
+// Size transfers the file if the sizes differ, whatever the times
+func (SyncCompareBy) Size() SyncCompareBy {
+	return 1
+}
+
+// LMTAndSize transfers the file if the sizes differ, or if the source is more recent
+func (SyncCompareBy) LMTAndSize() SyncCompareBy {
+	return 2
+}
+
+// Checksum transfers the file if the hashes differ, whatever the times
+func (SyncCompareBy) Checksum() SyncCompareBy {
+	return 3
+}
+
+// MetadataAware transfers the file as Default does, and also if the content headers or metadata differ
+func (SyncCompareBy) MetadataAware() SyncCompareBy {
+	return 4
+}
+
+func (c *SyncCompareBy) Parse(s string) error {
+	val, err := enum.ParseInt(reflect.TypeOf(c), s, true, true)
+	if err == nil {
+		*c = val.(SyncCompareBy)
+	}
+	return err
+}
+
+func (c SyncCompareBy) String() string {
+	return enum.StringInt(c, reflect.TypeOf(c))
+}
+
+// //////////////////////////////////////////////////////////////////////////////
+// FlattenCollision decides what a copy with --flatten does with a file whose name another file has already been given
+type FlattenCollision uint8
+
+var EFlattenCollision FlattenCollision = 0
+
+// Fail stops the job
+func (FlattenCollision) Fail() FlattenCollision {
+	return 0
+}
+
+// Skip leaves the file out, keeping the one that came first
+func (FlattenCollision) Skip() FlattenCollision {
+	return 1
+}
+
+// Suffix gives the file the first free name with -1, -2 and so on before its extension
+func (FlattenCollision) Suffix() FlattenCollision {
+	return 2
+}
+
+func (c *FlattenCollision) Parse(s string) error {
+	val, err := enum.ParseInt(reflect.TypeOf(c), s, true, true)
+	if err == nil {
+		*c = val.(FlattenCollision)
+	}
+	return err
+}
+
+func (c FlattenCollision) String() string {
+	return enum.StringInt(c, reflect.TypeOf(c))
+}
+
 // //////////////////////////////////////////////////////////////////////////////
 type SymlinkHandlingType uint8 // SymlinkHandlingType is only utilized internally to avoid having to carry around two contradictory flags. Thus, it doesn't have a parse method.
 
@@ -181,4 +181,13 @@ func TestHttpLocation_AllLocalLocations(t *testing.T) {
 	for _, loc := range localLocations {
 		assert.NotEqual(t, httpLoc, loc, "HTTP should not be in local locations")
 	}
-}
\ No newline at end of file
+}
+
+func TestHttpBlobFromTo_Components(t *testing.T) {
+	ft := EFromTo.HttpBlob()
+
+	assert.Equal(t, ELocation.Http(), ft.From(), "From should be HTTP")
+	assert.Equal(t, ELocation.Blob(), ft.To(), "To should be Blob")
+	assert.True(t, ft.IsS2S(), "HttpBlob should be a service to service copy")
+	assert.False(t, ft.IsDownload(), "HttpBlob should not be a download")
+}
@@ -21,9 +21,12 @@
 package common_test
 
 import (
+	"encoding/hex"
+	"hash/crc64"
+	"testing"
+
 	"github.com/Azure/azure-storage-azcopy/v10/common"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestEnhanceJobStatusInfo(t *testing.T) {
@@ -185,3 +188,32 @@ func TestMetadataResolveInvalidKeyNegative(t *testing.T) {
 	_, err = mNegative3.ResolveInvalidKey()
 	a.NotNil(err)
 }
+
+func TestSyncHashType(t *testing.T) {
+	a := assert.New(t)
+	sum := func(ht common.SyncHashType, data string) string {
+		h := ht.NewHash()
+		_, _ = h.Write([]byte(data))
+		return hex.EncodeToString(h.Sum(nil))
+	}
+
+	a.Equal("900150983cd24fb0d6963f7d28e17f72", sum(common.ESyncHashType.MD5(), "abc"))
+	a.Equal("ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", sum(common.ESyncHashType.SHA256(), "abc"))
+	a.Equal("44bc2cf5ad770999", sum(common.ESyncHashType.XXHash64(), "abc"))
+
+	// Azure's CRC-64 isn't the ECMA or ISO one
+	crc := sum(common.ESyncHashType.CRC64(), "abc")
+	a.Len(crc, 16)
+	ecma := crc64.New(crc64.MakeTable(crc64.ECMA))
+	_, _ = ecma.Write([]byte("abc"))
+	a.NotEqual(hex.EncodeToString(ecma.Sum(nil)), crc)
+	a.Nil(common.ESyncHashType.None().NewHash())
+
+	a.Equal("", common.ESyncHashType.MD5().MetadataKey())
+	a.Equal("azcopy_sha256", common.ESyncHashType.SHA256().MetadataKey())
+	a.Equal("azcopy_xxhash64", common.ESyncHashType.XXHash64().MetadataKey())
+
+	var ht common.SyncHashType
+	a.NoError(ht.Parse("crc64"))
+	a.Equal(common.ESyncHashType.CRC64(), ht)
+}
@@ -1,10 +1,17 @@
 package common
 
 import (
-	"github.com/JeffreyRichter/enum/enum"
+	"crypto/md5"
+	"crypto/sha256"
+	"hash"
+	"hash/crc64"
 	"reflect"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/JeffreyRichter/enum/enum"
+	"github.com/cespare/xxhash/v2"
 )
 
 // AzCopyHashDataStream is used as both the name of a data stream, xattr key, and the suffix of os-agnostic hash data files.
@@ -15,6 +22,43 @@ type SyncHashData struct {
 	Mode SyncHashType
 	Data string // base64 encoded
 	LMT  time.Time
+
+	// SourceETag is the ETag of the HTTP source the file was last synced from, so unchanged files can be skipped next time
+	SourceETag string `json:",omitempty"`
+}
+
+// SyncSourceETagMetadataKey records the ETag of the HTTP source an object was last synced from.
+// Remote destinations keep it as metadata; local ones keep it alongside their hash data.
+const SyncSourceETagMetadataKey = "azcopy_source_etag"
+
+// the polynomial of the CRC-64 Azure Storage computes for transactional validation
+const azureCRC64Polynomial uint64 = 0x9A6C9329AC4BC9B5
+
+var azureCRC64Table = crc64.MakeTable(azureCRC64Polynomial)
+
+// NewHash returns a hasher for the sync hash type, or nil for None
+func (ht SyncHashType) NewHash() hash.Hash {
+	switch ht {
+	case ESyncHashType.MD5():
+		return md5.New()
+	case ESyncHashType.CRC64():
+		return crc64.New(azureCRC64Table)
+	case ESyncHashType.SHA256():
+		return sha256.New()
+	case ESyncHashType.XXHash64():
+		return xxhash.New()
+	default:
+		return nil
+	}
+}
+
+// MetadataKey is the metadata key remote objects record the hash under (base64 encoded, as in SyncHashData).
+// MD5 is kept in the Content-MD5 property instead, so it has no key, and neither has None.
+func (ht SyncHashType) MetadataKey() string {
+	if ht == ESyncHashType.None() || ht == ESyncHashType.MD5() {
+		return ""
+	}
+	return "azcopy_" + strings.ToLower(ht.String())
 }
 
 // LocalHashStorageMode & LocalHashDir are temporary global variables pending some level of refactor on parameters
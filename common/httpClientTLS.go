@@ -0,0 +1,164 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// NewHTTPTLSConfig builds the TLS settings for HTTP sources that require mutual TLS, or that are signed by a private CA.
+// keyFile defaults to certFile, since PEM files commonly hold both. caBundle is trusted in addition to the system's roots.
+// Any of them may be empty; if all of them are, the result is nil.
+func NewHTTPTLSConfig(certFile, keyFile, caBundle string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" && caBundle == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if keyFile != "" && certFile == "" {
+		return nil, fmt.Errorf("%s must be set along with %s", EEnvironmentVariable.HTTPClientCertificate().Name, EEnvironmentVariable.HTTPClientKey().Name)
+	}
+	if certFile != "" {
+		if keyFile == "" {
+			keyFile = certFile
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the client certificate for HTTP sources: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CA bundle for HTTP sources: %w", err)
+		}
+
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool() // e.g. on platforms where the system pool can't be loaded
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("the CA bundle %s holds no PEM certificates", caBundle)
+		}
+		config.RootCAs = roots
+	}
+
+	return config, nil
+}
+
+var httpTLSConfigOnce sync.Once
+var httpTLSConfig *tls.Config
+var httpTLSConfigErr error
+
+// SetHTTPTLSConfig makes config the TLS settings for every HTTP source of this process,
+// in place of whatever the environment configures. It must be called before the first GetHTTPTLSConfig.
+func SetHTTPTLSConfig(config *tls.Config) {
+	httpTLSConfigOnce.Do(func() {})
+	httpTLSConfig, httpTLSConfigErr = config, nil
+}
+
+// GetHTTPTLSConfig returns the TLS settings configured for HTTP sources through the AZCOPY_HTTP_* environment variables,
+// or nil if the transport's defaults apply. Only the paths of the certificate and key are configured, so neither ends up in plan files.
+func GetHTTPTLSConfig() (*tls.Config, error) {
+	httpTLSConfigOnce.Do(func() {
+		httpTLSConfig, httpTLSConfigErr = NewHTTPTLSConfig(
+			GetEnvironmentVariable(EEnvironmentVariable.HTTPClientCertificate()),
+			GetEnvironmentVariable(EEnvironmentVariable.HTTPClientKey()),
+			GetEnvironmentVariable(EEnvironmentVariable.HTTPCABundle()))
+	})
+
+	return httpTLSConfig, httpTLSConfigErr
+}
+
+// the clients made by withHTTPTLSConfig, by the client they're derived from, so that every pipeline of a job shares their connections
+var httpTLSClients sync.Map
+
+type httpTLSClientKey struct {
+	base   *http.Client
+	config *tls.Config
+}
+
+// withHTTPTLSConfig returns a transport like the given one (nil meaning azcore's default), but using config for TLS.
+// The storage services share the original transport, so the client certificate is only ever presented to HTTP sources.
+func withHTTPTLSConfig(transport policy.Transporter, config *tls.Config) (policy.Transporter, error) {
+	if config == nil {
+		return transport, nil
+	}
+
+	var base *http.Client // nil for azcore's default
+	switch t := transport.(type) {
+	case nil:
+	case *http.Client:
+		base = t
+	default:
+		return nil, errors.New("TLS settings for HTTP sources can't be applied to a custom transport")
+	}
+
+	key := httpTLSClientKey{base: base, config: config}
+	if client, ok := httpTLSClients.Load(key); ok {
+		return client.(*http.Client), nil
+	}
+
+	client := &http.Client{}
+	if base != nil {
+		*client = *base
+	}
+
+	var baseTransport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		baseTransport = http.DefaultTransport.(*http.Transport)
+	case *http.Transport:
+		baseTransport = t
+	default:
+		return nil, errors.New("TLS settings for HTTP sources can't be applied to a custom transport")
+	}
+
+	tlsTransport := baseTransport.Clone()
+	tlsConfig := config.Clone()
+	if baseTransport.TLSClientConfig != nil {
+		// keep the base's settings (e.g. renegotiation), other than those configured for HTTP sources
+		tlsConfig = baseTransport.TLSClientConfig.Clone()
+		tlsConfig.Certificates = config.Certificates
+		if config.RootCAs != nil {
+			tlsConfig.RootCAs = config.RootCAs
+		}
+		if tlsConfig.MinVersion < config.MinVersion {
+			tlsConfig.MinVersion = config.MinVersion
+		}
+	}
+	tlsTransport.TLSClientConfig = tlsConfig
+	client.Transport = tlsTransport
+
+	actual, _ := httpTLSClients.LoadOrStore(key, client)
+	return actual.(*http.Client), nil
+}
@@ -0,0 +1,151 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestClientCertificate writes a self-signed client certificate and its key, as separate PEM files
+func writeTestClientCertificate(t *testing.T, dir string) (cert *x509.Certificate, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "azcopy-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return cert, certFile, keyFile
+}
+
+func TestHTTPClientTLS_MutualTLS(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	clientCert, certFile, keyFile := writeTestClientCertificate(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	// the server's certificate is signed by no CA the system knows of
+	caBundle := filepath.Join(dir, "ca.pem")
+	a.NoError(os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	base := &http.Client{Transport: &http.Transport{}}
+
+	trustOnly, err := NewHTTPTLSConfig("", "", caBundle)
+	a.NoError(err)
+	transport, err := withHTTPTLSConfig(base, trustOnly)
+	a.NoError(err)
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := transport.Do(req)
+	if err == nil {
+		// with TLS 1.3, the server only rejects the missing certificate once the handshake has completed on the client side
+		resp.Body.Close()
+	}
+	a.Error(err)
+
+	config, err := NewHTTPTLSConfig(certFile, keyFile, caBundle)
+	a.NoError(err)
+	transport, err = withHTTPTLSConfig(base, config)
+	a.NoError(err)
+	req, _ = http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err = transport.Do(req)
+	a.NoError(err)
+	if err == nil {
+		defer resp.Body.Close()
+		a.Equal(http.StatusOK, resp.StatusCode)
+	}
+
+	// the storage services' transport doesn't present the certificate, and pipelines share the derived one
+	if baseConfig := base.Transport.(*http.Transport).TLSClientConfig; baseConfig != nil { // cloning sets up HTTP/2 on the original
+		a.Empty(baseConfig.Certificates)
+		a.Nil(baseConfig.RootCAs)
+	}
+	again, err := withHTTPTLSConfig(base, config)
+	a.NoError(err)
+	a.Same(transport, again)
+}
+
+func TestNewHTTPTLSConfig(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+
+	config, err := NewHTTPTLSConfig("", "", "")
+	a.NoError(err)
+	a.Nil(config)
+
+	// a single PEM file may hold both the certificate and the key
+	_, certFile, keyFile := writeTestClientCertificate(t, dir)
+	certPEM, _ := os.ReadFile(certFile)
+	keyPEM, _ := os.ReadFile(keyFile)
+	combined := filepath.Join(dir, "combined.pem")
+	a.NoError(os.WriteFile(combined, append(certPEM, keyPEM...), 0600))
+	config, err = NewHTTPTLSConfig(combined, "", "")
+	a.NoError(err)
+	a.Len(config.Certificates, 1)
+	a.Nil(config.RootCAs)
+
+	_, err = NewHTTPTLSConfig("", keyFile, "")
+	a.Error(err)
+	_, err = NewHTTPTLSConfig(certFile, "", "")
+	a.Error(err, "the key is missing")
+	_, err = NewHTTPTLSConfig("", "", filepath.Join(dir, "missing.pem"))
+	a.Error(err)
+	_, err = NewHTTPTLSConfig("", "", keyFile)
+	a.Error(err, "the bundle holds no certificates")
+}
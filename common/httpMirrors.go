@@ -0,0 +1,67 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"net/url"
+	"strings"
+)
+
+// HTTPMirrorsMetadataKey holds, in the source metadata of an HTTP download, the URLs of other servers with the same file.
+// Keeping them with the transfer means they are saved in the job plan, so a resumed job downloads from the mirrors too.
+// Mirrors are only supported for downloads to the local disk, so the key is never written to a destination.
+const HTTPMirrorsMetadataKey = "azcopy_http_mirrors"
+
+// SetHTTPMirrors records in metadata the URLs of the mirrors of a file, not including the file itself
+func SetHTTPMirrors(metadata Metadata, mirrors []string) {
+	if len(mirrors) == 0 {
+		delete(metadata, HTTPMirrorsMetadataKey)
+		return
+	}
+	// URLs can't hold a raw newline, so it serves as the separator
+	joined := strings.Join(mirrors, "\n")
+	metadata[HTTPMirrorsMetadataKey] = &joined
+}
+
+// GetHTTPMirrors returns the URLs of the mirrors recorded in metadata, if any
+func GetHTTPMirrors(metadata Metadata) []string {
+	joined, ok := metadata[HTTPMirrorsMetadataKey]
+	if !ok || joined == nil || *joined == "" {
+		return nil
+	}
+	return strings.Split(*joined, "\n")
+}
+
+// ResolveHTTPMirrors finds a file at the same place beneath each of roots, which mirror the directory it was listed from.
+// relativePath is the unescaped path of the file below that directory.
+func ResolveHTTPMirrors(roots []string, relativePath string) []string {
+	mirrors := make([]string, 0, len(roots))
+	for _, root := range roots {
+		u, err := url.Parse(root)
+		if err != nil {
+			continue
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(relativePath, "/")
+		u.RawPath = ""
+		mirrors = append(mirrors, u.String())
+	}
+	return mirrors
+}
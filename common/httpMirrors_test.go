@@ -0,0 +1,56 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMirrors(t *testing.T) {
+	a := assert.New(t)
+
+	metadata := Metadata{}
+	a.Empty(GetHTTPMirrors(metadata))
+
+	SetHTTPMirrors(metadata, []string{"https://b.example.com/tool.tar.gz", "https://c.example.com/x/tool.tar.gz?token=1"})
+	a.Equal([]string{"https://b.example.com/tool.tar.gz", "https://c.example.com/x/tool.tar.gz?token=1"}, GetHTTPMirrors(metadata))
+
+	// the mirrors survive being saved in the job plan
+	marshalled, err := metadata.Marshal()
+	a.NoError(err)
+	unmarshalled, err := UnMarshalToCommonMetadata(marshalled)
+	a.NoError(err)
+	a.Equal(GetHTTPMirrors(metadata), GetHTTPMirrors(unmarshalled))
+
+	SetHTTPMirrors(metadata, nil)
+	a.Empty(GetHTTPMirrors(metadata))
+	a.Empty(metadata)
+}
+
+func TestResolveHTTPMirrors(t *testing.T) {
+	a := assert.New(t)
+
+	// the files of a listing are found at the same place beneath each mirror, whatever the query string
+	a.Equal([]string{"https://b.example.com/mirror/v1/tool%20one.zip", "https://c.example.com/r/v1/tool%20one.zip?token=1"},
+		ResolveHTTPMirrors([]string{"https://b.example.com/mirror", "https://c.example.com/r/?token=1"}, "v1/tool one.zip"))
+}
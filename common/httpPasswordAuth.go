@@ -0,0 +1,492 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// HTTPPasswordSource supplies the user name and password that HTTP sources ask for with Basic or Digest challenges
+type HTTPPasswordSource interface {
+	// Password returns the credentials for host (which may include a port), if there are any
+	Password(host string) (username, password string, ok bool)
+}
+
+// staticHTTPPasswordSource presents its credentials to a single server
+type staticHTTPPasswordSource struct {
+	host               string // lower case, with the port if there is one
+	username, password string
+}
+
+// NewStaticHTTPPasswordSource presents the credentials to host alone, so that they never reach another server the job talks to.
+// host is matched along with its port, if it has one.
+func NewStaticHTTPPasswordSource(host, username, password string) HTTPPasswordSource {
+	return staticHTTPPasswordSource{host: strings.ToLower(host), username: username, password: password}
+}
+
+func (s staticHTTPPasswordSource) Password(host string) (string, string, bool) {
+	if s.host == "" || strings.ToLower(host) != s.host {
+		return "", "", false
+	}
+	return s.username, s.password, true
+}
+
+// netrcHTTPPasswordSource looks the credentials of each server up in a .netrc file, by machine name
+type netrcHTTPPasswordSource struct {
+	machines map[string]netrcEntry
+	fallback *netrcEntry // from the default entry, if there is one
+}
+
+type netrcEntry struct {
+	login, password string
+}
+
+// NewNetrcHTTPPasswordSource reads the credentials of each server from a file in the .netrc format used by curl, wget and ftp
+func NewNetrcHTTPPasswordSource(path string) (HTTPPasswordSource, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read netrc file: %w", err)
+	}
+	return ParseNetrc(string(contents)), nil
+}
+
+// ParseNetrc parses the contents of a .netrc file. Macro definitions are skipped, and entries without a password are ignored.
+func ParseNetrc(contents string) HTTPPasswordSource {
+	source := &netrcHTTPPasswordSource{machines: make(map[string]netrcEntry)}
+
+	var machine string
+	var entry *netrcEntry
+	finish := func() {
+		if entry == nil || entry.password == "" {
+			return
+		}
+		if machine == "" {
+			source.fallback = entry
+		} else if _, ok := source.machines[machine]; !ok { // the first entry for a machine wins, as with curl
+			source.machines[machine] = *entry
+		}
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	inMacro := false
+	for scanner.Scan() {
+		line := scanner.Text()
+		if inMacro {
+			// a macro definition runs until the next blank line
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			if strings.HasPrefix(fields[i], "#") {
+				break
+			}
+
+			value := ""
+			if i+1 < len(fields) {
+				value = fields[i+1]
+			}
+			switch fields[i] {
+			case "machine":
+				finish()
+				machine, entry = strings.ToLower(value), &netrcEntry{}
+				i++
+			case "default":
+				finish()
+				machine, entry = "", &netrcEntry{}
+			case "login":
+				if entry != nil {
+					entry.login = value
+				}
+				i++
+			case "password":
+				if entry != nil {
+					entry.password = value
+				}
+				i++
+			case "account":
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	finish()
+
+	return source
+}
+
+func (s *netrcHTTPPasswordSource) Password(host string) (string, string, bool) {
+	host = strings.ToLower(host)
+	if entry, ok := s.machines[host]; ok {
+		return entry.login, entry.password, true
+	}
+
+	// entries normally name the host alone, whatever port the server listens on
+	if i := strings.LastIndex(host, ":"); i >= 0 && !strings.HasSuffix(host, "]") {
+		if entry, ok := s.machines[host[:i]]; ok {
+			return entry.login, entry.password, true
+		}
+	}
+
+	if s.fallback != nil {
+		return s.fallback.login, s.fallback.password, true
+	}
+	return "", "", false
+}
+
+var httpPasswordSourceOnce sync.Once
+var httpPasswordSourceOverride HTTPPasswordSource
+var httpNetrcSource HTTPPasswordSource
+var httpPasswordSourceErr error
+
+// SetHTTPPasswordSource makes source the password source for every HTTP request of this process,
+// in place of whatever the environment configures. It must be called before the first GetHTTPPasswordSource.
+func SetHTTPPasswordSource(source HTTPPasswordSource) {
+	httpPasswordSourceOnce.Do(func() {})
+	httpPasswordSourceOverride, httpPasswordSourceErr = source, nil
+}
+
+// GetHTTPPasswordSource returns the password source for requests against the server of resourceURL.
+// It is nil when no credentials are configured. As with the token source, it's configured through the environment,
+// so the credentials never end up in plan files.
+func GetHTTPPasswordSource(resourceURL string) (HTTPPasswordSource, error) {
+	httpPasswordSourceOnce.Do(func() {
+		// a .netrc file is read once, however many pipelines are built
+		if GetEnvironmentVariable(EEnvironmentVariable.HTTPNetrc()) != "" {
+			httpNetrcSource, httpPasswordSourceErr = NewHTTPPasswordSourceFromEnvironment("")
+		}
+	})
+	if httpPasswordSourceOverride != nil || httpPasswordSourceErr != nil {
+		return httpPasswordSourceOverride, httpPasswordSourceErr
+	}
+	if httpNetrcSource != nil {
+		return httpNetrcSource, nil
+	}
+
+	return NewHTTPPasswordSourceFromEnvironment(resourceURL)
+}
+
+// NewHTTPPasswordSourceFromEnvironment builds the password source configured through the AZCOPY_HTTP_* environment variables, if any.
+// A user name and password are only given to the server of resourceURL, on the same port; a .netrc file names the servers itself.
+func NewHTTPPasswordSourceFromEnvironment(resourceURL string) (HTTPPasswordSource, error) {
+	username := GetEnvironmentVariable(EEnvironmentVariable.HTTPUsername())
+	password := GetEnvironmentVariable(EEnvironmentVariable.HTTPPassword())
+	netrc := GetEnvironmentVariable(EEnvironmentVariable.HTTPNetrc())
+
+	switch {
+	case username != "" && netrc != "":
+		return nil, fmt.Errorf("only one of %s and %s can be set", EEnvironmentVariable.HTTPUsername().Name, EEnvironmentVariable.HTTPNetrc().Name)
+	case username != "":
+		u, err := url.Parse(resourceURL)
+		if err != nil || u.Host == "" {
+			// e.g. a list of URLs, which may name any number of servers
+			return nil, nil
+		}
+		return NewStaticHTTPPasswordSource(u.Host, username, password), nil
+	case password != "":
+		return nil, fmt.Errorf("%s must be set along with %s", EEnvironmentVariable.HTTPUsername().Name, EEnvironmentVariable.HTTPPassword().Name)
+	case netrc != "":
+		return NewNetrcHTTPPasswordSource(netrc)
+	}
+
+	return nil, nil
+}
+
+// httpChallenge is a parsed WWW-Authenticate challenge
+type httpChallenge struct {
+	scheme string // lower case
+	params map[string]string
+}
+
+// parseHTTPChallenges parses WWW-Authenticate header values, each of which may hold several challenges
+func parseHTTPChallenges(values []string) []httpChallenge {
+	var challenges []httpChallenge
+
+	for _, value := range values {
+		s := strings.TrimSpace(value)
+		for s != "" {
+			// the scheme, then auth-params up to the next scheme
+			scheme := s
+			if i := strings.IndexAny(s, " \t,"); i >= 0 {
+				scheme, s = s[:i], strings.TrimLeft(s[i:], " \t")
+			} else {
+				s = ""
+			}
+			if scheme == "" {
+				s = strings.TrimLeft(s, ", \t")
+				continue
+			}
+
+			challenge := httpChallenge{scheme: strings.ToLower(scheme), params: make(map[string]string)}
+			for {
+				s = strings.TrimLeft(s, ", \t")
+				key, rest, found := strings.Cut(s, "=")
+				if !found || strings.ContainsAny(strings.TrimSpace(key), " \t,") {
+					break // the next challenge's scheme
+				}
+
+				var value string
+				value, s = parseHTTPChallengeParamValue(strings.TrimLeft(rest, " \t"))
+				challenge.params[strings.ToLower(strings.TrimSpace(key))] = value
+			}
+			challenges = append(challenges, challenge)
+		}
+	}
+
+	return challenges
+}
+
+// parseHTTPChallengeParamValue reads a token or quoted string from the start of s, returning it and the remainder
+func parseHTTPChallengeParamValue(s string) (value, rest string) {
+	if !strings.HasPrefix(s, `"`) {
+		if i := strings.IndexAny(s, ", \t"); i >= 0 {
+			return s[:i], s[i:]
+		}
+		return s, ""
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// httpDigestAlgorithms are the Digest algorithms that can be answered, strongest first
+var httpDigestAlgorithms = map[string]func() hash.Hash{
+	"sha-256":      sha256.New,
+	"sha-256-sess": sha256.New,
+	"md5":          md5.New,
+	"md5-sess":     md5.New,
+}
+
+// supported is true for the challenges that can be answered: Basic, and Digest with a known algorithm and either no qop or "auth"
+func (c httpChallenge) supported() bool {
+	switch c.scheme {
+	case "basic":
+		return true
+	case "digest":
+		if c.params["nonce"] == "" {
+			return false
+		}
+		if _, ok := httpDigestAlgorithms[strings.ToLower(c.digestAlgorithm())]; !ok {
+			return false
+		}
+		return c.params["qop"] == "" || c.offersAuthQop()
+	}
+	return false
+}
+
+func (c httpChallenge) digestAlgorithm() string {
+	if alg := c.params["algorithm"]; alg != "" {
+		return alg
+	}
+	return "MD5"
+}
+
+func (c httpChallenge) offersAuthQop() bool {
+	for _, qop := range strings.Split(c.params["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			return true
+		}
+	}
+	return false
+}
+
+// strength orders the supported challenges, so that Digest is answered in preference to Basic
+func (c httpChallenge) strength() int {
+	if c.scheme != "digest" {
+		return 0
+	}
+	if strings.HasPrefix(strings.ToLower(c.digestAlgorithm()), "sha-256") {
+		return 2
+	}
+	return 1
+}
+
+// digestResponse computes the Authorization header value answering a Digest challenge, as per RFC 7616
+func (c httpChallenge) digestResponse(username, password, method, uri string, nc uint32, cnonce string) string {
+	alg := c.digestAlgorithm()
+	newHash := httpDigestAlgorithms[strings.ToLower(alg)]
+	h := func(s string) string {
+		hasher := newHash()
+		_, _ = io.WriteString(hasher, s)
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	realm, nonce := c.params["realm"], c.params["nonce"]
+	ha1 := h(username + ":" + realm + ":" + password)
+	if strings.HasSuffix(strings.ToLower(alg), "-sess") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	quote := func(s string) string { return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"` }
+	parts := []string{
+		"username=" + quote(username),
+		"realm=" + quote(realm),
+		"nonce=" + quote(nonce),
+		"uri=" + quote(uri),
+		"algorithm=" + alg,
+	}
+
+	if c.offersAuthQop() {
+		ncValue := fmt.Sprintf("%08x", nc)
+		parts = append(parts,
+			"response="+quote(h(ha1+":"+nonce+":"+ncValue+":"+cnonce+":auth:"+ha2)),
+			"qop=auth", "nc="+ncValue, "cnonce="+quote(cnonce))
+	} else {
+		parts = append(parts, "response="+quote(h(ha1+":"+nonce+":"+ha2)))
+	}
+	if opaque, ok := c.params["opaque"]; ok {
+		parts = append(parts, "opaque="+quote(opaque))
+	}
+
+	return "Digest " + strings.Join(parts, ", ")
+}
+
+// httpPasswordPolicy answers Basic and Digest challenges with credentials from an HTTPPasswordSource.
+// Credentials only go to servers that ask for them; after the first challenge from a server,
+// its later requests are authorized up front, rather than each taking an extra round trip.
+type httpPasswordPolicy struct {
+	source HTTPPasswordSource
+
+	mu         sync.Mutex
+	challenges map[string]*httpHostChallenge // by host
+}
+
+// httpHostChallenge is the last challenge a server made, along with the Digest nonce count
+type httpHostChallenge struct {
+	challenge httpChallenge
+	nc        uint32
+}
+
+// NewHTTPPasswordPolicy returns a per-retry policy that answers Basic and Digest challenges with credentials from source.
+// Requests that another policy has authorized with a bearer token are left alone.
+func NewHTTPPasswordPolicy(source HTTPPasswordSource) policy.Policy {
+	return &httpPasswordPolicy{source: source, challenges: make(map[string]*httpHostChallenge)}
+}
+
+func (p *httpPasswordPolicy) Do(req *policy.Request) (*http.Response, error) {
+	raw := req.Raw()
+	if strings.HasPrefix(raw.Header.Get("Authorization"), "Bearer ") {
+		return req.Next()
+	}
+
+	host := raw.URL.Host
+	authorized, err := p.authorize(raw, host, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := req.Next()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	var best *httpChallenge
+	for _, c := range parseHTTPChallenges(resp.Header.Values("WWW-Authenticate")) {
+		if c.supported() && (best == nil || c.strength() > best.strength()) {
+			best = &c
+		}
+	}
+	if best == nil {
+		return resp, nil
+	}
+
+	// Answering the same challenge again would only be rejected again, unless the server says the nonce went stale
+	if authorized && !strings.EqualFold(best.params["stale"], "true") {
+		return resp, nil
+	}
+	if req.RewindBody() != nil {
+		return resp, nil
+	}
+
+	if ok, err := p.authorize(raw, host, best); err != nil || !ok {
+		return resp, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	return req.Next()
+}
+
+// authorize sets the Authorization header of req in answer to challenge, or to the last challenge from host if that's nil.
+// It is false if there's no challenge to answer, or no credentials for host.
+func (p *httpPasswordPolicy) authorize(req *http.Request, host string, challenge *httpChallenge) (bool, error) {
+	username, password, ok := p.source.Password(host)
+	if !ok {
+		return false, nil
+	}
+
+	p.mu.Lock()
+	state := p.challenges[host]
+	if challenge != nil {
+		state = &httpHostChallenge{challenge: *challenge}
+		p.challenges[host] = state
+	}
+	if state == nil {
+		p.mu.Unlock()
+		return false, nil
+	}
+	state.nc++
+	c, nc := state.challenge, state.nc
+	p.mu.Unlock()
+
+	if c.scheme == "basic" {
+		req.SetBasicAuth(username, password)
+		return true, nil
+	}
+
+	cnonce := make([]byte, 16)
+	if _, err := rand.Read(cnonce); err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", c.digestResponse(username, password, req.Method, req.URL.RequestURI(), nc, hex.EncodeToString(cnonce)))
+	return true, nil
+}
@@ -0,0 +1,311 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetrc(t *testing.T) {
+	a := assert.New(t)
+
+	source := ParseNetrc(`# artifact stores
+machine artifacts.example.com
+  login alice
+  password s3cret
+
+machine Mirror.Example.com login bob password hunter2 account ignored
+macdef init
+  cd /pub
+  password not-a-password
+
+machine artifacts.example.com login shadowed password shadowed
+machine nopassword.example.com login carol
+default login anonymous password guest@example.com
+`)
+
+	check := func(host, username, password string) {
+		u, p, ok := source.Password(host)
+		a.True(ok, host)
+		a.Equal(username, u, host)
+		a.Equal(password, p, host)
+	}
+	check("artifacts.example.com", "alice", "s3cret")
+	check("artifacts.example.com:8443", "alice", "s3cret") // machines are matched regardless of the port
+	check("mirror.example.com", "bob", "hunter2")
+	check("nopassword.example.com", "anonymous", "guest@example.com")
+	check("other.example.com", "anonymous", "guest@example.com")
+
+	_, _, ok := ParseNetrc("machine a.example.com login x password y").Password("b.example.com")
+	a.False(ok)
+}
+
+func TestNewHTTPPasswordSourceFromEnvironment(t *testing.T) {
+	a := assert.New(t)
+
+	netrc := filepath.Join(t.TempDir(), "netrc")
+	a.NoError(os.WriteFile(netrc, []byte("machine example.com login user password pass"), 0600))
+
+	t.Setenv(EEnvironmentVariable.HTTPUsername().Name, "")
+	t.Setenv(EEnvironmentVariable.HTTPPassword().Name, "")
+	t.Setenv(EEnvironmentVariable.HTTPNetrc().Name, "")
+	source, err := NewHTTPPasswordSourceFromEnvironment("https://artifacts.example.com:8443/dist/")
+	a.NoError(err)
+	a.Nil(source)
+
+	t.Setenv(EEnvironmentVariable.HTTPUsername().Name, "user")
+	t.Setenv(EEnvironmentVariable.HTTPPassword().Name, "pass")
+	source, err = NewHTTPPasswordSourceFromEnvironment("https://artifacts.example.com:8443/dist/")
+	a.NoError(err)
+	username, password, ok := source.Password("Artifacts.example.com:8443")
+	a.True(ok)
+	a.Equal("user", username)
+	a.Equal("pass", password)
+
+	// the credentials are only for the server of the source, on the same port
+	for _, host := range []string{"artifacts.example.com", "artifacts.example.com:443", "other.example.com:8443"} {
+		_, _, ok = source.Password(host)
+		a.False(ok, host)
+	}
+
+	// a list of URLs has no single server to give them to
+	source, err = NewHTTPPasswordSourceFromEnvironment("")
+	a.NoError(err)
+	a.Nil(source)
+
+	t.Setenv(EEnvironmentVariable.HTTPNetrc().Name, netrc)
+	_, err = NewHTTPPasswordSourceFromEnvironment("https://artifacts.example.com:8443/dist/")
+	a.Error(err)
+
+	t.Setenv(EEnvironmentVariable.HTTPUsername().Name, "")
+	t.Setenv(EEnvironmentVariable.HTTPPassword().Name, "")
+	source, err = NewHTTPPasswordSourceFromEnvironment("https://artifacts.example.com:8443/dist/")
+	a.NoError(err)
+	_, password, ok = source.Password("example.com")
+	a.True(ok)
+	a.Equal("pass", password)
+
+	t.Setenv(EEnvironmentVariable.HTTPNetrc().Name, filepath.Join(t.TempDir(), "missing"))
+	_, err = NewHTTPPasswordSourceFromEnvironment("https://artifacts.example.com:8443/dist/")
+	a.Error(err)
+}
+
+func TestParseHTTPChallenges(t *testing.T) {
+	a := assert.New(t)
+
+	challenges := parseHTTPChallenges([]string{
+		`Basic realm="files, and more", Digest realm="files", qop="auth,auth-int", nonce="abc", algorithm=SHA-256`,
+		`Bearer`,
+	})
+	a.Len(challenges, 3)
+
+	a.Equal("basic", challenges[0].scheme)
+	a.Equal("files, and more", challenges[0].params["realm"])
+	a.Equal("digest", challenges[1].scheme)
+	a.Equal("auth,auth-int", challenges[1].params["qop"])
+	a.Equal("SHA-256", challenges[1].params["algorithm"])
+	a.Equal("bearer", challenges[2].scheme)
+
+	a.True(challenges[0].supported())
+	a.True(challenges[1].supported())
+	a.False(challenges[2].supported())
+	a.Greater(challenges[1].strength(), challenges[0].strength())
+
+	a.False(parseHTTPChallenges([]string{`Digest nonce="n", qop="auth-int"`})[0].supported())
+	a.False(parseHTTPChallenges([]string{`Digest nonce="n", algorithm=SHA-512-256`})[0].supported())
+}
+
+func TestHTTPDigestResponse(t *testing.T) {
+	a := assert.New(t)
+
+	// the examples of RFC 2617 section 3.5 and RFC 7616 section 3.9.1
+	c := parseHTTPChallenges([]string{`Digest realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`})[0]
+	a.Contains(c.digestResponse("Mufasa", "Circle Of Life", "GET", "/dir/index.html", 1, "0a4f113b"), `response="6629fae49393a05397450978507c4ef1"`)
+
+	c = parseHTTPChallenges([]string{`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`})[0]
+	response := c.digestResponse("Mufasa", "Circle of Life", "GET", "/dir/index.html", 1, "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ")
+	a.Contains(response, `response="753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"`)
+	a.Contains(response, `opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+	a.Contains(response, "nc=00000001")
+}
+
+// digestTestServer requires SHA-256 Digest authentication, verifying responses independently of the code under test
+type digestTestServer struct {
+	username, password string
+
+	mu       sync.Mutex
+	nonce    int
+	requests []string // the Authorization header of each request
+	stale    bool     // whether to declare the next valid response stale
+}
+
+var digestTestServerParam = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^,\s]*))`)
+
+func (s *digestTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth := r.Header.Get("Authorization")
+	s.requests = append(s.requests, auth)
+
+	challenge := func(stale bool) {
+		s.nonce++
+		w.Header().Add("WWW-Authenticate", `Basic realm="files"`)
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="files", qop="auth", algorithm=SHA-256, nonce="nonce-%d", stale=%v`, s.nonce, stale))
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	params := map[string]string{}
+	for _, m := range digestTestServerParam.FindAllStringSubmatch(auth, -1) {
+		params[m[1]] = m[2] + m[3]
+	}
+
+	h := func(v string) string {
+		sum := sha256.Sum256([]byte(v))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := h(s.username + ":files:" + s.password)
+	ha2 := h(r.Method + ":" + r.URL.RequestURI())
+	expected := h(ha1 + ":" + params["nonce"] + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+	if params["response"] != expected || params["nonce"] != fmt.Sprintf("nonce-%d", s.nonce) {
+		challenge(false)
+		return
+	}
+	if s.stale {
+		s.stale = false
+		challenge(true)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestHTTPPasswordPolicy_Digest(t *testing.T) {
+	a := assert.New(t)
+
+	handler := &digestTestServer{username: "user", password: "pass"}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	pipeline := azruntime.NewPipeline("azcopy", AzcopyVersion,
+		azruntime.PipelineOptions{PerRetry: []policy.Policy{NewHTTPPasswordPolicy(NewStaticHTTPPasswordSource(server.Listener.Addr().String(), "user", "pass"))}},
+		&azcore.ClientOptions{Transport: server.Client()})
+	get := func() int {
+		req, err := azruntime.NewRequest(context.Background(), http.MethodGet, server.URL+"/file?x=1")
+		a.NoError(err)
+		resp, err := pipeline.Do(req)
+		a.NoError(err)
+		return resp.StatusCode
+	}
+
+	// Digest is chosen over Basic, once the server asks for credentials
+	a.Equal(http.StatusOK, get())
+	a.Len(handler.requests, 2)
+	a.Empty(handler.requests[0])
+	a.Contains(handler.requests[1], "Digest ")
+	a.Contains(handler.requests[1], "nc=00000001")
+
+	// later requests answer the same challenge up front
+	a.Equal(http.StatusOK, get())
+	a.Len(handler.requests, 3)
+	a.Contains(handler.requests[2], "nc=00000002")
+
+	// a stale nonce is replaced without giving up
+	handler.stale = true
+	a.Equal(http.StatusOK, get())
+	a.Len(handler.requests, 5)
+	a.Contains(handler.requests[4], `nonce="nonce-2"`)
+}
+
+func TestHTTPPasswordPolicy_RejectedCredentials(t *testing.T) {
+	a := assert.New(t)
+
+	handler := &digestTestServer{username: "user", password: "pass"}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	pipeline := azruntime.NewPipeline("azcopy", AzcopyVersion,
+		azruntime.PipelineOptions{PerRetry: []policy.Policy{NewHTTPPasswordPolicy(NewStaticHTTPPasswordSource(server.Listener.Addr().String(), "user", "wrong"))}},
+		&azcore.ClientOptions{Transport: server.Client()})
+
+	for expectedRequests := 2; expectedRequests <= 3; expectedRequests++ {
+		req, err := azruntime.NewRequest(context.Background(), http.MethodGet, server.URL)
+		a.NoError(err)
+		resp, err := pipeline.Do(req)
+		a.NoError(err)
+		a.Equal(http.StatusUnauthorized, resp.StatusCode)
+		// a rejected answer isn't repeated
+		a.Len(handler.requests, expectedRequests)
+	}
+}
+
+func TestHTTPPasswordPolicy_Basic(t *testing.T) {
+	a := assert.New(t)
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if username, password, ok := r.BasicAuth(); ok && username == "user" && password == "pass" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="files", charset="UTF-8"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	host := server.Listener.Addr().String()
+	pipeline := azruntime.NewPipeline("azcopy", AzcopyVersion,
+		azruntime.PipelineOptions{PerRetry: []policy.Policy{NewHTTPPasswordPolicy(ParseNetrc("machine 127.0.0.1 login user password pass"))}},
+		&azcore.ClientOptions{Transport: server.Client()})
+
+	for _, expectedRequests := range []int{2, 3} {
+		req, err := azruntime.NewRequest(context.Background(), http.MethodHead, "http://"+host+"/file")
+		a.NoError(err)
+		resp, err := pipeline.Do(req)
+		a.NoError(err)
+		a.Equal(http.StatusOK, resp.StatusCode)
+		a.Equal(expectedRequests, requests)
+	}
+
+	// requests already authorized with a bearer token are left alone
+	req, err := azruntime.NewRequest(context.Background(), http.MethodHead, "http://"+host+"/file")
+	a.NoError(err)
+	req.Raw().Header.Set("Authorization", "Bearer token")
+	resp, err := pipeline.Do(req)
+	a.NoError(err)
+	a.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,387 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// HTTPTokenSource supplies bearer tokens for generic HTTP endpoints (the Http and WebDAV locations).
+// Tokens are cached and refreshed shortly before they expire. Since the expiry of a token isn't always known,
+// callers that get a 401 back call Invalidate with the rejected token, and the next call to Token fetches a new one.
+type HTTPTokenSource interface {
+	Token(ctx context.Context) (string, error)
+	Invalidate(rejected string)
+}
+
+// tokens this close to their expiry are refreshed before use, so they don't expire mid-request
+const httpTokenRefreshMargin = 2 * time.Minute
+
+// how long a token command may run before we give up on it
+const httpTokenCommandTimeout = time.Minute
+
+// httpTokenFetcher acquires a new token. A zero expiresOn means the expiry is unknown.
+type httpTokenFetcher func(ctx context.Context) (token string, expiresOn time.Time, err error)
+
+// cachingHTTPTokenSource wraps a fetcher with the caching and invalidation shared by every token source
+type cachingHTTPTokenSource struct {
+	fetch httpTokenFetcher
+
+	mu        sync.Mutex
+	token     string
+	expiresOn time.Time
+	rejected  bool
+}
+
+func (s *cachingHTTPTokenSource) Token(ctx context.Context) (string, error) {
+	// holding the lock while fetching means concurrent chunks share one refresh rather than stampeding the token endpoint
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && !s.rejected && (s.expiresOn.IsZero() || time.Until(s.expiresOn) > httpTokenRefreshMargin) {
+		return s.token, nil
+	}
+
+	token, expiresOn, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	if token == "" {
+		return "", errors.New("the token source returned an empty token")
+	}
+
+	s.token, s.expiresOn, s.rejected = token, expiresOn, false
+	return token, nil
+}
+
+func (s *cachingHTTPTokenSource) Invalidate(rejected string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// if another request already replaced the rejected token, there's nothing to do
+	if rejected == s.token {
+		s.rejected = true
+	}
+}
+
+// staticHTTPTokenSource always hands out the same token, e.g. one given with --bearer-token
+type staticHTTPTokenSource string
+
+func NewStaticHTTPTokenSource(token string) HTTPTokenSource {
+	return staticHTTPTokenSource(token)
+}
+
+func (s staticHTTPTokenSource) Token(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+func (s staticHTTPTokenSource) Invalidate(rejected string) {
+	// nothing to refresh
+}
+
+// NewFileHTTPTokenSource reads the token from a file, which is expected to be rewritten by some other process
+// (e.g. a sidecar or a cron job) before the token in it expires. The file is read again once the token
+// expires (if it is a JWT) or is rejected by the server.
+func NewFileHTTPTokenSource(path string) HTTPTokenSource {
+	return &cachingHTTPTokenSource{
+		fetch: func(ctx context.Context) (string, time.Time, error) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", time.Time{}, fmt.Errorf("failed to read bearer token file: %w", err)
+			}
+
+			token := strings.TrimSpace(string(data))
+			return token, jwtExpiry(token), nil
+		},
+	}
+}
+
+// NewCommandHTTPTokenSource runs a shell command to get a token. The command prints either the bare token,
+// or a JSON object with access_token and, optionally, expires_in (seconds) or expires_on (Unix time or RFC 3339).
+func NewCommandHTTPTokenSource(command string) HTTPTokenSource {
+	return &cachingHTTPTokenSource{
+		fetch: func(ctx context.Context) (string, time.Time, error) {
+			ctx, cancel := context.WithTimeout(ctx, httpTokenCommandTimeout)
+			defer cancel()
+
+			var cmd *exec.Cmd
+			if runtime.GOOS == "windows" {
+				cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+			} else {
+				cmd = exec.CommandContext(ctx, "sh", "-c", command)
+			}
+
+			var stdout, stderr bytes.Buffer
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				// stderr, unlike stdout, shouldn't be carrying the token
+				return "", time.Time{}, fmt.Errorf("bearer token command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+			}
+
+			output := bytes.TrimSpace(stdout.Bytes())
+			if len(output) > 0 && output[0] == '{' {
+				return parseHTTPTokenResponse(output)
+			}
+
+			token := string(output)
+			return token, jwtExpiry(token), nil
+		},
+	}
+}
+
+// NewClientCredentialsHTTPTokenSource gets tokens from an OAuth 2.0 token endpoint with the client credentials grant (RFC 6749 section 4.4).
+func NewClientCredentialsHTTPTokenSource(tokenURL, clientID, clientSecret, scope string) HTTPTokenSource {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+		},
+	}
+
+	return &cachingHTTPTokenSource{
+		fetch: func(ctx context.Context) (string, time.Time, error) {
+			form := url.Values{"grant_type": {"client_credentials"}}
+			if scope != "" {
+				form.Set("scope", scope)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+			if err != nil {
+				return "", time.Time{}, fmt.Errorf("failed to create token request: %w", err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Accept", "application/json")
+			// client_secret_basic, which every authorization server must support (RFC 6749 section 2.3.1)
+			req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+
+			resp, err := client.Do(req)
+			if err != nil {
+				return "", time.Time{}, fmt.Errorf("token request failed: %w", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+			if err != nil {
+				return "", time.Time{}, fmt.Errorf("failed to read token response: %w", err)
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				var oauthErr struct {
+					Error            string `json:"error"`
+					ErrorDescription string `json:"error_description"`
+				}
+				if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+					return "", time.Time{}, fmt.Errorf("token endpoint returned status %d: %s: %s", resp.StatusCode, oauthErr.Error, oauthErr.ErrorDescription)
+				}
+				return "", time.Time{}, fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, resp.Status)
+			}
+
+			return parseHTTPTokenResponse(body)
+		},
+	}
+}
+
+// parseHTTPTokenResponse reads an OAuth 2.0 style token response.
+// expires_in and expires_on may be numbers or strings, as various identity providers disagree on that.
+func parseHTTPTokenResponse(body []byte) (string, time.Time, error) {
+	var response struct {
+		AccessToken string          `json:"access_token"`
+		ExpiresIn   json.RawMessage `json:"expires_in"`
+		ExpiresOn   json.RawMessage `json:"expires_on"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if response.AccessToken == "" {
+		return "", time.Time{}, errors.New("token response has no access_token")
+	}
+
+	unquote := func(raw json.RawMessage) string {
+		return strings.Trim(strings.TrimSpace(string(raw)), `"`)
+	}
+
+	if seconds, err := strconv.ParseInt(unquote(response.ExpiresIn), 10, 64); err == nil && seconds > 0 {
+		return response.AccessToken, time.Now().Add(time.Duration(seconds) * time.Second), nil
+	}
+	if expiresOn := unquote(response.ExpiresOn); expiresOn != "" {
+		if unix, err := strconv.ParseInt(expiresOn, 10, 64); err == nil && unix > 0 {
+			return response.AccessToken, time.Unix(unix, 0), nil
+		}
+		if t, err := time.Parse(time.RFC3339, expiresOn); err == nil {
+			return response.AccessToken, t, nil
+		}
+	}
+
+	return response.AccessToken, jwtExpiry(response.AccessToken), nil
+}
+
+// jwtExpiry returns the exp claim of a JWT, or the zero time if the token isn't one
+func jwtExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if json.Unmarshal(payload, &claims) != nil {
+		return time.Time{}
+	}
+
+	exp, err := strconv.ParseFloat(string(claims.Exp), 64)
+	if err != nil || exp <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(exp), 0)
+}
+
+var httpTokenSourceOnce sync.Once
+var httpTokenSource HTTPTokenSource
+var httpTokenSourceErr error
+
+// SetHTTPTokenSource makes source the token source for every HTTP request of this process,
+// in place of whatever the environment configures. It must be called before the first GetHTTPTokenSource.
+func SetHTTPTokenSource(source HTTPTokenSource) {
+	httpTokenSourceOnce.Do(func() {})
+	httpTokenSource, httpTokenSourceErr = source, nil
+}
+
+// GetHTTPTokenSource returns the token source shared by the traversers and the transfer engine,
+// so that every request of the job benefits from a single refresh. It is nil when HTTP requests go out unauthenticated.
+// Since it's configured through the environment, it's also available when a job is resumed, and secrets never end up in plan files.
+func GetHTTPTokenSource() (HTTPTokenSource, error) {
+	httpTokenSourceOnce.Do(func() {
+		httpTokenSource, httpTokenSourceErr = NewHTTPTokenSourceFromEnvironment()
+	})
+
+	return httpTokenSource, httpTokenSourceErr
+}
+
+// NewHTTPTokenSourceFromEnvironment builds the token source configured through the AZCOPY_HTTP_* environment variables, if any
+func NewHTTPTokenSourceFromEnvironment() (HTTPTokenSource, error) {
+	tokenFile := GetEnvironmentVariable(EEnvironmentVariable.HTTPTokenFile())
+	tokenCommand := GetEnvironmentVariable(EEnvironmentVariable.HTTPTokenCommand())
+	tokenURL := GetEnvironmentVariable(EEnvironmentVariable.HTTPTokenURL())
+
+	configured := 0
+	for _, v := range []string{tokenFile, tokenCommand, tokenURL} {
+		if v != "" {
+			configured++
+		}
+	}
+	if configured > 1 {
+		return nil, fmt.Errorf("only one of %s, %s and %s can be set",
+			EEnvironmentVariable.HTTPTokenFile().Name, EEnvironmentVariable.HTTPTokenCommand().Name, EEnvironmentVariable.HTTPTokenURL().Name)
+	}
+
+	switch {
+	case tokenFile != "":
+		return NewFileHTTPTokenSource(tokenFile), nil
+	case tokenCommand != "":
+		return NewCommandHTTPTokenSource(tokenCommand), nil
+	case tokenURL != "":
+		clientID := GetEnvironmentVariable(EEnvironmentVariable.HTTPClientID())
+		clientSecret := GetEnvironmentVariable(EEnvironmentVariable.HTTPClientSecret())
+		if clientID == "" || clientSecret == "" {
+			return nil, fmt.Errorf("%s and %s must be set along with %s",
+				EEnvironmentVariable.HTTPClientID().Name, EEnvironmentVariable.HTTPClientSecret().Name, EEnvironmentVariable.HTTPTokenURL().Name)
+		}
+		return NewClientCredentialsHTTPTokenSource(tokenURL, clientID, clientSecret, GetEnvironmentVariable(EEnvironmentVariable.HTTPTokenScope())), nil
+	}
+
+	return nil, nil
+}
+
+// AuthorizeHTTPRequest sets the Authorization header of req from source, which may be nil.
+// It returns the token used, so that it can be invalidated if the server rejects it.
+func AuthorizeHTTPRequest(req *http.Request, source HTTPTokenSource) (string, error) {
+	if source == nil {
+		return "", nil
+	}
+
+	token, err := source.Token(req.Context())
+	if err != nil {
+		return "", fmt.Errorf("failed to get bearer token: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return token, nil
+}
+
+// httpTokenPolicy authorizes pipeline requests with tokens from an HTTPTokenSource
+type httpTokenPolicy struct {
+	source HTTPTokenSource
+}
+
+// NewHTTPTokenPolicy returns a per-retry policy that authorizes requests with tokens from source.
+// If the server answers 401, the token is invalidated and the request is sent once more with a fresh one.
+func NewHTTPTokenPolicy(source HTTPTokenSource) policy.Policy {
+	return httpTokenPolicy{source: source}
+}
+
+func (p httpTokenPolicy) Do(req *policy.Request) (*http.Response, error) {
+	token, err := AuthorizeHTTPRequest(req.Raw(), p.source)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := req.Next()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// The token most likely expired mid-transfer
+	p.source.Invalidate(token)
+	if req.RewindBody() != nil {
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if _, err = AuthorizeHTTPRequest(req.Raw(), p.source); err != nil {
+		return nil, err
+	}
+	return req.Next()
+}
@@ -0,0 +1,294 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeTestJWT builds an unsigned JWT expiring at exp
+func makeTestJWT(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"azcopy","exp":%d}`, exp.Unix())))
+	return "eyJhbGciOiJub25lIn0." + payload + ".sig"
+}
+
+func TestHTTPTokenSource_CachesUntilExpiry(t *testing.T) {
+	a := assert.New(t)
+
+	var fetches int32
+	expiresOn := time.Now().Add(time.Hour)
+	source := &cachingHTTPTokenSource{
+		fetch: func(ctx context.Context) (string, time.Time, error) {
+			n := atomic.AddInt32(&fetches, 1)
+			return fmt.Sprintf("token-%d", n), expiresOn, nil
+		},
+	}
+
+	token, err := source.Token(context.Background())
+	a.NoError(err)
+	a.Equal("token-1", token)
+
+	token, err = source.Token(context.Background())
+	a.NoError(err)
+	a.Equal("token-1", token)
+	a.EqualValues(1, fetches)
+
+	// a token within the refresh margin of its expiry is replaced before use
+	expiresOn = time.Now().Add(httpTokenRefreshMargin / 2)
+	source.expiresOn = expiresOn
+	token, err = source.Token(context.Background())
+	a.NoError(err)
+	a.Equal("token-2", token)
+}
+
+func TestHTTPTokenSource_Invalidate(t *testing.T) {
+	a := assert.New(t)
+
+	var fetches int32
+	source := &cachingHTTPTokenSource{
+		fetch: func(ctx context.Context) (string, time.Time, error) {
+			n := atomic.AddInt32(&fetches, 1)
+			return fmt.Sprintf("token-%d", n), time.Time{}, nil
+		},
+	}
+
+	token, _ := source.Token(context.Background())
+	a.Equal("token-1", token)
+
+	// rejecting a token that has already been replaced doesn't trigger another refresh
+	source.Invalidate("token-0")
+	token, _ = source.Token(context.Background())
+	a.Equal("token-1", token)
+
+	source.Invalidate("token-1")
+	token, _ = source.Token(context.Background())
+	a.Equal("token-2", token)
+
+	source.Invalidate("token-1")
+	token, _ = source.Token(context.Background())
+	a.Equal("token-2", token)
+	a.EqualValues(2, fetches)
+}
+
+func TestHTTPTokenSource_File(t *testing.T) {
+	a := assert.New(t)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	a.NoError(os.WriteFile(tokenFile, []byte("first-token\n"), 0600))
+
+	source := NewFileHTTPTokenSource(tokenFile)
+	token, err := source.Token(context.Background())
+	a.NoError(err)
+	a.Equal("first-token", token)
+
+	// the file isn't read again until the token is rejected
+	a.NoError(os.WriteFile(tokenFile, []byte("second-token"), 0600))
+	token, _ = source.Token(context.Background())
+	a.Equal("first-token", token)
+
+	source.Invalidate("first-token")
+	token, err = source.Token(context.Background())
+	a.NoError(err)
+	a.Equal("second-token", token)
+
+	// or until the JWT in it expires
+	expiring := makeTestJWT(time.Now().Add(time.Minute))
+	a.NoError(os.WriteFile(tokenFile, []byte(expiring), 0600))
+	source.Invalidate("second-token")
+	token, _ = source.Token(context.Background())
+	a.Equal(expiring, token)
+
+	a.NoError(os.WriteFile(tokenFile, []byte("third-token"), 0600))
+	token, _ = source.Token(context.Background())
+	a.Equal("third-token", token)
+
+	_, err = NewFileHTTPTokenSource(filepath.Join(t.TempDir(), "missing")).Token(context.Background())
+	a.Error(err)
+}
+
+func TestHTTPTokenSource_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands below assume a POSIX shell")
+	}
+	a := assert.New(t)
+
+	token, err := NewCommandHTTPTokenSource("echo raw-token").Token(context.Background())
+	a.NoError(err)
+	a.Equal("raw-token", token)
+
+	source := NewCommandHTTPTokenSource(`echo '{"access_token":"json-token","expires_in":"3600"}'`).(*cachingHTTPTokenSource)
+	token, err = source.Token(context.Background())
+	a.NoError(err)
+	a.Equal("json-token", token)
+	a.WithinDuration(time.Now().Add(time.Hour), source.expiresOn, time.Minute)
+
+	_, err = NewCommandHTTPTokenSource("echo oops >&2; exit 3").Token(context.Background())
+	a.Error(err)
+	a.Contains(err.Error(), "oops")
+}
+
+func TestHTTPTokenSource_ClientCredentials(t *testing.T) {
+	a := assert.New(t)
+
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the credentials are form-encoded before going into the Basic header
+		clientID, secret, ok := r.BasicAuth()
+		secret, _ = url.QueryUnescape(secret)
+		if !ok || clientID != "my-client" || secret != "s3cret%" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"bad secret"}`))
+			return
+		}
+
+		a.Equal("client_credentials", r.FormValue("grant_type"))
+		a.Equal("artifacts.read", r.FormValue("scope"))
+
+		n := atomic.AddInt32(&issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":"cc-token-%d","token_type":"Bearer","expires_in":3600}`, n)
+	}))
+	defer server.Close()
+
+	source := NewClientCredentialsHTTPTokenSource(server.URL, "my-client", "s3cret%", "artifacts.read")
+	token, err := source.Token(context.Background())
+	a.NoError(err)
+	a.Equal("cc-token-1", token)
+
+	token, _ = source.Token(context.Background())
+	a.Equal("cc-token-1", token)
+
+	source.Invalidate("cc-token-1")
+	token, _ = source.Token(context.Background())
+	a.Equal("cc-token-2", token)
+
+	_, err = NewClientCredentialsHTTPTokenSource(server.URL, "my-client", "wrong", "").Token(context.Background())
+	a.Error(err)
+	a.Contains(err.Error(), "invalid_client")
+}
+
+func TestParseHTTPTokenResponse(t *testing.T) {
+	a := assert.New(t)
+
+	_, expiresOn, err := parseHTTPTokenResponse([]byte(`{"access_token":"t","expires_on":1700000000}`))
+	a.NoError(err)
+	a.Equal(time.Unix(1700000000, 0), expiresOn)
+
+	_, expiresOn, err = parseHTTPTokenResponse([]byte(`{"access_token":"t","expires_on":"2030-01-02T03:04:05Z"}`))
+	a.NoError(err)
+	a.Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC), expiresOn.UTC())
+
+	_, expiresOn, err = parseHTTPTokenResponse([]byte(`{"access_token":"t"}`))
+	a.NoError(err)
+	a.True(expiresOn.IsZero())
+
+	_, _, err = parseHTTPTokenResponse([]byte(`{"token_type":"Bearer"}`))
+	a.Error(err)
+	_, _, err = parseHTTPTokenResponse([]byte(`not json`))
+	a.Error(err)
+}
+
+func TestJWTExpiry(t *testing.T) {
+	a := assert.New(t)
+
+	exp := time.Unix(2000000000, 0)
+	a.Equal(exp, jwtExpiry(makeTestJWT(exp)))
+	a.True(jwtExpiry("opaque-token").IsZero())
+	a.True(jwtExpiry("a.!!!.c").IsZero())
+}
+
+func TestNewHTTPPipeline_RefreshesRejectedToken(t *testing.T) {
+	a := assert.New(t)
+
+	// the server only accepts even tokens, as if each odd one had expired, and checks that a body is sent again in full
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == "PROPFIND" && string(body) != "<propfind/>" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token-2" && auth != "Bearer token-4" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var fetches int32
+	source := &cachingHTTPTokenSource{
+		fetch: func(ctx context.Context) (string, time.Time, error) {
+			n := atomic.AddInt32(&fetches, 1)
+			return fmt.Sprintf("token-%d", n), time.Time{}, nil
+		},
+	}
+
+	pipeline, err := NewHTTPPipeline(server.URL, &azcore.ClientOptions{Transport: server.Client()}, source)
+	a.NoError(err)
+	req, err := azruntime.NewRequest(context.Background(), http.MethodHead, server.URL)
+	a.NoError(err)
+
+	resp, err := pipeline.Do(req)
+	a.NoError(err)
+	a.Equal(http.StatusOK, resp.StatusCode)
+	a.EqualValues(2, requests)
+	a.EqualValues(2, fetches)
+
+	// a request with a body is retried with the body rewound
+	source.Invalidate("token-2")
+	req, err = azruntime.NewRequest(context.Background(), "PROPFIND", server.URL)
+	a.NoError(err)
+	a.NoError(req.SetBody(streaming.NopCloser(strings.NewReader("<propfind/>")), "application/xml"))
+	resp, err = pipeline.Do(req)
+	a.NoError(err)
+	a.Equal(http.StatusOK, resp.StatusCode)
+	a.EqualValues(4, requests)
+	a.EqualValues(4, fetches)
+
+	// without a token source the request goes out as-is
+	pipeline, err = NewHTTPPipeline(server.URL, &azcore.ClientOptions{Transport: server.Client()}, nil)
+	a.NoError(err)
+	req, err = azruntime.NewRequest(context.Background(), http.MethodHead, server.URL)
+	a.NoError(err)
+	resp, err = pipeline.Do(req)
+	a.NoError(err)
+	a.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
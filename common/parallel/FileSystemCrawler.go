@@ -48,10 +48,14 @@ type DirReader interface {
 // The items in the CrawResult output channel are FileSystemEntry s.
 // For a wrapper that makes this look more like filepath.Walk, see parallel.Walk.
 func CrawlLocalDirectory(ctx context.Context, root string, parallelism int, reader DirReader) <-chan CrawlResult {
+	return crawlLocalDirectory(ctx, root, parallelism, reader, nil)
+}
+
+func crawlLocalDirectory(ctx context.Context, root string, parallelism int, reader DirReader, skipDir func(fullPath string) bool) <-chan CrawlResult {
 	return Crawl(ctx,
 		root,
 		func(dir Directory, enqueueDir func(Directory), enqueueOutput func(DirectoryEntry, error)) error {
-			return enumerateOneFileSystemDirectory(dir, enqueueDir, enqueueOutput, reader)
+			return enumerateOneFileSystemDirectory(dir, enqueueDir, enqueueOutput, reader, skipDir)
 		},
 		parallelism,
 	)
@@ -64,6 +68,12 @@ func CrawlLocalDirectory(ctx context.Context, root string, parallelism int, read
 // 2. If the return value of walkFunc function is not nil, enumeration will always stop, not matter what the type of the error.
 //    (Unlike filepath.WalkFunc, where returning filePath.SkipDir is handled as a special case).
 func Walk(appCtx context.Context, root string, parallelism int, parallelStat bool, walkFn filepath.WalkFunc) {
+	WalkSkippingDirs(appCtx, root, parallelism, parallelStat, nil, walkFn)
+}
+
+// WalkSkippingDirs is Walk, except that the contents of the directories for which skipDir returns true aren't enumerated.
+// walkFn is still called for those directories themselves. skipDir is called concurrently, and may be nil.
+func WalkSkippingDirs(appCtx context.Context, root string, parallelism int, parallelStat bool, skipDir func(fullPath string) bool, walkFn filepath.WalkFunc) {
 	var ctx context.Context
 	var cancel context.CancelFunc
 	signalRootError := func(e error) {
@@ -101,7 +111,7 @@ func Walk(appCtx context.Context, root string, parallelism int, parallelStat boo
 
 	ctx, cancel = context.WithCancel(appCtx)
 	defer cancel()
-	ch := CrawlLocalDirectory(ctx, root, remainingParallelism, reader)
+	ch := crawlLocalDirectory(ctx, root, remainingParallelism, reader, skipDir)
 	for crawlResult := range ch {
 		entry, err := crawlResult.Item()
 		if err == nil {
@@ -123,7 +133,7 @@ func Walk(appCtx context.Context, root string, parallelism int, parallelStat boo
 }
 
 // enumerateOneFileSystemDirectory is an implementation of EnumerateOneDirFunc specifically for the local file system
-func enumerateOneFileSystemDirectory(dir Directory, enqueueDir func(Directory), enqueueOutput func(DirectoryEntry, error), r DirReader) error {
+func enumerateOneFileSystemDirectory(dir Directory, enqueueDir func(Directory), enqueueOutput func(DirectoryEntry, error), r DirReader, skipDir func(fullPath string) bool) error {
 	dirString := dir.(string)
 
 	d, err := os.Open(dirString) // for directories, we don't need a special open with FILE_FLAG_BACKUP_SEMANTICS, because directory opening uses FindFirst which doesn't need that flag. https://blog.differentpla.net/blog/2007/05/25/findfirstfile-and-se_backup_name
@@ -163,7 +173,7 @@ func enumerateOneFileSystemDirectory(dir Directory, enqueueDir func(Directory),
 				continue
 			}
 			isSymlink := childInfo.Mode()&os.ModeSymlink != 0 // for compatibility with filepath.Walk, we do not follow symlinks, but we do enqueue them as output
-			if childInfo.IsDir() && !isSymlink {
+			if childInfo.IsDir() && !isSymlink && (skipDir == nil || !skipDir(childEntry.fullPath)) {
 				enqueueDir(childEntry.fullPath)
 			}
 			enqueueOutput(childEntry, nil)
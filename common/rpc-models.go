@@ -139,6 +139,7 @@ type CopyJobPartOrderRequest struct {
 	CpkOptions                     CpkOptions
 	SetPropertiesFlags             SetPropertiesFlags
 	BlobFSRecursiveDelete          bool
+	SyncHashType                   SyncHashType // the hash a sync compares by, which transfers record for the next sync
 
 	// S2SSourceCredentialType will override CredentialInfo.CredentialType for use on the source.
 	// As a result, CredentialInfo.OAuthTokenInfo may end up being fulfilled even _if_ CredentialInfo.CredentialType is _not_ OAuth.
@@ -199,6 +200,7 @@ type BlobTransferAttributes struct {
 	PreserveLastModifiedTime         bool                  // when downloading, tell engine to set file's timestamp to timestamp of blob
 	PutMd5                           bool                  // when uploading, should we create and PUT Content-MD5 hashes
 	MD5ValidationOption              HashValidationOption  // when downloading, how strictly should we validate MD5 hashes?
+	HTTPChecksumFile                 string                // when downloading from HTTP, the checksum file to validate against, if any
 	BlockSizeInBytes                 int64                 // when uploading/downloading/copying, specify the size of each chunk
 	PutBlobSizeInBytes               int64                 // when uploading, specify the threshold to determine if the blob should be uploaded in a single PUT request
 	DeleteSnapshotsOption            DeleteSnapshotsOption // when deleting, specify what to do with the snapshots
@@ -295,6 +297,7 @@ type ListSyncJobSummaryResponse struct {
 	ListJobSummaryResponse
 	DeleteTotalTransfers     uint32 `json:",string"`
 	DeleteTransfersCompleted uint32 `json:",string"`
+	MoveTransfersCompleted   uint32 `json:",string"`
 }
 
 type ListJobTransfersRequest struct {
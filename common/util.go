@@ -12,6 +12,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	blobservice "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
@@ -222,11 +223,61 @@ func GetServiceClientForLocation(loc Location,
 		ret.fsc = fsc
 		return ret, nil
 
+	case ELocation.Http(), ELocation.WebDAV():
+		// There's no SDK client for a generic HTTP or WebDAV server, but its requests go through the same policies as the storage services
+		tokenSource, err := GetHTTPTokenSource()
+		if err != nil {
+			return nil, err
+		}
+
+		hpl, err := NewHTTPPipeline(resourceURL, policyOptions, tokenSource)
+		if err != nil {
+			return nil, err
+		}
+		ret.hpl = &hpl
+		return ret, nil
+
 	default:
 		return nil, nil
 	}
 }
 
+// NewHTTPPipeline builds a pipeline for requests against generic HTTP servers from the same client options
+// (retries, logging, stats, transport) used for the storage services. Requests are authorized by tokenSource, which may be nil,
+// or else answer Basic and Digest challenges with the password source configured for the server of resourceURL. Any client
+// certificate or CA bundle configured for HTTP sources applies to a copy of the transport, leaving the storage services' own untouched.
+func NewHTTPPipeline(resourceURL string, policyOptions *azcore.ClientOptions, tokenSource HTTPTokenSource) (azruntime.Pipeline, error) {
+	var plOptions azruntime.PipelineOptions
+	if tokenSource != nil {
+		plOptions.PerRetry = append(plOptions.PerRetry, NewHTTPTokenPolicy(tokenSource))
+	}
+
+	passwordSource, err := GetHTTPPasswordSource(resourceURL)
+	if err != nil {
+		return azruntime.Pipeline{}, err
+	}
+	if passwordSource != nil {
+		plOptions.PerRetry = append(plOptions.PerRetry, NewHTTPPasswordPolicy(passwordSource))
+	}
+
+	tlsConfig, err := GetHTTPTLSConfig()
+	if err != nil {
+		return azruntime.Pipeline{}, err
+	}
+	if tlsConfig != nil {
+		options := azcore.ClientOptions{}
+		if policyOptions != nil {
+			options = *policyOptions
+		}
+		if options.Transport, err = withHTTPTLSConfig(options.Transport, tlsConfig); err != nil {
+			return azruntime.Pipeline{}, err
+		}
+		policyOptions = &options
+	}
+
+	return azruntime.NewPipeline("azcopy", AzcopyVersion, plOptions, policyOptions), nil
+}
+
 // NewScopedCredential takes in a credInfo object and returns ScopedCredential
 // if credentialType is either MDOAuth or oAuth. For anything else,
 // nil is returned
@@ -266,6 +317,7 @@ type ServiceClient struct {
 	fsc *fileservice.Client
 	bsc *blobservice.Client
 	dsc *datalake.Client
+	hpl *azruntime.Pipeline
 }
 
 func (s *ServiceClient) BlobServiceClient() (*blobservice.Client, error) {
@@ -289,6 +341,13 @@ func (s *ServiceClient) DatalakeServiceClient() (*datalake.Client, error) {
 	return s.dsc, nil
 }
 
+func (s *ServiceClient) HTTPPipeline() (*azruntime.Pipeline, error) {
+	if s == nil || s.hpl == nil {
+		return nil, ErrInvalidClient("HTTP")
+	}
+	return s.hpl, nil
+}
+
 // This is currently used only in testcases
 func NewServiceClient(bsc *blobservice.Client,
 	fsc *fileservice.Client,
@@ -213,7 +213,10 @@ func ResumeJobOrder(req common.ResumeJobRequest) common.CancelPauseResumeRespons
 			common.EFromTo.LocalFile(),
 			common.EFromTo.LocalFileNFS(),
 			common.EFromTo.S3Blob(),
-			common.EFromTo.GCPBlob():
+			common.EFromTo.GCPBlob(),
+			common.EFromTo.HttpBlob(),
+			common.EFromTo.WebDAVBlob(),
+			common.EFromTo.WebDAVFile():
 			if len(req.DestinationSAS) == 0 {
 				errorMsg = "The destination-sas switch must be provided to resume the job"
 			}
@@ -13,7 +13,7 @@ import (
 // dataSchemaVersion defines the data schema version of JobPart order files supported by
 // current version of azcopy
 // To be Incremented every time when we release azcopy with changed dataSchema
-const DataSchemaVersion common.Version = 19
+const DataSchemaVersion common.Version = 21
 
 const (
 	CustomHeaderMaxBytes = 256
@@ -90,6 +90,9 @@ type JobPartPlanHeader struct {
 	S2SInvalidMetadataHandleOption common.InvalidMetadataHandleOption
 	// BlobFSRecursiveDelete represents whether the user wants to make a recursive call to the DFS endpoint or not
 	BlobFSRecursiveDelete bool
+	// SyncHashType is the hash a sync compares by. Uploads record it in the destination's metadata,
+	// and downloads record the source's alongside the local file.
+	SyncHashType common.SyncHashType
 
 	// Any fields below this comment are NOT constants; they may change over as the job part is processed.
 	// Care must be taken to read/write to these fields in a thread-safe way!
@@ -340,6 +343,12 @@ type JobPartPlanDstLocal struct {
 
 	// says how MD5 verification failures should be actioned
 	MD5VerificationOption common.HashValidationOption
+
+	// Specifies the length of the checksum file HTTP downloads are validated against
+	HTTPChecksumFileLength uint16
+
+	// Specifies the checksum file HTTP downloads are validated against, if any (see common.ChecksumFileURL for how it is located)
+	HTTPChecksumFile [1000]byte
 }
 
 // //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -118,6 +118,9 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 	if len(order.BlobAttributes.BlobTagsString) > len(JobPartPlanDstBlob{}.BlobTags) {
 		panic(fmt.Errorf("blob tags string is too large: %q", order.BlobAttributes.BlobTagsString))
 	}
+	if len(order.BlobAttributes.HTTPChecksumFile) > len(JobPartPlanDstLocal{}.HTTPChecksumFile) {
+		panic(fmt.Errorf("checksum file string is too large: %q", order.BlobAttributes.HTTPChecksumFile))
+	}
 
 	// This nested function writes a structure value to an io.Writer & returns the number of bytes written
 	writeValue := func(writer io.Writer, v interface{}) int64 {
@@ -213,6 +216,7 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 		DstLocalData: JobPartPlanDstLocal{
 			PreserveLastModifiedTime: order.BlobAttributes.PreserveLastModifiedTime,
 			MD5VerificationOption:    order.BlobAttributes.MD5ValidationOption, // here because it relates to downloads (file destination)
+			HTTPChecksumFileLength:   uint16(len(order.BlobAttributes.HTTPChecksumFile)),
 		},
 		PreservePermissions:     order.PreservePermissions,
 		PreserveInfo:            order.PreserveInfo,
@@ -223,6 +227,7 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 		S2SInvalidMetadataHandleOption: order.S2SInvalidMetadataHandleOption,
 		DestLengthValidation:           order.DestLengthValidation,
 		BlobFSRecursiveDelete:          order.BlobFSRecursiveDelete,
+		SyncHashType:                   order.SyncHashType,
 		atomicJobStatus:                common.EJobStatus.InProgress(), // We default to InProgress
 		DeleteSnapshotsOption:          order.BlobAttributes.DeleteSnapshotsOption,
 		PermanentDeleteOption:          order.BlobAttributes.PermanentDeleteOption,
@@ -246,6 +251,7 @@ func (jpfn JobPartPlanFileName) Create(order common.CopyJobPartOrderRequest) {
 	copy(jpph.DstBlobData.Metadata[:], order.BlobAttributes.Metadata)
 	copy(jpph.DstBlobData.BlobTags[:], order.BlobAttributes.BlobTagsString)
 	copy(jpph.DstBlobData.CpkScopeInfo[:], order.CpkOptions.CpkScopeInfo)
+	copy(jpph.DstLocalData.HTTPChecksumFile[:], order.BlobAttributes.HTTPChecksumFile)
 
 	eof += writeValue(file, &jpph)
 
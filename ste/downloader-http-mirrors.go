@@ -0,0 +1,318 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+const (
+	// a mirror whose requests fail this many times in a row is no longer used
+	httpMirrorMaxConsecutiveFailures = 3
+	// how many chunks a mirror must have served before its speed is judged
+	httpMirrorMinChunksForSpeed = 4
+	// a mirror this many times slower than the fastest is no longer used
+	httpMirrorSlownessFactor = 4
+)
+
+// httpMirror is one of the URLs a file can be downloaded from
+type httpMirror struct {
+	url  string
+	etag string // sent in If-Match, since every server has its own
+
+	inFlight            int
+	consecutiveFailures int
+	chunks              int
+	bytes               int64
+	elapsed             time.Duration
+	dropped             bool
+}
+
+// throughput is in bytes per second, or zero while there's too little to go on
+func (m *httpMirror) throughput() float64 {
+	if m.chunks < httpMirrorMinChunksForSpeed || m.elapsed <= 0 {
+		return 0
+	}
+	return float64(m.bytes) / m.elapsed.Seconds()
+}
+
+// preferredTo is true if m should serve the next chunk rather than other
+func (m *httpMirror) preferredTo(other *httpMirror) bool {
+	if m.inFlight != other.inFlight {
+		return m.inFlight < other.inFlight
+	}
+
+	// share the chunks out evenly until the speed of both is known
+	if m.throughput() == 0 || other.throughput() == 0 {
+		return m.chunks < other.chunks
+	}
+	return m.throughput() > other.throughput()
+}
+
+// httpMirrorSet spreads the chunks of a download across mirrors serving the same file, the way metalink clients do.
+// Each chunk goes to the mirror with the fewest requests in flight; ties go to the faster one, once the speed of each is known.
+// Mirrors that keep failing, or that are much slower than the fastest, are dropped; the last one never is.
+type httpMirrorSet struct {
+	mu      sync.Mutex
+	mirrors []*httpMirror
+	logDrop func(m *httpMirror, reason string)
+}
+
+func newHTTPMirrorSet(mirrors []*httpMirror, logDrop func(m *httpMirror, reason string)) *httpMirrorSet {
+	return &httpMirrorSet{mirrors: mirrors, logDrop: logDrop}
+}
+
+// pick chooses the mirror for the next request, skipping those already tried for it. It is nil if there's none left to try.
+func (s *httpMirrorSet) pick(tried []*httpMirror) *httpMirror {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var best *httpMirror
+	for _, m := range s.mirrors {
+		if m.dropped || containsHTTPMirror(tried, m) {
+			continue
+		}
+		if best == nil || m.preferredTo(best) {
+			best = m
+		}
+	}
+
+	if best != nil {
+		best.inFlight++
+	}
+	return best
+}
+
+// succeeded records that m served bytes in elapsed, and drops any mirror that has proven much slower than the fastest
+func (s *httpMirrorSet) succeeded(m *httpMirror, bytes int64, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.inFlight--
+	m.consecutiveFailures = 0
+	m.chunks++
+	m.bytes += bytes
+	m.elapsed += elapsed
+
+	fastest := 0.0
+	for _, other := range s.mirrors {
+		if !other.dropped && other.throughput() > fastest {
+			fastest = other.throughput()
+		}
+	}
+	for _, other := range s.mirrors {
+		if speed := other.throughput(); !other.dropped && speed > 0 && speed*httpMirrorSlownessFactor < fastest {
+			s.drop(other, fmt.Sprintf("it is more than %d times slower than the fastest mirror", httpMirrorSlownessFactor))
+		}
+	}
+}
+
+// failed records that a request to m failed, and drops m if that keeps happening
+func (s *httpMirrorSet) failed(m *httpMirror, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.inFlight--
+	m.consecutiveFailures++
+	if m.consecutiveFailures >= httpMirrorMaxConsecutiveFailures {
+		s.drop(m, fmt.Sprintf("%d requests in a row failed, most recently with: %s", m.consecutiveFailures, err))
+	}
+}
+
+// released records that a request to m ended without telling anything about it, e.g. because the transfer was cancelled
+func (s *httpMirrorSet) released(m *httpMirror) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.inFlight--
+}
+
+// drop stops using m, unless it's the only mirror left. s.mu must be held.
+func (s *httpMirrorSet) drop(m *httpMirror, reason string) {
+	if m.dropped {
+		return
+	}
+
+	live := 0
+	for _, other := range s.mirrors {
+		if !other.dropped {
+			live++
+		}
+	}
+	if live <= 1 {
+		return
+	}
+
+	m.dropped = true
+	if s.logDrop != nil {
+		s.logDrop(m, reason)
+	}
+}
+
+// get requests length bytes starting at offset from a mirror, moving on to the next one should a mirror fail.
+// The mirror that answered must be reported as having succeeded, failed or been released once the body has been read.
+func (s *httpMirrorSet) get(ctx context.Context, hd *httpDownloader, offset, length int64) (*http.Response, *httpMirror, error) {
+	var tried []*httpMirror
+	var lastErr error
+
+	for {
+		m := s.pick(tried)
+		if m == nil {
+			return nil, nil, lastErr
+		}
+
+		resp, err := hd.getFrom(ctx, m.url, m.etag, offset, length)
+		if err == nil {
+			return resp, m, nil
+		}
+
+		if ctx.Err() != nil {
+			s.released(m)
+			return nil, nil, err
+		}
+		s.failed(m, err)
+		tried = append(tried, m)
+		lastErr = err
+	}
+}
+
+func containsHTTPMirror(mirrors []*httpMirror, m *httpMirror) bool {
+	for _, other := range mirrors {
+		if other == m {
+			return true
+		}
+	}
+	return false
+}
+
+// probeMirrors sets up the download to use the mirrors recorded with the transfer, keeping only those that serve the same content.
+// Mirrors must support range requests and report the same size as the source. When the download is validated against a digest,
+// any digest a mirror advertises must match; otherwise, there being nothing else to catch a mirror serving another version of the file,
+// its ETag must match the source's.
+func (hd *httpDownloader) probeMirrors(jptm IJobPartTransferMgr) {
+	urls := common.GetHTTPMirrors(jptm.Info().SrcMetadata)
+	if len(urls) == 0 {
+		return
+	}
+	if !hd.supportsRange {
+		jptm.LogAtLevelForCurrentTransfer(common.LogWarning, "the source does not support range requests, so it is downloaded without its mirrors")
+		return
+	}
+
+	// a checksum file that doesn't list the file leaves only the response headers, which may have no digest at all
+	var digest common.Digest
+	if jptm.MD5ValidationOption() != common.EHashValidationOption.NoCheck() {
+		var err error
+		if digest, err = hd.ExpectedDigest(jptm); err != nil {
+			jptm.LogAtLevelForCurrentTransfer(common.LogWarning, fmt.Sprintf("the source is downloaded without its mirrors, since looking up its digest failed: %s", err))
+			return
+		}
+	}
+
+	probed := make([]*httpMirror, len(urls))
+	var wg sync.WaitGroup
+	for i, mirrorURL := range urls {
+		wg.Add(1)
+		go func(i int, mirrorURL string) {
+			defer wg.Done()
+
+			m, err := hd.probeMirror(jptm.Context(), mirrorURL, jptm.Info().SourceSize, digest)
+			if err != nil {
+				jptm.LogAtLevelForCurrentTransfer(common.LogWarning, fmt.Sprintf("not downloading from mirror %s: %s",
+					common.URLStringExtension(mirrorURL).RedactSecretQueryParamForLogging(), err))
+				return
+			}
+			probed[i] = m
+		}(i, mirrorURL)
+	}
+	wg.Wait()
+
+	mirrors := []*httpMirror{{url: hd.sourceURL, etag: hd.etag}}
+	for _, m := range probed {
+		if m != nil {
+			mirrors = append(mirrors, m)
+		}
+	}
+	if len(mirrors) == 1 {
+		return
+	}
+
+	jptm.LogAtLevelForCurrentTransfer(common.LogInfo, fmt.Sprintf("downloading from the source and %d mirror(s)", len(mirrors)-1))
+	hd.mirrors = newHTTPMirrorSet(mirrors, func(m *httpMirror, reason string) {
+		jptm.LogAtLevelForCurrentTransfer(common.LogWarning, fmt.Sprintf("no longer downloading from %s, since %s",
+			common.URLStringExtension(m.url).RedactSecretQueryParamForLogging(), reason))
+	})
+}
+
+// probeMirror checks that the mirror at mirrorURL serves the same content as the source, whose digest is empty if the download isn't validated
+func (hd *httpDownloader) probeMirror(ctx context.Context, mirrorURL string, size int64, digest common.Digest) (*httpMirror, error) {
+	req, err := azruntime.NewRequest(ctx, http.MethodHead, mirrorURL)
+	if err != nil {
+		return nil, err
+	}
+	req.Raw().Header.Set("Want-Repr-Digest", common.WantReprDigestHeaderValue)
+
+	resp, err := hd.pipeline.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HEAD request returned status %d: %s", resp.StatusCode, resp.Status)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		return nil, errors.New("it does not support range requests")
+	}
+	if resp.ContentLength != size {
+		return nil, fmt.Errorf("it reports a size of %d bytes, where the source has %d", resp.ContentLength, size)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if digest.IsEmpty() {
+		if hd.etag == "" || etag != hd.etag {
+			return nil, errors.New("its ETag differs from the source's, and there is no digest to validate the download against")
+		}
+		return &httpMirror{url: mirrorURL, etag: etag}, nil
+	}
+
+	advertised, ok := common.ParseDigestHeaders(resp.Header)
+	if !ok {
+		if decoded, err := base64.StdEncoding.DecodeString(resp.Header.Get("Content-MD5")); err == nil && len(decoded) > 0 {
+			advertised, ok = common.NewMD5Digest(decoded), true
+		}
+	}
+	if ok && advertised.Algorithm == digest.Algorithm && !bytes.Equal(advertised.Value, digest.Value) {
+		return nil, fmt.Errorf("its %s digest differs from the one the download is validated against", advertised.Algorithm)
+	}
+
+	return &httpMirror{url: mirrorURL, etag: etag}, nil
+}
@@ -0,0 +1,380 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// mirrorTestTransferManager records the warnings logged about mirrors
+type mirrorTestTransferManager struct {
+	testJobPartTransferManager
+	mu   sync.Mutex
+	logs []string
+}
+
+func (t *mirrorTestTransferManager) MD5ValidationOption() common.HashValidationOption {
+	return common.EHashValidationOption.FailIfDifferent()
+}
+
+func (t *mirrorTestTransferManager) LogAtLevelForCurrentTransfer(level common.LogLevel, msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.logs = append(t.logs, msg)
+}
+
+// newMirrorServer serves content with range support, counting the requests made to it
+func newMirrorServer(content []byte, headers map[string]string, requests *int32) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*requests++
+		mu.Unlock()
+
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+		if _, ok := headers["Accept-Ranges"]; !ok {
+			w.Header().Set("Accept-Ranges", "bytes")
+		}
+		if etag := headers["ETag"]; etag != "" && r.Header.Get("If-Match") != "" && r.Header.Get("If-Match") != etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(content[start : end+1])
+	}))
+}
+
+func TestHTTPMirrorSet(t *testing.T) {
+	t.Run("SpreadsRequests", func(t *testing.T) {
+		a, b := &httpMirror{url: "a"}, &httpMirror{url: "b"}
+		set := newHTTPMirrorSet([]*httpMirror{a, b}, nil)
+
+		assert.Same(t, a, set.pick(nil))
+		assert.Same(t, b, set.pick(nil))
+		assert.Same(t, a, set.pick(nil))
+
+		// a mirror already tried for a request isn't picked for it again
+		assert.Same(t, b, set.pick([]*httpMirror{a}))
+		assert.Nil(t, set.pick([]*httpMirror{a, b}))
+	})
+
+	t.Run("DropsFailingMirrors", func(t *testing.T) {
+		a, b := &httpMirror{url: "a"}, &httpMirror{url: "b"}
+		var dropped []string
+		set := newHTTPMirrorSet([]*httpMirror{a, b}, func(m *httpMirror, reason string) { dropped = append(dropped, m.url) })
+
+		// a success in between resets the count
+		for _, fail := range []bool{true, true, false, true, true} {
+			set.pick(nil)
+			if fail {
+				set.failed(a, errors.New("503"))
+			} else {
+				set.succeeded(a, 10, time.Millisecond)
+			}
+		}
+		assert.False(t, a.dropped)
+
+		set.pick(nil)
+		set.failed(a, errors.New("503"))
+		assert.True(t, a.dropped)
+		assert.Equal(t, []string{"a"}, dropped)
+		assert.Same(t, b, set.pick(nil))
+		assert.Same(t, b, set.pick(nil))
+
+		// the last mirror standing is kept, however often it fails
+		for i := 0; i < 2*httpMirrorMaxConsecutiveFailures; i++ {
+			set.failed(b, errors.New("503"))
+		}
+		assert.False(t, b.dropped)
+	})
+
+	t.Run("DropsSlowMirrors", func(t *testing.T) {
+		fast, slow := &httpMirror{url: "fast"}, &httpMirror{url: "slow"}
+		set := newHTTPMirrorSet([]*httpMirror{fast, slow}, nil)
+
+		for i := 0; i < httpMirrorMinChunksForSpeed; i++ {
+			set.succeeded(fast, 1000, time.Millisecond)
+			assert.False(t, slow.dropped)
+			set.succeeded(slow, 1000, time.Millisecond*httpMirrorSlownessFactor*2)
+		}
+		assert.True(t, slow.dropped)
+		assert.False(t, fast.dropped)
+	})
+}
+
+func TestHTTPDownloader_Mirrors(t *testing.T) {
+	content := []byte(strings.Repeat("mirrored artifact contents ", 40))
+	sha := sha256.Sum256(content)
+	digestHeader := "sha-256=:" + base64.StdEncoding.EncodeToString(sha[:]) + ":"
+	otherSHA := sha256.Sum256([]byte("another version"))
+
+	var sourceRequests, goodRequests, otherETagRequests, shortRequests, staleRequests, noRangeRequests int32
+	source := newMirrorServer(content, map[string]string{"ETag": `"a"`, "Repr-Digest": digestHeader}, &sourceRequests)
+	defer source.Close()
+	good := newMirrorServer(content, map[string]string{"ETag": `"b"`}, &goodRequests)
+	defer good.Close()
+	otherETag := newMirrorServer(content, map[string]string{"ETag": `"c"`, "Repr-Digest": digestHeader}, &otherETagRequests)
+	defer otherETag.Close()
+	short := newMirrorServer(content[1:], nil, &shortRequests)
+	defer short.Close()
+	stale := newMirrorServer(content, map[string]string{"Repr-Digest": "sha-256=:" + base64.StdEncoding.EncodeToString(otherSHA[:]) + ":"}, &staleRequests)
+	defer stale.Close()
+	noRange := newMirrorServer(content, map[string]string{"Accept-Ranges": "none"}, &noRangeRequests)
+	defer noRange.Close()
+
+	sourceURL := source.URL + "/dist/tool.tar.gz"
+	metadata := common.Metadata{}
+	common.SetHTTPMirrors(metadata, []string{
+		good.URL + "/dist/tool.tar.gz",
+		otherETag.URL + "/dist/tool.tar.gz",
+		short.URL + "/dist/tool.tar.gz",
+		stale.URL + "/dist/tool.tar.gz",
+		noRange.URL + "/dist/tool.tar.gz",
+	})
+
+	jptm := &mirrorTestTransferManager{testJobPartTransferManager: testJobPartTransferManager{info: &TransferInfo{Source: sourceURL, SourceSize: int64(len(content)), SrcProperties: SrcProperties{SrcMetadata: metadata}}}}
+	httpDl := &httpDownloader{
+		jptm:      jptm,
+		sourceURL: sourceURL,
+		pipeline:  newTestHTTPPipeline(http.DefaultClient, nil),
+	}
+	assert.NoError(t, httpDl.detectCapabilities(context.Background()))
+	httpDl.probeMirrors(jptm)
+
+	// with a digest to validate against, mirrors needn't share the source's ETag, but must have the same size, digest and range support
+	if assert.NotNil(t, httpDl.mirrors) {
+		var urls []string
+		for _, m := range httpDl.mirrors.mirrors {
+			urls = append(urls, m.url)
+		}
+		assert.Equal(t, []string{sourceURL, good.URL + "/dist/tool.tar.gz", otherETag.URL + "/dist/tool.tar.gz"}, urls)
+	}
+	assert.Len(t, jptm.logs, 4) // one for each mirror left out, and one saying how many are used
+
+	// the chunks are spread across the source and its mirrors, each of which gets its own ETag in If-Match
+	chunkSize := int64(100)
+	var downloaded []byte
+	for offset := int64(0); offset < int64(len(content)); offset += chunkSize {
+		length := chunkSize
+		if remaining := int64(len(content)) - offset; remaining < length {
+			length = remaining
+		}
+
+		resp, mirror, err := httpDl.getChunk(context.Background(), offset, length)
+		if !assert.NoError(t, err) {
+			return
+		}
+		reader := &httpRetryReader{ctx: context.Background(), hd: httpDl, body: resp.Body, mirror: mirror, offset: offset, remaining: length}
+		data, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.NoError(t, reader.Close())
+		downloaded = append(downloaded, data...)
+	}
+	assert.Equal(t, content, downloaded)
+	for _, requests := range []int32{sourceRequests, goodRequests, otherETagRequests} {
+		assert.GreaterOrEqual(t, requests, int32(1+2)) // the HEAD request, and a share of the chunks
+	}
+	assert.Equal(t, int32(1), shortRequests)
+	for _, m := range httpDl.mirrors.mirrors {
+		assert.Zero(t, m.inFlight)
+	}
+}
+
+func TestHTTPDownloader_MirrorsWithoutDigest(t *testing.T) {
+	content := []byte("unvalidated contents")
+
+	var sourceRequests, sameRequests, otherRequests int32
+	source := newMirrorServer(content, map[string]string{"ETag": `"v1"`}, &sourceRequests)
+	defer source.Close()
+	same := newMirrorServer(content, map[string]string{"ETag": `"v1"`}, &sameRequests)
+	defer same.Close()
+	other := newMirrorServer(content, map[string]string{"ETag": `"v2"`}, &otherRequests)
+	defer other.Close()
+
+	metadata := common.Metadata{}
+	common.SetHTTPMirrors(metadata, []string{same.URL + "/file.txt", other.URL + "/file.txt"})
+
+	sourceURL := source.URL + "/file.txt"
+	jptm := &mirrorTestTransferManager{testJobPartTransferManager: testJobPartTransferManager{info: &TransferInfo{Source: sourceURL, SourceSize: int64(len(content)), SrcProperties: SrcProperties{SrcMetadata: metadata}}}}
+	httpDl := &httpDownloader{
+		jptm:      jptm,
+		sourceURL: sourceURL,
+		pipeline:  newTestHTTPPipeline(http.DefaultClient, nil),
+	}
+	assert.NoError(t, httpDl.detectCapabilities(context.Background()))
+	httpDl.probeMirrors(jptm)
+
+	// there's nothing but the ETag to show that a mirror serves the same version of the file
+	if assert.NotNil(t, httpDl.mirrors) {
+		assert.Len(t, httpDl.mirrors.mirrors, 2)
+		assert.Equal(t, same.URL+"/file.txt", httpDl.mirrors.mirrors[1].url)
+	}
+}
+
+func TestHTTPDownloader_MirrorsWithUnlistedChecksum(t *testing.T) {
+	content := []byte("contents the checksum file doesn't cover")
+
+	var sourceRequests, sameRequests, otherRequests int32
+	files := newMirrorServer(content, map[string]string{"ETag": `"v1"`}, &sourceRequests)
+	defer files.Close()
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".sha256") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		files.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer source.Close()
+	same := newMirrorServer(content, map[string]string{"ETag": `"v1"`}, &sameRequests)
+	defer same.Close()
+	other := newMirrorServer(content, map[string]string{"ETag": `"v2"`}, &otherRequests)
+	defer other.Close()
+
+	metadata := common.Metadata{}
+	common.SetHTTPMirrors(metadata, []string{same.URL + "/file.txt", other.URL + "/file.txt"})
+
+	sourceURL := source.URL + "/file.txt"
+	jptm := &mirrorTestTransferManager{testJobPartTransferManager: testJobPartTransferManager{
+		info:             &TransferInfo{Source: sourceURL, SourceSize: int64(len(content)), SrcProperties: SrcProperties{SrcMetadata: metadata}},
+		httpChecksumFile: ".sha256",
+	}}
+	httpDl := &httpDownloader{
+		jptm:      jptm,
+		sourceURL: sourceURL,
+		pipeline:  newTestHTTPPipeline(http.DefaultClient, nil),
+	}
+	assert.NoError(t, httpDl.detectCapabilities(context.Background()))
+	httpDl.probeMirrors(jptm)
+
+	// a checksum file that doesn't list the file leaves no digest, so the ETag must match as if there were no checksum file
+	if assert.NotNil(t, httpDl.mirrors) {
+		assert.Len(t, httpDl.mirrors.mirrors, 2)
+		assert.Equal(t, same.URL+"/file.txt", httpDl.mirrors.mirrors[1].url)
+	}
+}
+
+func TestHTTPRetryReader_TimesOnlyTheRead(t *testing.T) {
+	m := &httpMirror{url: "a"}
+	set := newHTTPMirrorSet([]*httpMirror{m}, nil)
+	set.pick(nil)
+
+	content := "0123456789"
+	reader := &httpRetryReader{ctx: context.Background(), hd: &httpDownloader{mirrors: set}, body: io.NopCloser(strings.NewReader(content)),
+		mirror: m, remaining: int64(len(content))}
+
+	// the reader waits on its consumer, e.g. for the disk to catch up, far longer than it spends reading
+	wait := 20 * time.Millisecond
+	buf := make([]byte, 2)
+	var err error
+	for err == nil {
+		time.Sleep(wait)
+		_, err = reader.Read(buf)
+	}
+	assert.NoError(t, reader.Close())
+
+	assert.Equal(t, 1, m.chunks)
+	assert.Equal(t, int64(len(content)), m.bytes)
+	assert.Less(t, m.elapsed, wait)
+}
+
+func TestHTTPDownloader_MirrorFailover(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 20))
+
+	var sourceRequests int32
+	source := newMirrorServer(content, map[string]string{"ETag": `"v1"`}, &sourceRequests)
+	defer source.Close()
+
+	// the mirror passes the HEAD request, but then refuses to serve any content
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer broken.Close()
+
+	sourceURL := source.URL + "/file.bin"
+	metadata := common.Metadata{}
+	common.SetHTTPMirrors(metadata, []string{broken.URL + "/file.bin"})
+
+	jptm := &mirrorTestTransferManager{testJobPartTransferManager: testJobPartTransferManager{info: &TransferInfo{Source: sourceURL, SourceSize: int64(len(content)), SrcProperties: SrcProperties{SrcMetadata: metadata}}}}
+	httpDl := &httpDownloader{
+		jptm:      jptm,
+		sourceURL: sourceURL,
+		pipeline:  newTestHTTPPipeline(http.DefaultClient, nil),
+	}
+	assert.NoError(t, httpDl.detectCapabilities(context.Background()))
+	httpDl.probeMirrors(jptm)
+	if !assert.NotNil(t, httpDl.mirrors) {
+		return
+	}
+
+	// every chunk is still downloaded, from the source, and the broken mirror is dropped once it has failed often enough
+	var downloaded []byte
+	for offset := int64(0); offset < int64(len(content)); offset += 20 {
+		resp, mirror, err := httpDl.getChunk(context.Background(), offset, 20)
+		if !assert.NoError(t, err) {
+			return
+		}
+		reader := &httpRetryReader{ctx: context.Background(), hd: httpDl, body: resp.Body, mirror: mirror, offset: offset, remaining: 20}
+		data, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		_ = reader.Close()
+		downloaded = append(downloaded, data...)
+	}
+	assert.Equal(t, content, downloaded)
+	assert.True(t, httpDl.mirrors.mirrors[1].dropped)
+	assert.False(t, httpDl.mirrors.mirrors[0].dropped)
+}
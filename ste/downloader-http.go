@@ -23,53 +23,59 @@ package ste
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"path"
+	"sync"
 	"time"
 
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-storage-azcopy/v10/common"
 )
 
 type httpDownloader struct {
-	jptm            IJobPartTransferMgr
-	sourceURL       string
-	httpClient      *http.Client
-	bearerToken     string
-	supportsRange   bool
-	contentLength   int64
-	expectedMD5     []byte
-	etag            string
+	jptm           IJobPartTransferMgr
+	sourceURL      string
+	pipeline       *azruntime.Pipeline
+	detected       bool // whether the HEAD request has been made
+	supportsRange  bool
+	contentLength  int64
+	expectedMD5    []byte
+	expectedDigest common.Digest // the strongest hash advertised in the response headers
+	etag           string
+	lookedUp       bool           // whether the hash to validate against has been settled, which may take a checksum file
+	validateDigest common.Digest  // the hash to validate against, once looked up
+	mirrors        *httpMirrorSet // nil unless the file is also downloaded from mirrors
 }
 
 func newHTTPDownloader(jptm IJobPartTransferMgr) (downloader, error) {
 	info := jptm.Info()
 
-	// Create HTTP client with appropriate timeouts
-	client := &http.Client{
-		Timeout: 30 * time.Minute, // Long timeout for large downloads
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-			IdleConnTimeout:     90 * time.Second,
-			DisableCompression:  true, // Disable to get accurate byte counts
-		},
+	// The pipeline carries the same retry, logging and stats policies as the storage service clients,
+	// and authorizes requests with the job's HTTP token source, if any
+	pipeline, err := jptm.SrcServiceClient().HTTPPipeline()
+	if err != nil {
+		return nil, err
 	}
 
-	// Get bearer token from credential if available
-	// For Phase 3, we'll access it via jptm methods in Prologue
-	// This will be enhanced in Phase 4 with CLI integration
-
 	return &httpDownloader{
-		sourceURL:  info.Source,
-		httpClient: client,
+		sourceURL: info.Source,
+		pipeline:  pipeline,
 	}, nil
 }
 
 func (hd *httpDownloader) Prologue(jptm IJobPartTransferMgr) {
 	hd.jptm = jptm
 
-	// Perform HEAD request to detect server capabilities
-	err := hd.detectCapabilities()
+	// Perform HEAD request to detect server capabilities, unless looking up the expected hash already did
+	var err error
+	if !hd.detected {
+		err = hd.detectCapabilities(jptm.Context())
+	}
 	if err != nil {
 		jptm.LogError(hd.sourceURL, "HEAD request", err)
 		jptm.SetStatus(common.ETransferStatus.Failed())
@@ -84,31 +90,20 @@ func (hd *httpDownloader) Prologue(jptm IJobPartTransferMgr) {
 		jptm.LogError(hd.sourceURL, "Content length validation", err)
 		jptm.SetStatus(common.ETransferStatus.Failed())
 		jptm.ReportTransferDone()
+		return
 	}
+
+	hd.probeMirrors(jptm)
 }
 
 func (hd *httpDownloader) Epilogue() {
-	// Cleanup - HTTP client doesn't need explicit cleanup
+	// Cleanup - the pipeline is shared by the job, so there's nothing to release
 }
 
 // GenerateDownloadFunc returns a chunk function for HTTP downloads
 func (hd *httpDownloader) GenerateDownloadFunc(jptm IJobPartTransferMgr, destWriter common.ChunkedFileWriter, id common.ChunkID, length int64, pacer pacer) chunkFunc {
 	return createDownloadChunkFunc(jptm, id, func() {
-		// Download chunk from HTTP server
-		jptm.LogChunkStatus(id, common.EWaitReason.HeaderResponse())
-
-		// Create range request
-		req, err := http.NewRequestWithContext(jptm.Context(), "GET", hd.sourceURL, nil)
-		if err != nil {
-			jptm.FailActiveDownload("Creating HTTP request", err)
-			return
-		}
-
-		// Add range header if server supports it
-		if hd.supportsRange {
-			rangeHeader := fmt.Sprintf("bytes=%d-%d", id.OffsetInFile(), id.OffsetInFile()+length-1)
-			req.Header.Set("Range", rangeHeader)
-		} else if id.OffsetInFile() > 0 {
+		if !hd.supportsRange && id.OffsetInFile() > 0 {
 			// Server doesn't support range requests but we're trying to download a chunk
 			// This should only happen for the first chunk in single-shot downloads
 			err := fmt.Errorf("server does not support range requests, cannot download chunk at offset %d", id.OffsetInFile())
@@ -116,109 +111,96 @@ func (hd *httpDownloader) GenerateDownloadFunc(jptm IJobPartTransferMgr, destWri
 			return
 		}
 
-		// Add authentication if available
-		if hd.bearerToken != "" {
-			req.Header.Set("Authorization", "Bearer "+hd.bearerToken)
+		// The pipeline encapsulates any retries that may be necessary to get to the point of receiving response headers
+		jptm.LogChunkStatus(id, common.EWaitReason.HeaderResponse())
+		resp, mirror, err := hd.getChunk(jptm.Context(), id.OffsetInFile(), length)
+		if err != nil {
+			jptm.FailActiveDownload("Downloading response body", err) // cancel entire transfer because this chunk has failed
+			return
 		}
 
-		// Add If-Match for consistency (use ETag if available)
-		if hd.etag != "" {
-			req.Header.Set("If-Match", hd.etag)
+		// Enqueue the response body to be written out to disk
+		// The retryReader encapsulates any retries that may be necessary while downloading the body
+		jptm.LogChunkStatus(id, common.EWaitReason.Body())
+		retryReader := &httpRetryReader{
+			ctx:          jptm.Context(),
+			hd:           hd,
+			body:         resp.Body,
+			mirror:       mirror,
+			offset:       id.OffsetInFile(),
+			remaining:    length,
+			maxRetries:   destWriter.MaxRetryPerDownloadBody(),
+			onFailedRead: common.NewBlobReadLogFunc(jptm, hd.sourceURL),
 		}
+		defer retryReader.Close()
+		err = destWriter.EnqueueChunk(jptm.Context(), id, length, newPacedResponseBody(jptm.Context(), retryReader, pacer), true)
+		if err != nil {
+			jptm.FailActiveDownload("Enqueuing chunk", err)
+			return
+		}
+	})
+}
 
-		// Execute request with retries
-		var resp *http.Response
-		retries := 0
-		maxRetries := destWriter.MaxRetryPerDownloadBody()
-
-		for retries <= maxRetries {
-			resp, err = hd.httpClient.Do(req)
-			if err == nil && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent) {
-				break
-			}
+// getChunk requests length bytes starting at offset from the source, or from whichever mirror is best placed to serve them.
+// The mirror is nil when the file has none.
+func (hd *httpDownloader) getChunk(ctx context.Context, offset, length int64) (*http.Response, *httpMirror, error) {
+	if hd.mirrors != nil {
+		return hd.mirrors.get(ctx, hd, offset, length)
+	}
 
-			// Log retry
-			if err != nil {
-				jptm.Log(common.LogWarning, fmt.Sprintf("HTTP request failed (attempt %d/%d): %v", retries+1, maxRetries+1, err))
-			} else {
-				jptm.Log(common.LogWarning, fmt.Sprintf("HTTP request failed with status %d (attempt %d/%d)", resp.StatusCode, retries+1, maxRetries+1))
-				if resp.Body != nil {
-					resp.Body.Close()
-				}
-			}
+	resp, err := hd.get(ctx, offset, length)
+	return resp, nil, err
+}
 
-			retries++
-			if retries <= maxRetries {
-				// Exponential backoff
-				backoff := time.Duration(retries) * time.Second
-				if backoff > 30*time.Second {
-					backoff = 30 * time.Second
-				}
-				time.Sleep(backoff)
-
-				// Recreate request for retry
-				req, err = http.NewRequestWithContext(jptm.Context(), "GET", hd.sourceURL, nil)
-				if err != nil {
-					jptm.FailActiveDownload("Creating HTTP request for retry", err)
-					return
-				}
-				if hd.supportsRange {
-					rangeHeader := fmt.Sprintf("bytes=%d-%d", id.OffsetInFile(), id.OffsetInFile()+length-1)
-					req.Header.Set("Range", rangeHeader)
-				}
-				if hd.bearerToken != "" {
-					req.Header.Set("Authorization", "Bearer "+hd.bearerToken)
-				}
-				if hd.etag != "" {
-					req.Header.Set("If-Match", hd.etag)
-				}
-			}
-		}
+// get requests length bytes starting at offset (or the whole file, if the server doesn't support ranges)
+// and returns the response once its headers have arrived
+func (hd *httpDownloader) get(ctx context.Context, offset, length int64) (*http.Response, error) {
+	return hd.getFrom(ctx, hd.sourceURL, hd.etag, offset, length)
+}
 
-		if err != nil {
-			jptm.FailActiveDownload("Downloading response body", err)
-			return
-		}
+// getFrom is get for a given mirror of the source, which has its own ETag
+func (hd *httpDownloader) getFrom(ctx context.Context, rawURL, etag string, offset, length int64) (*http.Response, error) {
+	req, err := azruntime.NewRequest(ctx, http.MethodGet, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	// the body is streamed to disk, rather than buffered by the pipeline
+	azruntime.SkipBodyDownload(req)
 
-		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
-			resp.Body.Close()
-			err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-			jptm.FailActiveDownload("Downloading response body", err)
-			return
-		}
+	// Add range header if server supports it
+	if hd.supportsRange {
+		req.Raw().Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	}
 
-		defer resp.Body.Close()
+	// Add If-Match for consistency (use ETag if available)
+	if etag != "" {
+		req.Raw().Header.Set("If-Match", etag)
+	}
 
-		// Enqueue the response body to be written to disk
-		jptm.LogChunkStatus(id, common.EWaitReason.Body())
+	resp, err := hd.pipeline.Do(req)
+	if err != nil {
+		return nil, err
+	}
 
-		// Wrap the response body with pacing
-		pacedBody := newPacedResponseBody(jptm.Context(), resp.Body, pacer)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
 
-		err = destWriter.EnqueueChunk(jptm.Context(), id, length, pacedBody, true)
-		if err != nil {
-			jptm.FailActiveDownload("Enqueuing chunk", err)
-			return
-		}
-	})
+	return resp, nil
 }
 
 // detectCapabilities performs HEAD request to detect server capabilities
-func (hd *httpDownloader) detectCapabilities() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "HEAD", hd.sourceURL, nil)
+func (hd *httpDownloader) detectCapabilities(ctx context.Context) error {
+	req, err := azruntime.NewRequest(ctx, http.MethodHead, hd.sourceURL)
 	if err != nil {
 		return fmt.Errorf("failed to create HEAD request: %w", err)
 	}
 
-	// Add authentication
-	if hd.bearerToken != "" {
-		req.Header.Set("Authorization", "Bearer "+hd.bearerToken)
-	}
+	// servers that implement RFC 9530 only send Repr-Digest when asked to
+	req.Raw().Header.Set("Want-Repr-Digest", common.WantReprDigestHeaderValue)
 
-	resp, err := hd.httpClient.Do(req)
+	resp, err := hd.pipeline.Do(req)
 	if err != nil {
 		return fmt.Errorf("HEAD request failed: %w", err)
 	}
@@ -246,12 +228,221 @@ func (hd *httpDownloader) detectCapabilities() error {
 		}
 	}
 
+	// Prefer a digest header, since those can carry stronger hashes than MD5
+	if digest, ok := common.ParseDigestHeaders(resp.Header); ok {
+		hd.expectedDigest = digest
+	} else if len(hd.expectedMD5) > 0 {
+		hd.expectedDigest = common.NewMD5Digest(hd.expectedMD5)
+	}
+
 	// Get ETag for consistency checks
 	hd.etag = resp.Header.Get("ETag")
 
+	hd.detected = true
 	return nil
 }
 
+// ExpectedDigest returns the hash to validate the download against: the one listed in the job's checksum file, if any,
+// or else the strongest one advertised in the response headers. It is empty if there is neither.
+func (hd *httpDownloader) ExpectedDigest(jptm IJobPartTransferMgr) (common.Digest, error) {
+	if !hd.detected {
+		if err := hd.detectCapabilities(jptm.Context()); err != nil {
+			return common.Digest{}, err
+		}
+	}
+
+	// looked up once, since probing the mirrors needs it before the download does
+	if hd.lookedUp {
+		return hd.validateDigest, nil
+	}
+
+	digest := hd.expectedDigest
+	if checksumFile := jptm.HTTPChecksumFile(); checksumFile != "" {
+		listed, err := hd.lookUpChecksumFile(jptm.Context(), checksumFile)
+		if err != nil {
+			return common.Digest{}, err
+		}
+		if listed.IsEmpty() {
+			jptm.LogAtLevelForCurrentTransfer(common.LogWarning, "the checksum file does not list this file, so the download is validated against the response headers instead")
+		} else {
+			digest = listed
+		}
+	}
+
+	hd.lookedUp, hd.validateDigest = true, digest
+	return digest, nil
+}
+
+// lookUpChecksumFile finds the source file in its checksum file. The digest is empty if either is missing.
+func (hd *httpDownloader) lookUpChecksumFile(ctx context.Context, checksumFile string) (common.Digest, error) {
+	checksumURL, err := common.ChecksumFileURL(hd.sourceURL, checksumFile)
+	if err != nil {
+		return common.Digest{}, err
+	}
+
+	var contents []byte
+	if common.IsChecksumFileSuffix(checksumFile) {
+		contents, err = getHTTPChecksumFile(ctx, hd.pipeline, checksumURL)
+	} else {
+		contents, err = sharedHTTPChecksumFiles.get(ctx, hd.pipeline, checksumURL)
+	}
+	if err != nil || contents == nil {
+		return common.Digest{}, err
+	}
+
+	u, err := url.Parse(hd.sourceURL)
+	if err != nil {
+		return common.Digest{}, err
+	}
+	digest, err := common.ParseChecksumFile(contents, path.Base(u.Path))
+	if errors.Is(err, common.ErrNotInChecksumFile) {
+		return common.Digest{}, nil
+	}
+	if err != nil {
+		return common.Digest{}, fmt.Errorf("%s: %w", common.URLStringExtension(checksumURL).RedactSecretQueryParamForLogging(), err)
+	}
+	return digest, nil
+}
+
+// maxHTTPChecksumFileSize guards against a checksum file URL that actually names something huge
+const maxHTTPChecksumFileSize = 16 * 1024 * 1024
+
+// getHTTPChecksumFile downloads a checksum file. The contents are nil if the server doesn't have it.
+func getHTTPChecksumFile(ctx context.Context, pipeline *azruntime.Pipeline, checksumURL string) ([]byte, error) {
+	req, err := azruntime.NewRequest(ctx, http.MethodGet, checksumURL)
+	if err != nil {
+		return nil, err
+	}
+	azruntime.SkipBodyDownload(req)
+
+	resp, err := pipeline.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("checksum file request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("checksum file request returned status %d: %s", resp.StatusCode, resp.Status)
+	}
+
+	contents, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPChecksumFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading checksum file: %w", err)
+	}
+	if len(contents) > maxHTTPChecksumFileSize {
+		return nil, fmt.Errorf("checksum file is larger than %d bytes", maxHTTPChecksumFileSize)
+	}
+	return contents, nil
+}
+
+// httpChecksumFileCache holds the checksum files that cover many downloads (SHA256SUMS and the like),
+// so that each is only fetched once per job, however many of its files are transferred
+type httpChecksumFileCache struct {
+	mu    sync.Mutex
+	files map[string]*cachedHTTPChecksumFile
+}
+
+type cachedHTTPChecksumFile struct {
+	once     sync.Once
+	contents []byte
+	err      error
+}
+
+var sharedHTTPChecksumFiles = &httpChecksumFileCache{files: make(map[string]*cachedHTTPChecksumFile)}
+
+func (c *httpChecksumFileCache) get(ctx context.Context, pipeline *azruntime.Pipeline, checksumURL string) ([]byte, error) {
+	c.mu.Lock()
+	file, ok := c.files[checksumURL]
+	if !ok {
+		file = &cachedHTTPChecksumFile{}
+		c.files[checksumURL] = file
+	}
+	c.mu.Unlock()
+
+	// concurrent transfers wait for the first one's request, rather than each making their own
+	file.once.Do(func() {
+		file.contents, file.err = getHTTPChecksumFile(ctx, pipeline, checksumURL)
+	})
+	return file.contents, file.err
+}
+
+// httpRetryReader requests the rest of the range again when reading a response body fails part way through,
+// the way the storage SDKs' retry readers do. With mirrors, the rest may come from another one.
+type httpRetryReader struct {
+	ctx          context.Context
+	hd           *httpDownloader
+	body         io.ReadCloser
+	mirror       *httpMirror   // that the body comes from, until it's been reported on
+	elapsed      time.Duration // reading the body, which leaves out any time spent waiting for the disk or the pacer
+	read         int64         // from the body
+	offset       int64         // of the next byte to be read
+	remaining    int64
+	maxRetries   int
+	failures     int
+	onFailedRead func(failureCount int32, err error, r blob.HTTPRange, willRetry bool)
+}
+
+func (r *httpRetryReader) Read(p []byte) (int, error) {
+	for {
+		started := time.Now()
+		n, err := r.body.Read(p)
+		r.elapsed += time.Since(started)
+		r.offset += int64(n)
+		r.remaining -= int64(n)
+		r.read += int64(n)
+		if err == nil || (err == io.EOF && r.remaining <= 0) {
+			if r.remaining <= 0 && r.mirror != nil {
+				r.hd.mirrors.succeeded(r.mirror, r.read, r.elapsed)
+				r.mirror = nil
+			}
+			return n, err
+		}
+
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF // the server closed the connection early
+		}
+
+		// without range support, the remainder of the body can't be requested on its own
+		r.failures++
+		willRetry := r.hd.supportsRange && r.failures <= r.maxRetries && r.ctx.Err() == nil
+		if r.onFailedRead != nil {
+			r.onFailedRead(int32(r.failures), err, blob.HTTPRange{Offset: r.offset, Count: r.remaining}, willRetry)
+		}
+		if !willRetry {
+			return n, err
+		}
+
+		_ = r.body.Close()
+		if r.mirror != nil {
+			r.hd.mirrors.failed(r.mirror, err)
+			r.mirror = nil
+		}
+
+		resp, mirror, err := r.hd.getChunk(r.ctx, r.offset, r.remaining)
+		if err != nil {
+			r.body = http.NoBody
+			return n, err
+		}
+		r.body, r.mirror, r.elapsed, r.read = resp.Body, mirror, 0, 0
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *httpRetryReader) Close() error {
+	if r.mirror != nil {
+		r.hd.mirrors.released(r.mirror)
+		r.mirror = nil
+	}
+	return r.body.Close()
+}
+
 // GetExpectedMD5 returns the expected MD5 hash from the server
 func (hd *httpDownloader) GetExpectedMD5() []byte {
 	return hd.expectedMD5
@@ -272,4 +463,4 @@ func bytesEqual(a, b []byte) bool {
 		}
 	}
 	return true
-}
\ No newline at end of file
+}
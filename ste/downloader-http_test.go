@@ -21,15 +21,44 @@
 package ste
 
 import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-storage-azcopy/v10/common"
 	"github.com/stretchr/testify/assert"
 )
 
+// newTestHTTPPipeline builds a pipeline with the production policies, but quick retries
+func newTestHTTPPipeline(client *http.Client, tokenSource common.HTTPTokenSource) *azruntime.Pipeline {
+	options := NewClientOptions(policy.RetryOptions{
+		MaxRetries:    2,
+		RetryDelay:    time.Millisecond,
+		MaxRetryDelay: 50 * time.Millisecond,
+	}, policy.TelemetryOptions{}, client, LogOptions{}, nil, nil)
+
+	pipeline, err := common.NewHTTPPipeline("", &options, tokenSource)
+	if err != nil {
+		panic(err)
+	}
+	return &pipeline
+}
+
 func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 	t.Run("SupportsRange", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -43,11 +72,11 @@ func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, httpDl.supportsRange)
 		assert.Equal(t, int64(1000), httpDl.contentLength)
@@ -64,11 +93,11 @@ func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		assert.False(t, httpDl.supportsRange)
 		assert.Equal(t, int64(500), httpDl.contentLength)
@@ -83,11 +112,11 @@ func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		assert.False(t, httpDl.supportsRange)
 	})
@@ -99,11 +128,11 @@ func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "500")
 	})
@@ -115,11 +144,11 @@ func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "404")
 	})
@@ -139,16 +168,47 @@ func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:   server.URL,
-			httpClient:  server.Client(),
-			bearerToken: expectedToken,
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), common.NewStaticHTTPTokenSource(expectedToken)),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, tokenReceived)
 	})
 
+	t.Run("RefreshesRejectedToken", func(t *testing.T) {
+		// the token in the file has expired by the time the transfer starts, and has since been rewritten
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		assert.NoError(t, os.WriteFile(tokenFile, []byte("expired-token"), 0600))
+		tokenSource := common.NewFileHTTPTokenSource(tokenFile)
+		_, err := tokenSource.Token(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(tokenFile, []byte("fresh-token"), 0600))
+
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Header.Get("Authorization") != "Bearer fresh-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Content-Length", "1000")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		httpDl := &httpDownloader{
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), tokenSource),
+		}
+
+		err = httpDl.detectCapabilities(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, requests)
+		assert.Equal(t, int64(1000), httpDl.contentLength)
+	})
+
 	t.Run("InvalidMD5", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-MD5", "not-valid-base64!!!")
@@ -157,11 +217,11 @@ func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		assert.Empty(t, httpDl.expectedMD5) // Invalid MD5 should be ignored
 	})
@@ -179,11 +239,11 @@ func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, httpDl.supportsRange)
 		assert.Equal(t, int64(2048), httpDl.contentLength)
@@ -201,24 +261,24 @@ func TestHTTPDownloader_DetectCapabilities(t *testing.T) {
 
 		httpDl := &httpDownloader{
 			sourceURL: server.URL,
-			httpClient: &http.Client{
+			pipeline: newTestHTTPPipeline(&http.Client{
 				Timeout: 100 * time.Millisecond,
-			},
+			}, nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.Error(t, err)
 	})
 
 	t.Run("NetworkFailure", func(t *testing.T) {
 		httpDl := &httpDownloader{
 			sourceURL: "http://localhost:1/nonexistent",
-			httpClient: &http.Client{
+			pipeline: newTestHTTPPipeline(&http.Client{
 				Timeout: 1 * time.Second,
-			},
+			}, nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "HEAD request failed")
 	})
@@ -283,28 +343,103 @@ func TestHTTPDownloader_BytesEqual(t *testing.T) {
 	})
 }
 
-func TestHTTPDownloader_HTTPClient(t *testing.T) {
-	t.Run("ClientConfiguration", func(t *testing.T) {
-		client := &http.Client{
-			Timeout: 30 * time.Minute,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 100,
-				IdleConnTimeout:     90 * time.Second,
-				DisableCompression:  true,
+func TestHTTPDownloader_Pipeline(t *testing.T) {
+	t.Run("RetriesServerBusy", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Length", "1000")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		httpDl := &httpDownloader{
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
+		}
+
+		err := httpDl.detectCapabilities(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 2, requests)
+		assert.Equal(t, int64(1000), httpDl.contentLength)
+	})
+
+	t.Run("RetryReaderResumesBody", func(t *testing.T) {
+		content := "0123456789abcdefghij"
+		var ranges []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			if len(ranges) == 1 {
+				// drop the connection part way through the body
+				w.Header().Set("Content-Length", "16")
+				w.WriteHeader(http.StatusPartialContent)
+				_, _ = w.Write([]byte(content[2:7]))
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write([]byte(content[7:18]))
+		}))
+		defer server.Close()
+
+		httpDl := &httpDownloader{
+			sourceURL:     server.URL,
+			pipeline:      newTestHTTPPipeline(server.Client(), nil),
+			supportsRange: true,
+		}
+
+		resp, err := httpDl.get(context.Background(), 2, 16)
+		assert.NoError(t, err)
+
+		failures := 0
+		reader := &httpRetryReader{
+			ctx:        context.Background(),
+			hd:         httpDl,
+			body:       resp.Body,
+			offset:     2,
+			remaining:  16,
+			maxRetries: 3,
+			onFailedRead: func(failureCount int32, err error, r blob.HTTPRange, willRetry bool) {
+				failures++
+				assert.True(t, willRetry)
 			},
 		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, content[2:18], string(data))
+		assert.Equal(t, 1, failures)
+		assert.Equal(t, []string{"bytes=2-17", "bytes=7-17"}, ranges)
+	})
+
+	t.Run("RetryReaderWithoutRangeSupport", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Length", "10")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("01234"))
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}))
+		defer server.Close()
 
 		httpDl := &httpDownloader{
-			httpClient: client,
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		assert.Equal(t, 30*time.Minute, httpDl.httpClient.Timeout)
-		transport := httpDl.httpClient.Transport.(*http.Transport)
-		assert.Equal(t, 100, transport.MaxIdleConns)
-		assert.Equal(t, 100, transport.MaxIdleConnsPerHost)
-		assert.Equal(t, 90*time.Second, transport.IdleConnTimeout)
-		assert.True(t, transport.DisableCompression)
+		resp, err := httpDl.get(context.Background(), 0, 10)
+		assert.NoError(t, err)
+
+		reader := &httpRetryReader{ctx: context.Background(), hd: httpDl, body: resp.Body, remaining: 10, maxRetries: 3}
+		defer reader.Close()
+
+		_, err = io.ReadAll(reader)
+		assert.Error(t, err)
 	})
 }
 
@@ -320,17 +455,17 @@ func TestHTTPDownloader_Various(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
 		// First check
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		firstCallCount := callCount
 
 		// Second check should update state
-		err = httpDl.detectCapabilities()
+		err = httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		assert.Equal(t, firstCallCount+1, callCount)
 	})
@@ -343,11 +478,11 @@ func TestHTTPDownloader_Various(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		assert.Equal(t, int64(0), httpDl.contentLength)
 	})
@@ -360,12 +495,151 @@ func TestHTTPDownloader_Various(t *testing.T) {
 		defer server.Close()
 
 		httpDl := &httpDownloader{
-			sourceURL:  server.URL,
-			httpClient: server.Client(),
+			sourceURL: server.URL,
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
 		}
 
-		err := httpDl.detectCapabilities()
+		err := httpDl.detectCapabilities(context.Background())
 		assert.NoError(t, err)
 		assert.Equal(t, int64(0), httpDl.contentLength)
 	})
-}
\ No newline at end of file
+}
+
+func TestHTTPDownloader_ExpectedDigest(t *testing.T) {
+	content := []byte("toolchain archive contents")
+	sha256Sum := sha256.Sum256(content)
+	md5Sum := md5.Sum(content)
+	hexSHA256 := hex.EncodeToString(sha256Sum[:])
+
+	// newServer serves content at /dist/tool.tar.gz, and the given checksum files alongside it
+	newServer := func(headers map[string]string, checksumFiles map[string]string, requests map[string]int) *httptest.Server {
+		var mu sync.Mutex
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[r.URL.Path]++
+			mu.Unlock()
+
+			if r.URL.Path == "/dist/tool.tar.gz" {
+				assert.Equal(t, common.WantReprDigestHeaderValue, r.Header.Get("Want-Repr-Digest"))
+				for k, v := range headers {
+					w.Header().Set(k, v)
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			if body, ok := checksumFiles[r.URL.Path]; ok {
+				_, _ = w.Write([]byte(body))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	}
+
+	newDownloader := func(server *httptest.Server) *httpDownloader {
+		return &httpDownloader{
+			sourceURL: server.URL + "/dist/tool.tar.gz",
+			pipeline:  newTestHTTPPipeline(server.Client(), nil),
+		}
+	}
+
+	t.Run("PrefersDigestHeaders", func(t *testing.T) {
+		requests := map[string]int{}
+		server := newServer(map[string]string{
+			"Content-MD5": base64.StdEncoding.EncodeToString(md5Sum[:]),
+			"Repr-Digest": "unixsum=:AAAA:, sha-256=:" + base64.StdEncoding.EncodeToString(sha256Sum[:]) + ":",
+		}, nil, requests)
+		defer server.Close()
+
+		httpDl := newDownloader(server)
+		digest, err := httpDl.ExpectedDigest(&testJobPartTransferManager{})
+		assert.NoError(t, err)
+		assert.Equal(t, "sha-256", digest.Algorithm)
+		assert.Equal(t, sha256Sum[:], digest.Value)
+
+		// the prologue doesn't need to ask again
+		assert.True(t, httpDl.detected)
+		assert.Equal(t, 1, requests["/dist/tool.tar.gz"])
+	})
+
+	t.Run("FallsBackToContentMD5", func(t *testing.T) {
+		server := newServer(map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(md5Sum[:])}, nil, map[string]int{})
+		defer server.Close()
+
+		digest, err := newDownloader(server).ExpectedDigest(&testJobPartTransferManager{})
+		assert.NoError(t, err)
+		assert.Equal(t, common.NewMD5Digest(md5Sum[:]), digest)
+	})
+
+	t.Run("ChecksumFileSuffix", func(t *testing.T) {
+		server := newServer(map[string]string{"Content-MD5": base64.StdEncoding.EncodeToString(md5Sum[:])},
+			map[string]string{"/dist/tool.tar.gz.sha256": hexSHA256 + "  tool.tar.gz\n"}, map[string]int{})
+		defer server.Close()
+
+		digest, err := newDownloader(server).ExpectedDigest(&testJobPartTransferManager{httpChecksumFile: ".sha256"})
+		assert.NoError(t, err)
+		assert.Equal(t, "sha-256", digest.Algorithm)
+		assert.Equal(t, sha256Sum[:], digest.Value)
+	})
+
+	t.Run("SharedChecksumFileIsFetchedOnce", func(t *testing.T) {
+		requests := map[string]int{}
+		server := newServer(nil, map[string]string{
+			"/dist/SHA256SUMS": strings.Repeat("0", 64) + " *other.tar.gz\n" + hexSHA256 + " *tool.tar.gz\n",
+		}, requests)
+		defer server.Close()
+
+		for i := 0; i < 3; i++ {
+			digest, err := newDownloader(server).ExpectedDigest(&testJobPartTransferManager{httpChecksumFile: "SHA256SUMS"})
+			assert.NoError(t, err)
+			assert.Equal(t, sha256Sum[:], digest.Value)
+		}
+		assert.Equal(t, 1, requests["/dist/SHA256SUMS"])
+	})
+
+	t.Run("MissingChecksumFile", func(t *testing.T) {
+		server := newServer(nil, nil, map[string]int{})
+		defer server.Close()
+
+		httpDl := newDownloader(server)
+		digest, err := httpDl.lookUpChecksumFile(context.Background(), ".sha512")
+		assert.NoError(t, err)
+		assert.True(t, digest.IsEmpty())
+
+		// a list that doesn't mention the file isn't an error either
+		server = newServer(nil, map[string]string{"/dist/MD5SUMS": strings.Repeat("0", 32) + "  other.tar.gz\n"}, map[string]int{})
+		defer server.Close()
+
+		digest, err = newDownloader(server).lookUpChecksumFile(context.Background(), "MD5SUMS")
+		assert.NoError(t, err)
+		assert.True(t, digest.IsEmpty())
+	})
+
+	t.Run("ChecksumFileServerError", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		_, err := newDownloader(server).lookUpChecksumFile(context.Background(), ".sha256")
+		assert.Error(t, err)
+	})
+}
+
+func TestMD5Comparer_HTTPDigest(t *testing.T) {
+	expected := sha256.Sum256([]byte("expected"))
+	actual := sha256.Sum256([]byte("tampered"))
+
+	comparer := md5Comparer{
+		expected:         common.Digest{Algorithm: "sha-256", Value: expected[:]},
+		actualAsSaved:    actual[:],
+		validationOption: common.EHashValidationOption.FailIfDifferent(),
+		httpSource:       true,
+	}
+	err := comparer.Check()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "sha-256")
+
+	comparer.actualAsSaved = expected[:]
+	assert.NoError(t, comparer.Check())
+}
@@ -56,6 +56,13 @@ type unixPropertyAwareDownloader interface {
 	ApplyUnixProperties(adapter common.UnixStatAdapter) (stage string, err error)
 }
 
+// digestAwareDownloader is a downloader that only learns the hash to validate the download against
+// once the transfer starts, rather than from the properties found at enumeration time
+type digestAwareDownloader interface {
+	downloader
+	ExpectedDigest(jptm IJobPartTransferMgr) (common.Digest, error)
+}
+
 // folderDownloader is a downloader that can also process folder properties
 type folderDownloader interface {
 	downloader
@@ -23,6 +23,8 @@ package ste
 import (
 	"bytes"
 	"errors"
+	"fmt"
+
 	"github.com/Azure/azure-storage-azcopy/v10/common"
 )
 
@@ -31,10 +33,11 @@ type transferSpecificLogger interface {
 }
 
 type md5Comparer struct {
-	expected         []byte
+	expected         common.Digest // usually an MD5, but HTTP sources may advertise other algorithms
 	actualAsSaved    []byte
 	validationOption common.HashValidationOption
 	logger           transferSpecificLogger
+	httpSource       bool // whether the expected hash came from a web server, rather than a storage service
 }
 
 // TODO: let's add an aka.ms link to the message,  that gives more info
@@ -48,6 +51,16 @@ const noMD5Stored = "no MD5 was stored in the Blob/File service against this fil
 
 var errExpectedMd5Missing = errors.New(noMD5Stored + " This application is currently configured to treat missing MD5 hashes as errors")
 
+// digestMismatchError is the counterpart of errMd5Mismatch for hashes advertised by web servers and checksum files
+func digestMismatchError(algorithm string) error {
+	return fmt.Errorf("the %s hash of the data, as we received it, did not match the expected value, as advertised by the server or its checksum file. "+
+		"This means that either there is a data integrity error, the file has been tampered with, OR the published hash is out of date", algorithm)
+}
+
+const noDigestAdvertised = "the server advertised no hash for this file, in a Content-MD5, Repr-Digest, Content-Digest or Digest header, or a checksum file. So the downloaded data cannot be validated."
+
+var errExpectedDigestMissing = errors.New(noDigestAdvertised + " This application is currently configured to treat missing hashes as errors")
+
 var errActualMd5NotComputed = errors.New("no MDB was computed within this application. This indicates a logic error in this application")
 
 // Check compares the two MD5s, and returns any error if applicable
@@ -60,7 +73,7 @@ func (c *md5Comparer) Check() error {
 	}
 
 	// missing (at the source)
-	if len(c.expected) == 0 {
+	if c.expected.IsEmpty() {
 		switch c.validationOption {
 		// This code would never be triggered anymore due to the early check that now occurs in xfer-remoteToLocal.go
 		case common.EHashValidationOption.FailIfDifferentOrMissing():
@@ -78,12 +91,12 @@ func (c *md5Comparer) Check() error {
 	if len(c.actualAsSaved) == 0 {
 		return errActualMd5NotComputed // Should never happen, so there's no way to opt out of this error being returned if it DOES happen
 	}
-	match := bytes.Equal(c.expected, c.actualAsSaved)
+	match := bytes.Equal(c.expected.Value, c.actualAsSaved)
 	if !match {
 		switch c.validationOption {
 		case common.EHashValidationOption.FailIfDifferentOrMissing(),
 			common.EHashValidationOption.FailIfDifferent():
-			return errMd5Mismatch
+			return c.mismatchError()
 		case common.EHashValidationOption.LogOnly():
 			c.logAsDifferent()
 			return nil
@@ -95,10 +108,21 @@ func (c *md5Comparer) Check() error {
 	return nil
 }
 
+func (c *md5Comparer) mismatchError() error {
+	if c.httpSource {
+		return digestMismatchError(c.expected.Algorithm)
+	}
+	return errMd5Mismatch
+}
+
 func (c *md5Comparer) logAsMissing() {
+	if c.httpSource {
+		c.logger.LogAtLevelForCurrentTransfer(common.LogWarning, noDigestAdvertised)
+		return
+	}
 	c.logger.LogAtLevelForCurrentTransfer(common.LogWarning, noMD5Stored)
 }
 
 func (c *md5Comparer) logAsDifferent() {
-	c.logger.LogAtLevelForCurrentTransfer(common.LogWarning, errMd5Mismatch.Error())
+	c.logger.LogAtLevelForCurrentTransfer(common.LogWarning, c.mismatchError().Error())
 }
@@ -28,6 +28,7 @@ type IJobPartTransferMgr interface {
 	ShouldPutMd5() bool
 	DeleteDestinationFileIfNecessary() bool
 	MD5ValidationOption() common.HashValidationOption
+	HTTPChecksumFile() string
 	BlobTypeOverride() common.BlobType
 	BlobTiers() (blockBlobTier common.BlockBlobTier, pageBlobTier common.PageBlobTier)
 	JobHasLowFileCount() bool
@@ -118,6 +119,7 @@ type TransferInfo struct {
 	PreserveInfo            bool
 	PreservePOSIXProperties bool
 	BlobFSRecursiveDelete   bool
+	SyncHashType            common.SyncHashType
 
 	// Paths of targets excluding the container/fileshare name.
 	// ie. for https://acc1.blob.core.windows.net/c1/a/b/c/d.txt,
@@ -427,6 +429,7 @@ func (jptm *jobPartTransferMgr) Info() *TransferInfo {
 		S2SSourceChangeValidation:      s2sSourceChangeValidation,
 		S2SInvalidMetadataHandleOption: s2sInvalidMetadataHandleOption,
 		BlobFSRecursiveDelete:          plan.BlobFSRecursiveDelete,
+		SyncHashType:                   plan.SyncHashType,
 		DestLengthValidation:           DestLengthValidation,
 		SrcProperties: SrcProperties{
 			SrcHTTPHeaders: srcHTTPHeaders,
@@ -564,6 +567,12 @@ func (jptm *jobPartTransferMgr) MD5ValidationOption() common.HashValidationOptio
 	return jptm.jobPartMgr.(*jobPartMgr).localDstData().MD5VerificationOption
 }
 
+// HTTPChecksumFile returns the checksum file HTTP downloads are validated against, or "" for none
+func (jptm *jobPartTransferMgr) HTTPChecksumFile() string {
+	dstData := jptm.jobPartMgr.(*jobPartMgr).localDstData()
+	return string(dstData.HTTPChecksumFile[:dstData.HTTPChecksumFileLength])
+}
+
 func (jptm *jobPartTransferMgr) DeleteSnapshotsOption() common.DeleteSnapshotsOption {
 	return jptm.jobPartMgr.(*jobPartMgr).deleteSnapshotsOption()
 }
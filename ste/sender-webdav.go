@@ -0,0 +1,425 @@
+// Copyright © Microsoft <wastore@microsoft.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package ste
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	azruntime "github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-storage-azcopy/v10/common"
+)
+
+// webDAVKnownCollections remembers collections we have created or found to exist, so that
+// each file doesn't cost an extra MKCOL round trip for its parent
+var webDAVKnownCollections sync.Map
+
+var errWebDAVCollectionExists = errors.New("WebDAV collection already exists")
+var errWebDAVParentMissing = errors.New("WebDAV parent collection does not exist")
+
+// webDAVUploader sends files with a single PUT and folders with MKCOL.
+// WebDAV has no standard way to write ranges, so the chunks scheduled by anyToRemote are
+// streamed, in order, into the body of one PUT request that is opened in the Prologue.
+type webDAVUploader struct {
+	jptm        IJobPartTransferMgr
+	destURL     string
+	pipeline    *azruntime.Pipeline
+	chunkSize   int64
+	numChunks   uint32
+	pacer       pacer
+	ctx         context.Context
+	sip         ISourceInfoProvider
+	md5Channel  chan []byte
+
+	contentType string
+
+	// chunkTurns[i] is closed once chunk i may write to the request body
+	chunkTurns []chan struct{}
+	bodyWriter *io.PipeWriter
+	putResult  chan error
+}
+
+func newWebDAVUploader(jptm IJobPartTransferMgr, destination string, pacer pacer, sip ISourceInfoProvider) (sender, error) {
+	if _, err := common.NewHTTPURLParts(destination); err != nil {
+		return nil, err
+	}
+
+	info := jptm.Info()
+	chunkSize := int64(info.BlockSize)
+	numChunks := getNumChunks(info.SourceSize, chunkSize, chunkSize)
+
+	props, err := sip.Properties()
+	if err != nil {
+		return nil, err
+	}
+
+	// The pipeline carries the same retry, logging and stats policies as the storage service clients,
+	// and authenticates requests just as it does for HTTP sources
+	pipeline, err := jptm.DstServiceClient().HTTPPipeline()
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := ""
+	if props.SrcHTTPHeaders.ContentType != "" {
+		contentType = props.SrcHTTPHeaders.ContentType
+	}
+
+	return &webDAVUploader{
+		jptm:        jptm,
+		destURL:     destination,
+		pipeline:    pipeline,
+		chunkSize:   chunkSize,
+		numChunks:   numChunks,
+		pacer:       pacer,
+		ctx:         jptm.Context(),
+		sip:         sip,
+		md5Channel:  newMd5Channel(),
+		contentType: contentType,
+	}, nil
+}
+
+func (u *webDAVUploader) ChunkSize() int64 {
+	return u.chunkSize
+}
+
+func (u *webDAVUploader) NumChunks() uint32 {
+	return u.numChunks
+}
+
+func (u *webDAVUploader) Md5Channel() chan<- []byte {
+	// WebDAV has nowhere to store a content hash, so whatever is sent here is dropped
+	return u.md5Channel
+}
+
+func (u *webDAVUploader) RemoteFileExists() (bool, time.Time, error) {
+	resp, err := u.do(http.MethodHead, u.destURL, nil, -1, nil)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return false, time.Time{}, nil
+	case http.StatusOK:
+		lmt, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return true, lmt, nil
+	default:
+		return false, time.Time{}, fmt.Errorf("HEAD request returned status %d: %s", resp.StatusCode, resp.Status)
+	}
+}
+
+func (u *webDAVUploader) Prologue(state common.PrologueState) (destinationModified bool) {
+	jptm := u.jptm
+
+	if jptm.ShouldInferContentType() {
+		if inferred := state.GetInferredContentType(jptm); inferred != nil {
+			u.contentType = *inferred
+		}
+	}
+
+	if err := u.ensureCollection(parentCollectionURL(u.destURL)); err != nil {
+		jptm.FailActiveUpload("Creating parent collection", err)
+		return false
+	}
+
+	u.chunkTurns = make([]chan struct{}, u.numChunks)
+	for i := range u.chunkTurns {
+		u.chunkTurns[i] = make(chan struct{})
+	}
+	close(u.chunkTurns[0])
+
+	bodyReader, bodyWriter := io.Pipe()
+	u.bodyWriter = bodyWriter
+	u.putResult = make(chan error, 1)
+
+	go func() {
+		resp, err := u.do(http.MethodPut, u.destURL, bodyReader, jptm.Info().SourceSize, func(req *http.Request) {
+			if u.contentType != "" {
+				req.Header.Set("Content-Type", u.contentType)
+			}
+		})
+		if err == nil {
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+				err = fmt.Errorf("PUT request returned status %d: %s", resp.StatusCode, resp.Status)
+			}
+			resp.Body.Close()
+		}
+		// unblock any chunk that is still writing, e.g. because the server rejected the request early
+		_ = bodyReader.CloseWithError(common.Iff(err != nil, err, io.ErrClosedPipe))
+		u.putResult <- err
+	}()
+
+	return true
+}
+
+func (u *webDAVUploader) GenerateUploadFunc(id common.ChunkID, blockIndex int32, reader common.SingleChunkReader, chunkIsWholeFile bool) chunkFunc {
+	return createSendToRemoteChunkFunc(u.jptm, id, func() {
+		jptm := u.jptm
+
+		defer reader.Close()
+
+		if u.chunkTurns == nil {
+			return // the prologue failed before the request was started
+		}
+
+		// wait for every earlier chunk to be written to the request body
+		select {
+		case <-u.chunkTurns[blockIndex]:
+		case <-u.ctx.Done():
+			return
+		}
+		defer func() {
+			if int(blockIndex)+1 < len(u.chunkTurns) {
+				close(u.chunkTurns[blockIndex+1])
+			}
+		}()
+
+		if !jptm.IsLive() || jptm.Info().SourceSize == 0 {
+			return
+		}
+
+		jptm.LogChunkStatus(id, common.EWaitReason.Body())
+		body := newPacedRequestBody(u.ctx, reader, u.pacer)
+		if _, err := io.Copy(u.bodyWriter, body); err != nil {
+			jptm.FailActiveUpload("Writing chunk to request body", err)
+		}
+	})
+}
+
+func (u *webDAVUploader) Epilogue() {
+	jptm := u.jptm
+
+	if u.bodyWriter == nil {
+		return // the prologue never started a request
+	}
+
+	if jptm.IsLive() {
+		_ = u.bodyWriter.Close()
+		if err := <-u.putResult; err != nil {
+			jptm.FailActiveUpload("Completing PUT", err)
+		}
+	} else {
+		_ = u.bodyWriter.CloseWithError(errors.New("transfer did not complete"))
+		<-u.putResult
+	}
+}
+
+func (u *webDAVUploader) Cleanup() {
+	jptm := u.jptm
+
+	if jptm.IsDeadInflight() && u.bodyWriter != nil {
+		// some servers keep whatever part of the body they received, so remove the incomplete file
+		deletionContext, cancelFn := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancelFn()
+
+		resp, err := u.doWithContext(deletionContext, http.MethodDelete, u.destURL, nil, -1, nil)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+				err = fmt.Errorf("DELETE request returned status %d: %s", resp.StatusCode, resp.Status)
+			}
+		}
+		if err != nil {
+			jptm.Log(common.LogError, fmt.Sprintf("error deleting the (incomplete) file %s. Failed with error %s", u.destURL, err.Error()))
+		}
+	}
+}
+
+func (u *webDAVUploader) GetDestinationLength() (int64, error) {
+	resp, err := u.do(http.MethodHead, u.destURL, nil, -1, nil)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return -1, fmt.Errorf("HEAD request returned status %d: %s", resp.StatusCode, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return -1, fmt.Errorf("destination content length not returned")
+	}
+	return resp.ContentLength, nil
+}
+
+func (u *webDAVUploader) EnsureFolderExists() error {
+	return u.ensureCollection(u.destURL)
+}
+
+func (u *webDAVUploader) SetFolderProperties() error {
+	// the only properties we could set are dead properties, which nothing on the source side maps to
+	return nil
+}
+
+func (u *webDAVUploader) DirUrlToString() string {
+	return collectionKey(u.destURL)
+}
+
+// ensureCollection MKCOLs the collection at dirURL, creating missing ancestors first when the server reports them absent
+func (u *webDAVUploader) ensureCollection(dirURL string) error {
+	key := collectionKey(dirURL)
+	knownKey := strings.TrimSuffix(key, "/")
+	if _, ok := webDAVKnownCollections.Load(knownKey); ok {
+		return nil
+	}
+
+	tracker := u.jptm.GetFolderCreationTracker()
+	create := func() error {
+		return tracker.CreateFolder(key, func() error { return u.mkcol(dirURL) })
+	}
+
+	err := create()
+	if errors.Is(err, errWebDAVParentMissing) {
+		parent := parentCollectionURL(dirURL)
+		if strings.TrimSuffix(parent, "/") == knownKey {
+			return fmt.Errorf("cannot create collection %s: %w", key, err)
+		}
+		if err = u.ensureCollection(parent); err != nil {
+			return err
+		}
+		err = create()
+	}
+
+	if err != nil && !errors.Is(err, errWebDAVCollectionExists) {
+		return err
+	}
+
+	webDAVKnownCollections.Store(knownKey, struct{}{})
+	return nil
+}
+
+func (u *webDAVUploader) mkcol(dirURL string) error {
+	resp, err := u.do("MKCOL", dirURL, nil, -1, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK:
+		return nil
+	case http.StatusMethodNotAllowed:
+		// RFC 4918: MKCOL on a mapped URL fails with 405
+		return errWebDAVCollectionExists
+	case http.StatusConflict:
+		return errWebDAVParentMissing
+	default:
+		return fmt.Errorf("MKCOL request returned status %d: %s", resp.StatusCode, resp.Status)
+	}
+}
+
+func (u *webDAVUploader) do(method, rawURL string, body io.Reader, contentLength int64, prepare func(*http.Request)) (*http.Response, error) {
+	return u.doWithContext(u.ctx, method, rawURL, body, contentLength, prepare)
+}
+
+func (u *webDAVUploader) doWithContext(ctx context.Context, method, rawURL string, body io.Reader, contentLength int64, prepare func(*http.Request)) (*http.Response, error) {
+	if body != nil {
+		// The streamed PUT body can't be replayed, so it isn't retried by the pipeline, nor cut off by its per-try timeout.
+		// A failure, including a 401, fails the transfer, which is then retried as a whole.
+		ctx = policy.WithRetryOptions(ctx, policy.RetryOptions{MaxRetries: -1})
+	}
+
+	req, err := azruntime.NewRequest(ctx, method, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil && contentLength > 0 {
+		if err = req.SetBody(&webDAVStreamedBody{reader: body, size: contentLength}, ""); err != nil {
+			return nil, err
+		}
+	} else if contentLength == 0 {
+		req.Raw().Body = http.NoBody
+	}
+	if prepare != nil {
+		prepare(req.Raw())
+	}
+	// PUT streams its body to the server, and the responses we read are small
+	azruntime.SkipBodyDownload(req)
+
+	return u.pipeline.Do(req)
+}
+
+// webDAVStreamedBody lets a request body that is written as the chunks come in go through the pipeline.
+// It can only be "rewound" before any of it was read, which is all the pipeline does for a request that isn't retried.
+type webDAVStreamedBody struct {
+	reader io.Reader
+	size   int64
+	read   bool
+}
+
+func (b *webDAVStreamedBody) Read(p []byte) (int, error) {
+	b.read = true
+	return b.reader.Read(p)
+}
+
+func (b *webDAVStreamedBody) Seek(offset int64, whence int) (int64, error) {
+	switch {
+	case offset == 0 && whence == io.SeekEnd:
+		return b.size, nil
+	case offset == 0 && whence == io.SeekStart && !b.read:
+		return 0, nil
+	default:
+		return 0, errors.New("the streamed request body cannot be replayed")
+	}
+}
+
+func (b *webDAVStreamedBody) Close() error {
+	if closer, ok := b.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// collectionKey normalizes a collection URL the same way folder transfers are registered with the folder tracker
+func collectionKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery = ""
+	u.RawPath = ""
+	return u.String()
+}
+
+// parentCollectionURL returns the URL of the collection containing rawURL
+func parentCollectionURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.RawQuery = ""
+	u.RawPath = ""
+	u.Path = path.Dir(strings.TrimSuffix(u.Path, "/"))
+	if u.Path == "." {
+		u.Path = "/"
+	}
+	return u.String()
+}
@@ -109,6 +109,12 @@ func (p *gcpSourceInfoProvider) Properties() (*SrcProperties, error) {
 			},
 			SrcMetadata: oie.NewCommonMetadata(),
 		}
+
+		// a sync asks for the ETag of the source to be recorded, for the next sync to compare; that of the version being copied is recorded
+		if _, ok := p.transferInfo.SrcMetadata[common.SyncSourceETagMetadataKey]; ok {
+			eTag := objectInfo.Etag
+			srcProperties.SrcMetadata[common.SyncSourceETagMetadataKey] = &eTag
+		}
 	}
 	resolvedMetadata, err := p.handleInvalidMetadataKeys(srcProperties.SrcMetadata)
 
@@ -51,6 +51,12 @@ func (f localFileSourceInfoProvider) Properties() (*SrcProperties, error) {
 
 	headers, metadata, blobTags, _ := f.jptm.ResourceDstData(nil) // we don't have a known MIME type yet, so pass nil for the sniffed content of thefile
 
+	// sync records the hash it compared the file by in the destination's metadata, for the next sync to compare against
+	if syncHash, ok := common.TryReadMetadata(f.transferInfo.SrcMetadata, f.transferInfo.SyncHashType.MetadataKey()); ok {
+		metadata = metadata.Clone() // the job's metadata is shared by all its transfers
+		metadata[f.transferInfo.SyncHashType.MetadataKey()] = syncHash
+	}
+
 	return &SrcProperties{
 		SrcHTTPHeaders: common.ResourceHTTPHeaders{
 			ContentType:        headers.ContentType,
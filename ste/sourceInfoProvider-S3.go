@@ -126,6 +126,12 @@ func (p *s3SourceInfoProvider) Properties() (*SrcProperties, error) {
 			},
 			SrcMetadata: oie.NewCommonMetadata(),
 		}
+
+		// a sync asks for the ETag of the source to be recorded, for the next sync to compare; that of the version being copied is recorded
+		if _, ok := p.transferInfo.SrcMetadata[common.SyncSourceETagMetadataKey]; ok {
+			eTag := objectInfo.ETag
+			srcProperties.SrcMetadata[common.SyncSourceETagMetadataKey] = &eTag
+		}
 	}
 
 	// Handle invalid metadata.
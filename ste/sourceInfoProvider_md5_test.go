@@ -29,6 +29,7 @@ import (
 	"hash/crc64"
 	"io"
 	"math/rand"
+	"net/http"
 	"os"
 	"runtime"
 	"strings"
@@ -530,3 +531,47 @@ func TestS3(t *testing.T) {
 	a.Nil(err)
 	a.True(bytes.Equal(localMd5[:], computedMd5))
 }
+
+func TestHTTPRangeBody(t *testing.T) {
+	a := assert.New(t)
+	data := []byte("0123456789")
+	respond := func(status int, contentRange string) *http.Response {
+		resp := &http.Response{StatusCode: status, Status: http.StatusText(status), Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(data))}
+		if contentRange != "" {
+			resp.Header.Set("Content-Range", contentRange)
+		}
+		return resp
+	}
+
+	// A server without range support sends the whole file, which serves only when the whole file was asked for
+	body, err := httpRangeBody(respond(http.StatusOK, ""), 0, 0)
+	a.NoError(err)
+	got, _ := io.ReadAll(body)
+	a.Equal("0123456789", string(got))
+
+	whole := respond(http.StatusOK, "")
+	whole.ContentLength = int64(len(data))
+	body, err = httpRangeBody(whole, 0, 10)
+	a.NoError(err)
+	got, _ = io.ReadAll(body)
+	a.Equal("0123456789", string(got))
+
+	// otherwise each range would download the file again from the start, so none of them is read
+	_, err = httpRangeBody(whole, 0, 4)
+	a.ErrorIs(err, errHTTPRangesNotSupported)
+	_, err = httpRangeBody(respond(http.StatusOK, ""), 3, 4)
+	a.ErrorIs(err, errHTTPRangesNotSupported)
+	_, err = httpRangeBody(respond(http.StatusOK, ""), 3, 0)
+	a.ErrorIs(err, errHTTPRangesNotSupported)
+
+	// A partial response must start where it was asked to
+	_, err = httpRangeBody(respond(http.StatusPartialContent, "bytes 3-6/10"), 3, 4)
+	a.NoError(err)
+	_, err = httpRangeBody(respond(http.StatusPartialContent, "bytes 0-9/10"), 3, 4)
+	a.Error(err)
+	_, err = httpRangeBody(respond(http.StatusPartialContent, ""), 3, 4)
+	a.Error(err)
+
+	_, err = httpRangeBody(respond(http.StatusNotFound, ""), 3, 4)
+	a.Error(err)
+}
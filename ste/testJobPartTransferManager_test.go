@@ -34,11 +34,12 @@ import (
 var _ IJobPartTransferMgr = &testJobPartTransferManager{}
 
 type testJobPartTransferManager struct {
-	info       *TransferInfo
-	fromTo     common.FromTo
-	jobPartMgr jobPartMgr
-	ctx        context.Context
-	status     common.TransferStatus
+	info             *TransferInfo
+	fromTo           common.FromTo
+	jobPartMgr       jobPartMgr
+	ctx              context.Context
+	status           common.TransferStatus
+	httpChecksumFile string
 }
 
 func (t *testJobPartTransferManager) DeleteDestinationFileIfNecessary() bool {
@@ -129,6 +130,10 @@ func (t *testJobPartTransferManager) MD5ValidationOption() common.HashValidation
 	panic("implement me")
 }
 
+func (t *testJobPartTransferManager) HTTPChecksumFile() string {
+	return t.httpChecksumFile
+}
+
 func (t *testJobPartTransferManager) BlobTypeOverride() common.BlobType {
 	panic("implement me")
 }
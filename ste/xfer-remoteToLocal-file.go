@@ -104,11 +104,29 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, pacer pacer, df downloaderFact
 		}
 	}
 
+	// The hash to validate against normally comes from the properties found at enumeration time,
+	// but some sources (web servers, for instance) only advertise theirs when asked about the file itself
+	expectedHash := common.NewMD5Digest(info.SrcHTTPHeaders.ContentMD5)
+	dda, isDigestAware := dl.(digestAwareDownloader)
+	if isDigestAware && jptm.MD5ValidationOption() != common.EHashValidationOption.NoCheck() {
+		expectedHash, err = dda.ExpectedDigest(jptm)
+		if err != nil {
+			jptm.LogDownloadError(info.Source, info.Destination, "Expected hash lookup error "+err.Error(), 0)
+			jptm.SetStatus(common.ETransferStatus.Failed())
+			jptm.ReportTransferDone()
+			return
+		}
+	}
+
 	if jptm.MD5ValidationOption() == common.EHashValidationOption.FailIfDifferentOrMissing() {
 		// We can make a check early on MD5 existence and fail the transfer if it's not present.
 		// This will save hours in the event a user has say, a several hundred gigabyte file.
-		if len(info.SrcHTTPHeaders.ContentMD5) == 0 {
-			jptm.LogDownloadError(info.Source, info.Destination, errExpectedMd5Missing.Error(), 0)
+		if expectedHash.IsEmpty() {
+			missingErr := errExpectedMd5Missing
+			if isDigestAware {
+				missingErr = errExpectedDigestMissing
+			}
+			jptm.LogDownloadError(info.Source, info.Destination, missingErr.Error(), 0)
 			jptm.SetStatus(common.ETransferStatus.Failed())
 			jptm.ReportTransferDone()
 			return
@@ -134,7 +152,7 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, pacer pacer, df downloaderFact
 			jptm.LogDownloadError(info.Source, info.Destination, "File Creation Error "+err.Error(), 0)
 			jptm.SetStatus(common.ETransferStatus.Failed())
 			// use standard epilogue for consistency, but force release of file count (without an actual file) if necessary
-			epilogueWithCleanupDownload(jptm, dl, nil, nil)
+			epilogueWithCleanupDownload(jptm, dl, nil, nil, common.Digest{})
 		}
 		// block until we can safely use a file handle
 		err := jptm.WaitUntilLockDestination(jptm.Context())
@@ -175,7 +193,7 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, pacer pacer, df downloaderFact
 
 		if !needChunks { // If no chunks need to be transferred (e.g. this is 0-bytes long, a symlink, etc.), treat it as a 0-byte transfer
 			dl.Prologue(jptm)
-			epilogueWithCleanupDownload(jptm, dl, nil, nil)
+			epilogueWithCleanupDownload(jptm, dl, nil, nil, common.Digest{})
 			return
 		}
 
@@ -209,7 +227,7 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, pacer pacer, df downloaderFact
 			// For blobs, it sets up a page blob pacer if it's a page blob.
 			// For blobFS, it's a noop.
 			dl.Prologue(jptm)
-			epilogueWithCleanupDownload(jptm, dl, nil, nil) // need standard epilogue, rather than a quick exit, so we can preserve modification dates
+			epilogueWithCleanupDownload(jptm, dl, nil, nil, common.Digest{}) // need standard epilogue, rather than a quick exit, so we can preserve modification dates
 			return
 		}
 
@@ -219,7 +237,7 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, pacer pacer, df downloaderFact
 			jptm.LogDownloadError(info.Source, info.Destination, "File Creation Error "+err.Error(), 0)
 			jptm.SetStatus(common.ETransferStatus.Failed())
 			// use standard epilogue for consistency, but force release of file count (without an actual file) if necessary
-			epilogueWithCleanupDownload(jptm, dl, nil, nil)
+			epilogueWithCleanupDownload(jptm, dl, nil, nil, common.Digest{})
 		}
 		// block until we can safely use a file handle
 		err := jptm.WaitUntilLockDestination(jptm.Context())
@@ -276,7 +294,6 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, pacer pacer, df downloaderFact
 
 	// step 5b: create destination writer
 	chunkLogger := jptm.ChunkStatusLogger()
-	sourceMd5Exists := len(info.SrcHTTPHeaders.ContentMD5) > 0
 	dstWriter := common.NewChunkedFileWriter(
 		jptm.Context(),
 		jptm.SlicePool(),
@@ -286,7 +303,7 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, pacer pacer, df downloaderFact
 		numChunks,
 		MaxRetryPerDownloadBody,
 		jptm.MD5ValidationOption(),
-		sourceMd5Exists)
+		expectedHash)
 
 	// step 5c: run prologue in downloader (here it can, for example, create things that will require cleanup in the epilogue)
 	common.GetLifecycleMgr().E2EAwaitAllowOpenFiles()
@@ -294,7 +311,7 @@ func remoteToLocal_file(jptm IJobPartTransferMgr, pacer pacer, df downloaderFact
 
 	// step 5d: tell jptm what to expect, and how to clean up at the end
 	jptm.SetNumberOfChunks(numChunks)
-	jptm.SetActionAfterLastChunk(func() { epilogueWithCleanupDownload(jptm, dl, dstFile, dstWriter) })
+	jptm.SetActionAfterLastChunk(func() { epilogueWithCleanupDownload(jptm, dl, dstFile, dstWriter, expectedHash) })
 
 	// step 6: go through the blob range and schedule download chunk jobs
 	// TODO: currently, the epilogue will only run if the number of completed chunks = numChunks.
@@ -370,7 +387,7 @@ func createDestinationFile(jptm IJobPartTransferMgr, destination string, size in
 }
 
 // complete epilogue. Handles both success and failure
-func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, activeDstFile io.WriteCloser, cw common.ChunkedFileWriter) {
+func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, activeDstFile io.WriteCloser, cw common.ChunkedFileWriter, expectedHash common.Digest) {
 	info := jptm.Info()
 
 	// allow our usual state tracking mechanism to keep count of how many epilogues are running at any given instant, for perf diagnostics
@@ -388,7 +405,7 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 	if haveNonEmptyFile {
 
 		// wait until all received chunks are flushed out
-		md5OfFileAsWritten, flushError := cw.Flush(jptm.Context())
+		hashOfFileAsWritten, flushError := cw.Flush(jptm.Context())
 		closeErr := activeDstFile.Close() // always try to close if, even if flush failed
 		if flushError != nil {
 			jptm.FailActiveDownload("Flushing file", flushError)
@@ -400,11 +417,13 @@ func epilogueWithCleanupDownload(jptm IJobPartTransferMgr, dl downloader, active
 
 		// Check MD5 (but only if file was fully flushed and saved - else no point and may not have actualAsSaved hash anyway)
 		if jptm.IsLive() {
+			_, isDigestAware := dl.(digestAwareDownloader)
 			comparison := md5Comparer{
-				expected:         info.SrcHTTPHeaders.ContentMD5, // the MD5 that came back from Service when we enumerated the source
-				actualAsSaved:    md5OfFileAsWritten,
+				expected:         expectedHash, // usually the MD5 that came back from Service when we enumerated the source
+				actualAsSaved:    hashOfFileAsWritten,
 				validationOption: jptm.MD5ValidationOption(),
-				logger:           jptm}
+				logger:           jptm,
+				httpSource:       isDigestAware}
 			err := comparison.Check()
 			if err != nil {
 				jptm.FailActiveDownload("Checking MD5 hash", err)
@@ -485,8 +504,12 @@ redoCompletion:
 			panic("reached branch where jptm is assumed to be live, but it isn't")
 		}
 
-		// Attempt to put MD5 data if necessary, compliant with the sync hash scheme
-		if jptm.ShouldPutMd5() {
+		// Attempt to put MD5 data if necessary, compliant with the sync hash scheme.
+		// Syncs also record there the other hashes remote sources keep in their metadata, and the ETags of HTTP sources,
+		// since local files have no metadata to keep them in.
+		sourceETag, hasSourceETag := common.TryReadMetadata(info.SrcMetadata, common.SyncSourceETagMetadataKey)
+		sourceHash, hasSourceHash := common.TryReadMetadata(info.SrcMetadata, info.SyncHashType.MetadataKey())
+		if jptm.ShouldPutMd5() || hasSourceETag || hasSourceHash {
 			fi, err := os.Stat(info.Destination)
 			if err != nil {
 				jptm.FailActiveDownload("saving MD5 data (stat to pull LMT)", err)
@@ -498,17 +521,27 @@ redoCompletion:
 			_, idx := jptm.TransferIndex()
 			_, relDest := plan.TransferSrcDstRelatives(idx)
 			adapter, err := common.NewHashDataAdapter(common.LocalHashDir, dataRoot, common.LocalHashStorageMode)
-			if err != nil {
-				jptm.FailActiveDownload("initializing hash adapter", err)
+			if err == nil {
+				hashData := &common.SyncHashData{LMT: fi.ModTime()}
+				if jptm.ShouldPutMd5() {
+					hashData.Mode = common.ESyncHashType.MD5()
+					hashData.Data = base64.StdEncoding.EncodeToString(info.SrcHTTPHeaders.ContentMD5)
+				} else if hasSourceHash && sourceHash != nil {
+					hashData.Mode = info.SyncHashType
+					hashData.Data = *sourceHash
+				}
+				if hasSourceETag && sourceETag != nil {
+					hashData.SourceETag = *sourceETag
+				}
+				err = adapter.SetHashData(relDest, hashData)
 			}
-			err = adapter.SetHashData(relDest, &common.SyncHashData{
-				Mode: common.ESyncHashType.MD5(),
-				LMT:  fi.ModTime(),
-				Data: base64.StdEncoding.EncodeToString(info.SrcHTTPHeaders.ContentMD5),
-			})
-			if err != nil {
+			if err != nil && jptm.ShouldPutMd5() {
 				jptm.FailActiveDownload("saving MD5 data (writing alternate data stream)", err)
 				goto redoCompletion // let fail as expected
+			} else if err != nil {
+				// without the ETag or hash, the next sync hashes the file again or compares times, so this needn't fail the transfer
+				common.LogHashStorageFailure()
+				jptm.LogAtLevelForCurrentTransfer(common.LogWarning, "failed to record the source ETag or hash: "+err.Error())
 			}
 		}
 
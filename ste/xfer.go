@@ -92,6 +92,8 @@ func computeJobXfer(fromTo common.FromTo, blobType common.BlobType) newJobXfer {
 			return newBlobFSDownloader
 		case common.ELocation.Http():
 			return newHTTPDownloader
+		case common.ELocation.WebDAV():
+			return newWebDAVDownloader
 		default:
 			panic("unexpected source type")
 		}
@@ -121,6 +123,8 @@ func computeJobXfer(fromTo common.FromTo, blobType common.BlobType) newJobXfer {
 				return newAzureFilesUploader
 			case common.ELocation.BlobFS():
 				return newBlobFSUploader
+			case common.ELocation.WebDAV():
+				return newWebDAVUploader
 			default:
 				panic("unexpected target location type")
 			}
@@ -143,6 +147,8 @@ func computeJobXfer(fromTo common.FromTo, blobType common.BlobType) newJobXfer {
 			return newS3SourceInfoProvider
 		case common.ELocation.GCP():
 			return newGCPSourceInfoProvider
+		case common.ELocation.Http(), common.ELocation.WebDAV():
+			return newHTTPSourceInfoProvider
 		default:
 			panic("unexpected source type")
 		}